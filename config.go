@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+	"github.com/rs/zerolog"
+)
+
+// config holds the settings main reads from the environment, see
+// checkConfig.
+type config struct {
+	Port            string
+	AdminAddr       string
+	LogFormat       string
+	LogLevel        string
+	StartTime       string
+	StartZone       string
+	Duration        string
+	VideoURL        string
+	AudioURL        string
+	AudioMountPoint string
+	JSONStyle       string
+	FilterAction    string
+	WordFilterPath  string
+	RegexFilterPath string
+	DBDriver        string
+	URLs            map[string]string // env -> URL, empty when unset
+}
+
+// envConfig returns the config from the environment and .env file.
+func envConfig() config {
+	return config{
+		Port:            port,
+		AdminAddr:       adminAddr,
+		LogFormat:       logFormat,
+		LogLevel:        logLevel,
+		StartTime:       radioStartTime,
+		StartZone:       radioStartZone,
+		Duration:        radioDuration,
+		VideoURL:        videoURL,
+		AudioURL:        audioURL,
+		AudioMountPoint: audioMountPoint,
+		JSONStyle:       jsonStyle,
+		FilterAction:    wordFilterMode,
+		WordFilterPath:  wordFilterPath,
+		RegexFilterPath: regexFilterPath,
+		DBDriver:        dbDriver,
+		URLs: map[string]string{
+			"RADIO_NATS_URL":           natsURL,
+			"REDIS_URL":                redisURL,
+			"CHAT_WEBHOOK_URL":         webhookURL,
+			"SENTRY_DSN":               sentryDSN,
+			"TOKEN_JWKS_URL":           tokenJWKSURL,
+			"RADIO_ICECAST_STATUS_URL": icecastStatusURL,
+		},
+	}
+}
+
+// settings are what main derives from a valid config.
+type settings struct {
+	radio        chat.RadioInfo
+	style        chat.JSONStyle
+	filterAction chat.FilterAction
+	wordFilter   *chat.WordFilter  // nil without RADIO_WORD_FILTER_PATH
+	regexFilter  *chat.RegexFilter // nil without RADIO_REGEX_FILTER_PATH
+}
+
+// urlSchemes lists the schemes accepted for each URL setting.
+var urlSchemes = map[string][]string{
+	"RADIO_NATS_URL":           {"nats", "tls", "ws", "wss"},
+	"REDIS_URL":                {"redis", "rediss", "unix"},
+	"CHAT_WEBHOOK_URL":         {"http", "https"},
+	"SENTRY_DSN":               {"http", "https"},
+	"TOKEN_JWKS_URL":           {"http", "https"},
+	"RADIO_ICECAST_STATUS_URL": {"http", "https"},
+}
+
+// checkConfig parses the config into settings, loading the filter files, and
+// reports every problem found. Startup and -validate both use it, startup
+// refuses to run with fatal problems.
+func checkConfig(cfg config) (settings, []chat.ConfigProblem) {
+	var s settings
+	var problems []chat.ConfigProblem
+	fatal := func(setting string, err error) {
+		problems = append(problems, chat.ConfigProblem{Setting: setting, Err: err, Fatal: true})
+	}
+
+	if cfg.AdminAddr != "" && cfg.AdminAddr == cfg.Port {
+		fatal("ADMIN_ADDR", errors.New("must differ from PORT"))
+	}
+	if _, err := zerolog.ParseLevel(cfg.LogLevel); err != nil {
+		fatal("LOG_LEVEL", err)
+	}
+	if _, err := newLogger(cfg.LogFormat, io.Discard, nil); err != nil {
+		fatal("LOG_FORMAT", err)
+	}
+
+	startTime, err := normalizeStartTime(cfg.StartTime, cfg.StartZone, time.Now())
+	if err != nil {
+		fatal("RADIO_START_TIME", err)
+	}
+	s.radio = chat.RadioInfo{
+		VideoURL:        cfg.VideoURL,
+		AudioURL:        cfg.AudioURL,
+		AudioMountPoint: cfg.AudioMountPoint,
+		StartTime:       startTime,
+		Duration:        cfg.Duration,
+	}
+	if err == nil {
+		if err := s.radio.ComputeEndTime(); err != nil {
+			fatal("RADIO_DURATION", err)
+		}
+	}
+
+	if s.style, err = chat.ParseJSONStyle(cfg.JSONStyle); err != nil {
+		fatal("RADIO_JSON_STYLE", err)
+	}
+	if s.filterAction, err = chat.ParseFilterAction(cfg.FilterAction); err != nil {
+		fatal("RADIO_WORD_FILTER_ACTION", err)
+	}
+	if cfg.WordFilterPath != "" {
+		if s.wordFilter, err = chat.LoadWordFilter(cfg.WordFilterPath); err != nil {
+			fatal("RADIO_WORD_FILTER_PATH", err)
+		}
+	}
+	if cfg.RegexFilterPath != "" {
+		if s.regexFilter, err = chat.LoadRegexFilter(cfg.RegexFilterPath); err != nil {
+			fatal("RADIO_REGEX_FILTER_PATH", err)
+		}
+	}
+	if cfg.DBDriver != "" {
+		if err := chat.CheckSQLDriver(cfg.DBDriver); err != nil {
+			fatal("CHAT_DB_DRIVER", err)
+		}
+	}
+
+	for _, env := range slices.Sorted(maps.Keys(cfg.URLs)) {
+		if cfg.URLs[env] == "" {
+			continue
+		}
+		// NATS takes a comma-separated list of servers
+		for _, raw := range strings.Split(cfg.URLs[env], ",") {
+			if err := checkURL(strings.TrimSpace(raw), urlSchemes[env]); err != nil {
+				fatal(env, err)
+				break
+			}
+		}
+	}
+	return s, problems
+}
+
+// checkURL reports URLs that are not absolute or have another scheme.
+func checkURL(raw string, schemes []string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || (u.Host == "" && u.Scheme != "unix") {
+		return errors.New("expected an absolute URL")
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported scheme %q, expected one of %v", u.Scheme, schemes)
+}
+
+// runValidate checks the configuration from the environment and .env file
+// without starting the server, prints every problem to out and returns the
+// exit code.
+func runValidate(out io.Writer) int {
+	_, problems := checkConfig(envConfig())
+	problems = slices.Concat(chat.EnvProblems(), chat.CheckEnv(), problems)
+	writeProblems(out, problems)
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// writeProblems prints the problems for people, errors being those the server
+// does not start with.
+func writeProblems(w io.Writer, problems []chat.ConfigProblem) {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "configuration ok")
+		return
+	}
+	fmt.Fprintf(w, "%d configuration problem(s):\n", len(problems))
+	for _, p := range problems {
+		level := "warning"
+		if p.Fatal {
+			level = "error"
+		}
+		fmt.Fprintf(w, "  %-7s  %s\n", level, p.Error())
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+)
+
+func validConfig() config {
+	return config{
+		LogFormat:    LogFormatJSON,
+		LogLevel:     "info",
+		StartTime:    "2025-08-18T07:00:00Z",
+		StartZone:    "UTC",
+		Duration:     "PT2H",
+		JSONStyle:    string(chat.JSONSnakeCase),
+		FilterAction: string(chat.FilterActionWarn),
+		URLs: map[string]string{
+			"RADIO_NATS_URL":   "nats://nats-1:4222,nats://nats-2:4222",
+			"REDIS_URL":        "",
+			"CHAT_WEBHOOK_URL": "https://example.org/hook",
+		},
+	}
+}
+
+// settingsOf lists the settings with a problem.
+func settingsOf(problems []chat.ConfigProblem) []string {
+	var settings []string
+	for _, p := range problems {
+		settings = append(settings, p.Setting)
+	}
+	return settings
+}
+
+func TestCheckConfigValid(t *testing.T) {
+	s, problems := checkConfig(validConfig())
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+	if s.radio.EndTime == "" || s.style != chat.JSONSnakeCase || s.filterAction != chat.FilterActionWarn {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+}
+
+func TestCheckConfigBroken(t *testing.T) {
+	cfg := validConfig()
+	cfg.Port = ":8080"
+	cfg.AdminAddr = ":8080"
+	cfg.LogLevel = "loud"
+	cfg.LogFormat = "xml"
+	cfg.StartTime = "18-08-2025 07:00"
+	cfg.JSONStyle = "kebab"
+	cfg.FilterAction = "ban"
+	cfg.WordFilterPath = filepath.Join(t.TempDir(), "missing.txt")
+	cfg.DBDriver = "mysql"
+	cfg.URLs["REDIS_URL"] = "localhost:6379"
+	cfg.URLs["CHAT_WEBHOOK_URL"] = "ftp://example.org/hook"
+
+	_, problems := checkConfig(cfg)
+	want := []string{
+		"ADMIN_ADDR", "LOG_LEVEL", "LOG_FORMAT", "RADIO_START_TIME", "RADIO_JSON_STYLE", "RADIO_WORD_FILTER_ACTION",
+		"RADIO_WORD_FILTER_PATH", "CHAT_DB_DRIVER", "CHAT_WEBHOOK_URL", "REDIS_URL",
+	}
+	if got := settingsOf(problems); !slices.Equal(got, want) {
+		t.Fatalf("expected problems with %v, got %v", want, problems)
+	}
+	for _, p := range problems {
+		if !p.Fatal {
+			t.Errorf("expected %s to be fatal", p.Setting)
+		}
+	}
+}
+
+func TestCheckConfigDuration(t *testing.T) {
+	cfg := validConfig()
+	cfg.Duration = "2 hours"
+	_, problems := checkConfig(cfg)
+	if got := settingsOf(problems); !slices.Equal(got, []string{"RADIO_DURATION"}) {
+		t.Fatalf("expected a RADIO_DURATION problem, got %v", problems)
+	}
+
+	cfg = validConfig()
+	cfg.RegexFilterPath = filepath.Join(t.TempDir(), "patterns.txt")
+	if err := os.WriteFile(cfg.RegexFilterPath, []byte("(unclosed\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, problems = checkConfig(cfg)
+	if got := settingsOf(problems); !slices.Equal(got, []string{"RADIO_REGEX_FILTER_PATH"}) {
+		t.Fatalf("expected a RADIO_REGEX_FILTER_PATH problem, got %v", problems)
+	}
+}
+
+func TestWriteProblems(t *testing.T) {
+	var out bytes.Buffer
+	writeProblems(&out, nil)
+	if out.String() != "configuration ok\n" {
+		t.Fatalf("unexpected report: %q", out.String())
+	}
+
+	out.Reset()
+	writeProblems(&out, []chat.ConfigProblem{
+		{Setting: "RADIO_START_TIME", Err: errors.New("cannot parse"), Fatal: true},
+		{Setting: "GEWIS_SECRET", Err: errors.New("secret is too short")},
+	})
+	report := out.String()
+	for _, line := range []string{"2 configuration problem(s):", "error    RADIO_START_TIME: cannot parse", "warning  GEWIS_SECRET: secret is too short"} {
+		if !strings.Contains(report, line) {
+			t.Errorf("expected %q in the report:\n%s", line, report)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+//go:build ignore
+
+// generate_openapi writes openapi.json describing the REST endpoints. Run it
+// through go generate after changing an endpoint, CI fails if the committed
+// spec is out of date.
+//
+// Request and response bodies are described by the Go types the handlers
+// encode and decode, read by reflection. Fields are named after their json
+// tag, required unless omitempty or omitzero, and may carry description,
+// format, pattern and enum tags.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+)
+
+type object = map[string]any
+
+// schemas collects the components of the structs used by the paths.
+var schemas = object{}
+
+// enums are the values of properties, by schema and property name, taken
+// from the package rather than repeated in an enum tag.
+var enums = map[string][]string{
+	"ClientInfo.role": chat.Roles,
+}
+
+// schema describes the JSON encoding of v. Structs are added to the
+// components and referenced, an object is used as is.
+func schema(v any) object {
+	if s, ok := v.(object); ok {
+		return s
+	}
+	return typeSchema(reflect.TypeOf(v))
+}
+
+func typeSchema(t reflect.Type) object {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[time.Time]() {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = nil // taken, for structs referring to themselves
+			schemas[t.Name()] = structSchema(t)
+		}
+		return object{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	log.Fatalf("cannot describe %s", t)
+	return nil
+}
+
+func structSchema(t reflect.Type) object {
+	properties := object{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		prop := typeSchema(f.Type)
+		if _, ok := prop["$ref"]; ok && f.Tag.Get("description") != "" {
+			// Siblings of $ref are ignored in OpenAPI 3.0
+			prop = object{"allOf": []object{prop}}
+		}
+		for _, key := range []string{"description", "format", "pattern"} {
+			if v := f.Tag.Get(key); v != "" {
+				prop[key] = v
+			}
+		}
+		if v := f.Tag.Get("enum"); v != "" {
+			prop["enum"] = strings.Split(v, ",")
+		}
+		if v, ok := enums[t.Name()+"."+name]; ok {
+			prop["enum"] = v
+		}
+		properties[name] = prop
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			required = append(required, name)
+		}
+	}
+	s := object{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func jsonContent(v any) object {
+	return object{"application/json": object{"schema": schema(v)}}
+}
+
+// body is a required JSON request body shaped like v.
+func body(v any) object {
+	return object{"required": true, "content": jsonContent(v)}
+}
+
+// response has a JSON body shaped like v, or none if v is nil.
+func response(description string, v any) object {
+	r := object{"description": description}
+	if v != nil {
+		r["content"] = jsonContent(v)
+	}
+	return r
+}
+
+// failure is a response carrying a chat.ErrorResponse.
+func failure(description string) object {
+	return response(description, chat.ErrorResponse{})
+}
+
+func str(description string) object {
+	return object{"type": "string", "description": description}
+}
+
+func roomParam() object {
+	return object{"name": "room", "in": "query", "schema": str("Chat room, defaults to main")}
+}
+
+func main() {
+	spec := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "RadioGaGa",
+			"description": "Backend for the GEWIS radio stream frontend and its listener chat.",
+			"version":     "1",
+		},
+		"paths": object{
+			"/api/v1/health": object{
+				"get": object{
+					"summary":     "Liveness check",
+					"operationId": "getHealth",
+					"responses": object{
+						"200": response("Service is up", chat.StatusResponse{}),
+						"503": response("Shutting down, connected clients are being drained", chat.StatusResponse{}),
+					},
+				},
+			},
+			"/api/v1/token": object{
+				"get": object{
+					"summary":     "Shared GEWIS radio token",
+					"operationId": "getToken",
+					"responses": object{
+						"200": response("The token", ""),
+					},
+				},
+			},
+			"/api/v1/countdown": object{
+				"get": object{
+					"summary":     "Countdown running in a room",
+					"operationId": "getCountdown",
+					"parameters": []object{
+						{"name": "room", "in": "query", "schema": object{"type": "string", "default": "main"}},
+					},
+					"responses": object{
+						"200": response("The running countdown", chat.Countdown{}),
+						"404": failure("No countdown running in the room"),
+					},
+				},
+			},
+			"/api/v1/radio": object{
+				"get": object{
+					"summary":     "Stream information",
+					"operationId": "getRadio",
+					"responses": object{
+						"200": response("Current stream information", chat.RadioInfo{}),
+					},
+				},
+				"post": object{
+					"summary":     "Replace all stream information and notify clients",
+					"operationId": "replaceRadio",
+					"security":    []object{{"radioKey": []string{}}},
+					"requestBody": body(chat.RadioInfo{}),
+					"responses": object{
+						"200": response("The previous stream information, for rolling back", chat.RadioInfo{}),
+						"400": failure("Missing or invalid field"),
+						"401": failure("Missing or invalid radio key"),
+					},
+				},
+			},
+			"/api/v1/broadcast": object{
+				"post": object{
+					"summary":     "Push a system message into the chat",
+					"operationId": "postBroadcast",
+					"security":    []object{{"radioKey": []string{}}},
+					"requestBody": body(chat.BroadcastRequest{}),
+					"responses": object{
+						"200": response("Message delivered", chat.StatusResponse{}),
+						"400": failure("Invalid request"),
+						"401": failure("Missing or invalid radio key"),
+						"404": failure("Target user is not connected"),
+					},
+				},
+			},
+			"/api/v1/chat/inbox": object{
+				"get": object{
+					"summary":     "User messages newer than a cursor",
+					"operationId": "getInbox",
+					"security":    []object{{"radioKey": []string{}}},
+					"parameters": []object{
+						{"name": "since", "in": "query", "schema": str("Cursor returned by the previous call")},
+						{"name": "limit", "in": "query", "schema": object{"type": "integer", "maximum": 500}},
+						roomParam(),
+					},
+					"responses": object{
+						"200": response("Messages after the cursor, oldest first", chat.InboxResponse{}),
+						"400": failure("Invalid limit or unknown room"),
+						"401": failure("Missing or invalid radio key"),
+					},
+				},
+			},
+			"/api/v1/chat/reply": object{
+				"post": object{
+					"summary":     "Reply to a user as a radio",
+					"operationId": "postReply",
+					"security":    []object{{"radioKey": []string{}}},
+					"requestBody": body(chat.ReplyRequest{}),
+					"responses": object{
+						"200": response("Reply dispatched", chat.StatusResponse{}),
+						"400": failure("Invalid request"),
+						"401": failure("Missing or invalid radio key"),
+						"404": failure("Target user is not connected"),
+					},
+				},
+			},
+			"/api/v1/chat/stream": object{
+				"get": object{
+					"summary":     "Server-sent events fallback for users",
+					"operationId": "getStream",
+					"parameters": []object{
+						{"name": "token", "in": "query", "required": true, "schema": str("GEWIS JWT")},
+						roomParam(),
+					},
+					"responses": object{
+						"200": object{
+							"description": "Stream of messages as data events, ends with a close event",
+							"content":     object{"text/event-stream": object{"schema": object{"type": "string"}}},
+						},
+						"400": failure("Unknown room"),
+						"401": failure("Invalid token"),
+						"503": failure("Shutting down"),
+					},
+				},
+			},
+			"/api/v1/poll": object{
+				"get": object{
+					"summary":     "Long-polling fallback for users",
+					"operationId": "getPoll",
+					"parameters": []object{
+						{"name": "token", "in": "query", "required": true, "schema": str("GEWIS JWT")},
+						{"name": "since", "in": "query", "schema": str("ID of the last message received")},
+						roomParam(),
+					},
+					"responses": object{
+						"200": response("The first message to the user after since", chat.OutgoingMessage{}),
+						"204": response("No message arrived within RADIO_POLL_TIMEOUT, poll again", nil),
+						"400": failure("Unknown room"),
+						"401": failure("Invalid token"),
+						"503": failure("Shutting down"),
+					},
+				},
+			},
+			"/api/v1/chat/send": object{
+				"post": object{
+					"summary":     "Send a message as a user without a websocket",
+					"operationId": "postSend",
+					"security":    []object{{"gewisToken": []string{}}},
+					"parameters":  []object{roomParam()},
+					"requestBody": body(chat.IncomingMessage{}),
+					"responses": object{
+						"200": response("Message dispatched", chat.StatusResponse{}),
+						"400": failure("Invalid message"),
+						"401": failure("Invalid token"),
+					},
+				},
+			},
+			"/api/v1/chat/users": object{
+				"get": object{
+					"summary":     "Users connected to this instance",
+					"operationId": "getUsers",
+					"security":    []object{{"radioKey": []string{}}},
+					"parameters": []object{
+						{"name": "room", "in": "query", "schema": str("Only list users in this room")},
+					},
+					"responses": object{
+						"200": response("Connected users, sorted by room", []chat.UserInfo{}),
+						"400": failure("Unknown room"),
+						"401": failure("Missing or invalid radio key"),
+					},
+				},
+			},
+			"/api/v1/chat/questions": object{
+				"get": object{
+					"summary":     "Unanswered user messages, oldest first",
+					"operationId": "getQuestions",
+					"security":    []object{{"radioKey": []string{}}},
+					"parameters":  []object{roomParam()},
+					"responses": object{
+						"200": response("Open questions", []chat.OutgoingMessage{}),
+						"400": failure("Unknown room"),
+						"401": failure("Missing or invalid radio key"),
+					},
+				},
+			},
+			"/api/v1/chat/audit": object{
+				"get": object{
+					"summary":     "Audit log of radio commands and admin actions, newest first",
+					"operationId": "getAudit",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "offset", "in": "query", "schema": object{"type": "integer", "minimum": 0, "description": "Newest entries to skip"}},
+						{"name": "limit", "in": "query", "schema": object{"type": "integer", "minimum": 1, "maximum": 500, "default": 50}},
+					},
+					"responses": object{
+						"200": response("Audit entries", chat.AuditResponse{}),
+						"400": failure("Invalid offset or limit"),
+						"401": failure("Missing or invalid admin key"),
+						"404": failure("Audit log not configured"),
+					},
+				},
+			},
+			"/api/v1/history/users/{id}": object{
+				"get": object{
+					"summary":     "Last messages sent by a user that are still in the history or message store, oldest first",
+					"operationId": "getUserHistory",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "id", "in": "path", "required": true, "schema": str("The user's lidnr")},
+						{"name": "limit", "in": "query", "schema": object{"type": "integer", "minimum": 1, "maximum": 500, "default": 50}},
+						{"name": "before_id", "in": "query", "schema": str("Only messages older than this message ID")},
+					},
+					"responses": object{
+						"200": response("Messages of the user", chat.UserHistoryResponse{}),
+						"400": failure("Invalid limit"),
+						"401": failure("Missing or invalid admin key"),
+						"404": failure("No messages from this user"),
+					},
+				},
+				"delete": object{
+					"summary":     "Erase the messages sent by or to a user from the history and the message store",
+					"operationId": "eraseUserHistory",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "id", "in": "path", "required": true, "schema": str("The user's lidnr")},
+					},
+					"responses": object{
+						"200": response("Messages erased", chat.UserErasure{}),
+						"401": failure("Missing or invalid admin key"),
+						"500": failure("The message store failed"),
+					},
+				},
+			},
+			"/api/v1/history/export": object{
+				"get": object{
+					"summary":     "Download the message history as newline-delimited JSON, oldest first",
+					"operationId": "exportHistory",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "from", "in": "query", "schema": object{"type": "string", "format": "date-time", "description": "Earliest sentAt, inclusive"}},
+						{"name": "to", "in": "query", "schema": object{"type": "string", "format": "date-time", "description": "Latest sentAt, exclusive"}},
+						{"name": "room", "in": "query", "schema": str("Only this room and messages sent to every room")},
+					},
+					"responses": object{
+						"200": object{
+							"description": "One message per line, as an attachment named chat-export.ndjson",
+							"content":     object{"application/x-ndjson": object{"schema": schema(chat.OutgoingMessage{})}},
+						},
+						"400": failure("Invalid from or to"),
+						"401": failure("Missing or invalid admin key"),
+						"500": failure("The message store failed"),
+					},
+				},
+			},
+			"/api/v1/state": object{
+				"get": object{
+					"summary":     "Snapshot of the clients connected to this instance",
+					"operationId": "getState",
+					"security":    []object{{"adminKey": []string{}}},
+					"responses": object{
+						"200": response("Connected users and radios, sorted by room and id", chat.StateSnapshot{}),
+						"401": failure("Missing or invalid admin key"),
+					},
+				},
+			},
+			"/api/v1/metrics/connections": object{
+				"get": object{
+					"summary":     "Current and peak connection counts of this instance",
+					"operationId": "getConnectionMetrics",
+					"security":    []object{{"adminKey": []string{}}},
+					"responses": object{
+						"200": response("Connection counts", chat.ConnectionMetrics{}),
+						"401": failure("Missing or invalid admin key"),
+					},
+				},
+			},
+			"/api/v1/rooms": object{
+				"post": object{
+					"summary":     "Add a room that can be joined",
+					"operationId": "addRoom",
+					"security":    []object{{"adminKey": []string{}}},
+					"requestBody": body(chat.RoomRequest{}),
+					"responses": object{
+						"201": response("Room added", chat.RoomRequest{}),
+						"400": failure("Invalid room name"),
+						"401": failure("Missing or invalid admin key"),
+						"409": failure("Room exists or RADIO_MAX_ROOMS reached"),
+					},
+				},
+			},
+			"/api/v1/rooms/{name}": object{
+				"delete": object{
+					"summary":     "Close a room and disconnect everyone in it",
+					"operationId": "closeRoom",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "name", "in": "path", "required": true, "schema": str("Room name")},
+					},
+					"responses": object{
+						"204": response("Room closed", nil),
+						"400": failure("The default room cannot be closed"),
+						"401": failure("Missing or invalid admin key"),
+						"404": failure("Unknown room"),
+					},
+				},
+			},
+			"/api/v1/polls/{id}": object{
+				"delete": object{
+					"summary":     "Close a poll and send the final tally to its room",
+					"operationId": "closePoll",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "id", "in": "path", "required": true, "schema": str("The pollId")},
+					},
+					"responses": object{
+						"204": response("Poll closed, or already closed", nil),
+						"401": failure("Missing or invalid admin key"),
+						"404": failure("Unknown poll"),
+					},
+				},
+			},
+			"/api/v1/connections/{id}": object{
+				"delete": object{
+					"summary":     "Disconnect every session of a user on this instance",
+					"operationId": "deleteConnection",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "id", "in": "path", "required": true, "schema": str("The user's lidnr")},
+						{"name": "code", "in": "query", "schema": object{"type": "integer", "minimum": 4000, "maximum": 4999, "default": 4403}},
+						{"name": "reason", "in": "query", "schema": str("Close frame text, defaults to the code's reason")},
+					},
+					"responses": object{
+						"204": response("User disconnected", nil),
+						"400": failure("Invalid code or reason"),
+						"401": failure("Missing or invalid admin key"),
+						"404": failure("User not connected"),
+					},
+				},
+			},
+			"/api/v1/connections/{id}/messages": object{
+				"get": object{
+					"summary":     "Last messages in the history sent by or to a connected user, oldest first",
+					"operationId": "getConnectionMessages",
+					"security":    []object{{"adminKey": []string{}}},
+					"parameters": []object{
+						{"name": "id", "in": "path", "required": true, "schema": str("The user's lidnr")},
+						{"name": "limit", "in": "query", "schema": object{"type": "integer", "minimum": 1, "maximum": 500, "default": 20}},
+					},
+					"responses": object{
+						"200": response("Messages of the user", chat.UserHistoryResponse{}),
+						"400": failure("Invalid limit"),
+						"401": failure("Missing or invalid admin key"),
+						"404": failure("User not connected"),
+					},
+				},
+			},
+			"/api/v1/openapi.json": object{
+				"get": object{
+					"summary":     "This document",
+					"operationId": "getOpenAPI",
+					"responses": object{
+						"200": response("OpenAPI 3.0 document", object{"type": "object"}),
+					},
+				},
+			},
+		},
+		"components": object{
+			"securitySchemes": object{
+				"radioKey": object{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The RADIO_CHAT_KEY",
+				},
+				"adminKey": object{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The RADIO_ADMIN_KEY",
+				},
+				"gewisToken": object{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+			"schemas": schemas,
+		},
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("openapi.json", append(data, '\n'), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// healthcheckTimeout bounds a healthcheck, well below Docker's default
+// HEALTHCHECK timeout.
+const healthcheckTimeout = 2 * time.Second
+
+// runHealthcheck runs the healthcheck subcommand against the server listening
+// on PORT and returns the exit code, so images without curl can probe it.
+func runHealthcheck(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	ready := fs.Bool("ready", false, "fail while the server is draining, not only when it is down")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+	defer cancel()
+	if err := healthcheck(ctx, port, *ready); err != nil {
+		fmt.Fprintf(stderr, "healthcheck: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// healthcheck gets /api/v1/health from the server listening on addr, in the
+// form of PORT. A draining server answers 503, which only fails a readiness
+// check.
+func healthcheck(ctx context.Context, addr string, ready bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+localAddr(addr)+"/api/v1/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusServiceUnavailable && !ready:
+		return nil
+	default:
+		return fmt.Errorf("health endpoint answered %s", resp.Status)
+	}
+}
+
+// localAddr turns a listen address such as ":8080" or "0.0.0.0:8080" into one
+// to connect to on this host.
+func localAddr(addr string) string {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		// A bare port
+		return net.JoinHostPort("localhost", addr)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, p)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+	"github.com/rs/zerolog"
+)
+
+func TestHealthcheck(t *testing.T) {
+	c := chat.New(chat.WithLogger(zerolog.Nop()))
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	if err := healthcheck(context.Background(), addr, false); err != nil {
+		t.Fatalf("expected a healthy server, got: %v", err)
+	}
+	if err := healthcheck(context.Background(), addr, true); err != nil {
+		t.Fatalf("expected a ready server, got: %v", err)
+	}
+
+	// A draining server is alive but no longer ready
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = c.Shutdown(ctx)
+	if err := healthcheck(context.Background(), addr, false); err != nil {
+		t.Fatalf("expected a draining server to be healthy, got: %v", err)
+	}
+	if err := healthcheck(context.Background(), addr, true); err == nil {
+		t.Fatal("expected a draining server not to be ready")
+	}
+}
+
+func TestHealthcheckClosedPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, p, _ := net.SplitHostPort(l.Addr().String())
+	_ = l.Close()
+
+	if err := healthcheck(context.Background(), ":"+p, false); err == nil {
+		t.Fatal("expected a closed port to fail the check")
+	}
+
+	prev := port
+	port = ":" + p
+	defer func() { port = prev }()
+	var stderr bytes.Buffer
+	if code := runHealthcheck(nil, &stderr); code != 1 || !strings.Contains(stderr.String(), "connection refused") {
+		t.Fatalf("expected exit code 1 with the error, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestLocalAddr(t *testing.T) {
+	tests := map[string]string{
+		":8080":          "localhost:8080",
+		"0.0.0.0:8080":   "localhost:8080",
+		"[::]:8080":      "localhost:8080",
+		"127.0.0.1:9000": "127.0.0.1:9000",
+		"8080":           "localhost:8080",
+	}
+	for in, want := range tests {
+		if got := localAddr(in); got != want {
+			t.Errorf("localAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// loadtestPrefix starts the content of every load test message, followed by
+	// the sender's lidnr, a sequence number and the send time in Unix
+	// nanoseconds.
+	loadtestPrefix = "loadtest"
+	// loadtestDialers is how many clients connect at once.
+	loadtestDialers = 64
+	// loadtestSettle gives the target time to register the radios, which get
+	// no welcome frame to wait for, before users start sending.
+	loadtestSettle = 500 * time.Millisecond
+	// First lidnrs of the simulated users and radios
+	loadtestUserLidnr  = 1_000_000
+	loadtestRadioLidnr = 9_000_000
+)
+
+// loadtestConfig describes a load test run against a running chat.
+type loadtestConfig struct {
+	URL      string        // websocket endpoint, such as ws://localhost:8080/ws
+	Users    int           // simulated users
+	Radios   int           // simulated radios
+	Secret   string        // GEWIS_SECRET of the target, to sign the test tokens
+	RadioKey string        // RADIO_CHAT_KEY of the target
+	Rate     float64       // messages per second per user
+	Duration time.Duration // how long users send
+	Wait     time.Duration // how long radios keep receiving after the last send
+}
+
+// loadtestReport is the outcome of a load test. Latencies are end to end,
+// from a user sending a message to the first radio receiving it.
+type loadtestReport struct {
+	Users           int // connected
+	Radios          int // connected
+	ConnectFailures int // refused, or radios closed by the target during the run
+	Sent            int
+	Received        int // distinct messages received by at least one radio
+	Dropped         int // sent but never received
+	P50, P95, P99   time.Duration
+}
+
+// runLoadtest runs the loadtest subcommand with its arguments and returns the
+// exit code.
+func runLoadtest(args []string, stdout, stderr io.Writer) int {
+	cfg := loadtestConfig{}
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cfg.URL, "url", "ws://localhost:8080/ws", "websocket endpoint of the chat")
+	fs.IntVar(&cfg.Users, "users", 100, "simulated users")
+	fs.IntVar(&cfg.Radios, "radios", 2, "simulated radios")
+	fs.StringVar(&cfg.Secret, "secret", chat.GEWISSecret, "GEWIS_SECRET of the chat, to sign test tokens")
+	fs.StringVar(&cfg.RadioKey, "radio-key", chat.RADIOChatKey, "RADIO_CHAT_KEY of the chat")
+	fs.Float64Var(&cfg.Rate, "rate", 0.2, "messages per second per user")
+	fs.DurationVar(&cfg.Duration, "duration", 30*time.Second, "how long users send")
+	fs.DurationVar(&cfg.Wait, "wait", 2*time.Second, "how long to wait for messages after the last send")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.Users < 1 || cfg.Radios < 1 || cfg.Rate <= 0 {
+		fmt.Fprintln(stderr, "loadtest: -users and -radios must be at least 1 and -rate above 0")
+		return 2
+	}
+
+	report, err := loadtest(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "loadtest: %v\n", err)
+		return 1
+	}
+	report.write(stdout)
+	return 0
+}
+
+// write prints the report for people.
+func (r loadtestReport) write(w io.Writer) {
+	fmt.Fprintf(w, "connected:        %d users, %d radios\n", r.Users, r.Radios)
+	fmt.Fprintf(w, "connect failures: %d\n", r.ConnectFailures)
+	fmt.Fprintf(w, "messages:         %d sent, %d received, %d dropped\n", r.Sent, r.Received, r.Dropped)
+	fmt.Fprintf(w, "latency:          p50 %v, p95 %v, p99 %v\n", r.P50, r.P95, r.P99)
+}
+
+// loadtestRun holds the state shared by the simulated clients.
+type loadtestRun struct {
+	cfg      loadtestConfig
+	stopping atomic.Bool // set before the clients are closed
+
+	mu        sync.Mutex
+	failures  int
+	lost      int // radios closed by the target
+	sent      int
+	received  map[string]struct{} // contents of the messages received
+	latencies []time.Duration
+}
+
+// loadtest connects the radios and users, lets every user send at the
+// configured rate for the duration and collects what the radios receive.
+func loadtest(ctx context.Context, cfg loadtestConfig) (loadtestReport, error) {
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return loadtestReport{}, fmt.Errorf("invalid url: %w", err)
+	}
+	run := &loadtestRun{cfg: cfg, received: make(map[string]struct{})}
+
+	var readers sync.WaitGroup
+	radios := run.connectAll(cfg.Radios, func(i int) (*websocket.Conn, error) {
+		return run.connectRadio(loadtestRadioLidnr + i)
+	})
+	for _, conn := range radios {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			run.receive(conn)
+		}()
+	}
+	users := run.connectAll(cfg.Users, func(i int) (*websocket.Conn, error) {
+		return run.connectUser(loadtestUserLidnr + i)
+	})
+	for _, conn := range users {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			discard(conn)
+		}()
+	}
+	if len(radios) == 0 {
+		closeAll(users)
+		readers.Wait()
+		return run.report(0, 0), errors.New("no radio could connect")
+	}
+
+	select {
+	case <-time.After(loadtestSettle):
+	case <-ctx.Done():
+	}
+	var senders sync.WaitGroup
+	deadline := time.Now().Add(cfg.Duration)
+	for i, conn := range users {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			run.send(ctx, conn, loadtestUserLidnr+i, deadline)
+		}()
+	}
+	senders.Wait()
+
+	select {
+	case <-time.After(cfg.Wait):
+	case <-ctx.Done():
+	}
+	run.stopping.Store(true)
+	closeAll(users)
+	closeAll(radios)
+	readers.Wait()
+	return run.report(len(users), len(radios)), ctx.Err()
+}
+
+// connectAll connects n clients, a few at a time, and returns those that
+// connected.
+func (run *loadtestRun) connectAll(n int, connect func(i int) (*websocket.Conn, error)) []*websocket.Conn {
+	conns := make([]*websocket.Conn, n)
+	slots := make(chan struct{}, loadtestDialers)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			conn, err := connect(i)
+			if err != nil {
+				run.mu.Lock()
+				run.failures++
+				run.mu.Unlock()
+				return
+			}
+			conns[i] = conn
+		}()
+	}
+	wg.Wait()
+	return slices.DeleteFunc(conns, func(conn *websocket.Conn) bool { return conn == nil })
+}
+
+// dial opens a connection with the role and sends the handshake.
+func (run *loadtestRun) dial(role string, lidnr int, handshake chat.IncomingMessage) (*websocket.Conn, error) {
+	u, _ := url.Parse(run.cfg.URL)
+	q := u.Query()
+	q.Set("role", role)
+	u.RawQuery = q.Encode()
+
+	token, err := run.token(lidnr, role)
+	if err != nil {
+		return nil, err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	handshake.Token = token
+	handshake.ClientVersion = "loadtest"
+	if err := conn.WriteJSON(handshake); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (run *loadtestRun) connectRadio(lidnr int) (*websocket.Conn, error) {
+	return run.dial("radio", lidnr, chat.IncomingMessage{RadioKey: run.cfg.RadioKey})
+}
+
+// connectUser connects a user and waits for their welcome frame.
+func (run *loadtestRun) connectUser(lidnr int) (*websocket.Conn, error) {
+	conn, err := run.dial("user", lidnr, chat.IncomingMessage{})
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		var msg chat.OutgoingMessage
+		if json.Unmarshal(data, &msg) == nil && msg.Type == chat.MessageTypeWelcome {
+			break
+		}
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// token signs a test token for the lidnr.
+func (run *loadtestRun) token(lidnr int, role string) (string, error) {
+	claims := chat.GEWISClaims{
+		Lidnr:      lidnr,
+		GivenName:  "Load",
+		FamilyName: "Test " + role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(run.cfg.Duration + time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(run.cfg.Secret))
+}
+
+// send sends messages at the configured rate until the deadline, stamped with
+// the time they were sent.
+func (run *loadtestRun) send(ctx context.Context, conn *websocket.Conn, lidnr int, deadline time.Time) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / run.cfg.Rate))
+	defer ticker.Stop()
+	for seq := 0; ; seq++ {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if time.Now().After(deadline) {
+			return
+		}
+		content := fmt.Sprintf("%s %d %d %d", loadtestPrefix, lidnr, seq, time.Now().UnixNano())
+		if err := conn.WriteJSON(chat.IncomingMessage{Content: content}); err != nil {
+			return
+		}
+		run.mu.Lock()
+		run.sent++
+		run.mu.Unlock()
+	}
+}
+
+// receive records the load test messages a radio receives until its
+// connection closes. Radios are not welcomed, so one refused at the handshake
+// is only noticed here.
+func (run *loadtestRun) receive(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !run.stopping.Load() {
+				run.mu.Lock()
+				run.failures++
+				run.lost++
+				run.mu.Unlock()
+			}
+			return
+		}
+		now := time.Now()
+		var msg chat.OutgoingMessage
+		if json.Unmarshal(data, &msg) != nil || !strings.HasPrefix(msg.Content, loadtestPrefix+" ") {
+			continue
+		}
+		fields := strings.Fields(msg.Content)
+		sentAt, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		run.mu.Lock()
+		if _, ok := run.received[msg.Content]; !ok {
+			run.received[msg.Content] = struct{}{}
+			run.latencies = append(run.latencies, now.Sub(time.Unix(0, sentAt)))
+		}
+		run.mu.Unlock()
+	}
+}
+
+// discard reads from a user's connection until it closes, so pings are
+// answered and the server never sees a stalled reader.
+func discard(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func closeAll(conns []*websocket.Conn) {
+	for _, conn := range conns {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		_ = conn.Close()
+	}
+}
+
+func (run *loadtestRun) report(users, radios int) loadtestReport {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	slices.Sort(run.latencies)
+	return loadtestReport{
+		Users:           users,
+		Radios:          radios - run.lost,
+		ConnectFailures: run.failures,
+		Sent:            run.sent,
+		Received:        len(run.received),
+		Dropped:         max(run.sent-len(run.received), 0),
+		P50:             percentile(run.latencies, 0.50),
+		P95:             percentile(run.latencies, 0.95),
+		P99:             percentile(run.latencies, 0.99),
+	}
+}
+
+// percentile returns the q-th quantile of the sorted durations, 0 if there are
+// none.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(q*float64(len(sorted)-1))]
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+	"github.com/rs/zerolog"
+)
+
+// startLoadtestTarget serves a chat accepting the load test's tokens.
+func startLoadtestTarget(t *testing.T) *httptest.Server {
+	t.Helper()
+	c := chat.New(chat.WithSecret("loadsecret"), chat.WithRadioKey("loadkey", nil), chat.WithLogger(zerolog.Nop()))
+	srv := httptest.NewServer(c.Handler())
+	t.Cleanup(func() {
+		// An ended context skips the drain
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = c.Shutdown(ctx)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestLoadtest(t *testing.T) {
+	srv := startLoadtestTarget(t)
+
+	report, err := loadtest(context.Background(), loadtestConfig{
+		URL:      "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws",
+		Users:    3,
+		Radios:   2,
+		Secret:   "loadsecret",
+		RadioKey: "loadkey",
+		Rate:     20,
+		Duration: 300 * time.Millisecond,
+		Wait:     500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("loadtest: %v", err)
+	}
+	if report.Users != 3 || report.Radios != 2 || report.ConnectFailures != 0 {
+		t.Fatalf("expected every client to connect, got %+v", report)
+	}
+	if report.Sent == 0 || report.Received != report.Sent || report.Dropped != 0 {
+		t.Fatalf("expected every message to arrive, got %+v", report)
+	}
+	if report.P50 <= 0 || report.P50 > report.P95 || report.P95 > report.P99 {
+		t.Fatalf("unexpected latencies: %+v", report)
+	}
+}
+
+func TestLoadtestConnectFailures(t *testing.T) {
+	srv := startLoadtestTarget(t)
+
+	var stdout, stderr bytes.Buffer
+	code := runLoadtest([]string{
+		"-url", "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws",
+		"-users", "2", "-radios", "1", "-secret", "wrong", "-radio-key", "loadkey",
+		"-duration", "100ms", "-wait", "0s",
+	}, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "connect failures: 3") {
+		t.Fatalf("expected 3 connect failures, got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// setupLogger configures the global logger to write to out, and to the file
+// at path if it is not empty. The returned file is nil without a path.
+func setupLogger(format, level, path string, maxSize int64, out io.Writer) (*rotatingFile, error) {
+	l, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *rotatingFile
+	var fileOut io.Writer
+	if path != "" {
+		if file, err = openRotatingFile(path, maxSize); err != nil {
+			return nil, err
+		}
+		fileOut = file
+	}
+	logger, err := newLogger(format, out, fileOut)
+	if err != nil {
+		if file != nil {
+			_ = file.Close()
+		}
+		return nil, err
+	}
+
+	zerolog.SetGlobalLevel(l)
+	useLogger(logger)
+	return file, nil
+}
+
+// newLogger writes to out as JSON, or human-readable for the console format.
+// When file is set, output is also written to it, always as JSON.
+func newLogger(format string, out io.Writer, file io.Writer) (zerolog.Logger, error) {
+	var w io.Writer
+	switch format {
+	case LogFormatJSON:
+		w = out
+	case LogFormatConsole:
+		w = zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339}
+	default:
+		return zerolog.Logger{}, fmt.Errorf("unknown log format %q, expected json or console", format)
+	}
+	if file != nil {
+		w = zerolog.MultiLevelWriter(w, file)
+	}
+	return zerolog.New(w).With().Timestamp().Logger(), nil
+}
+
+// useLogger makes the logger the global logger, which chats created after it
+// log to.
+func useLogger(logger zerolog.Logger) {
+	log.Logger = logger
+}
+
+// rotatingFile appends to a log file and moves it to <path>.1 once it would
+// grow beyond maxSize bytes. A maxSize of 0 disables rotation.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file at path, callers must hold f.mu unless f is not shared
+// yet.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside, replacing an earlier rotated file.
+// Callers must hold f.mu.
+func (f *rotatingFile) rotate() error {
+	_ = f.file.Close()
+	// If the rename fails the same file is reopened and keeps growing, rather
+	// than losing lines
+	_ = os.Rename(f.path, f.path+".1")
+	return f.open()
+}
+
+// Reopen closes and reopens the file, for when logrotate has moved it.
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_ = f.file.Close()
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
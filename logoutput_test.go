@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// restoreLogger undoes setupLogger at the end of the test.
+func restoreLogger(t *testing.T) {
+	t.Helper()
+	prev, prevLevel := log.Logger, zerolog.GlobalLevel()
+	t.Cleanup(func() {
+		zerolog.SetGlobalLevel(prevLevel)
+		useLogger(prev)
+	})
+}
+
+func TestSetupLoggerJSON(t *testing.T) {
+	restoreLogger(t)
+	var out bytes.Buffer
+	if _, err := setupLogger(LogFormatJSON, "info", "", 0, &out); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	log.Debug().Msg("hidden")
+	log.Info().Str("room", "main").Msg("hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", out.String(), err)
+	}
+	if line["message"] != "hello" || line["room"] != "main" || line["time"] == nil {
+		t.Fatalf("unexpected log line: %v", line)
+	}
+}
+
+func TestSetupLoggerConsole(t *testing.T) {
+	restoreLogger(t)
+	var out bytes.Buffer
+	if _, err := setupLogger(LogFormatConsole, "info", "", 0, &out); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	log.Info().Str("room", "main").Msg("hello")
+
+	got := out.String()
+	if json.Valid(out.Bytes()) || !strings.Contains(got, "hello") || !strings.Contains(got, "room=") {
+		t.Fatalf("expected human-readable output, got %q", got)
+	}
+}
+
+func TestSetupLoggerFile(t *testing.T) {
+	restoreLogger(t)
+	path := filepath.Join(t.TempDir(), "radiogaga.log")
+	var out bytes.Buffer
+	file, err := setupLogger(LogFormatConsole, "info", path, 0, &out)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	defer file.Close()
+	log.Info().Msg("hello")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(data, &line); err != nil || line["message"] != "hello" {
+		t.Fatalf("expected JSON line in file, got %q: %v", data, err)
+	}
+	if !strings.Contains(out.String(), "hello") {
+		t.Fatalf("expected console output as well, got %q", out.String())
+	}
+}
+
+func TestSetupLoggerInvalid(t *testing.T) {
+	restoreLogger(t)
+	if _, err := setupLogger("xml", "info", "", 0, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+	if _, err := setupLogger(LogFormatJSON, "loud", "", 0, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "radiogaga.log")
+	f, err := openRotatingFile(path, 10)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "aaaaaa\n" {
+		t.Fatalf("expected rotated file with first line, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "bbbbbb\n" {
+		t.Fatalf("expected current file with second line, got %q", data)
+	}
+
+	// logrotate moves the file away, then signals a reopen
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if _, err := f.Write([]byte("cc\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "cc\n" {
+		t.Fatalf("expected write to reopened file, got %q", data)
+	}
+}
@@ -1,62 +1,318 @@
 package main
 
 import (
-	"encoding/json"
-	"github.com/rs/zerolog"
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/GEWIS/radiogaga/pkg/chat"
 	"github.com/rs/zerolog/log"
 )
 
-type RadioInfo struct {
-	VideoURL        string `json:"videoUrl"`
-	AudioURL        string `json:"audioUrl"`
-	AudioMountPoint string `json:"audioMountPoint"`
-	StartTime       string `json:"startTime"`
-}
-
 var (
-	port            = String("PORT", ":8080")
-	videoURL        = String("RADIO_VIDEO_URL", "https://hd-auth.skylinewebcams.com/live.m3u8?a=2j5v70ov5ng6jq544ji0u6kjh3")
-	audioURL        = String("RADIO_AUDIO_URL", "bata-radio.snt.utwente.nl")
-	audioMountPoint = String("RADIO_AUDIO_MOUNT_POINT", "/high")
-	radioStartTime  = String("RADIO_START_TIME", "2025-08-18T07:00:00Z")
-	token           = String("RADIO_GEWIS_TOKEN", "gewis-radio")
-	logLevel        = String("LOG_LEVEL", "trace")
+	port                = chat.String("PORT", ":8080")
+	adminAddr           = chat.String("ADMIN_ADDR", "")
+	pidFile             = chat.String("RADIO_PID_FILE", "")
+	upgradeTimeout      = chat.Duration("RADIO_UPGRADE_TIMEOUT", time.Minute)
+	videoURL            = chat.String("RADIO_VIDEO_URL", "https://hd-auth.skylinewebcams.com/live.m3u8?a=2j5v70ov5ng6jq544ji0u6kjh3")
+	audioURL            = chat.String("RADIO_AUDIO_URL", "bata-radio.snt.utwente.nl")
+	audioMountPoint     = chat.String("RADIO_AUDIO_MOUNT_POINT", "/high")
+	radioStartTime      = chat.String("RADIO_START_TIME", "2025-08-18T07:00:00Z")
+	radioStartZone      = chat.String("RADIO_START_TIME_TIMEZONE", "UTC")
+	radioDuration       = chat.String("RADIO_DURATION", "")
+	token               = chat.String("RADIO_GEWIS_TOKEN", "gewis-radio")
+	logLevel            = chat.String("LOG_LEVEL", "trace")
+	logFormat           = chat.String("LOG_FORMAT", LogFormatJSON)
+	logFilePath         = chat.String("LOG_FILE", "")
+	logMaxSize          = chat.Int("LOG_MAX_SIZE", 100<<20)
+	natsURL             = chat.String("RADIO_NATS_URL", "")
+	redisURL            = chat.String("REDIS_URL", chat.String("RADIO_REDIS_URL", ""))
+	webhookURL          = chat.String("CHAT_WEBHOOK_URL", "")
+	webhookSecret       = chat.String("CHAT_WEBHOOK_SECRET", "")
+	webhookQueue        = chat.Int("CHAT_WEBHOOK_QUEUE_SIZE", 256)
+	webhookTimeout      = chat.Duration("CHAT_WEBHOOK_TIMEOUT", 5*time.Second)
+	webhookRetries      = chat.Int("CHAT_WEBHOOK_RETRIES", 3)
+	wordFilterPath      = chat.String("RADIO_WORD_FILTER_PATH", "")
+	wordFilterMode      = chat.String("RADIO_WORD_FILTER_ACTION", string(chat.FilterActionWarn))
+	regexFilterPath     = chat.String("RADIO_REGEX_FILTER_PATH", "")
+	sentryDSN           = chat.String("SENTRY_DSN", "")
+	auditLogPath        = chat.String("AUDIT_LOG_FILE", "")
+	deadLetterPath      = chat.String("RADIO_DEAD_LETTER_FILE", "")
+	tokenJWKSURL        = chat.String("TOKEN_JWKS_URL", "")
+	tokenJWKSRefresh    = chat.Duration("TOKEN_JWKS_REFRESH_INTERVAL", time.Hour)
+	icecastStatusURL    = chat.String("RADIO_ICECAST_STATUS_URL", "")
+	icecastPollInterval = chat.Duration("RADIO_ICECAST_POLL_INTERVAL", 10*time.Second)
+	dbDriver            = chat.String("CHAT_DB_DRIVER", "")
+	dbDSN               = chat.String("CHAT_DB_DSN", "")
+	jsonStyle           = chat.String("RADIO_JSON_STYLE", string(chat.JSONSnakeCase))
 )
 
 func main() {
-	chat := NewChat()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "loadtest":
+			os.Exit(runLoadtest(os.Args[2:], os.Stdout, os.Stderr))
+		case "healthcheck":
+			os.Exit(runHealthcheck(os.Args[2:], os.Stderr))
+		case "-validate":
+			os.Exit(runValidate(os.Stdout))
+		}
+	}
+
+	logFile, err := setupLogger(logFormat, logLevel, logFilePath, int64(logMaxSize), os.Stdout)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up logging")
+	}
+	if logFile != nil {
+		defer logFile.Close()
 
-	l, err := zerolog.ParseLevel(logLevel)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := logFile.Reopen(); err != nil {
+					log.Error().Err(err).Msg("could not reopen log file")
+				}
+			}
+		}()
+	}
+
+	// Numbers, durations and booleans that fell back were logged when read
+	parsed, problems := checkConfig(envConfig())
+	invalid := false
+	for _, p := range append(chat.CheckEnv(), problems...) {
+		if p.Fatal {
+			log.Error().Err(p.Err).Str("setting", p.Setting).Msg("invalid configuration")
+			invalid = true
+		} else {
+			log.Warn().Err(p.Err).Str("setting", p.Setting).Msg("configuration problem")
+		}
+	}
+	if invalid {
+		log.Fatal().Msg("refusing to start, check the configuration with -validate")
+	}
+	radio := parsed.radio
+	radioState := chat.NewRadioState(radio)
+
+	shutdownTracing, err := chat.SetupTracing(context.Background())
 	if err != nil {
-		log.Fatal().Err(err).Msg("could not parse level")
-	}
-	zerolog.SetGlobalLevel(l)
-
-	http.HandleFunc("/ws", chat.HandleWS)
-
-	http.HandleFunc("/api/v1/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"status":"ok"}`))
-	})
-
-	http.HandleFunc("/api/v1/token", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(token)
-	})
-
-	http.HandleFunc("/api/v1/radio", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(RadioInfo{
-			VideoURL:        videoURL,
-			AudioURL:        audioURL,
-			AudioMountPoint: audioMountPoint,
-			StartTime:       radioStartTime,
+		log.Fatal().Err(err).Msg("could not set up tracing")
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
+	var reporter chat.ErrorReporter
+	var chatOpts []chat.Option
+	if sentryDSN != "" {
+		sentryReporter, err := chat.NewSentryReporter(sentryDSN)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not set up Sentry")
+		}
+		defer sentryReporter.Flush(2 * time.Second)
+		reporter = chat.NewRateLimitedReporter(sentryReporter, chat.ErrorReportInterval)
+		chatOpts = append(chatOpts, chat.WithErrorReporter(reporter))
+		log.Info().Msg("reporting errors to Sentry")
+	}
+
+	chatOpts = append(chatOpts, chat.WithJSONStyle(parsed.style), chat.WithRadioState(radioState))
+	if tokenJWKSURL != "" {
+		jwks := chat.NewJWKS(tokenJWKSURL)
+		if err := jwks.Refresh(context.Background()); err != nil {
+			// Not fatal, keys are fetched again when a token needs one
+			log.Error().Err(err).Msg("could not fetch JWKS")
+		}
+		go jwks.Run(context.Background(), tokenJWKSRefresh)
+		chatOpts = append(chatOpts, chat.WithJWKS(jwks))
+	}
+	c := chat.New(chatOpts...)
+
+	if icecastStatusURL != "" {
+		poller := &chat.IcecastPoller{
+			URL:      icecastStatusURL,
+			Mount:    audioMountPoint,
+			Interval: icecastPollInterval,
+			State:    radioState,
+			OnChange: func(info chat.RadioInfo) { c.RadioUpdate(context.Background(), info) },
+		}
+		go poller.Run(context.Background())
+	}
+
+	if natsURL != "" {
+		backend, err := chat.NewNATSBackend(natsURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to NATS")
+		}
+		defer backend.Close()
+		if err := c.UseBackend(backend); err != nil {
+			log.Fatal().Err(err).Msg("could not subscribe to NATS")
+		}
+		log.Info().Str("url", natsURL).Msg("using NATS backend")
+	}
+
+	if redisURL != "" {
+		backend, err := chat.NewRedisBackend(redisURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not connect to Redis")
+		}
+		defer backend.Close()
+		if err := c.UseBackend(backend); err != nil {
+			log.Fatal().Err(err).Msg("could not subscribe to Redis")
+		}
+		log.Info().Str("url", redisURL).Msg("using Redis backend")
+	}
+
+	if dbDriver != "" {
+		store, err := chat.OpenSQLStore(context.Background(), dbDriver, dbDSN)
+		if err != nil {
+			log.Fatal().Err(err).Str("driver", dbDriver).Msg("could not open message store")
+		}
+		c.UseStore(store)
+		defer func() {
+			if err := c.CloseStore(); err != nil {
+				log.Warn().Err(err).Msg("could not close message store")
+			}
+		}()
+		log.Info().Str("driver", dbDriver).Msg("storing messages in database")
+	}
+
+	if webhookURL != "" {
+		webhook := chat.NewWebhook(chat.WebhookConfig{
+			URL:       webhookURL,
+			Secret:    webhookSecret,
+			QueueSize: webhookQueue,
+			Timeout:   webhookTimeout,
+			Retries:   webhookRetries,
+			Reporter:  reporter,
 		})
-	})
+		defer webhook.Close()
+		c.UseWebhook(webhook)
+		log.Info().Str("url", webhookURL).Msg("mirroring user messages to webhook")
+	}
+
+	if auditLogPath != "" {
+		auditLog, err := chat.OpenAuditLog(auditLogPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not open audit log")
+		}
+		defer auditLog.Close()
+		c.UseAuditLog(auditLog)
+		log.Info().Str("path", auditLogPath).Msg("writing audit log")
+	}
+
+	if deadLetterPath != "" {
+		deadLetters, err := chat.OpenDeadLetters(deadLetterPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not open dead-letter file")
+		}
+		defer deadLetters.Close()
+		c.UseDeadLetters(deadLetters)
+		log.Info().Str("path", deadLetterPath).Msg("writing unacknowledged messages to dead-letter file")
+	}
+
+	filterAction := parsed.filterAction
+	if filter := parsed.wordFilter; filter != nil {
+		c.UseFilter(filter, filterAction)
+		log.Info().Str("path", wordFilterPath).Str("action", string(filterAction)).Msg("filtering user messages")
+	}
+	if filter := parsed.regexFilter; filter != nil {
+		c.UseFilter(filter, filterAction)
+		log.Info().Str("path", regexFilterPath).Str("action", string(filterAction)).Msg("filtering user messages by pattern")
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := filter.Reload(); err != nil {
+					log.Error().Err(err).Msg("could not reload regex filter, keeping old patterns")
+					continue
+				}
+				log.Info().Str("path", regexFilterPath).Msg("regex filter reloaded")
+			}
+		}()
+	}
+
+	go c.WatchRadioKeyExpiry(time.Hour, nil)
+
+	public, admin := routes(c, radioState, envConfig(), adminAddr != "")
+	servers := []*http.Server{{Addr: port, Handler: public}}
+	if admin != nil {
+		servers = append(servers, &http.Server{Addr: adminAddr, Handler: admin})
+	}
+	up, err := newUpgrader(pidFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not inherit sockets")
+	}
+	listeners := make([]net.Listener, len(servers))
+	for i, srv := range servers {
+		if listeners[i], err = up.listen(srv.Addr); err != nil {
+			log.Fatal().Err(err).Str("addr", srv.Addr).Msg("could not listen")
+		}
+		go func() {
+			log.Info().Str("addr", listeners[i].Addr().String()).Msg("Starting server")
+			err := srv.Serve(listeners[i])
+			if !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+				log.Fatal().Err(err).Str("addr", srv.Addr).Msg("server failed")
+			}
+		}()
+	}
+	if err := up.ready(); err != nil {
+		log.Fatal().Err(err).Msg("could not signal readiness")
+	}
+	// The main PID changes with an upgrade
+	if err := up.notify("READY=1", "MAINPID="+strconv.Itoa(os.Getpid())); err != nil {
+		log.Warn().Err(err).Msg("could not notify systemd")
+	}
 
-	log.Info().Str("port", port).Msg("Starting server")
-	log.Fatal().Err(http.ListenAndServe(port, nil))
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	upgrades := make(chan os.Signal, 1)
+	if upgradeSignal != nil {
+		signal.Notify(upgrades, upgradeSignal)
+	}
+	upgraded := false
+	for !upgraded && stop.Err() == nil {
+		select {
+		case <-stop.Done():
+		case <-upgrades:
+			log.Info().Msg("starting a new process to hand the sockets to")
+			pid, err := up.upgrade(upgradeTimeout)
+			if err != nil {
+				log.Error().Err(err).Msg("upgrade failed, still serving")
+				continue
+			}
+			log.Info().Int("pid", pid).Msg("new process is serving")
+			upgraded = true
+		}
+	}
+	signal.Stop(upgrades)
+	cancel()
+	if upgraded {
+		// The new process accepts on the sockets now, so rather than draining
+		// with 503s this one stops accepting right away
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+	} else if err := up.notify("STOPPING=1"); err != nil {
+		log.Warn().Err(err).Msg("could not notify systemd")
+	}
+	log.Info().Msg("shutting down, send another signal to stop right away")
+
+	// A second signal cuts the drain short
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("drain cut short")
+	}
+	ctx, cancelHTTP := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelHTTP()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Warn().Err(err).Str("addr", srv.Addr).Msg("could not finish HTTP requests")
+		}
+	}
 }
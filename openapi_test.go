@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+)
+
+func TestOpenAPISpecServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleOpenAPI(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected json content type, got %q", ct)
+	}
+
+	var spec struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	if spec.OpenAPI != "3.0.3" {
+		t.Fatalf("unexpected openapi version %q", spec.OpenAPI)
+	}
+	for _, path := range []string{"/api/v1/health", "/api/v1/token", "/api/v1/radio", "/api/v1/broadcast", "/api/v1/openapi.json"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec is missing %s", path)
+		}
+	}
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	for _, v := range []any{chat.BroadcastRequest{}, chat.OutgoingMessage{}, chat.RadioInfo{}, chat.ClientInfo{}} {
+		typ := reflect.TypeOf(v)
+		schema, ok := spec.Components.Schemas[typ.Name()]
+		if !ok {
+			t.Errorf("spec is missing %s, run go generate", typ.Name())
+			continue
+		}
+		for i := range typ.NumField() {
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if _, ok := schema.Properties[name]; !ok && typ.Field(i).IsExported() {
+				t.Errorf("%s in the spec is missing %s, run go generate", typ.Name(), name)
+			}
+		}
+	}
+}
+
+func TestOpenAPIRolesMatchChat(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas struct {
+				ClientInfo struct {
+					Properties struct {
+						Role struct {
+							Enum []string `json:"enum"`
+						} `json:"role"`
+					} `json:"properties"`
+				} `json:"ClientInfo"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	if got := spec.Components.Schemas.ClientInfo.Properties.Role.Enum; !slices.Equal(got, chat.Roles) {
+		t.Fatalf("expected the roles %v in the spec, got %v, run go generate", chat.Roles, got)
+	}
+}
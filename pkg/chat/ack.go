@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ackMode asks users to acknowledge messages addressed to them, which are
+	// resent once and then dead-lettered if they do not.
+	ackMode    = Bool("RADIO_ACK_MODE", false)
+	ackTimeout = Duration("RADIO_ACK_TIMEOUT", 5*time.Second)
+)
+
+var ErrAckNotAllowed = errors.New("only users acknowledge messages")
+
+// Dead letter reasons
+const (
+	DeadLetterNoAck        = "no ack"
+	DeadLetterDisconnected = "disconnected"
+)
+
+// pendingAck is a message written to a client that has not been acknowledged
+// yet.
+type pendingAck struct {
+	msg     OutgoingMessage
+	data    []byte
+	sentAt  time.Time
+	retried bool
+}
+
+// ackRequired reports whether users are asked to acknowledge the message.
+// Only messages with an ID can be acked, notices are never retried.
+func (c *Chat) ackRequired(msg OutgoingMessage) bool {
+	return c.ackMode && msg.ID != "" && !highPriority(msg)
+}
+
+// trackAck remembers a message about to be written to the client until it is
+// acked. Only websocket users track acks, see ackLoop.
+func (cl *Client) trackAck(msg OutgoingMessage, data []byte) {
+	cl.ackMu.Lock()
+	defer cl.ackMu.Unlock()
+	if cl.ackPending != nil {
+		cl.ackPending[msg.ID] = pendingAck{msg: msg, data: data, sentAt: time.Now()}
+	}
+}
+
+// untrackAck forgets a tracked message that could not be written after all.
+func (cl *Client) untrackAck(id string) {
+	cl.ackMu.Lock()
+	defer cl.ackMu.Unlock()
+	delete(cl.ackPending, id)
+}
+
+// ack handles {"type": "ack", "ack_id": "<message id>"}. Acks for unknown or
+// already acked messages are ignored.
+func (c *Chat) ack(client *Client, in IncomingMessage) error {
+	if client.role != "user" {
+		return ErrAckNotAllowed
+	}
+	client.ackMu.Lock()
+	defer client.ackMu.Unlock()
+	if _, ok := client.ackPending[in.AckID]; ok {
+		delete(client.ackPending, in.AckID)
+		client.trace.Trace().Str("message", in.AckID).Msg("message acked")
+	}
+	return nil
+}
+
+// expireAcks resends messages that were not acked within the timeout once,
+// and returns those that were not acked after the resend either.
+func (cl *Client) expireAcks(timeout time.Duration) (resend [][]byte, dead []OutgoingMessage) {
+	cl.ackMu.Lock()
+	defer cl.ackMu.Unlock()
+	now := time.Now()
+	for id, p := range cl.ackPending {
+		if now.Sub(p.sentAt) < timeout {
+			continue
+		}
+		if p.retried {
+			dead = append(dead, p.msg)
+			delete(cl.ackPending, id)
+			continue
+		}
+		p.sentAt, p.retried = now, true
+		cl.ackPending[id] = p
+		resend = append(resend, p.data)
+	}
+	return resend, dead
+}
+
+// ackLoop checks the client's unacked messages until it disconnects, after
+// which whatever is still unacked is dead-lettered.
+func (c *Chat) ackLoop(client *Client) {
+	ticker := time.NewTicker(max(c.ackTimeout/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.done:
+			client.ackMu.Lock()
+			pending := client.ackPending
+			client.ackPending = nil
+			client.ackMu.Unlock()
+			for _, p := range pending {
+				c.deadLetter(client, p.msg, DeadLetterDisconnected)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		resend, dead := client.expireAcks(c.ackTimeout)
+		for _, data := range resend {
+			client.trace.Trace().Msg("resending unacked message")
+			if err := client.send(data); err != nil {
+				client.log.Debug().Err(err).Msg("failed to resend unacked message")
+			}
+		}
+		for _, msg := range dead {
+			c.deadLetter(client, msg, DeadLetterNoAck)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func readDeadLetters(t *testing.T, path string) []DeadLetter {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open dead letters: %v", err)
+	}
+	defer f.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var l DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			t.Fatalf("invalid dead letter %q: %v", scanner.Text(), err)
+		}
+		letters = append(letters, l)
+	}
+	return letters
+}
+
+func waitForDeadLetters(t *testing.T, path string, n int) []DeadLetter {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		letters := readDeadLetters(t, path)
+		if len(letters) == n {
+			return letters
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d dead letters, have %d", n, len(letters))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startAckChat connects user 12345 and a radio to a chat in ack mode, with
+// dead letters written to the returned path.
+func startAckChat(t *testing.T) (chat *Chat, user, radio *websocket.Conn, path string) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	path = filepath.Join(t.TempDir(), "deadletters.jsonl")
+	deadLetters, err := OpenDeadLetters(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = deadLetters.Close() })
+
+	chat = New()
+	chat.ackMode = true
+	chat.ackTimeout = 100 * time.Millisecond
+	chat.UseDeadLetters(deadLetters)
+	srv, wsBase := startTestServer(t, chat)
+	t.Cleanup(srv.Close)
+	user, radio = connectUserAndRadio(t, chat, wsBase)
+	t.Cleanup(func() {
+		_ = user.Close()
+		_ = radio.Close()
+	})
+	return chat, user, radio, path
+}
+
+func expectAckRequired(t *testing.T, user *websocket.Conn, content string) OutgoingMessage {
+	t.Helper()
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || out.Content != content || !out.AckRequired {
+		t.Fatalf("expected %q requiring an ack, got: %+v (%v)", content, out, err)
+	}
+	return out
+}
+
+func TestAckClearsPending(t *testing.T) {
+	_, user, radio, path := startAckChat(t)
+
+	replyToUser(t, radio, "12345", "Coming up next")
+	out := expectAckRequired(t, user, "Coming up next")
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeAck, AckID: out.ID}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+
+	// Acked messages are neither dead-lettered nor resent
+	time.Sleep(300 * time.Millisecond)
+	if letters := readDeadLetters(t, path); len(letters) != 0 {
+		t.Fatalf("expected no dead letters, got: %+v", letters)
+	}
+	replyToUser(t, radio, "12345", "And then")
+	expectAckRequired(t, user, "And then")
+}
+
+func TestAckBeforeDeliveryReturns(t *testing.T) {
+	chat := New()
+	chat.ackMode = true
+	client := stalledClient(false)
+	client.ackPending = make(map[string]pendingAck)
+	chat.register(client)
+
+	// The user acks as soon as the message is queued, before the delivery
+	// returned
+	acked := make(chan struct{})
+	go func() {
+		defer close(acked)
+		var out OutgoingMessage
+		if err := json.Unmarshal(<-client.normalQueue, &out); err != nil {
+			t.Errorf("decode: %v", err)
+			return
+		}
+		_ = chat.ack(client, IncomingMessage{Type: MessageTypeAck, AckID: out.ID})
+	}()
+	msg := OutgoingMessage{ID: chat.nextMessageID(), From: "99999", To: "12345", Content: "hi", Room: DefaultRoom}
+	if !chat.deliverToUser(t.Context(), "12345", msg) {
+		t.Fatal("expected the message to be delivered")
+	}
+	<-acked
+	client.ackMu.Lock()
+	defer client.ackMu.Unlock()
+	if len(client.ackPending) != 0 {
+		t.Fatalf("expected the ack to clear the message, pending: %v", client.ackPending)
+	}
+}
+
+func TestAckRetriedOnce(t *testing.T) {
+	_, user, radio, path := startAckChat(t)
+
+	replyToUser(t, radio, "12345", "Coming up next")
+	out := expectAckRequired(t, user, "Coming up next")
+	retry := expectAckRequired(t, user, "Coming up next")
+	if retry.ID != out.ID || retry.SeqNum <= out.SeqNum {
+		t.Fatalf("expected the same message with a new seq, got: %+v after %+v", retry, out)
+	}
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeAck, AckID: out.ID}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if letters := readDeadLetters(t, path); len(letters) != 0 {
+		t.Fatalf("expected no dead letters after the retry was acked, got: %+v", letters)
+	}
+}
+
+func TestAckTimeoutDeadLetters(t *testing.T) {
+	_, user, radio, path := startAckChat(t)
+
+	replyToUser(t, radio, "12345", "Coming up next")
+	out := expectAckRequired(t, user, "Coming up next")
+	expectAckRequired(t, user, "Coming up next")
+
+	letters := waitForDeadLetters(t, path, 1)
+	if l := letters[0]; l.To != "12345" || l.Reason != DeadLetterNoAck || l.Message.ID != out.ID {
+		t.Fatalf("expected a dead letter for %s, got: %+v", out.ID, l)
+	}
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrorResponse is the body of every failed API request.
+type ErrorResponse struct {
+	Error string `json:"error" description:"Human readable error"`
+}
+
+// StatusResponse is the body of API requests that have nothing else to
+// return.
+type StatusResponse struct {
+	Status string `json:"status" enum:"ok,draining"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
+
+// WithAdminKey authorizes the admin endpoints with the key instead of
+// RADIO_ADMIN_KEY. Empty disables them.
+func WithAdminKey(key string) Option {
+	return func(c *Chat) {
+		c.adminKey = key
+	}
+}
+
+// RequireAdminKey guards a handler with the admin key, like the admin
+// endpoints of the chat.
+func (c *Chat) RequireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, c.adminKey) {
+			writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether the request carries the key as a bearer token.
+// An empty key never authorizes anything.
+func authorized(r *http.Request, key string) bool {
+	if key == "" {
+		return false
+	}
+	got := bearerToken(r)
+	if got == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1
+}
+
+// bearerToken returns the token from the Authorization header, if any.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// Actors for actions taken with a shared key rather than as a member.
+const (
+	ActorRadioKey = "radio-key"
+	ActorAdminKey = "admin-key"
+)
+
+// AuditEntry records a moderation or radio action.
+type AuditEntry struct {
+	Time   time.Time         `json:"time"`
+	Actor  string            `json:"actor" description:"Lidnr of the radio, or radio-key or admin-key"`
+	Action string            `json:"action" description:"Command or endpoint, e.g. pin or broadcast"`
+	Target string            `json:"target,omitempty" description:"Room, user, message or poll acted on"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// AuditLog appends entries to a JSONL file. Writes are synchronous, so an
+// entry is on disk by the time the command or request completes.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: path, file: file}, nil
+}
+
+func (a *AuditLog) Write(e AuditEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(line, '\n'))
+	return err
+}
+
+// Entries returns up to limit entries, newest first, skipping the offset
+// newest ones, and the total number of entries.
+func (a *AuditLog) Entries(offset, limit int) ([]AuditEntry, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var all []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		all = append(all, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	entries := []AuditEntry{}
+	for i := len(all) - 1 - offset; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, all[i])
+	}
+	return entries, len(all), nil
+}
+
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// UseAuditLog records radio commands and admin actions in the log.
+func (c *Chat) UseAuditLog(a *AuditLog) {
+	c.auditLog = a
+}
+
+// audit records an action, if an audit log is configured.
+func (c *Chat) audit(actor, action, target string, params map[string]string) {
+	if c.auditLog == nil {
+		return
+	}
+	e := AuditEntry{Actor: actor, Action: action, Target: target, Params: params}
+	if err := c.auditLog.Write(e); err != nil {
+		c.log.Error().Err(err).Str("action", action).Msg("could not write audit log")
+	}
+}
+
+type AuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total" description:"Number of entries in the log"`
+}
+
+// HandleAudit returns audit entries newest first, paginated with ?offset= and
+// ?limit=. Requires the admin key.
+func (c *Chat) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+	if c.auditLog == nil {
+		writeError(w, http.StatusNotFound, "audit log not configured")
+		return
+	}
+
+	offset, limit := 0, defaultAuditLimit
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+		offset = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	entries, total, err := c.auditLog.Entries(offset, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not read audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, AuditResponse{Entries: entries, Total: total})
+}
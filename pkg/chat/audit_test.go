@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func readAuditFile(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAuditLogRecordsCommands(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer auditLog.Close()
+	chat := New()
+	chat.UseAuditLog(auditLog)
+
+	radio := &Client{role: "radio", id: "99999", room: DefaultRoom}
+	ctx := context.Background()
+	if err := chat.dispatch(ctx, radio, IncomingMessage{Cmd: CommandPin, Content: "Stuur je verzoekjes!"}); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if err := chat.dispatch(ctx, radio, IncomingMessage{Cmd: CommandUnpin}); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+	if rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"Team 42 has passed checkpoint 7"}`); rec.Code != http.StatusOK {
+		t.Fatalf("broadcast: %d %s", rec.Code, rec.Body)
+	}
+
+	entries := readAuditFile(t, path)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got: %+v", entries)
+	}
+	pin, unpin, broadcast := entries[0], entries[1], entries[2]
+	if pin.Actor != "99999" || pin.Action != CommandPin || pin.Target != DefaultRoom || pin.Params["content"] != "Stuur je verzoekjes!" || pin.Time.IsZero() {
+		t.Fatalf("unexpected pin entry: %+v", pin)
+	}
+	if unpin.Actor != "99999" || unpin.Action != CommandUnpin {
+		t.Fatalf("unexpected unpin entry: %+v", unpin)
+	}
+	if broadcast.Actor != ActorRadioKey || broadcast.Action != "broadcast" || broadcast.Target != "all" {
+		t.Fatalf("unexpected broadcast entry: %+v", broadcast)
+	}
+}
+
+func TestAuditLogConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer auditLog.Close()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := auditLog.Write(AuditEntry{Actor: "99999", Action: CommandPin}); err != nil {
+				t.Errorf("write: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if entries := readAuditFile(t, path); len(entries) != 50 {
+		t.Fatalf("expected 50 intact entries, got %d", len(entries))
+	}
+}
+
+func TestHandleAudit(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	auditLog, err := OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer auditLog.Close()
+	chat := New()
+	chat.UseAuditLog(auditLog)
+	for _, target := range []string{"1", "2", "3"} {
+		_ = auditLog.Write(AuditEntry{Actor: "99999", Action: CommandResolve, Target: target})
+	}
+
+	get := func(key, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/chat/audit"+query, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		chat.HandleAudit(rec, req)
+		return rec
+	}
+
+	if rec := get(RADIOChatKey, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with the radio key, got %d", rec.Code)
+	}
+	rec := get("admin", "?offset=1&limit=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var page AuditResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if page.Total != 3 || len(page.Entries) != 1 || page.Entries[0].Target != "2" {
+		t.Fatalf("expected second newest entry, got: %+v", page)
+	}
+}
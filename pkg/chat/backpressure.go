@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// dropOnBackpressure drops chat messages for websocket clients whose send
+// queue is full, instead of disconnecting them.
+var dropOnBackpressure = Bool("RADIO_DROP_ON_BACKPRESSURE", false)
+
+// sendQueueWait is how long a client's full send queue may stay full before
+// the client is disconnected, like the write it replaced. The sender does not
+// wait, the messages are set aside meanwhile. Negative, the default, waits for
+// the write wait of the client's role, 0 not at all.
+var sendQueueWait = Duration("RADIO_SEND_QUEUE_WAIT", -1)
+
+var droppedMessages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "radiogaga_dropped_messages_total",
+	Help: "Chat messages dropped because the recipient's send queue was full.",
+})
+
+// dropIfFull turns a full send queue into a dropped message when the client
+// drops on back-pressure, so the sender goes on without disconnecting it.
+func (cl *Client) dropIfFull(err error) error {
+	if err != errSendQueueFull || !cl.dropOnFull {
+		return err
+	}
+	n := cl.droppedMessages.Add(1)
+	droppedMessages.Inc()
+	cl.log.Debug().Uint64("dropped", n).Msg("send queue full, dropping message")
+	return nil
+}
+
+// sendQueueWait returns how long sends to the client wait for room in its
+// queue. Clients dropping on back-pressure never wait.
+func (c *Chat) sendQueueWait(cl *Client) time.Duration {
+	switch {
+	case cl.dropOnFull:
+		return 0
+	case c.queueWait < 0:
+		return cl.timings().writeWait(cl.role)
+	}
+	return c.queueWait
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stalledClient is a websocket user whose writer never runs, as if the
+// connection stopped draining.
+func stalledClient(dropOnFull bool) *Client {
+	return &Client{
+		conn:              &websocket.Conn{},
+		role:              "user",
+		id:                "12345",
+		room:              DefaultRoom,
+		highPriorityQueue: make(chan []byte, highPriorityQueueSize),
+		normalQueue:       make(chan []byte, normalQueueSize),
+		dropOnFull:        dropOnFull,
+	}
+}
+
+func TestDropOnBackpressure(t *testing.T) {
+	chat := New()
+	client := stalledClient(true)
+	chat.register(client)
+	before := readMetric(t, droppedMessages).GetCounter().GetValue()
+
+	for range normalQueueSize + 3 {
+		chat.deliverToUsers(context.Background(), OutgoingMessage{ID: chat.nextMessageID(), Content: "hi", Room: DefaultRoom})
+	}
+	if n := client.droppedMessages.Load(); n != 3 {
+		t.Fatalf("expected 3 dropped messages, got %d", n)
+	}
+	if n := readMetric(t, droppedMessages).GetCounter().GetValue() - before; n != 3 {
+		t.Fatalf("expected the metric to count 3 drops, got %v", n)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected the user to stay connected, have %d users", n)
+	}
+	if info := client.stateInfo(); info.DroppedMessages != 3 {
+		t.Fatalf("expected the state to show the drops, got: %+v", info)
+	}
+}
+
+func TestFullQueueWithoutDropping(t *testing.T) {
+	client := stalledClient(false)
+	for range normalQueueSize {
+		if err := client.send([]byte(`{}`)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := client.send([]byte(`{}`)); err != errSendQueueFull {
+		t.Fatalf("expected a full queue, got: %v", err)
+	}
+	if n := client.droppedMessages.Load(); n != 0 {
+		t.Fatalf("expected nothing counted as dropped, got %d", n)
+	}
+}
+
+func TestFullQueueWaits(t *testing.T) {
+	client := stalledClient(false)
+	client.queueWait = 100 * time.Millisecond
+	conn, peer := wsPair(t)
+	client.conn = conn
+	for range normalQueueSize {
+		if err := client.send([]byte(`{}`)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	// The sender never waits, a writer catching up in time gets the message
+	start := time.Now()
+	if err := client.send([]byte(`"late"`)); err != nil {
+		t.Fatalf("expected the message to be set aside, got: %v", err)
+	}
+	if waited := time.Since(start); waited >= client.queueWait {
+		t.Fatalf("expected the send not to wait, took %v", waited)
+	}
+	for range normalQueueSize {
+		<-client.normalQueue
+	}
+	select {
+	case data := <-client.normalQueue:
+		if string(data) != `"late"` {
+			t.Fatalf("expected the set aside message, got %s", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the set aside message to be queued")
+	}
+
+	// A writer that does not catch up gets the client disconnected
+	start = time.Now()
+	for range normalQueueSize + 1 {
+		if err := client.send([]byte(`{}`)); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := peer.ReadMessage(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	if waited := time.Since(start); waited < client.queueWait {
+		t.Fatalf("expected to wait %v, gave up after %v", client.queueWait, waited)
+	}
+
+	chat := New()
+	chat.queueWait = -1
+	if wait := chat.sendQueueWait(client); wait != client.timings().writeWait("user") {
+		t.Fatalf("expected the write wait by default, got %v", wait)
+	}
+	if wait := chat.sendQueueWait(stalledClient(true)); wait != 0 {
+		t.Fatalf("expected clients dropping messages not to wait, got %v", wait)
+	}
+}
@@ -0,0 +1,217 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+// benchChat registers users and radios backed by drained streams, so
+// deliveries cost what they cost in the chat rather than on the network.
+func benchChat(b *testing.B, users, radios int) *Chat {
+	b.Helper()
+	chat := New()
+	done := make(chan struct{})
+	b.Cleanup(func() { close(done) })
+	add := func(role, id string) {
+		stream := newSSEStream()
+		client := &Client{role: role, id: id, room: DefaultRoom, stream: stream}
+		go func() {
+			for {
+				select {
+				case <-stream.queue:
+				case <-done:
+					return
+				}
+			}
+		}()
+		chat.register(client)
+	}
+	for i := range users {
+		add("user", strconv.Itoa(10000+i))
+	}
+	for i := range radios {
+		add("radio", strconv.Itoa(90000+i))
+	}
+	return chat
+}
+
+// BenchmarkDelivery mixes what a busy show does at once: users writing to the
+// radios, radios replying to single users, announcements to everyone and
+// stats being scraped.
+func BenchmarkDelivery(b *testing.B) {
+	// Measure the chat, not the logger
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+	for _, size := range []struct{ users, radios int }{{100, 2}, {2000, 5}} {
+		b.Run(fmt.Sprintf("users=%d/radios=%d", size.users, size.radios), func(b *testing.B) {
+			chat := benchChat(b, size.users, size.radios)
+			ctx := context.Background()
+			var n atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := n.Add(1)
+					user := strconv.Itoa(10000 + int(i)%size.users)
+					msg := OutgoingMessage{ID: chat.nextMessageID(), SentAt: time.Now(), From: user, Content: "hi", Room: DefaultRoom}
+					switch i % 100 {
+					case 0:
+						msg.Type = MessageTypeSystem
+						chat.deliverToUsers(ctx, msg)
+					case 1:
+						chat.Stats()
+					default:
+						if i%2 == 0 {
+							chat.deliverToRadios(ctx, nil, msg)
+						} else {
+							msg.From, msg.To = "90000", user
+							chat.deliverToUser(ctx, user, msg)
+						}
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkBroadcast delivers announcements to every user, one after the other
+// and through the fan-out workers.
+func BenchmarkBroadcast(b *testing.B) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+	for _, workers := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			chat := benchChat(b, 2000, 0)
+			chat.fanout = newFanoutPool(chat, workers)
+			b.Cleanup(chat.fanout.stop)
+			ctx := context.Background()
+			b.ResetTimer()
+			for range b.N {
+				chat.deliverToUsers(ctx, OutgoingMessage{ID: chat.nextMessageID(), SentAt: time.Now(), Type: MessageTypeSystem, Content: "hi"})
+			}
+		})
+	}
+}
+
+// discardConn returns the server side of a websocket connection whose peer
+// reads and discards every message.
+func discardConn(b *testing.B) *websocket.Conn {
+	conn, peer := wsPair(b)
+	go func() {
+		for {
+			if _, _, err := peer.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return conn
+}
+
+// BenchmarkForwardToRadios sends user messages to 50 radios, through their
+// write pumps.
+func BenchmarkForwardToRadios(b *testing.B) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	defer zerolog.SetGlobalLevel(level)
+	chat := New()
+	radios := make([]*Client, 50)
+	for i := range radios {
+		radios[i] = &Client{conn: discardConn(b), role: "radio", id: strconv.Itoa(90000 + i), room: DefaultRoom}
+		radios[i].startWriter()
+		chat.register(radios[i])
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		chat.forwardToRadios(ctx, OutgoingMessage{ID: chat.nextMessageID(), SentAt: time.Now(), From: "12345", Content: "Can you play Bohemian Rhapsody?", Room: DefaultRoom})
+		// Keep the queues from overflowing
+		for _, r := range radios {
+			for len(r.normalQueue) > normalQueueSize/2 {
+				runtime.Gosched()
+			}
+		}
+	}
+	b.StopTimer()
+	for _, r := range radios {
+		r.stopWriter()
+	}
+}
+
+// BenchmarkVerifyToken verifies the token of 1000 connections sharing it, with
+// and without the token cache.
+func BenchmarkVerifyToken(b *testing.B) {
+	GEWISSecret = "testsecret"
+	tok := makeToken(b, GEWISSecret, 12345, "Alice", "User", time.Hour)
+	for _, ttl := range []time.Duration{0, 30 * time.Second} {
+		name := "uncached"
+		if ttl > 0 {
+			name = "cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			chat := New()
+			chat.tokenCache.ttl = ttl
+			b.ReportAllocs()
+			for range b.N {
+				for range 1000 {
+					if _, err := chat.verifyGEWISTokenHandshake(tok); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDispatchTraceLogging forwards user messages to a radio and radio
+// replies to a user at trace level, logging to a file every message-level
+// event or one in 100 with LOG_MESSAGE_SAMPLE.
+func BenchmarkDispatchTraceLogging(b *testing.B) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	defer zerolog.SetGlobalLevel(level)
+	for _, n := range []int{1, 100} {
+		name := "unsampled"
+		if n > 1 {
+			name = "sampled"
+		}
+		b.Run(name, func(b *testing.B) {
+			logFile, err := os.Create(filepath.Join(b.TempDir(), "chat.log"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer logFile.Close()
+			chat := New(WithLogger(zerolog.New(logFile).Level(zerolog.TraceLevel)), WithMessageLogSample(n))
+			radio := &Client{conn: discardConn(b), role: "radio", id: "99999", room: DefaultRoom, log: zerolog.Nop(), trace: zerolog.Nop()}
+			user := &Client{conn: discardConn(b), role: "user", id: "12345", room: DefaultRoom, log: zerolog.Nop(), trace: zerolog.Nop()}
+			for _, cl := range []*Client{radio, user} {
+				cl.startWriter()
+				chat.register(cl)
+			}
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				chat.forwardToRadios(ctx, OutgoingMessage{ID: chat.nextMessageID(), SentAt: time.Now(), From: "12345", Content: "Can you play Bohemian Rhapsody?", Room: DefaultRoom})
+				chat.forwardToUser(ctx, "12345", OutgoingMessage{ID: chat.nextMessageID(), SentAt: time.Now(), From: "99999", To: "12345", Content: "Coming up next", Room: DefaultRoom})
+				for len(radio.normalQueue) > normalQueueSize/2 || len(user.normalQueue) > normalQueueSize/2 {
+					runtime.Gosched()
+				}
+			}
+			b.StopTimer()
+			radio.stopWriter()
+			user.stopWriter()
+		})
+	}
+}
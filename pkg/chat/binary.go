@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// binaryProtocol sends every websocket client MessagePack in binary frames
+// instead of JSON in text frames.
+var binaryProtocol = Bool("RADIO_BINARY_PROTOCOL", false)
+
+// binaryFrameLimit is how many binary frames a client that gets JSON may send
+// before it is disconnected.
+var binaryFrameLimit = Int("RADIO_BINARY_FRAME_LIMIT", 3)
+
+var ErrBinaryFrame = errors.New("binary frames are not supported, send JSON in text frames")
+
+// BinarySubprotocol always gets binary frames, when listed in
+// RADIO_WS_SUBPROTOCOLS.
+const BinarySubprotocol = "radiogaga.v2"
+
+// binaryFor reports whether a client that negotiated the subprotocol gets
+// binary frames.
+func (c *Chat) binaryFor(protocol string) bool {
+	return c.binary || protocol == BinarySubprotocol
+}
+
+// decodeFrame decodes a frame read from a client. Binary frames are
+// MessagePack, text frames JSON. Clients that get JSON may only send text, see
+// rejectBinary.
+func decodeFrame(messageType int, data []byte, in *IncomingMessage) error {
+	if messageType != websocket.BinaryMessage {
+		return json.Unmarshal(data, in)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(in)
+}
+
+// rejectBinary answers a binary frame from a client that gets JSON with an
+// error, and closes the connection with 1003 once it sent binaryFrameLimit of
+// them. Only called from the read loop.
+func (c *Chat) rejectBinary(client *Client) {
+	client.binaryFrames++
+	c.emitError(client.info(), ErrBinaryFrame)
+	if client.binaryFrames < c.binaryFrameLimit {
+		client.log.Warn().Int("frames", client.binaryFrames).Msg("rejecting binary frame")
+		c.sendNotice(client, MessageTypeError, ErrBinaryFrame.Error())
+		return
+	}
+	client.log.Warn().Int("frames", client.binaryFrames).Msg("closing connection: binary frames")
+	client.closeWith(websocket.CloseUnsupportedData, "binary frames are not supported")
+}
+
+// marshalBinary encodes the message as MessagePack, with the same field names
+// as the JSON encoding in the style.
+func marshalBinary(msg OutgoingMessage, style JSONStyle) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(style.styled(msg)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendEncoded returns the send function for a message delivered to the
+// recipients. Those getting binary frames are sent the message encoded as
+// MessagePack, once for all of them, instead of the JSON in data.
+func (c *Chat) sendEncoded(msg OutgoingMessage, recipients []*Client) func(*Client, []byte) error {
+	send := sendFunc(msg)
+	if !slices.ContainsFunc(recipients, func(cl *Client) bool { return cl.binary }) {
+		return send
+	}
+	encoded, err := marshalBinary(msg, c.style)
+	if err != nil {
+		// The writer tries again with the JSON
+		c.log.Warn().Err(err).Str("id", msg.ID).Msg("could not encode binary frame")
+		return send
+	}
+	return func(cl *Client, data []byte) error {
+		if cl.binary {
+			return send(cl, encoded)
+		}
+		return send(cl, data)
+	}
+}
+
+// stampBinary is stamp for a message encoded as MessagePack, adding seq as
+// the first entry of its map. Anything else is returned as is.
+func (cl *Client) stampBinary(buf *bytes.Buffer, data []byte) []byte {
+	var n int
+	var rest []byte
+	switch {
+	case len(data) >= 1 && data[0]&0xf0 == 0x80: // fixmap
+		n, rest = int(data[0]&0x0f), data[1:]
+	case len(data) >= 3 && data[0] == 0xde: // map 16
+		n, rest = int(binary.BigEndian.Uint16(data[1:])), data[3:]
+	case len(data) >= 5 && data[0] == 0xdf: // map 32
+		n, rest = int(binary.BigEndian.Uint32(data[1:])), data[5:]
+	default:
+		return data
+	}
+	buf.Reset()
+	buf.Grow(len(data) + 16)
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(buf)
+	_ = enc.EncodeMapLen(n + 1)
+	_ = enc.EncodeString("seq")
+	_ = enc.EncodeUint(cl.seq.Add(1))
+	buf.Write(rest)
+	return buf.Bytes()
+}
+
+// encodeBinary converts a queued JSON message to MessagePack. Messages to a
+// single client, such as notices and replays, are queued as JSON and
+// converted when written. Deliveries encode once for all recipients, see
+// sendEncoded.
+func encodeBinary(data []byte, style JSONStyle) ([]byte, error) {
+	msg, err := style.unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return marshalBinary(msg, style)
+}
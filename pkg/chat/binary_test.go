@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func unmarshalBinary(t *testing.T, data []byte) OutgoingMessage {
+	t.Helper()
+	var out OutgoingMessage
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&out); err != nil {
+		t.Fatalf("decode msgpack: %v", err)
+	}
+	return out
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	msg := OutgoingMessage{
+		ID:         "00065df3140a7172",
+		SentAt:     time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Type:       MessageTypePollUpdate,
+		From:       "99999",
+		GivenName:  "Bob",
+		FamilyName: "Radio",
+		To:         "12345",
+		Content:    "Coming up next 🎶",
+		Room:       DefaultRoom,
+		PollID:     "p1",
+		Options:    []string{"yes", "no"},
+		Tally:      []int{3, 1},
+		Radio:      &RadioInfo{Title: "Bohemian Rhapsody", Artist: "Queen"},
+		SeqNum:     7,
+	}
+	data, _ := json.Marshal(msg)
+	encoded, err := encodeBinary(data, JSONSnakeCase)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(encoded) >= len(data) {
+		t.Errorf("expected MessagePack to be smaller than JSON, got %d >= %d bytes", len(encoded), len(data))
+	}
+	got := unmarshalBinary(t, encoded)
+	if !got.SentAt.Equal(msg.SentAt) {
+		t.Fatalf("expected sentAt %v, got %v", msg.SentAt, got.SentAt)
+	}
+	got.SentAt = msg.SentAt
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("round trip changed the message:\n got: %+v\nwant: %+v", got, msg)
+	}
+}
+
+func TestStampBinary(t *testing.T) {
+	msg := OutgoingMessage{ID: "00065df3140a7172", Type: MessageTypeChat, From: "12345", Content: "hi", Room: DefaultRoom}
+	// The full message is a fixmap of 15 entries, which seq turns into a map 16
+	full := msg
+	full.GivenName, full.FamilyName, full.DisplayName, full.Email = "Alice", "User", "Alice User", "alice@example.com"
+	full.To, full.InReplyTo, full.Title, full.Artist = "99999", "q1", "Radio Ga Ga", "Queen"
+	for _, msg := range []OutgoingMessage{msg, full} {
+		encoded, err := marshalBinary(msg, JSONSnakeCase)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		cl := &Client{}
+		for seq := uint64(1); seq <= 2; seq++ {
+			var buf bytes.Buffer
+			got := unmarshalBinary(t, cl.stampBinary(&buf, encoded))
+			want := msg
+			want.SeqNum = seq
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("stamping changed the message:\n got: %+v\nwant: %+v", got, want)
+			}
+		}
+	}
+}
+
+func readBinary(t *testing.T, conn *websocket.Conn) OutgoingMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage {
+		t.Fatalf("expected a binary frame, got type %d (%v)", messageType, err)
+	}
+	return unmarshalBinary(t, data)
+}
+
+func writeBinary(t *testing.T, conn *websocket.Conn, in IncomingMessage) {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(in); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, buf.Bytes()); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestBinarySubprotocol(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.upgrader.Subprotocols = []string{BinarySubprotocol, "radiogaga.v1"}
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	user, _, err := dialSubprotocols(wsBase, BinarySubprotocol)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer user.Close()
+	writeBinary(t, user, IncomingMessage{Token: makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)})
+	if welcome := readBinary(t, user); welcome.Type != MessageTypeWelcome || welcome.SeqNum != 1 {
+		t.Fatalf("expected a binary welcome with seq 1, got: %+v", welcome)
+	}
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, 1)
+
+	// Binary and JSON clients talk to each other
+	writeBinary(t, user, IncomingMessage{Content: "Can you play Bohemian Rhapsody?"})
+	expectContent(t, radio, "Can you play Bohemian Rhapsody?")
+	replyToUser(t, radio, "12345", "Coming up next")
+	if reply := readBinary(t, user); reply.Content != "Coming up next" || reply.From != "99999" {
+		t.Fatalf("expected the reply, got: %+v", reply)
+	}
+}
+
+func TestRejectBinaryFrames(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.binaryFrameLimit = 2
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+
+	writeBinary(t, user, IncomingMessage{Content: "hi"})
+	notice, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || notice.Type != MessageTypeError || notice.Content != ErrBinaryFrame.Error() {
+		t.Fatalf("expected an error for the binary frame, got: %+v (%v)", notice, err)
+	}
+
+	// Text frames still work in between
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypePing}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	writeBinary(t, user, IncomingMessage{Content: "hi"})
+	_ = user.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = user.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseUnsupportedData) {
+		t.Fatalf("expected close 1003 after the second binary frame, got: %v", err)
+	}
+}
+
+func TestRejectBinaryHandshake(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user, _, err := dialSubprotocols(wsBase)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer user.Close()
+	writeBinary(t, user, IncomingMessage{Token: makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)})
+	_ = user.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = user.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseUnsupportedData) {
+		t.Fatalf("expected close 1003 for a binary handshake, got: %v", err)
+	}
+}
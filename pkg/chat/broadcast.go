@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrUserNotConnected = errors.New("user not connected")
+
+type BroadcastRequest struct {
+	Content string `json:"content" description:"Message body"`
+	To      string `json:"to,omitempty" description:"Target lidnr, omit to broadcast to all users"`
+}
+
+// Broadcast delivers a system message to all users in every room, or to a
+// single user when to is set. Radios receive a copy so staff can see what was
+// sent. The message passes the MessageTypeSystem hooks and the message hook
+// like any other, with a sender of role "system"; content filters only apply
+// to users and are skipped.
+func (c *Chat) Broadcast(ctx context.Context, to, content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("broadcast requires content")
+	}
+	sender := c.systemClient()
+	in := IncomingMessage{Type: MessageTypeSystem, To: to, Content: content}
+	if !c.runHooks(ctx, sender, in) {
+		c.log.Debug().Str("type", in.Type).Msg("broadcast cancelled by hook")
+		return nil
+	}
+	out, err := c.hookMessage(sender, OutgoingMessage{Type: in.Type, To: to, Content: content})
+	if err != nil {
+		return err
+	}
+	if out.To != "" && !c.userReachable(out.To) {
+		return ErrUserNotConnected
+	}
+
+	c.order.Lock()
+	defer c.order.Unlock()
+	out.ID, out.SentAt = c.nextMessageID(), time.Now()
+	if out.To == "" {
+		c.forwardToUsers(ctx, out)
+	} else if !c.forwardToUser(ctx, out.To, out) {
+		return ErrUserNotConnected
+	}
+
+	c.record("", out)
+	c.emitMessage(out)
+	c.forwardToRadios(ctx, out)
+	return nil
+}
+
+// systemClient is the sender hooks see for messages the server sends on its
+// own, such as broadcasts.
+func (c *Chat) systemClient() *Client {
+	return &Client{role: "system", id: ActorRadioKey, log: c.log, trace: c.traceLog}
+}
+
+// HandleBroadcast lets automation push system messages without a websocket.
+// Requests are authenticated with the radio chat key.
+func (c *Chat) HandleBroadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.radioKeyAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing radio key")
+		return
+	}
+
+	var req BroadcastRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	err := c.Broadcast(r.Context(), req.To, req.Content)
+	switch {
+	case errors.Is(err, ErrUserNotConnected):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		target := req.To
+		if target == "" {
+			target = "all"
+		}
+		c.audit(ActorRadioKey, "broadcast", target, map[string]string{"content": req.Content})
+		writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+	}
+}
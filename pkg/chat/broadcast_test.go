@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func postBroadcast(t *testing.T, chat *Chat, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/broadcast", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	chat.HandleBroadcast(rec, req)
+	return rec
+}
+
+func TestBroadcastToAllUsers(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	alice := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer alice.Close()
+	carol := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute), "")
+	defer carol.Close()
+	waitForUsers(t, chat, 2)
+
+	rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"Team 42 has passed checkpoint 7"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for name, conn := range map[string]*websocket.Conn{"alice": alice, "carol": carol} {
+		out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+		if err != nil {
+			t.Fatalf("%s read: %v", name, err)
+		}
+		if out.Type != MessageTypeSystem || out.Content != "Team 42 has passed checkpoint 7" {
+			t.Fatalf("unexpected message for %s: %+v", name, out)
+		}
+	}
+}
+
+func TestBroadcastToSingleUser(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+
+	rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"you are up next","to":"12345"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if out.To != "12345" || out.Content != "you are up next" {
+		t.Fatalf("unexpected message: %+v", out)
+	}
+}
+
+func TestBroadcastOfflineTarget(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"hello","to":"12345"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "user not connected") {
+		t.Fatalf("expected json error body, got: %s", rec.Body)
+	}
+}
+
+func TestBroadcastRequiresKey(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	if rec := postBroadcast(t, chat, "", `{"content":"hello"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without key, got %d", rec.Code)
+	}
+	if rec := postBroadcast(t, chat, "wrong", `{"content":"hello"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong key, got %d", rec.Code)
+	}
+}
+
+func TestBroadcastRunsHooks(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	var seen []IncomingMessage
+	chat.OnMessageType(MessageTypeSystem, func(ctx context.Context, client *Client, in IncomingMessage) {
+		if client.role != "system" {
+			t.Errorf("expected a system sender, got %q", client.role)
+		}
+		seen = append(seen, in)
+		if in.Content == "secret" {
+			CancelDelivery(ctx)
+		}
+	})
+
+	if rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"hello"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"secret"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(seen) != 2 || seen[0].Content != "hello" || seen[1].Content != "secret" {
+		t.Fatalf("expected the hook to see both broadcasts, got %+v", seen)
+	}
+	if n := len(chat.history.Since("", 10, func(string, OutgoingMessage) bool { return true })); n != 1 {
+		t.Fatalf("expected only the first broadcast in history, got %d", n)
+	}
+}
@@ -0,0 +1,1340 @@
+// Package chat relays questions from GEWIS members to the radio over
+// websockets. Members connect as users with a GEWIS token, the radio connects
+// with a token and a radio key, and admins use the REST API served by
+// Chat.Handler. Every Chat is independent, see New and its options.
+package chat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errNoTransport = errors.New("client has no open connection")
+
+// transport carries messages to a client connected other than over a
+// websocket, such as a server-sent events stream. The handler owning it
+// writes what is sent.
+type transport interface {
+	send(data []byte) error
+	close(code int, reason string)
+	kind() string // as ClientInfo.Transport
+}
+
+// Client is a user, radio or guest connected to a Chat.
+type Client struct {
+	conn         *websocket.Conn
+	role         string
+	id           string // lidnr as string
+	givenName    string
+	familyName   string
+	email        string // from the token, only sent with RADIO_INCLUDE_EMAIL
+	room         string
+	protocol     string         // negotiated websocket subprotocol, empty if none
+	binary       bool           // written MessagePack in binary frames, see binaryFor
+	style        JSONStyle      // of the messages queued, for binary
+	ws           *WSConfig      // timings of the chat, see timings
+	compressed   bool           // permessage-deflate was negotiated, see setupCompression
+	binaryFrames int            // binary frames received while getting JSON, see rejectBinary
+	log          zerolog.Logger // carries request ID, conn_id, role and lidnr, see setLogger
+	trace        zerolog.Logger // sampled, for per-message logs
+	stream       transport      // set instead of conn for server-sent events, neither for one-off HTTP requests
+	upgrade      trace.Link     // span of the request that opened the connection
+	connID       string         // websocket connections only, see newConnID
+
+	clientVersion  string // from the handshake, for support
+	clientPlatform string // from the handshake, for support
+	userAgent      string // of the upgrade request
+
+	recentMsgIDs *lru.Cache[string, struct{}] // last client message IDs, see duplicate
+	recentSends  *recentSends                 // last user messages, see resent
+	idle         *time.Timer                  // closes idle users, see touch
+	resumeToken  string                       // users only, see park
+	idleTimeout  time.Duration
+	running      *sync.WaitGroup // goroutines of the connection, see spawn
+
+	tokenMu        sync.Mutex
+	token          string    // last verified GEWIS token, see revalidateToken
+	tokenExpiresAt time.Time // exp claim of token, zero if none
+
+	// Websocket writes go through these queues, see writePump
+	highPriorityQueue chan []byte
+	normalQueue       chan []byte
+	dropOnFull        bool          // full normalQueue drops the message, see dropIfFull
+	queueWait         time.Duration // how long a full queue is waited on, see enqueue
+	overflowMu        sync.Mutex
+	overflow          []overflowed  // messages waiting for room in a full queue, see drainOverflow
+	draining          bool          // drainOverflow is running
+	droppedMessages   atomic.Uint64 // messages dropped by dropIfFull
+	done              chan struct{}
+	flushed           chan struct{}
+	stopOnce          sync.Once
+	writeMu           sync.Mutex
+	seq               atomic.Uint64 // last sequence number written, see stamp
+
+	pingTime atomic.Int64 // unix nanoseconds the last unanswered ping was sent, 0 if answered
+	lastRTT  atomic.Int64 // nanoseconds between the last ping and its pong
+
+	closedByServer atomic.Bool // set by closeWith, such sessions are not parked
+
+	ackMu      sync.Mutex
+	ackPending map[string]pendingAck // message ID -> unacked message, nil unless RADIO_ACK_MODE
+}
+
+// send queues an encoded message on the client's transport.
+func (cl *Client) send(data []byte) error {
+	if cl.stream != nil {
+		return cl.stream.send(data)
+	}
+	if cl.conn == nil {
+		return errNoTransport
+	}
+	return cl.dropIfFull(cl.enqueue(cl.normalQueue, data))
+}
+
+// sendHighPriority queues a system-originated message ahead of chat messages
+// that have not been written yet.
+func (cl *Client) sendHighPriority(data []byte) error {
+	if cl.stream != nil {
+		return cl.stream.send(data)
+	}
+	if cl.conn == nil {
+		return errNoTransport
+	}
+	return cl.enqueue(cl.highPriorityQueue, data)
+}
+
+// closeWith tells the client why it is being disconnected and closes the
+// transport.
+func (cl *Client) closeWith(code int, reason string) {
+	cl.closedByServer.Store(true)
+	if cl.stream != nil {
+		cl.stream.close(code, reason)
+		return
+	}
+	if cl.conn == nil {
+		return
+	}
+	// Let the writer flush what was sent before the close frame
+	cl.stopWriter()
+	select {
+	case <-cl.flushed:
+	case <-time.After(cl.timings().CloseTimeout):
+	}
+	_ = cl.writeControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		cl.timings().CloseTimeout,
+	)
+	_ = cl.conn.Close()
+}
+
+// terminate closes the transport without notifying the client, used after
+// write failures.
+func (cl *Client) terminate() {
+	if cl.stream != nil {
+		cl.stream.close(websocket.CloseAbnormalClosure, "write failed")
+		return
+	}
+	if cl.conn != nil {
+		_ = cl.conn.Close()
+	}
+}
+
+func (cl *Client) writeControl(mt int, data []byte, deadline time.Duration) error {
+	cl.writeMu.Lock()
+	defer cl.writeMu.Unlock()
+	return cl.conn.WriteControl(mt, data, time.Now().Add(deadline))
+}
+
+// Application close codes, sent with CloseReason as the close message text.
+const (
+	CloseCodeReplaced         = 4100
+	CloseCodeInvalidRadioKey  = 4103
+	CloseCodeRejected         = 4400 // by the connect hook, see RejectError
+	CloseCodeTokenExpired     = 4401
+	CloseCodeTokenNotAccepted = 4402
+	CloseCodeBanned           = 4403
+	CloseCodeRoomClosed       = 4404
+	CloseCodeSessionExpired   = 4408
+	CloseCodeMessageTooLarge  = 4413
+	CloseCodeRateLimited      = 4429
+)
+
+// CloseReason returns the human-readable reason for an application close code,
+// or an empty string for other codes.
+func CloseReason(code int) string {
+	switch code {
+	case CloseCodeReplaced:
+		return "replaced by new connection"
+	case CloseCodeInvalidRadioKey:
+		return "invalid radio key"
+	case CloseCodeRejected:
+		return "connection rejected"
+	case CloseCodeTokenExpired:
+		return "token expired"
+	case CloseCodeTokenNotAccepted:
+		return "token not accepted"
+	case CloseCodeBanned:
+		return "banned"
+	case CloseCodeRoomClosed:
+		return "room closed"
+	case CloseCodeSessionExpired:
+		return "session expired"
+	case CloseCodeMessageTooLarge:
+		return "message too large"
+	case CloseCodeRateLimited:
+		return "rate limited"
+	}
+	return ""
+}
+
+// IncomingMessage is a frame sent by a client, the first one carrying the
+// handshake.
+type IncomingMessage struct {
+	Type     string `json:"type,omitempty" description:"Message type, defaults to chat"`
+	Cmd      string `json:"cmd,omitempty"`   // radio command, see commands.go
+	Token    string `json:"token,omitempty"` // handshake and type=token_refresh only
+	To       string `json:"to,omitempty"`    // target user id when role=radio
+	Content  string `json:"content" description:"Message body"`
+	RadioKey string `json:"radioKey,omitempty"` // required in handshake when role=radio
+
+	MessageID string `json:"messageId,omitempty"` // message reacted to, retracted or resolved
+	Emoji     string `json:"emoji,omitempty"`     // reaction, see reactionEmoji
+	InReplyTo string `json:"inReplyTo,omitempty"` // user message a radio reply answers
+
+	Question    string   `json:"question,omitempty"`    // when type=poll, defaults to content
+	Options     []string `json:"options,omitempty"`     // when type=poll
+	PollOptions []string `json:"pollOptions,omitempty"` // starts a poll asking content, see startPoll
+	PollID      string   `json:"pollId,omitempty"`      // when type=vote or cmd=closepoll
+	Option      *int     `json:"option,omitempty"`      // index into options when type=vote
+
+	ClientMsgID string `json:"clientMsgId,omitempty"` // optional, resent messages with the same ID are dropped
+
+	LastSeenMessageID string `json:"lastSeenMessageId,omitempty"` // handshake only, replays what a user missed
+	ResumeToken       string `json:"resumeToken,omitempty"`       // handshake only, from the welcome frame of a dropped session
+	ClientVersion     string `json:"clientVersion,omitempty"`     // handshake only, for support
+	ClientPlatform    string `json:"clientPlatform,omitempty"`    // handshake only, for support
+
+	AckID string `json:"ack_id,omitempty"` // when type=ack, the message acknowledged
+}
+
+// OutgoingMessage is a message written to clients, stored and published.
+type OutgoingMessage struct {
+	ID          string     `json:"id,omitempty" description:"Server assigned, sortable message ID"`
+	SentAt      time.Time  `json:"sentAt,omitzero"`
+	Type        string     `json:"type,omitempty" description:"Message type"`
+	From        string     `json:"from" description:"Sender lidnr"`
+	GivenName   string     `json:"given_name,omitempty" description:"Sender given name"`
+	FamilyName  string     `json:"family_name,omitempty" description:"Sender family name"`
+	DisplayName string     `json:"display_name,omitempty" description:"Sender name as configured by RADIO_DISPLAY_NAME_FORMAT"`
+	Email       string     `json:"email,omitempty" description:"Sender email, only with RADIO_INCLUDE_EMAIL"`
+	To          string     `json:"to,omitempty" description:"Target lidnr"`
+	Content     string     `json:"content" description:"Message body"`
+	Pinned      bool       `json:"pinned,omitempty"`
+	Room        string     `json:"room,omitempty" description:"Room the message was sent in, omitted for every room"`
+	MessageID   string     `json:"messageId,omitempty"`
+	Emoji       string     `json:"emoji,omitempty"`
+	InReplyTo   string     `json:"inReplyTo,omitempty" description:"ID of the user message a radio reply answers"`
+	Answered    bool       `json:"answered,omitempty" description:"A radio replied to or resolved this user message"`
+	PollID      string     `json:"pollId,omitempty"`
+	Question    string     `json:"question,omitempty"`
+	Options     []string   `json:"options,omitempty"`
+	Tally       []int      `json:"tally,omitempty" description:"Votes per option"`
+	Closed      bool       `json:"closed,omitempty"`
+	Title       string     `json:"title,omitempty"`  // when type=radio_update
+	Artist      string     `json:"artist,omitempty"` // when type=radio_update
+	Radio       *RadioInfo `json:"radio,omitempty"`  // when type=radio_update
+	EndsAt      time.Time  `json:"endsAt,omitzero"`  // when type=countdown_start
+
+	ClientMsgID  string   `json:"clientMsgId,omitempty"`  // when type=ack
+	ResumeToken  string   `json:"resumeToken,omitempty"`  // when type=welcome
+	Resumed      bool     `json:"resumed,omitempty"`      // when type=welcome
+	Capabilities []string `json:"capabilities,omitempty"` // when type=welcome
+	AckRequired  bool     `json:"ackRequired,omitempty"`  // reply with type=ack, see RADIO_ACK_MODE
+
+	Replayed bool   `json:"replayed,omitempty"` // resent after a reconnect, see replayMissed
+	SeqNum   uint64 `json:"seq,omitempty" description:"Per connection, consecutive, set when written"`
+}
+
+// GEWISClaims are the claims of a GEWIS token.
+type GEWISClaims struct {
+	Lidnr      int      `json:"lidnr"`
+	GivenName  string   `json:"given_name"`
+	FamilyName string   `json:"family_name"`
+	Email      string   `json:"email,omitempty"`
+	Roles      []string `json:"roles,omitempty"` // see RADIO_ALLOWED_ROLES
+	jwt.RegisteredClaims
+}
+
+// The secrets a Chat uses unless configured otherwise, see WithSecret,
+// WithRadioKey and WithAdminKey. New copies them.
+var (
+	GEWISSecret  = envOr("GEWIS_SECRET", "ChangeMe")
+	RADIOChatKey = envOr("RADIO_CHAT_KEY", "ChangeMe")
+	// RADIOAdminKey authorizes the admin endpoints, which are disabled without it
+	RADIOAdminKey = envOr("RADIO_ADMIN_KEY", "")
+	allowUserDM   = Bool("RADIO_ALLOW_USER_DM", false)
+	// includeEmail adds the sender's email to messages, off by default as
+	// emails are personal data
+	includeEmail = Bool("RADIO_INCLUDE_EMAIL", false)
+)
+
+func envOr(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
+
+// Chat relays messages between the clients connected to it. Create it with
+// New.
+type Chat struct {
+	upgrader websocket.Upgrader
+
+	// mutex guards the rooms and what depends on their members: userRadio,
+	// parked, roomList. Deliveries only read-lock it.
+	mutex            sync.RWMutex
+	order            sync.Mutex                  // held from nextMessageID until the message is queued locally and for peers
+	fanout           *fanoutPool                 // delivers room-wide messages, see RADIO_FANOUT_WORKERS
+	draining         atomic.Bool                 // set by Shutdown, new connections are refused
+	drain            time.Duration               // see RADIO_SHUTDOWN_DRAIN
+	admitMu          sync.Mutex                  // guards admitted and closed, see admit
+	admitted         map[*Client]struct{}        // websocket connections until handleClient returns
+	closed           bool                        // set by Shutdown once connections are no longer admitted
+	running          sync.WaitGroup              // goroutines of admitted connections, see Shutdown
+	rooms            map[string]*room            // name -> members, see rooms.go
+	pinMu            sync.Mutex                  // guards pinned
+	pinned           map[string]*OutgoingMessage // room -> announcement sent to every user on connect
+	countdownMu      sync.Mutex                  // guards countdowns
+	countdowns       map[string]*Countdown       // room -> running countdown, see startCountdown
+	userDM           bool                        // users may message each other directly using to
+	tokenExpiry      TokenExpiryMode
+	tokenLeeway      time.Duration             // allowed clock skew when enforcing token expiry
+	revalidate       time.Duration             // how often connected clients' tokens are checked, 0 disables
+	refreshGrace     time.Duration             // how long a client has to refresh an expired token
+	requiredIssuer   string                    // see TOKEN_REQUIRED_ISSUER
+	requiredAudience string                    // see TOKEN_REQUIRED_AUDIENCE
+	jwks             *JWKS                     // keys for RS256 and ES256 tokens, nil accepts HS512 only
+	radioState       *RadioState               // updated with radio info POSTed to peers, see WithRadioState
+	tokenCache       *tokenCache               // verified tokens, see RADIO_JWT_CACHE_TTL
+	radioRoles       []string                  // token roles that may connect as radio without a key
+	replayLimit      int                       // missed messages replayed on reconnect
+	duplicateWindow  time.Duration             // how long resent user messages are acked instead of sent
+	idleTimeout      time.Duration             // see CHAT_IDLE_TIMEOUT
+	resumeGrace      time.Duration             // how long dropped user sessions can be resumed
+	ackMode          bool                      // users acknowledge messages addressed to them
+	ackTimeout       time.Duration             // see RADIO_ACK_TIMEOUT
+	parked           map[string]*parkedSession // room/lidnr -> dropped user session, see park
+	sticky           bool                      // user messages go to a single radio, see forwardFromUser
+	binary           bool                      // all websocket clients get MessagePack, see RADIO_BINARY_PROTOCOL
+	binaryFrameLimit int                       // see RADIO_BINARY_FRAME_LIMIT
+	dropOnFull       bool                      // see RADIO_DROP_ON_BACKPRESSURE
+	queueWait        time.Duration             // see RADIO_SEND_QUEUE_WAIT, negative for the write wait
+	ws               WSConfig                  // websocket timings and buffers
+	userRadio        map[string]*Client        // user id -> sticky radio
+	guestLimit       int                       // concurrent guests, see RADIO_MAX_GUESTS
+	privacy          PrivacyMode               // how members are shown to radios
+	nameFormat       DisplayNameFormat         // see RADIO_DISPLAY_NAME_FORMAT
+	includeEmail     bool                      // see RADIO_INCLUDE_EMAIL
+	roomList         map[string]bool           // rooms that can always be joined, see canJoin
+	closedRooms      map[string]bool           // rooms closed by CloseRoom until added again
+	maxRooms         int                       // see RADIO_MAX_ROOMS
+	autoCreate       bool                      // unlisted rooms can be joined, see RADIO_AUTO_CREATE_ROOMS
+	pseudonyms       *pseudonyms               // handles for PrivacyPseudonym
+
+	secrets   []gewisSecret       // verify HS512 tokens, tried in order
+	radioKey  string              // see RADIO_CHAT_KEY
+	radioKeys map[string]RadioKey // see RADIO_CHAT_KEYS
+	adminKey  string              // authorizes the admin endpoints, empty disables them
+	style     JSONStyle           // of messages to clients, see RADIO_JSON_STYLE
+	log       zerolog.Logger      // for what is not tied to a request or client
+
+	onConnect    ConnectFunc    // see WithOnConnect
+	onMessage    MessageFunc    // see WithOnMessage
+	onDisconnect DisconnectFunc // see WithOnDisconnect
+
+	traceLog       zerolog.Logger // sampled log, for message-level logs
+	messageSample  int            // see LOG_MESSAGE_SAMPLE
+	suppressedLogs atomic.Uint64  // message-level events sampled out
+
+	lastMessageID atomic.Uint64
+	messageCount  atomic.Uint64 // IDs handed out by nextMessageID
+	guestCount    atomic.Int64  // connected guests, see reserveGuest
+	peakUsers     atomic.Uint64 // most users connected at once, see countConnection
+	peakRadios    atomic.Uint64 // most radios connected at once
+	connections   atomic.Uint64 // clients registered since startup
+	history       *History
+	webhook       *Webhook
+	auditLog      *AuditLog
+	deadLetters   *DeadLetters
+
+	filters          []contentFilter
+	filteredMessages atomic.Uint64
+	disconnects      disconnectCounts // per reason, see disconnectReason
+
+	instanceID    string
+	backend       PubSubBackend
+	subscriptions []CancelFunc
+	publishQueue  chan publication // messages for peers, in order, see publish
+	publishStop   chan struct{}    // closed by stopPublishing
+	publishDone   chan struct{}    // closed once publishLoop returned
+	stopPublish   sync.Once
+	owners        UserOwnership   // set if the backend records user ownership, see ownsUser
+	ownerMu       sync.RWMutex    // guards lostUsers
+	lostUsers     map[string]bool // local users another instance owns, see refreshOwnership
+	store         MessageStore    // see UseStore
+	storeQueue    chan storeOp    // writes to store, in order
+	storeDone     chan struct{}   // closed once storeQueue is drained
+	storeMu       sync.RWMutex    // held for reading while writes are queued, see CloseStore
+	storeClosed   bool
+	ownerTTL      time.Duration // see RADIO_OWNER_TTL
+
+	typesMu sync.RWMutex
+	types   MessageTypeRegistry
+	hooks   map[string][]MessageHook
+
+	listeners []EventListener
+	tracer    trace.Tracer
+	reporter  ErrorReporter
+	polls     pollState
+
+	pollMu      sync.Mutex
+	pollWaiters map[string]map[string]chan OutgoingMessage // room -> lidnr -> long poll, see HandleLongPoll
+	pollTimeout time.Duration                              // see RADIO_POLL_TIMEOUT
+}
+
+// New creates a chat configured from the environment, overridden by the
+// options.
+func New(opts ...Option) *Chat {
+	c := &Chat{
+		upgrader: websocket.Upgrader{
+			CheckOrigin:  func(r *http.Request) bool { return true },
+			Subprotocols: wsSubprotocols,
+		},
+		rooms:            make(map[string]*room),
+		pinned:           make(map[string]*OutgoingMessage),
+		countdowns:       make(map[string]*Countdown),
+		userDM:           allowUserDM,
+		tokenExpiry:      TokenExpiryWarn,
+		tokenLeeway:      tokenExpiryLeeway,
+		tokenCache:       &tokenCache{ttl: jwtCacheTTL},
+		revalidate:       tokenRevalidateInterval,
+		requiredIssuer:   tokenRequiredIssuer,
+		requiredAudience: tokenRequiredAudience,
+		radioRoles:       radioAllowedRoles,
+		replayLimit:      maxReplay,
+		messageSample:    messageLogSample,
+		duplicateWindow:  duplicateWindow,
+		idleTimeout:      idleTimeout,
+		pollWaiters:      make(map[string]map[string]chan OutgoingMessage),
+		admitted:         make(map[*Client]struct{}),
+		pollTimeout:      pollTimeout,
+		resumeGrace:      resumeGrace,
+		ackMode:          ackMode,
+		ackTimeout:       ackTimeout,
+		parked:           make(map[string]*parkedSession),
+		refreshGrace:     tokenRefreshGrace,
+		sticky:           stickyRouting,
+		binary:           binaryProtocol,
+		binaryFrameLimit: binaryFrameLimit,
+		dropOnFull:       dropOnBackpressure,
+		queueWait:        sendQueueWait,
+		drain:            shutdownDrain,
+		ws:               wsConfig,
+		guestLimit:       maxGuests,
+		privacy:          PrivacyFull,
+		nameFormat:       defaultNameFormat,
+		includeEmail:     includeEmail,
+		roomList:         maps.Clone(allowedRooms),
+		closedRooms:      make(map[string]bool),
+		maxRooms:         maxRooms,
+		autoCreate:       autoCreateRooms,
+		pseudonyms:       newPseudonyms(),
+		secrets:          defaultSecrets(),
+		radioKey:         RADIOChatKey,
+		radioKeys:        maps.Clone(RADIOChatKeys),
+		adminKey:         RADIOAdminKey,
+		style:            JSONSnakeCase,
+		log:              log.Logger,
+		types:            defaultMessageTypes(),
+		disconnects:      newDisconnectCounts(),
+		hooks:            make(map[string][]MessageHook),
+
+		history:    NewHistory(historySize),
+		instanceID: newInstanceID(),
+		ownerTTL:   ownerTTL,
+		tracer:     otel.Tracer(tracerName),
+		reporter:   nopReporter{},
+	}
+	c.fanout = newFanoutPool(c, fanoutWorkers)
+	c.polls.byID = make(map[string]*poll)
+	c.userRadio = make(map[string]*Client)
+	// Like CHAT_PRIVACY_MODE, an unknown mode refuses startup in main and
+	// fails closed here
+	if mode, err := ParseTokenExpiryMode(tokenValidateExpiry); err == nil {
+		c.tokenExpiry = mode
+	} else {
+		c.tokenExpiry = TokenExpiryEnforce
+		log.Error().Err(err).Msg("invalid TOKEN_VALIDATE_EXPIRY, using enforce")
+	}
+	if f, err := ParseDisplayNameFormat(displayNameFormat); err == nil {
+		c.nameFormat = f
+	} else {
+		log.Error().Err(err).Msg("invalid RADIO_DISPLAY_NAME_FORMAT, using " + defaultDisplayNameFormat)
+	}
+	// main refuses to start with an unknown mode, see CheckEnv. Other users of
+	// the package hide names rather than show them.
+	if mode, err := ParsePrivacyMode(chatPrivacyMode); err == nil {
+		c.privacy = mode
+	} else {
+		c.privacy = PrivacyAnonymous
+		log.Error().Err(err).Msg("invalid CHAT_PRIVACY_MODE, using anonymous")
+	}
+	if style, err := ParseJSONStyle(radioJSONStyle); err == nil {
+		c.style = style
+	} else {
+		log.Warn().Err(err).Msg("invalid RADIO_JSON_STYLE, using snake_case")
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.traceLog = c.log.Sample(countingSampler{messageSampler(c.messageSample), &c.suppressedLogs})
+	c.upgrader.ReadBufferSize = c.ws.ReadBuffer
+	c.upgrader.WriteBufferSize = c.ws.WriteBuffer
+	c.upgrader.EnableCompression = c.ws.EnableCompression
+	return c
+}
+
+// Roles are the values of ?role= on /ws, and of ClientInfo.Role.
+var Roles = []string{"user", "radio", "guest"}
+
+// handshakeDocs documents connecting and the handshake frame.
+const handshakeDocs = "https://github.com/GEWIS/radiogaga#connection-flow"
+
+// upgradeRequired is the answer to a request for /ws that is not a websocket
+// upgrade, such as when opening it in a browser tab.
+type upgradeRequired struct {
+	Error string   `json:"error"`
+	Roles []string `json:"roles"`
+	Docs  string   `json:"docs"`
+}
+
+// writeUpgradeRequired explains that /ws takes websocket connections only.
+func writeUpgradeRequired(w http.ResponseWriter) {
+	w.Header().Set("Upgrade", "websocket")
+	w.Header().Set("Connection", "Upgrade")
+	writeJSON(w, http.StatusUpgradeRequired, upgradeRequired{
+		Error: "this endpoint requires a websocket connection, connect with ws:// or wss:// and ?role=",
+		Roles: Roles,
+		Docs:  handshakeDocs,
+	})
+}
+
+// HandleWS upgrades the request to a websocket and verifies the handshake
+// frame before the client joins its room.
+func (c *Chat) HandleWS(w http.ResponseWriter, r *http.Request) {
+	if c.refuseWhileDraining(w) {
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeUpgradeRequired(w)
+		return
+	}
+	logger := requestLogger(r.Context())
+	role := r.URL.Query().Get("role")
+	if !slices.Contains(Roles, role) {
+		http.Error(w, "missing ?role=user, ?role=radio or ?role=guest", http.StatusBadRequest)
+		return
+	}
+	roomName, err := c.roomFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, tokenProtocol := requestToken(r)
+	requested := slices.DeleteFunc(websocket.Subprotocols(r), func(p string) bool { return p == tokenProtocol })
+	if !supportsSubprotocol(c.upgrader.Subprotocols, requested) {
+		http.Error(w, "unsupported subprotocol", http.StatusBadRequest)
+		return
+	}
+	if role == "guest" {
+		c.acceptGuest(w, r, roomName, requested, tokenProtocol)
+		return
+	}
+
+	// A token in the request is checked before upgrading, so it can be
+	// refused with a plain 401
+	pending := ClientInfo{Role: role, Room: roomName, Transport: "websocket"}
+	var claims *GEWISClaims
+	if token != "" {
+		if claims, err = c.verifyGEWISTokenHandshake(token); err != nil {
+			logger.Warn().Err(err).Msg("rejecting upgrade: invalid token")
+			c.emitError(pending, err)
+			http.Error(w, tokenErrorMessage(err), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	upgrader, header := c.upgraderFor(requested, tokenProtocol)
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		logger.Warn().Err(err).Msg("websocket upgrade failed")
+		return
+	}
+	connID := newConnID()
+	connLog := withConnID(logger, connID)
+	logger = &connLog
+
+	// Without a token in the request, the first message is the handshake
+	var first IncomingMessage
+	handshakeSize := 0
+	radioKey := r.Header.Get(RadioKeyHeader)
+	if claims == nil {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			_ = conn.Close()
+			return
+		}
+		handshakeSize = len(data)
+		if messageType == websocket.BinaryMessage && !c.binaryFor(conn.Subprotocol()) {
+			logger.Warn().Msg("closing connection: binary handshake")
+			c.emitError(pending, ErrBinaryFrame)
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "binary frames are not supported"),
+				time.Now().Add(c.ws.CloseTimeout),
+			)
+			_ = conn.Close()
+			return
+		}
+		if err := decodeFrame(messageType, data, &first); err != nil {
+			logger.Warn().Err(err).Msg("closing connection: invalid frame")
+			c.emitError(pending, err)
+			_ = conn.Close()
+			return
+		}
+
+		// Handshake token verification, expiry depends on TOKEN_VALIDATE_EXPIRY
+		claims, err = c.verifyGEWISTokenHandshake(first.Token)
+		if err != nil {
+			c.emitError(pending, err)
+			code := tokenCloseCode(err)
+			switch {
+			case errors.Is(err, ErrTokenIssuer), errors.Is(err, ErrTokenAudience):
+				logger.Warn().Err(err).Msg("closing connection: token issuer or audience mismatch")
+			case errors.Is(err, ErrTokenLidnr):
+				logger.Warn().Err(err).Msg("closing connection: token without lidnr")
+			default:
+				logger.Warn().Err(err).Msg("closing connection: invalid token at handshake")
+			}
+			if code != 0 {
+				_ = conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(code, CloseReason(code)),
+					time.Now().Add(c.ws.CloseTimeout),
+				)
+			}
+			_ = conn.Close()
+			return
+		}
+		token, radioKey = first.Token, first.RadioKey
+	}
+	pending.ID = strconv.Itoa(claims.Lidnr)
+
+	if role == "radio" {
+		if radioRole, ok := c.radioRole(claims); ok {
+			logger.Info().Str("via", "role").Str("radio_role", radioRole).Msg("radio authorized by token role")
+		} else if keyID, err := c.checkRadioKey(radioKey, time.Now()); err != nil {
+			code := CloseCodeInvalidRadioKey
+			if errors.Is(err, ErrRadioKeyExpired) {
+				code = CloseCodeSessionExpired
+			}
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(code, CloseReason(code)),
+				time.Now().Add(c.ws.CloseTimeout),
+			)
+			logger.Warn().Str("key", keyID).Msgf("closing connection: %v", err)
+			c.emitError(pending, err)
+			_ = conn.Close()
+			return
+		} else {
+			logger.Info().Str("via", "key").Str("key", keyID).Msg("radio authorized by radio key")
+		}
+	}
+
+	pending.GivenName, pending.FamilyName = claims.GivenName, claims.FamilyName
+	if code, reason, err := c.hookConnect(pending); err != nil {
+		_ = conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(c.ws.CloseTimeout),
+		)
+		logger.Warn().Err(err).Msg("closing connection: rejected by connect hook")
+		c.emitError(pending, err)
+		_ = conn.Close()
+		return
+	}
+
+	lid := strconv.Itoa(claims.Lidnr)
+	client := &Client{
+		conn:       conn,
+		role:       role,
+		connID:     connID,
+		id:         lid,
+		givenName:  claims.GivenName,
+		familyName: claims.FamilyName,
+		email:      claims.Email,
+		room:       roomName,
+		protocol:   negotiatedProtocol(conn, tokenProtocol),
+
+		clientVersion:  first.ClientVersion,
+		clientPlatform: first.ClientPlatform,
+		userAgent:      r.UserAgent(),
+
+		recentMsgIDs: newRecentMsgIDs(),
+	}
+	client.binary = c.binaryFor(client.protocol)
+	client.style = c.style
+	client.dropOnFull = c.dropOnFull
+	client.ws = &c.ws
+	client.queueWait = c.sendQueueWait(client)
+	if role == "user" {
+		client.recentSends = newRecentSends()
+	}
+	client.setToken(token, claims)
+	client.setLogger(connLog)
+	if !c.admit(client) {
+		c.refuseShutdown(client)
+		return
+	}
+	c.setupCompression(client, r)
+	client.upgrade = trace.LinkFromContext(r.Context())
+	client.startWriter()
+	client.keepAlive()
+
+	// A resumed session gets what it missed since it dropped
+	var parked *parkedSession
+	lastSeen := first.LastSeenMessageID
+	if role == "user" {
+		if c.resumeGrace > 0 {
+			if parked = c.resume(client, first.ResumeToken); parked != nil {
+				c.restore(client, parked)
+				lastSeen = cmp.Or(lastSeen, parked.lastID)
+			}
+			client.resumeToken = newResumeToken()
+		}
+		c.sendWelcome(client, parked != nil)
+	}
+
+	if role == "user" && c.idleTimeout > 0 {
+		client.startIdleTimer(c.idleTimeout)
+	}
+	if role == "user" && c.ackMode {
+		client.ackPending = make(map[string]pendingAck)
+		client.spawn(func() { c.ackLoop(client) })
+	}
+	// Missed messages go out before any live ones. Holding c.order, every
+	// message is either in the history already or dispatched once the client
+	// is registered, so none falls in between.
+	c.order.Lock()
+	c.replayMissed(client, lastSeen)
+	prev, err := c.addClient(client)
+	c.order.Unlock()
+	if err != nil {
+		client.log.Info().Err(err).Msg("refusing connection")
+		client.stopIdleTimer()
+		client.closeWith(CloseCodeRoomClosed, CloseReason(CloseCodeRoomClosed))
+		c.release(client)
+		return
+	}
+	c.registered(client, prev)
+	if c.revalidate > 0 && c.tokenExpiry == TokenExpiryEnforce {
+		client.spawn(func() { c.revalidateToken(client) })
+	}
+
+	if parked != nil {
+		client.log.Info().Str("room", roomName).Msg("client resumed session")
+	} else {
+		client.log.Info().
+			Str("room", roomName).
+			Str("client_version", client.clientVersion).
+			Str("client_platform", client.clientPlatform).
+			Str("user_agent", client.userAgent).
+			Msg("client connected")
+		c.emitConnect(client.info())
+	}
+
+	if role == "user" {
+		c.sendPinned(client)
+	}
+
+	// Handshake frame should not be broadcast unless it contains data
+	if strings.TrimSpace(first.Content) != "" || strings.TrimSpace(first.To) != "" || first.Cmd != "" {
+		ctx, span := c.traceFrame(client, handshakeSize)
+		if err := c.dispatch(ctx, client, first); err != nil {
+			client.log.Warn().Err(err).Msg("dropping handshake message")
+			c.emitError(client.info(), err)
+			span.RecordError(err)
+		}
+		span.End()
+	}
+
+	// Continue with normal loop
+	go c.handleClient(client)
+}
+
+// keepAlive sets up read deadlines and pong handling and starts the ping
+// loop, so dead peers are detected.
+func (cl *Client) keepAlive() {
+	ws := cl.timings()
+	cl.conn.SetReadDeadline(time.Now().Add(ws.PongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		cl.conn.SetReadDeadline(time.Now().Add(ws.PongWait))
+		if sent := cl.pingTime.Swap(0); sent != 0 {
+			cl.recordRTT(time.Since(time.Unix(0, sent)))
+		}
+		return nil
+	})
+	cl.conn.SetCloseHandler(cl.handleClose)
+
+	cl.spawn(func() {
+		ticker := time.NewTicker(ws.PingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-cl.done:
+				return
+			}
+			cl.pingTime.Store(time.Now().UnixNano())
+			if err := cl.writeControl(websocket.PingMessage, nil, ws.writeWait(cl.role)); err != nil {
+				cl.log.Debug().Err(err).Msg("stopping pings")
+				return
+			}
+			cl.trace.Trace().Msg("ping sent")
+		}
+	})
+}
+
+// register adds the client to its room, replacing any existing session with
+// the same role and lidnr in that room regardless of its transport. The
+// replaced session is closed after releasing the lock, as closing waits for
+// its queue to be flushed.
+func (c *Chat) register(client *Client) error {
+	prev, err := c.addClient(client)
+	if err != nil {
+		return err
+	}
+	c.registered(client, prev)
+	return nil
+}
+
+// addClient adds the client to its room and returns the session it replaced,
+// if any. It fails with ErrRoomClosed if the room was closed since the client
+// was let in.
+func (c *Chat) addClient(client *Client) (prev *Client, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closedRooms[client.room] {
+		return nil, fmt.Errorf("%w: %q", ErrRoomClosed, client.room)
+	}
+	r := c.joinRoom(client.room)
+	switch client.role {
+	case "guest":
+		r.guests[client] = struct{}{}
+	case "user":
+		prev = r.users[client.id]
+		r.users[client.id] = client
+	default:
+		if prev = r.radiosByID[client.id]; prev != nil {
+			r.removeRadio(prev)
+		}
+		r.radios[client] = struct{}{}
+		r.radiosByID[client.id] = client
+	}
+	c.countConnection()
+	return prev, nil
+}
+
+// registered claims a user added by addClient and closes the session it
+// replaced.
+func (c *Chat) registered(client, prev *Client) {
+	if client.role == "user" {
+		c.claimUser(client.id)
+	}
+	if prev != nil {
+		client.log.Warn().Str("role", client.role).Msg("replacing connection: " + CloseReason(CloseCodeReplaced))
+		prev.closeWith(CloseCodeReplaced, CloseReason(CloseCodeReplaced))
+	}
+}
+
+// unregister removes the client, unless it has already been replaced by a
+// newer session.
+func (c *Chat) unregister(client *Client) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.eachRoom(client.room, func(_ string, r *room) {
+		if client.role == "user" {
+			if r.users[client.id] == client {
+				delete(r.users, client.id)
+				delete(c.userRadio, client.id)
+			}
+		} else if client.role == "radio" {
+			r.removeRadio(client)
+		} else if client.role == "guest" {
+			delete(r.guests, client)
+		}
+	})
+	if client.role == "radio" {
+		// Its users fall back to all radios, see stickyRadio
+		maps.DeleteFunc(c.userRadio, func(_ string, radio *Client) bool { return radio == client })
+	}
+}
+
+// handleClient reads from an admitted client until its connection closes.
+func (c *Chat) handleClient(client *Client) {
+	defer c.release(client)
+	defer recoverPanic(c.reporter, client)
+	reason := DisconnectServer
+	var readErr error
+	defer func() {
+		if n, ok := c.disconnects[reason]; ok {
+			n.Add(1)
+		}
+		parked := c.park(client, reason)
+		c.unregister(client)
+		client.stopIdleTimer()
+		client.forgetRTT()
+		client.stopWriter()
+		_ = client.conn.Close()
+		client.log.Info().Str("reason", reason).AnErr("error", readErr).Msg("client disconnected")
+		if client.role == "guest" {
+			c.releaseGuest()
+			return
+		}
+		c.hookDisconnect(client.info(), reason)
+		if !parked {
+			c.emitDisconnect(client.info(), reason)
+		}
+	}()
+
+	for {
+		messageType, data, err := client.conn.ReadMessage()
+		if err != nil {
+			reason, readErr = disconnectReason(client, err), err
+			return
+		}
+		switch messageType {
+		case websocket.TextMessage:
+		case websocket.BinaryMessage:
+			// Only clients that get MessagePack may send it
+			if !client.binary {
+				c.rejectBinary(client)
+				continue
+			}
+		default:
+			continue
+		}
+		ctx, span := c.traceFrame(client, len(data))
+		var in IncomingMessage
+		if err := decodeFrame(messageType, data, &in); err != nil {
+			client.log.Warn().Err(err).Msg("invalid frame")
+			c.emitError(client.info(), err)
+			span.RecordError(err)
+			span.End()
+			continue
+		}
+		// Tokens are only checked at handshake and by revalidateToken
+		if err := c.dispatch(ctx, client, in); err != nil {
+			client.log.Warn().Err(err).Msg("dropping message")
+			c.emitError(client.info(), err)
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
+
+func (c *Chat) dispatch(ctx context.Context, client *Client, in IncomingMessage) error {
+	if client.role == "guest" {
+		return c.rejectGuest(client)
+	}
+	if in.Type != MessageTypePing {
+		client.touch()
+	}
+	if client.role != "user" && client.duplicate(in.ClientMsgID) {
+		client.trace.Trace().Str("client_msg_id", in.ClientMsgID).Msg("dropping duplicate message")
+		return nil
+	}
+	if in.Cmd != "" {
+		return c.handleCommand(ctx, client, in)
+	}
+	if in.Type == "" {
+		in.Type = MessageTypeChat
+		if len(in.PollOptions) > 0 {
+			in.Type = MessageTypePoll
+		}
+	}
+	if err := c.validate(in); err != nil {
+		return err
+	}
+	if c.filtered(client, in) {
+		return ErrMessageBlocked
+	}
+	if !c.runHooks(ctx, client, in) {
+		client.log.Debug().Str("type", in.Type).Msg("delivery cancelled by hook")
+		return nil
+	}
+	switch in.Type {
+	case MessageTypePing:
+		return nil
+	case MessageTypeReaction:
+		return c.react(ctx, client, in)
+	case MessageTypeRetract:
+		return c.retract(ctx, client, in)
+	case MessageTypePoll:
+		return c.startPoll(ctx, client, in)
+	case MessageTypeVote:
+		return c.vote(ctx, client, in)
+	case MessageTypeCountdown:
+		return c.startCountdown(ctx, client, in)
+	case MessageTypeTokenRefresh:
+		return c.refreshToken(client, in)
+	case MessageTypeAck:
+		return c.ack(client, in)
+	}
+	if client.role != "user" {
+		in.To = c.memberID(in.To)
+	}
+	var key string
+	if client.role == "user" && in.Type != MessageTypeTyping {
+		key = resendKey(in)
+		if id, ok := c.resent(client, key); ok {
+			client.log.Debug().Str("message", id).Msg("acking resent message")
+			c.sendAck(client, id, in.ClientMsgID)
+			return nil
+		}
+	}
+
+	out := OutgoingMessage{
+		Type:        in.Type,
+		From:        client.id,
+		GivenName:   client.givenName,
+		FamilyName:  client.familyName,
+		DisplayName: c.displayName(client),
+		To:          in.To,
+		Content:     in.Content,
+		Room:        client.room,
+		InReplyTo:   in.InReplyTo,
+	}
+	if c.includeEmail {
+		out.Email = client.email
+	}
+	out, err := c.hookMessage(client, out)
+	if err != nil {
+		c.sendNotice(client, MessageTypeError, err.Error())
+		return err
+	}
+	dm := c.isDM(client.role, out)
+	if dm && !c.userReachable(out.To) {
+		c.sendNotice(client, MessageTypeError, ErrUserNotConnected.Error())
+		return ErrUserNotConnected
+	}
+
+	// Queue the message before a later ID is assigned, so every recipient
+	// gets messages in ID order
+	c.order.Lock()
+	defer c.order.Unlock()
+	out.ID, out.SentAt = c.nextMessageID(), time.Now()
+	trace.SpanFromContext(ctx).SetAttributes(attrMessageID.String(out.ID))
+	messageContentBytes.Observe(float64(len(in.Content)))
+	if out.Type != MessageTypeTyping {
+		c.record(client.role, out)
+	}
+	c.emitMessage(out)
+
+	if dm {
+		// Direct messages bypass the radios
+		if !c.forwardToUser(ctx, out.To, out) {
+			c.sendNotice(client, MessageTypeError, ErrUserNotConnected.Error())
+			return ErrUserNotConnected
+		}
+		c.rememberSend(client, key, out.ID)
+		return nil
+	}
+	if client.role == "user" {
+		// User messages go to all radios, or the user's radio with sticky routing
+		c.rememberSend(client, key, out.ID)
+		c.forwardFromUser(ctx, out)
+		if c.webhook != nil && out.Type == MessageTypeChat {
+			c.webhook.Enqueue(out)
+		}
+		return nil
+	}
+
+	// Radio messages
+	if out.InReplyTo != "" && !c.markAnswered(client.room, out.InReplyTo) {
+		client.log.Debug().Str("inReplyTo", out.InReplyTo).Msg("reply to unknown question")
+	}
+	if out.To != "" {
+		// Send to the targeted user
+		c.forwardToUser(ctx, out.To, out)
+	}
+
+	// Also mirror to other radios so fellow admins see it
+	c.forwardToOtherRadios(ctx, client, c.hideRecipient(out))
+	return nil
+}
+
+func (c *Chat) forwardToRadios(ctx context.Context, msg OutgoingMessage) {
+	c.traceLog.Trace().Str("user", msg.From).Msg("forwarding message to radios")
+	c.deliverToRadios(ctx, nil, msg)
+	c.publish(subjectRadios, "", msg)
+}
+
+func (c *Chat) forwardToUsers(ctx context.Context, msg OutgoingMessage) {
+	c.deliverToUsers(ctx, msg)
+	c.publish(subjectUsers, "", msg)
+}
+
+func (c *Chat) forwardToOtherRadios(ctx context.Context, sender *Client, msg OutgoingMessage) {
+	sender.trace.Trace().Msg("mirroring message to other radios")
+	c.deliverToRadios(ctx, sender, msg)
+	c.publish(subjectRadios, "", msg)
+}
+
+// forwardToUser delivers the message to a connected or polling user and
+// reports whether the write succeeded. Users connected to a peer instance, or
+// that moved to one, are reached through the pub/sub backend, if configured,
+// which counts as delivered. Callers that report a user not being connected
+// check userReachable first.
+func (c *Chat) forwardToUser(ctx context.Context, userID string, msg OutgoingMessage) bool {
+	c.traceLog.Trace().Str("user", userID).Msg("trying to forward message to user")
+	if c.ownsUser(userID) && c.deliverToUser(ctx, userID, msg) {
+		return true
+	}
+	return c.publish(subjectUsers, userID, msg)
+}
+
+// deliverToRadios writes the message to all local radios in the message's
+// room except the sender, and returns the first radio written to.
+func (c *Chat) deliverToRadios(ctx context.Context, except *Client, msg OutgoingMessage) (first *Client) {
+	data := c.style.marshal(msg)
+	ctx, span := c.traceDeliver(ctx, msg, len(data))
+	defer span.End()
+	var recipients []*Client
+	c.mutex.RLock()
+	c.rangeRooms(msg.Room, func(_ string, rm *room) {
+		for r := range rm.radios {
+			if r != except {
+				recipients = append(recipients, r)
+			}
+		}
+	})
+	c.mutex.RUnlock()
+	span.SetAttributes(attrRecipients.Int(len(recipients)))
+
+	failed := c.fanout.deliver(ctx, recipients, c.sendEncoded(msg, recipients), data)
+	dropped := make(map[*Client]bool, len(failed))
+	for _, f := range failed {
+		f.client.log.Warn().Err(f.err).Msg("failed to forward to radio, removing")
+		c.reportError(ErrorKindWriteFailed, f.err, f.client)
+		dropped[f.client] = true
+	}
+	c.drop(failed)
+	for _, r := range recipients {
+		if !dropped[r] {
+			c.traceLog.Trace().Str("radio", r.id).Str("conn_id", r.connID).Msg("message forwarded to radio")
+			return r
+		}
+	}
+	return nil
+}
+
+// deliverToUsers writes the message to all local users in the message's room,
+// and to its guests if they may see it.
+func (c *Chat) deliverToUsers(ctx context.Context, msg OutgoingMessage) {
+	data := c.style.marshal(msg)
+	ctx, span := c.traceDeliver(ctx, msg, len(data))
+	defer span.End()
+	var recipients []*Client
+	c.mutex.RLock()
+	c.rangeRooms(msg.Room, func(_ string, rm *room) {
+		for _, u := range rm.users {
+			recipients = append(recipients, u)
+		}
+		if !guestVisible(msg) {
+			return
+		}
+		for g := range rm.guests {
+			recipients = append(recipients, g)
+		}
+	})
+	c.mutex.RUnlock()
+	span.SetAttributes(attrRecipients.Int(len(recipients)))
+	c.notifyPollers("", msg)
+
+	failed := c.fanout.deliver(ctx, recipients, c.sendEncoded(msg, recipients), data)
+	for _, f := range failed {
+		f.client.log.Warn().Err(f.err).Str("role", f.client.role).Msg("failed to broadcast, removing")
+		if f.client.role != "guest" {
+			c.reportError(ErrorKindWriteFailed, f.err, f.client)
+		}
+	}
+	if len(failed) > 0 {
+		c.log.Warn().Int("failed", len(failed)).Int("recipients", len(recipients)).Msg("broadcast incomplete")
+	}
+	c.drop(failed)
+}
+
+// drop closes and removes clients that could not keep up with a delivery.
+func (c *Chat) drop(failed []deliveryFailure) {
+	for _, f := range failed {
+		f.client.terminate()
+		c.unregister(f.client)
+	}
+}
+
+// deliverToUser writes the message to a local user in the message's room, or
+// to all of the user's sessions when the message has no room, and answers
+// their long polls. It reports whether any write succeeded or a poll got the
+// message.
+func (c *Chat) deliverToUser(ctx context.Context, userID string, msg OutgoingMessage) bool {
+	polled := c.notifyPollers(userID, msg)
+	msg.AckRequired = c.ackRequired(msg)
+	data := c.style.marshal(msg)
+	var sessions []*Client
+	c.mutex.RLock()
+	c.rangeRooms(msg.Room, func(_ string, rm *room) {
+		if u, ok := rm.users[userID]; ok {
+			sessions = append(sessions, u)
+		}
+	})
+	c.mutex.RUnlock()
+	send := c.sendEncoded(msg, sessions)
+
+	ctx, span := c.traceDeliver(ctx, msg, len(data))
+	defer span.End()
+	span.SetAttributes(attrRecipients.Int(len(sessions)))
+	delivered := false
+	for _, user := range sessions {
+		user.touch()
+		// Tracked first, as the ack may come in as soon as the message is queued
+		if msg.AckRequired {
+			user.trackAck(msg, data)
+		}
+		if err := c.traceWrite(ctx, user, send, data); err != nil {
+			user.untrackAck(msg.ID)
+			user.log.Warn().Err(err).Msg("failed to forward message to user")
+			c.reportError(ErrorKindWriteFailed, err, user)
+			user.terminate()
+			c.unregister(user)
+			continue
+		}
+		delivered = true
+	}
+	if delivered {
+		c.traceLog.Trace().Str("user", userID).Msg("message forwarded to user")
+	}
+	return delivered || polled
+}
+
+// isDM reports whether a message sent by a member with the role is a direct
+// message between users.
+func (c *Chat) isDM(role string, msg OutgoingMessage) bool {
+	return c.userDM && role == "user" && msg.To != ""
+}
+
+// nextMessageID returns a unique message ID. IDs are based on the current time
+// in microseconds, so they sort in dispatch order and stay increasing across
+// restarts. Callers hold c.order until the message is queued for all local
+// recipients, which then receive messages in ID order.
+func (c *Chat) nextMessageID() string {
+	for {
+		last := c.lastMessageID.Load()
+		next := max(uint64(time.Now().UnixMicro()), last+1)
+		if c.lastMessageID.CompareAndSwap(last, next) {
+			c.messageCount.Add(1)
+			return fmt.Sprintf("%016x", next)
+		}
+	}
+}
+
+// verifyGEWISTokenHandshake verifies signature and algorithm, or finds the
+// token among those verified in the last RADIO_JWT_CACHE_TTL. Expiry is
+// handled according to the chat's TokenExpiryMode, enforced expiry returns
+// ErrTokenExpired.
+func (c *Chat) verifyGEWISTokenHandshake(tokenStr string) (*GEWISClaims, error) {
+	if tokenStr == "" {
+		return nil, errors.New("missing token")
+	}
+	claims, ok := c.tokenCache.get(tokenStr, time.Now())
+	if !ok {
+		var err error
+		if claims, err = c.parseGEWISToken(tokenStr); err != nil {
+			return nil, err
+		}
+		c.tokenCache.put(tokenStr, claims, time.Now())
+	}
+
+	switch c.tokenExpiry {
+	case TokenExpiryEnforce:
+		if tokenExpired(claims, time.Now(), c.tokenLeeway) {
+			return nil, ErrTokenExpired
+		}
+	case TokenExpiryWarn:
+		if tokenExpired(claims, time.Now(), 0) {
+			c.log.Warn().
+				Int("lidnr", claims.Lidnr).
+				Time("expired_at", claims.ExpiresAt.Time).
+				Msg("GEWIS token expired at handshake, accepting anyway")
+		}
+	}
+	return claims, nil
+}
+
+// parseGEWISToken checks the token's signature and the claims that do not
+// change over time.
+func (c *Chat) parseGEWISToken(tokenStr string) (*GEWISClaims, error) {
+	claims := &GEWISClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenStr,
+		claims,
+		c.keyfunc,
+		jwt.WithValidMethods(c.validMethods()),
+		jwt.WithoutClaimsValidation(), // skip time checks
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if err := c.checkIssuerAudience(claims); err != nil {
+		return nil, err
+	}
+	if err := checkMember(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,560 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+// --- helpers ---
+
+func startTestServer(t *testing.T, chat *Chat) (*httptest.Server, string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", chat.HandleWS)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() { shutdownNow(t, chat) })
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	return srv, wsURL
+}
+
+// shutdownNow closes the chat's connections without a drain and waits for
+// their goroutines.
+func shutdownNow(t *testing.T, chat *Chat) {
+	t.Helper()
+	chat.drain = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := chat.Shutdown(ctx); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
+
+func makeToken(t testing.TB, secret string, lidnr int, given, family string, ttl time.Duration) string {
+	t.Helper()
+	claims := GEWISClaims{
+		Lidnr:      lidnr,
+		GivenName:  given,
+		FamilyName: family,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	j := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	s, err := j.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func dialAndHandshake(t *testing.T, wsBase string, role string, token string, radioKey string) *websocket.Conn {
+	t.Helper()
+	c := dialHandshake(t, wsBase, role, token, radioKey)
+	if role == "user" {
+		expectWelcome(t, c)
+	}
+	return c
+}
+
+// dialHandshake dials and sends the handshake without waiting for the
+// welcome, for handshakes that are expected to be rejected.
+func dialHandshake(t *testing.T, wsBase string, role string, token string, radioKey string) *websocket.Conn {
+	t.Helper()
+	u, _ := url.Parse(wsBase)
+	q := u.Query()
+	q.Set("role", role)
+	u.RawQuery = q.Encode()
+
+	c, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			t.Fatalf("dial failed: %v, status=%d", err, resp.StatusCode)
+		}
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	// First frame is the handshake message the server expects
+	if role == "radio" {
+		if err := c.WriteJSON(IncomingMessage{Token: token, RadioKey: radioKey}); err != nil {
+			t.Fatalf("write radio handshake: %v", err)
+		}
+	} else {
+		if err := c.WriteJSON(IncomingMessage{Token: token}); err != nil {
+			t.Fatalf("write handshake: %v", err)
+		}
+	}
+	return c
+}
+
+// expectWelcome reads the welcome frame users get after the handshake.
+func expectWelcome(t *testing.T, c *websocket.Conn) OutgoingMessage {
+	t.Helper()
+	welcome, err := readJSONWithDeadline[OutgoingMessage](t, c, 2*time.Second)
+	if err != nil || welcome.Type != MessageTypeWelcome {
+		t.Fatalf("expected welcome, got: %+v (%v)", welcome, err)
+	}
+	return welcome
+}
+
+func readJSONWithDeadline[T any](t *testing.T, c *websocket.Conn, d time.Duration) (T, error) {
+	t.Helper()
+	var zero T
+	_ = c.SetReadDeadline(time.Now().Add(d))
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return zero, err
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// waitForUsers blocks until the chat has registered n users across all rooms.
+func waitForUsers(t *testing.T, chat *Chat, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := chat.Stats().ConnectedUsers
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d users, have %d", n, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForRadios blocks until the chat has registered n radios across all rooms.
+func waitForRadios(t *testing.T, chat *Chat, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := chat.Stats().ConnectedRadios
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d radios, have %d", n, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// --- tests ---
+
+func TestUserToRadioForwarding(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	userTok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	radioTok := makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute)
+
+	radio := dialAndHandshake(t, wsBase, "radio", radioTok, RADIOChatKey)
+	defer radio.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", userTok, "")
+	defer user.Close()
+
+	// Send from user -> expect radio to receive
+	msg := IncomingMessage{Token: userTok, Content: "hi radio"}
+	if err := user.WriteJSON(msg); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.From != "12345" || out.Content != "hi radio" || out.GivenName != "Alice" || out.FamilyName != "User" {
+		t.Fatalf("unexpected message: %+v", out)
+	}
+}
+
+func TestRadioToUserForwarding(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	userTok := makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute)
+	radioTok := makeToken(t, GEWISSecret, 33333, "Dave", "Radio", time.Minute)
+
+	user := dialAndHandshake(t, wsBase, "user", userTok, "")
+	defer user.Close()
+
+	radio := dialAndHandshake(t, wsBase, "radio", radioTok, RADIOChatKey)
+	defer radio.Close()
+
+	// Send from radio to user 22222
+	msg := IncomingMessage{Token: radioTok, To: "22222", Content: "hello user"}
+	if err := radio.WriteJSON(msg); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if out.From != "33333" || out.To != "22222" || out.Content != "hello user" {
+		t.Fatalf("unexpected message: %+v", out)
+	}
+}
+
+func TestWSRequiresUpgrade(t *testing.T) {
+	chat := New()
+	for _, path := range []string{"/ws", "/ws?role=user"} {
+		rec := httptest.NewRecorder()
+		chat.HandleWS(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp upgradeRequired
+		if rec.Code != http.StatusUpgradeRequired || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+			t.Fatalf("%s: expected 426 with JSON, got %d: %s", path, rec.Code, rec.Body)
+		}
+		if rec.Header().Get("Upgrade") != "websocket" || len(resp.Roles) != 3 || resp.Docs == "" || resp.Error == "" {
+			t.Fatalf("%s: expected the roles and a link to the docs, got %+v", path, resp)
+		}
+	}
+
+	// A real upgrade that fails keeps the upgrader's answer
+	req := httptest.NewRequest(http.MethodGet, "/ws?role=user", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	rec := httptest.NewRecorder()
+	chat.HandleWS(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an upgrade without a websocket version, got %d", rec.Code)
+	}
+}
+
+func TestWSUpgrade(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+}
+
+func TestReconnectKicksOldWith4100(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	tok := makeToken(t, GEWISSecret, 77777, "Eve", "User", time.Minute)
+
+	// First connection for lidnr 77777
+	c1 := dialAndHandshake(t, wsBase, "user", tok, "")
+	defer c1.Close()
+
+	// Start a waiter that expects the close from server with code 4100
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := c1.ReadMessage()
+		errCh <- err
+	}()
+
+	// Second connection with the same lidnr triggers kick of c1
+	c2 := dialAndHandshake(t, wsBase, "user", tok, "")
+	defer c2.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected close error on first connection")
+		}
+		if !websocket.IsCloseError(err, 4100) {
+			// Some stacks surface 1006 if the TCP closes fast. Allow both but prefer 4100.
+			if !(websocket.IsUnexpectedCloseError(err, 4100) && strings.Contains(err.Error(), "1006")) {
+				t.Fatalf("expected close code 4100, got: %v", err)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for first connection to be closed")
+	}
+}
+
+func TestRadioReconnectKicksOldWith4100(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	tok := makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute)
+
+	// First connection for radio 99999
+	r1 := dialAndHandshake(t, wsBase, "radio", tok, RADIOChatKey)
+	defer r1.Close()
+	waitForRadios(t, chat, 1)
+
+	// Start a waiter that expects the close from server with code 4100
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := r1.ReadMessage()
+		errCh <- err
+	}()
+
+	// Second connection with the same lidnr triggers kick of r1
+	r2 := dialAndHandshake(t, wsBase, "radio", tok, RADIOChatKey)
+	defer r2.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected close error on first connection")
+		}
+		if !websocket.IsCloseError(err, CloseCodeReplaced) {
+			// Some stacks surface 1006 if the TCP closes fast. Allow both but prefer 4100.
+			if !(websocket.IsUnexpectedCloseError(err, CloseCodeReplaced) && strings.Contains(err.Error(), "1006")) {
+				t.Fatalf("expected close code 4100, got: %v", err)
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for first connection to be closed")
+	}
+	if n := chat.RadioCount(); n != 1 {
+		t.Fatalf("expected 1 radio after replacement, got %d", n)
+	}
+}
+
+func TestConcurrentRadioReconnects(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	const n = 20
+	tok := makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute)
+	u, _ := url.Parse(wsBase)
+	q := u.Query()
+	q.Set("role", "radio")
+	u.RawQuery = q.Encode()
+
+	// Every connection races to register, the ones that lose get 4100
+	start := make(chan struct{})
+	dialErrs := make(chan error, n)
+	closes := make(chan error, n)
+	for range n {
+		go func() {
+			<-start
+			conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+			if err != nil {
+				dialErrs <- err
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+			if err := conn.WriteJSON(IncomingMessage{Token: tok, RadioKey: RADIOChatKey}); err != nil {
+				dialErrs <- err
+				return
+			}
+			dialErrs <- nil
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					closes <- err
+					return
+				}
+			}
+		}()
+	}
+	close(start)
+	for range n {
+		if err := <-dialErrs; err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+	}
+
+	for range n - 1 {
+		select {
+		case err := <-closes:
+			if !websocket.IsCloseError(err, CloseCodeReplaced) {
+				t.Fatalf("expected close code 4100, got: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the replaced radios to be closed")
+		}
+	}
+	select {
+	case err := <-closes:
+		t.Fatalf("expected one radio to stay connected, all were closed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	chat.mutex.RLock()
+	defer chat.mutex.RUnlock()
+	r := chat.rooms[DefaultRoom]
+	if len(r.radios) != 1 || len(r.radiosByID) != 1 {
+		t.Fatalf("expected exactly 1 radio, got %d connections and %d IDs", len(r.radios), len(r.radiosByID))
+	}
+	if _, ok := r.radios[r.radiosByID["99999"]]; !ok {
+		t.Fatal("expected the radio registered by ID to be the connected one")
+	}
+}
+
+func TestDeadRadioRemovedDuringFanout(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+
+	// Gone without a close frame, while messages are fanned out to it
+	if err := radio.UnderlyingConn().Close(); err != nil {
+		t.Fatalf("close radio connection: %v", err)
+	}
+	for i := range 10 {
+		sendAsUser(t, user, fmt.Sprintf("Anyone there? %d", i))
+	}
+	waitForRadios(t, chat, 0)
+
+	chat.mutex.RLock()
+	r := chat.rooms[DefaultRoom]
+	radios, byID := len(r.radios), len(r.radiosByID)
+	chat.mutex.RUnlock()
+	if radios != 0 || byID != 0 {
+		t.Fatalf("expected the dead radio to be removed, got %d connections and %d IDs", radios, byID)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected the user to stay connected, got %d users", n)
+	}
+}
+
+func TestUserMessageWithNoRadiosConnected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+	sendAsUser(t, user, "Is anyone listening?")
+
+	// Kept in the history for radios that connect later
+	var kept []OutgoingMessage
+	for i := 0; len(kept) == 0; i++ {
+		if i == 100 {
+			t.Fatal("timeout waiting for the message to be dispatched")
+		}
+		time.Sleep(10 * time.Millisecond)
+		kept = chat.history.Since("", 0, func(role string, msg OutgoingMessage) bool {
+			return role == "user" && msg.From == "12345"
+		})
+	}
+	if len(kept) != 1 || kept[0].Content != "Is anyone listening?" {
+		t.Fatalf("expected the message in the history, got: %+v", kept)
+	}
+
+	// Nothing closed the user's connection
+	if err := user.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("expected the connection to stay open, got: %v", err)
+	}
+	var closeErr *websocket.CloseError
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, user, 200*time.Millisecond); errors.As(err, &closeErr) {
+		t.Fatalf("expected the connection to stay open, got: %v", err)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected 1 user, got %d", n)
+	}
+}
+
+func TestInvalidRoleRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", chat.HandleWS)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Try to dial with role=foo, expect HTTP 400 on upgrade
+	u, _ := url.Parse("ws" + strings.TrimPrefix(srv.URL, "http") + "/ws")
+	q := u.Query()
+	q.Set("role", "foo")
+	u.RawQuery = q.Encode()
+
+	_, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err == nil {
+		t.Fatal("expected dial error for invalid role")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got: %+v, err=%v", resp, err)
+	}
+}
+
+func TestInvalidTokenHandshakeCloses(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	// Dial as user and send a bad token in the handshake frame
+	u, _ := url.Parse(wsBase)
+	q := u.Query()
+	q.Set("role", "user")
+	u.RawQuery = q.Encode()
+
+	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	_ = c.WriteJSON(IncomingMessage{Token: "definitely-not-a-jwt"})
+
+	// Server should close immediately
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, rerr := c.ReadMessage()
+	if rerr == nil {
+		t.Fatal("expected close after invalid token")
+	}
+}
+
+func TestCloseReason(t *testing.T) {
+	tests := map[int]string{
+		CloseCodeReplaced:            "replaced by new connection",
+		CloseCodeInvalidRadioKey:     "invalid radio key",
+		CloseCodeTokenExpired:        "token expired",
+		CloseCodeTokenNotAccepted:    "token not accepted",
+		CloseCodeBanned:              "banned",
+		CloseCodeSessionExpired:      "session expired",
+		CloseCodeMessageTooLarge:     "message too large",
+		CloseCodeRateLimited:         "rate limited",
+		websocket.CloseNormalClosure: "",
+	}
+	for code, want := range tests {
+		if got := CloseReason(code); got != want {
+			t.Errorf("CloseReason(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
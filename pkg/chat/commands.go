@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Commands radios can send using the cmd field.
+const (
+	CommandPin       = "pin"
+	CommandUnpin     = "unpin"
+	CommandResolve   = "resolve"
+	CommandClosePoll = "closepoll"
+)
+
+// Message types generated by the server itself.
+const (
+	MessageTypeSystem     = "system"
+	MessageTypeUnpin      = "unpin"
+	MessageTypeWarning    = "warning"
+	MessageTypeError      = "error"
+	MessageTypeAnswered   = "answered"
+	MessageTypePollUpdate = "poll_update" // tally of a poll, sent to its room, see scheduleTally
+
+	MessageTypeTokenExpiring = "token_expiring"
+	MessageTypeRadioUpdate   = "radio_update"
+	MessageTypeAck           = "ack"     // answers a resent message, see resent; users send it too, see ack
+	MessageTypeWelcome       = "welcome" // first frame of a user session, see sendWelcome
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+func (c *Chat) handleCommand(ctx context.Context, client *Client, in IncomingMessage) error {
+	if client.role != "radio" {
+		return fmt.Errorf("command %q not allowed for role %s", in.Cmd, client.role)
+	}
+
+	target := client.room
+	var params map[string]string
+	switch in.Cmd {
+	case CommandPin:
+		if strings.TrimSpace(in.Content) == "" {
+			return errors.New("pin requires content")
+		}
+		c.pin(ctx, client.room, in.Content)
+		params = map[string]string{"content": in.Content}
+	case CommandUnpin:
+		c.unpin(ctx, client.room)
+	case CommandClosePoll:
+		if err := c.closePoll(ctx, client, in.PollID); err != nil {
+			return err
+		}
+		target = in.PollID
+	case CommandResolve:
+		if !c.markAnswered(client.room, in.MessageID) {
+			c.sendNotice(client, MessageTypeError, ErrUnknownMessage.Error())
+			return ErrUnknownMessage
+		}
+		c.forwardToOtherRadios(ctx, client, OutgoingMessage{Type: MessageTypeAnswered, Room: client.room, MessageID: in.MessageID})
+		target = in.MessageID
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownCommand, in.Cmd)
+	}
+	c.audit(client.id, in.Cmd, target, params)
+
+	client.log.Info().Str("cmd", in.Cmd).Msg("radio command executed")
+	return nil
+}
+
+// pin stores the announcement and broadcasts it to every user in the room.
+func (c *Chat) pin(ctx context.Context, roomName, content string) {
+	c.order.Lock()
+	defer c.order.Unlock()
+	msg := OutgoingMessage{
+		ID:      c.nextMessageID(),
+		SentAt:  time.Now(),
+		Type:    MessageTypeSystem,
+		Content: content,
+		Pinned:  true,
+		Room:    roomName,
+	}
+
+	c.pinMu.Lock()
+	c.pinned[roomName] = &msg
+	c.pinMu.Unlock()
+
+	c.forwardToUsers(ctx, msg)
+}
+
+// unpin clears the room's announcement and tells users to remove it.
+func (c *Chat) unpin(ctx context.Context, roomName string) {
+	c.pinMu.Lock()
+	delete(c.pinned, roomName)
+	c.pinMu.Unlock()
+
+	c.forwardToUsers(ctx, OutgoingMessage{Type: MessageTypeUnpin, Room: roomName})
+}
+
+// sendPinned delivers the announcement of the client's room, if any, to a
+// single client.
+func (c *Chat) sendPinned(client *Client) {
+	c.pinMu.Lock()
+	pinned := c.pinned[client.room]
+	c.pinMu.Unlock()
+	if pinned == nil {
+		return
+	}
+
+	data := c.style.marshal(*pinned)
+	if err := client.sendHighPriority(data); err != nil {
+		client.log.Warn().Err(err).Msg("failed to send pinned message")
+	}
+}
+
+// sendNotice sends a server message such as a warning or error to a single
+// client without disconnecting it.
+func (c *Chat) sendNotice(client *Client, msgType, content string) {
+	data := c.style.marshal(OutgoingMessage{Type: msgType, SentAt: time.Now(), Content: content})
+	if err := client.sendHighPriority(data); err != nil {
+		client.log.Warn().Err(err).Str("type", msgType).Msg("failed to send notice")
+	}
+}
@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPinBroadcastsToUsers(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	waitForUsers(t, chat, 1)
+
+	if err := radio.WriteJSON(IncomingMessage{Cmd: CommandPin, Content: "Stuur je verzoekjes met teamnummer!"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if out.Type != MessageTypeSystem || !out.Pinned || out.Content != "Stuur je verzoekjes met teamnummer!" {
+		t.Fatalf("unexpected message: %+v", out)
+	}
+}
+
+func TestPinDeliveredOnConnect(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	// Pin from a radio that disconnects afterwards, the pin is server state
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	if err := radio.WriteJSON(IncomingMessage{Cmd: CommandPin, Content: "pinned"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		chat.mutex.Lock()
+		pinned := chat.pinned[DefaultRoom]
+		chat.mutex.Unlock()
+		if pinned != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for pin")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = radio.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if !out.Pinned || out.Content != "pinned" {
+		t.Fatalf("unexpected message: %+v", out)
+	}
+}
+
+func TestUnpinClearsAnnouncement(t *testing.T) {
+	chat := New()
+	radio := &Client{role: "radio", id: "99999", room: DefaultRoom}
+
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{Cmd: CommandPin, Content: "pinned"}); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{Cmd: CommandUnpin}); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+	if pinned := chat.pinned[DefaultRoom]; pinned != nil {
+		t.Fatalf("expected pin to be cleared, got: %+v", pinned)
+	}
+}
+
+func TestUserCannotPin(t *testing.T) {
+	chat := New()
+	user := &Client{role: "user", id: "12345", room: DefaultRoom}
+
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Cmd: CommandPin, Content: "pinned"}); err == nil {
+		t.Fatal("expected users to be refused commands")
+	}
+	if len(chat.pinned) != 0 {
+		t.Fatal("expected no pin to be stored")
+	}
+}
@@ -0,0 +1,33 @@
+package chat
+
+import (
+	"net/http"
+	"strings"
+)
+
+// deflateOffered reports whether the upgrade request offers permessage-deflate,
+// which the upgrader accepts when compression is enabled.
+func deflateOffered(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-Websocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setupCompression compresses writes to the client at the configured level
+// if it negotiated permessage-deflate. Control frames are never compressed.
+func (c *Chat) setupCompression(client *Client, r *http.Request) {
+	client.compressed = c.upgrader.EnableCompression && deflateOffered(r)
+	client.conn.EnableWriteCompression(client.compressed)
+	if !client.compressed {
+		return
+	}
+	if err := client.conn.SetCompressionLevel(c.ws.CompressionLevel); err != nil {
+		client.log.Warn().Err(err).Msg("invalid compression level, using the default")
+	}
+}
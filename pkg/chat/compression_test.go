@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingConn counts the bytes read from the network.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// dialCounting connects user lidnr, offering compression or not, and returns
+// the connection with a counter of the bytes it read.
+func dialCounting(t *testing.T, wsBase string, lidnr int, compress bool) (*websocket.Conn, *atomic.Int64) {
+	t.Helper()
+	read := new(atomic.Int64)
+	dialer := websocket.Dialer{
+		EnableCompression: compress,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			return countingConn{Conn: conn, read: read}, err
+		},
+	}
+	u, _ := url.Parse(wsBase)
+	u.RawQuery = url.Values{"role": {"user"}}.Encode()
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := conn.WriteJSON(IncomingMessage{Token: makeToken(t, GEWISSecret, lidnr, "Alice", "User", time.Minute)}); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	expectWelcome(t, conn)
+	return conn, read
+}
+
+func TestCompressionNegotiated(t *testing.T) {
+	GEWISSecret = "testsecret"
+	ws := wsConfig
+	ws.EnableCompression = true
+	ws.CompressionLevel = 9
+	chat := New(WithWSConfig(ws))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	compressed, compressedRead := dialCounting(t, wsBase, 12345, true)
+	defer compressed.Close()
+	plain, plainRead := dialCounting(t, wsBase, 22222, false)
+	defer plain.Close()
+	waitForUsers(t, chat, 2)
+
+	if n := chat.Stats().Compressed; n != 1 {
+		t.Fatalf("expected 1 compressed connection, got %d", n)
+	}
+	for _, info := range chat.SnapshotState().Users {
+		if info.Compressed != (info.ID == "12345") {
+			t.Fatalf("expected only 12345 to be compressed, got: %+v", info)
+		}
+	}
+
+	content := strings.Repeat("Bohemian Rhapsody ", 500)
+	compressedBefore, plainBefore := compressedRead.Load(), plainRead.Load()
+	for id, conn := range map[string]*websocket.Conn{"12345": compressed, "22222": plain} {
+		if !chat.forwardToUser(t.Context(), id, OutgoingMessage{ID: chat.nextMessageID(), From: "99999", To: id, Content: content, Room: DefaultRoom}) {
+			t.Fatalf("expected the message to %s to be delivered", id)
+		}
+		out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+		if err != nil || out.Content != content {
+			t.Fatalf("expected the large message, got %d bytes (%v)", len(out.Content), err)
+		}
+	}
+	if n := compressedRead.Load() - compressedBefore; n >= int64(len(content))/10 {
+		t.Fatalf("expected a compressed frame, read %d bytes for %d bytes of content", n, len(content))
+	}
+	if n := plainRead.Load() - plainBefore; n < int64(len(content)) {
+		t.Fatalf("expected an uncompressed frame, read %d bytes for %d bytes of content", n, len(content))
+	}
+}
@@ -0,0 +1,132 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// maxCloseReason is the longest reason that fits in a close frame.
+const maxCloseReason = 123
+
+const (
+	defaultConnectionMessagesLimit = 20
+	maxConnectionMessagesLimit     = 500
+)
+
+// ForceDisconnect closes every session of the user on this instance with the
+// close code and reason, and removes them from their rooms. It returns
+// ErrUserNotFound if the user is not connected.
+func (c *Chat) ForceDisconnect(userID string, code int, reason string) error {
+	var sessions []*Client
+	c.mutex.Lock()
+	c.eachRoom("", func(_ string, r *room) {
+		if u, ok := r.users[userID]; ok {
+			sessions = append(sessions, u)
+			delete(r.users, userID)
+		}
+	})
+	delete(c.userRadio, userID)
+	c.mutex.Unlock()
+	if len(sessions) == 0 {
+		return ErrUserNotFound
+	}
+
+	for _, u := range sessions {
+		u.log.Info().Int("code", code).Str("reason", reason).Msg("forcing disconnect")
+		u.closeWith(code, reason)
+	}
+	return nil
+}
+
+// userConnected reports whether the user has a session on this instance.
+func (c *Chat) userConnected(userID string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	found := false
+	c.rangeRooms("", func(_ string, r *room) {
+		if _, ok := r.users[userID]; ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// HandleConnection disconnects a user with DELETE /api/v1/connections/{id},
+// optionally with ?code= and ?reason= for the close frame. Requires the admin
+// key.
+func (c *Chat) HandleConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+
+	id := r.PathValue("id")
+	code := CloseCodeBanned
+	if v := r.URL.Query().Get("code"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 4000 || n > 4999 {
+			writeError(w, http.StatusBadRequest, "invalid code, expected 4000-4999")
+			return
+		}
+		code = n
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = CloseReason(code)
+	}
+	if len(reason) > maxCloseReason {
+		writeError(w, http.StatusBadRequest, "reason too long")
+		return
+	}
+
+	if err := c.ForceDisconnect(id, code, reason); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	c.audit(ActorAdminKey, "disconnect", id, map[string]string{"code": strconv.Itoa(code), "reason": reason})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleConnectionMessages returns the last messages in the history sent by
+// or to a connected user with GET /api/v1/connections/{id}/messages, oldest
+// first and limited by ?limit=. Requires the admin key.
+func (c *Chat) HandleConnectionMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+
+	id := r.PathValue("id")
+	limit := defaultConnectionMessagesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxConnectionMessagesLimit)
+	}
+	if !c.userConnected(id) {
+		writeError(w, http.StatusNotFound, ErrUserNotFound.Error())
+		return
+	}
+
+	messages := c.history.Before("", limit, func(_ string, msg OutgoingMessage) bool {
+		return msg.From == id || msg.To == id
+	})
+	if messages == nil {
+		messages = []OutgoingMessage{}
+	}
+	writeJSON(w, http.StatusOK, UserHistoryResponse{Messages: messages})
+}
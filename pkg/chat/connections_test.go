@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func deleteConnection(t *testing.T, chat *Chat, id, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/connections/"+id+query, nil)
+	req.SetPathValue("id", id)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	chat.HandleConnection(rec, req)
+	return rec
+}
+
+func TestForceDisconnect(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+
+	if rec := deleteConnection(t, chat, "12345", "?code=4403&reason=abuse"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	_ = user.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := user.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseCodeBanned || closeErr.Text != "abuse" {
+		t.Fatalf("expected close 4403 abuse, got: %v", err)
+	}
+	if users := chat.Users(""); len(users) != 0 {
+		t.Fatalf("expected user to be removed, got: %+v", users)
+	}
+}
+
+func TestForceDisconnectNotConnected(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+
+	if err := chat.ForceDisconnect("12345", CloseCodeBanned, "abuse"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got: %v", err)
+	}
+	if rec := deleteConnection(t, chat, "12345", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	if rec := deleteConnection(t, chat, "12345", "?code=1000"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-application code, got %d", rec.Code)
+	}
+}
+
+func getConnectionMessages(t *testing.T, chat *Chat, id, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/connections/"+id+"/messages"+query, nil)
+	req.SetPathValue("id", id)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	chat.HandleConnectionMessages(rec, req)
+	return rec
+}
+
+func TestConnectionMessages(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	sendAsUser(t, user, "Play something loud")
+	expectContent(t, radio, "Play something loud")
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "Coming up next"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	expectContent(t, user, "Coming up next")
+	chat.history.Add("user", OutgoingMessage{ID: chat.nextMessageID(), From: "54321", Content: "Someone else"})
+
+	rec := getConnectionMessages(t, chat, "12345", "")
+	var resp UserHistoryResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(resp.Messages) != 2 || resp.Messages[0].Content != "Play something loud" || resp.Messages[1].Content != "Coming up next" {
+		t.Fatalf("expected the user's message and the reply, got: %+v", resp.Messages)
+	}
+
+	rec = getConnectionMessages(t, chat, "12345", "?limit=1")
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil || len(resp.Messages) != 1 || resp.Messages[0].Content != "Coming up next" {
+		t.Fatalf("expected the last message only, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := getConnectionMessages(t, chat, "12345", "?limit=0"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid limit, got %d", rec.Code)
+	}
+}
+
+func TestConnectionMessagesEmpty(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+
+	rec := getConnectionMessages(t, chat, "12345", "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"messages":[]}` {
+		t.Fatalf("expected no messages, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := getConnectionMessages(t, chat, "54321", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a user who is not connected, got %d", rec.Code)
+	}
+}
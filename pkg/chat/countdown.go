@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// maxCountdown bounds countdowns, so a typo does not leave one running all day.
+const maxCountdown = time.Hour
+
+const (
+	MessageTypeCountdown      = "countdown"       // sent by radios with a duration as content
+	MessageTypeCountdownStart = "countdown_start" // sent to the room, see startCountdown
+	MessageTypeCountdownEnd   = "countdown_end"   // sent to the room when it expires or is replaced
+)
+
+// Countdown is the countdown running in a room.
+type Countdown struct {
+	ID     string    `json:"id" description:"ID of the countdown_start message"`
+	Room   string    `json:"room" description:"Room the countdown runs in"`
+	EndsAt time.Time `json:"endsAt"`
+
+	timer *time.Timer
+}
+
+func validateCountdown(in IncomingMessage) error {
+	d, err := time.ParseDuration(in.Content)
+	if err != nil || d <= 0 || d > maxCountdown {
+		return errors.New("countdown requires a duration up to 1h as content, such as 30s")
+	}
+	return nil
+}
+
+// startCountdown starts a countdown from a radio in its room, replacing the
+// one running there, and sends countdown_start to everyone in the room. All
+// clients count down to the same endsAt.
+func (c *Chat) startCountdown(ctx context.Context, client *Client, in IncomingMessage) error {
+	if client.role != "radio" {
+		return errors.New("only radios can start countdowns")
+	}
+	d, _ := time.ParseDuration(in.Content)
+
+	c.order.Lock()
+	defer c.order.Unlock()
+	cd := &Countdown{ID: c.nextMessageID(), Room: client.room, EndsAt: time.Now().Add(d)}
+	c.countdownMu.Lock()
+	prev := c.countdowns[cd.Room]
+	c.countdowns[cd.Room] = cd
+	cd.timer = time.AfterFunc(d, func() { c.endCountdown(context.Background(), cd) })
+	c.countdownMu.Unlock()
+
+	if prev != nil && prev.timer.Stop() {
+		c.sendCountdownEnd(ctx, prev)
+	}
+	out := OutgoingMessage{
+		ID:          cd.ID,
+		SentAt:      time.Now(),
+		Type:        MessageTypeCountdownStart,
+		From:        client.id,
+		GivenName:   client.givenName,
+		FamilyName:  client.familyName,
+		DisplayName: c.displayName(client),
+		Content:     in.Content,
+		Room:        cd.Room,
+		EndsAt:      cd.EndsAt,
+	}
+	c.forwardToUsers(ctx, out)
+	c.forwardToRadios(ctx, out)
+	return nil
+}
+
+// endCountdown forgets the countdown if it is still the one running in its
+// room, and sends countdown_end.
+func (c *Chat) endCountdown(ctx context.Context, cd *Countdown) {
+	c.countdownMu.Lock()
+	if c.countdowns[cd.Room] == cd {
+		delete(c.countdowns, cd.Room)
+	}
+	c.countdownMu.Unlock()
+	c.sendCountdownEnd(ctx, cd)
+}
+
+func (c *Chat) sendCountdownEnd(ctx context.Context, cd *Countdown) {
+	out := OutgoingMessage{
+		SentAt:    time.Now(),
+		Type:      MessageTypeCountdownEnd,
+		Room:      cd.Room,
+		MessageID: cd.ID,
+	}
+	c.forwardToUsers(ctx, out)
+	c.forwardToRadios(ctx, out)
+}
+
+// stopCountdowns stops the running countdowns without ending them, for
+// Shutdown.
+func (c *Chat) stopCountdowns() {
+	c.countdownMu.Lock()
+	defer c.countdownMu.Unlock()
+	for _, cd := range c.countdowns {
+		cd.timer.Stop()
+	}
+}
+
+// ActiveCountdown returns the countdown running in the room, if any.
+func (c *Chat) ActiveCountdown(roomName string) (Countdown, bool) {
+	c.countdownMu.Lock()
+	defer c.countdownMu.Unlock()
+	cd, ok := c.countdowns[roomName]
+	if !ok {
+		return Countdown{}, false
+	}
+	return *cd, true
+}
+
+// HandleCountdown returns the countdown running in ?room=, which defaults to
+// main, for clients that connected after it started.
+func (c *Chat) HandleCountdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	roomName := r.URL.Query().Get("room")
+	if roomName == "" {
+		roomName = DefaultRoom
+	}
+	cd, ok := c.ActiveCountdown(roomName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no active countdown")
+		return
+	}
+	writeJSON(w, http.StatusOK, cd)
+}
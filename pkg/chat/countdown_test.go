@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func getCountdown(t *testing.T, chat *Chat, query string) (int, Countdown) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	chat.HandleCountdown(rec, httptest.NewRequest(http.MethodGet, "/api/v1/countdown"+query, nil))
+	var cd Countdown
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&cd); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+	}
+	return rec.Code, cd
+}
+
+func expectType(t *testing.T, conn *websocket.Conn, msgType string) OutgoingMessage {
+	t.Helper()
+	out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+	if err != nil || out.Type != msgType {
+		t.Fatalf("expected %s, got: %+v (%v)", msgType, out, err)
+	}
+	return out
+}
+
+func TestCountdownLifecycle(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if code, _ := getCountdown(t, chat, ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the countdown, got %d", code)
+	}
+	before := time.Now()
+	if err := radio.WriteJSON(IncomingMessage{Type: MessageTypeCountdown, Content: "300ms"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	start := expectType(t, user, MessageTypeCountdownStart)
+	if start.ID == "" || start.EndsAt.Before(before.Add(300*time.Millisecond)) || start.EndsAt.After(time.Now().Add(300*time.Millisecond)) {
+		t.Fatalf("expected to end in 300ms, got: %+v", start)
+	}
+	expectType(t, radio, MessageTypeCountdownStart)
+
+	code, cd := getCountdown(t, chat, "?room=main")
+	if code != http.StatusOK || cd.ID != start.ID || !cd.EndsAt.Equal(start.EndsAt) || cd.Room != DefaultRoom {
+		t.Fatalf("expected the running countdown, got %d: %+v", code, cd)
+	}
+	if code, _ := getCountdown(t, chat, "?room=tech"); code != http.StatusNotFound {
+		t.Fatalf("expected no countdown in another room, got %d", code)
+	}
+
+	end := expectType(t, user, MessageTypeCountdownEnd)
+	if end.MessageID != start.ID || time.Now().Before(start.EndsAt) {
+		t.Fatalf("expected the end of %s after endsAt, got: %+v", start.ID, end)
+	}
+	if code, _ := getCountdown(t, chat, ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after the countdown, got %d", code)
+	}
+}
+
+func TestCountdownReplaced(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	for _, d := range []string{"1m", "2m"} {
+		if err := radio.WriteJSON(IncomingMessage{Type: MessageTypeCountdown, Content: d}); err != nil {
+			t.Fatalf("radio write: %v", err)
+		}
+	}
+	first := expectType(t, user, MessageTypeCountdownStart)
+	if end := expectType(t, user, MessageTypeCountdownEnd); end.MessageID != first.ID {
+		t.Fatalf("expected the first countdown to end, got: %+v", end)
+	}
+	second := expectType(t, user, MessageTypeCountdownStart)
+	if _, cd := getCountdown(t, chat, ""); cd.ID != second.ID {
+		t.Fatalf("expected the second countdown to run, got: %+v", cd)
+	}
+}
+
+func TestCountdownValidation(t *testing.T) {
+	for _, content := range []string{"", "soon", "0s", "-5s", "2h"} {
+		if err := validateCountdown(IncomingMessage{Type: MessageTypeCountdown, Content: content}); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+	if err := validateCountdown(IncomingMessage{Type: MessageTypeCountdown, Content: "30s"}); err != nil {
+		t.Fatalf("expected 30s to be accepted, got: %v", err)
+	}
+
+	chat := New()
+	user := &Client{role: "user", room: DefaultRoom}
+	if err := chat.startCountdown(t.Context(), user, IncomingMessage{Content: "30s"}); err == nil {
+		t.Fatal("expected users not to start countdowns")
+	}
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter records a message a user never acknowledged, see RADIO_ACK_MODE.
+type DeadLetter struct {
+	Time    time.Time       `json:"time"`
+	To      string          `json:"to"`
+	ConnID  string          `json:"connId,omitempty"`
+	Reason  string          `json:"reason"`
+	Message OutgoingMessage `json:"message"`
+}
+
+// DeadLetters appends undelivered messages to a JSONL file.
+type DeadLetters struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenDeadLetters(path string) (*DeadLetters, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetters{file: file}, nil
+}
+
+func (d *DeadLetters) Write(l DeadLetter) error {
+	if l.Time.IsZero() {
+		l.Time = time.Now()
+	}
+	line, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err = d.file.Write(append(line, '\n'))
+	return err
+}
+
+func (d *DeadLetters) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.file.Close()
+}
+
+// UseDeadLetters records messages that were not acknowledged in time.
+func (c *Chat) UseDeadLetters(d *DeadLetters) {
+	c.deadLetters = d
+}
+
+// deadLetter records a message the client did not acknowledge. Without a
+// dead-letter file it is only logged.
+func (c *Chat) deadLetter(client *Client, msg OutgoingMessage, reason string) {
+	client.log.Warn().Str("message", msg.ID).Str("reason", reason).Msg("message not acknowledged")
+	if c.deadLetters == nil {
+		return
+	}
+	l := DeadLetter{To: client.id, ConnID: client.connID, Reason: reason, Message: msg}
+	if err := c.deadLetters.Write(l); err != nil {
+		c.log.Error().Err(err).Str("message", msg.ID).Msg("could not write dead letter")
+	}
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// recentMsgIDsSize is how many client message IDs are remembered per
+// connection to detect resent messages.
+const recentMsgIDsSize = 64
+
+func newRecentMsgIDs() *lru.Cache[string, struct{}] {
+	cache, _ := lru.New[string, struct{}](recentMsgIDsSize)
+	return cache
+}
+
+// duplicate reports whether the client already sent a message with this ID,
+// remembering it otherwise. Messages without an ID are never duplicates. Users
+// are checked by resent instead.
+func (cl *Client) duplicate(clientMsgID string) bool {
+	if clientMsgID == "" || cl.recentMsgIDs == nil {
+		return false
+	}
+	seen, _ := cl.recentMsgIDs.ContainsOrAdd(clientMsgID, struct{}{})
+	return seen
+}
+
+// duplicateWindow is how long a user message is remembered to detect resends
+// by flaky clients, 0 disables.
+var duplicateWindow = Duration("CHAT_DUPLICATE_WINDOW", 30*time.Second)
+
+// recentSendsSize is how many messages are remembered per user connection.
+const recentSendsSize = 16
+
+// recentSends is a ring of the last messages a user sent, so a resend can be
+// answered with an ack for the original. It lives on the connection and is
+// gone after a disconnect.
+type recentSends struct {
+	mu      sync.Mutex
+	entries [recentSendsSize]recentSend
+	next    int
+}
+
+type recentSend struct {
+	key string
+	id  string // message ID handed out for the original
+	at  time.Time
+}
+
+func newRecentSends() *recentSends {
+	return &recentSends{}
+}
+
+// find returns the ID of a message with the key sent within the window.
+func (r *recentSends) find(key string, now time.Time, window time.Duration) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.key == key && now.Sub(e.at) < window {
+			return e.id, true
+		}
+	}
+	return "", false
+}
+
+func (r *recentSends) add(key, id string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = recentSend{key: key, id: id, at: now}
+	r.next = (r.next + 1) % recentSendsSize
+}
+
+// resendKey identifies a message by its client message ID, or by a hash of
+// what it says to whom when it has none.
+func resendKey(in IncomingMessage) string {
+	if in.ClientMsgID != "" {
+		return "id:" + in.ClientMsgID
+	}
+	sum := sha256.Sum256([]byte(in.Type + "\x00" + in.To + "\x00" + in.InReplyTo + "\x00" + in.Content))
+	return "sum:" + hex.EncodeToString(sum[:])
+}
+
+// resent returns the ID of the original when the user sent the same message
+// within the chat's duplicate window. Radios are never checked.
+func (c *Chat) resent(client *Client, key string) (string, bool) {
+	if client.recentSends == nil || c.duplicateWindow <= 0 {
+		return "", false
+	}
+	return client.recentSends.find(key, time.Now(), c.duplicateWindow)
+}
+
+func (c *Chat) rememberSend(client *Client, key, id string) {
+	if client.recentSends != nil && key != "" {
+		client.recentSends.add(key, id, time.Now())
+	}
+}
+
+// sendAck confirms to the client that the message with the ID was delivered.
+func (c *Chat) sendAck(client *Client, id, clientMsgID string) {
+	data := c.style.marshal(OutgoingMessage{Type: MessageTypeAck, SentAt: time.Now(), MessageID: id, ClientMsgID: clientMsgID})
+	if err := client.sendHighPriority(data); err != nil {
+		client.log.Warn().Err(err).Msg("failed to send ack")
+	}
+}
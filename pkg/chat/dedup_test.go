@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDuplicateMessageDropped(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	for _, in := range []IncomingMessage{
+		{Content: "Play Bohemian Rhapsody", ClientMsgID: "a1"},
+		{Content: "Play Bohemian Rhapsody", ClientMsgID: "a1"},
+		{Content: "And Radio Ga Ga", ClientMsgID: "a2"},
+	} {
+		if err := user.WriteJSON(in); err != nil {
+			t.Fatalf("user write: %v", err)
+		}
+	}
+
+	expectContent(t, radio, "Play Bohemian Rhapsody")
+	expectContent(t, radio, "And Radio Ga Ga")
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 200*time.Millisecond); err == nil {
+		t.Fatalf("expected no more messages, got: %+v", out)
+	}
+}
+
+func TestDuplicateOnlyWithinWindow(t *testing.T) {
+	client := &Client{recentMsgIDs: newRecentMsgIDs()}
+	if client.duplicate("first") {
+		t.Fatal("first message reported as duplicate")
+	}
+	for i := range recentMsgIDsSize {
+		client.duplicate(strconv.Itoa(i))
+	}
+	if client.duplicate("first") {
+		t.Fatal("expected message outside the window to be forwarded")
+	}
+	if client.duplicate("") || client.duplicate("") {
+		t.Fatal("messages without an ID are never duplicates")
+	}
+}
+
+func TestResentMessageAcked(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	sendAsUser(t, user, "Play Bohemian Rhapsody")
+	original, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+
+	// Same content without a client message ID is a resend too
+	sendAsUser(t, user, "Play Bohemian Rhapsody")
+	ack, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || ack.Type != MessageTypeAck || ack.MessageID != original.ID {
+		t.Fatalf("expected ack for %s, got: %+v (%v)", original.ID, ack, err)
+	}
+
+	// Different content goes through
+	sendAsUser(t, user, "And Radio Ga Ga")
+	expectContent(t, radio, "And Radio Ga Ga")
+}
+
+func TestRadiosNotCheckedForResends(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	for range 2 {
+		if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "Coming up next"}); err != nil {
+			t.Fatalf("radio write: %v", err)
+		}
+		expectContent(t, user, "Coming up next")
+	}
+}
+
+func TestRecentSendsWindow(t *testing.T) {
+	sends := newRecentSends()
+	now := time.Now()
+	key := resendKey(IncomingMessage{Content: "Play Bohemian Rhapsody"})
+	sends.add(key, "0001", now)
+
+	if id, ok := sends.find(key, now.Add(29*time.Second), 30*time.Second); !ok || id != "0001" {
+		t.Fatalf("expected resend within the window, got %q %v", id, ok)
+	}
+	if _, ok := sends.find(key, now.Add(30*time.Second), 30*time.Second); ok {
+		t.Fatal("expected the window to have expired")
+	}
+	if _, ok := sends.find(resendKey(IncomingMessage{Content: "And Radio Ga Ga"}), now, 30*time.Second); ok {
+		t.Fatal("expected different content not to match")
+	}
+
+	// The ring is bounded
+	for i := range recentSendsSize {
+		sends.add(strconv.Itoa(i), strconv.Itoa(i), now)
+	}
+	if _, ok := sends.find(key, now, 30*time.Second); ok {
+		t.Fatal("expected the oldest entry to be overwritten")
+	}
+}
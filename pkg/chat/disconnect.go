@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Why a websocket client disconnected, passed to OnDisconnect and counted in
+// Stats.
+const (
+	DisconnectLeft    = "left"             // the client sent a close frame
+	DisconnectLost    = "connection lost"  // the connection dropped without a close frame
+	DisconnectTimeout = "timeout"          // nothing was read within PongWait
+	DisconnectServer  = "closed by server" // see closeWith
+)
+
+var disconnectReasons = []string{DisconnectLeft, DisconnectLost, DisconnectTimeout, DisconnectServer}
+
+// disconnectCounts counts disconnects per reason. The map is filled once and
+// only read afterwards.
+type disconnectCounts map[string]*atomic.Uint64
+
+func newDisconnectCounts() disconnectCounts {
+	counts := make(disconnectCounts, len(disconnectReasons))
+	for _, reason := range disconnectReasons {
+		counts[reason] = new(atomic.Uint64)
+	}
+	return counts
+}
+
+func (d disconnectCounts) snapshot() map[string]uint64 {
+	s := make(map[string]uint64, len(d))
+	for reason, n := range d {
+		s[reason] = n.Load()
+	}
+	return s
+}
+
+// disconnectReason tells why reading from the client failed with err.
+func disconnectReason(cl *Client, err error) string {
+	var closeErr *websocket.CloseError
+	var netErr net.Error
+	switch {
+	case cl.closedByServer.Load():
+		return DisconnectServer
+	case errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure:
+		return DisconnectLeft
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return DisconnectTimeout
+	}
+	return DisconnectLost
+}
+
+// handleClose answers the close frame of the client with the same code, as
+// RFC 6455 asks, before the read loop tears the connection down.
+func (cl *Client) handleClose(code int, text string) error {
+	cl.trace.Trace().Int("code", code).Str("text", text).Msg("client sent close frame")
+	if code == websocket.CloseNoStatusReceived {
+		code = websocket.CloseNormalClosure
+	}
+	_ = cl.writeControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), cl.timings().CloseTimeout)
+	return nil
+}
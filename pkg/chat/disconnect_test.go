@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type reasonListener struct {
+	countingListener
+	reasons chan string
+}
+
+func (l *reasonListener) OnDisconnect(_ ClientInfo, reason string) { l.reasons <- reason }
+
+// startDisconnectChat connects user 12345 to a chat that emits disconnects
+// right away.
+func startDisconnectChat(t *testing.T) (*Chat, *reasonListener, *websocket.Conn) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	listener := &reasonListener{reasons: make(chan string, 1)}
+	chat := New(WithEventListener(listener))
+	chat.resumeGrace = 0
+	srv, wsBase := startTestServer(t, chat)
+	t.Cleanup(srv.Close)
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	t.Cleanup(func() { _ = user.Close() })
+	waitForUsers(t, chat, 1)
+	return chat, listener, user
+}
+
+func expectDisconnect(t *testing.T, chat *Chat, listener *reasonListener, want string) {
+	t.Helper()
+	select {
+	case reason := <-listener.reasons:
+		if reason != want {
+			t.Fatalf("expected disconnect reason %q, got %q", want, reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for disconnect")
+	}
+	if n := chat.Stats().Disconnects[want]; n != 1 {
+		t.Fatalf("expected 1 disconnect counted as %q, got: %+v", want, chat.Stats().Disconnects)
+	}
+}
+
+func TestCleanCloseEchoed(t *testing.T) {
+	chat, listener, user := startDisconnectChat(t)
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "tab closed")
+	if err := user.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("write close: %v", err)
+	}
+	_ = user.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := user.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expected the close frame to be echoed, got: %v", err)
+	}
+	expectDisconnect(t, chat, listener, DisconnectLeft)
+}
+
+func TestAbruptCloseIsConnectionLost(t *testing.T) {
+	chat, listener, user := startDisconnectChat(t)
+
+	_ = user.UnderlyingConn().Close()
+	expectDisconnect(t, chat, listener, DisconnectLost)
+}
+
+func TestDisconnectReason(t *testing.T) {
+	closedByServer := &Client{}
+	closedByServer.closedByServer.Store(true)
+	tests := []struct {
+		name   string
+		client *Client
+		err    error
+		want   string
+	}{
+		{"close frame", &Client{}, &websocket.CloseError{Code: websocket.CloseNormalClosure}, DisconnectLeft},
+		{"close without status", &Client{}, &websocket.CloseError{Code: websocket.CloseNoStatusReceived}, DisconnectLeft},
+		{"abnormal closure", &Client{}, &websocket.CloseError{Code: websocket.CloseAbnormalClosure}, DisconnectLost},
+		{"eof", &Client{}, io.ErrUnexpectedEOF, DisconnectLost},
+		{"read deadline", &Client{}, os.ErrDeadlineExceeded, DisconnectTimeout},
+		{"closed by server", closedByServer, errors.New("use of closed network connection"), DisconnectServer},
+	}
+	for _, tt := range tests {
+		if got := disconnectReason(tt.client, tt.err); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
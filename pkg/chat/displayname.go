@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+)
+
+const defaultDisplayNameFormat = "{given} {family}"
+
+// displayNameFormat is how the display_name of messages is built from the
+// sender's token, see ParseDisplayNameFormat.
+var displayNameFormat = String("RADIO_DISPLAY_NAME_FORMAT", defaultDisplayNameFormat)
+
+var defaultNameFormat, _ = ParseDisplayNameFormat(defaultDisplayNameFormat)
+
+// Tokens of a display name format.
+const (
+	nameLiteral = iota
+	nameGiven
+	nameFamily
+	nameID
+)
+
+var nameTokens = map[string]int{"given": nameGiven, "family": nameFamily, "id": nameID}
+
+type namePart struct {
+	kind    int
+	literal string
+}
+
+// DisplayNameFormat builds display names from a format with the tokens
+// {given}, {family} and {id}, parsed once by ParseDisplayNameFormat.
+type DisplayNameFormat struct {
+	parts []namePart
+}
+
+// ParseDisplayNameFormat parses a format such as "{family}, {given} ({id})".
+// Text outside the tokens is copied as is.
+func ParseDisplayNameFormat(format string) (DisplayNameFormat, error) {
+	var f DisplayNameFormat
+	for format != "" {
+		literal, rest, found := strings.Cut(format, "{")
+		if literal != "" {
+			f.parts = append(f.parts, namePart{kind: nameLiteral, literal: literal})
+		}
+		if !found {
+			break
+		}
+		token, after, closed := strings.Cut(rest, "}")
+		kind, known := nameTokens[token]
+		switch {
+		case !closed:
+			return DisplayNameFormat{}, errors.New("unclosed { in display name format")
+		case !known:
+			return DisplayNameFormat{}, errors.New("unknown token {" + token + "} in display name format, expected {given}, {family} or {id}")
+		}
+		f.parts = append(f.parts, namePart{kind: kind})
+		format = after
+	}
+	return f, nil
+}
+
+// Format returns the display name of a member, without surrounding spaces.
+func (f DisplayNameFormat) Format(id, given, family string) string {
+	var b strings.Builder
+	for _, p := range f.parts {
+		switch p.kind {
+		case nameGiven:
+			b.WriteString(given)
+		case nameFamily:
+			b.WriteString(family)
+		case nameID:
+			b.WriteString(id)
+		default:
+			b.WriteString(p.literal)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// displayName returns the display name of the client's messages.
+func (c *Chat) displayName(cl *Client) string {
+	return c.nameFormat.Format(cl.id, cl.givenName, cl.familyName)
+}
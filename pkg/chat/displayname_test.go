@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDisplayNameFormat(t *testing.T) {
+	tests := []struct {
+		format, given, family, want string
+	}{
+		{defaultDisplayNameFormat, "Alice", "User", "Alice User"},
+		{defaultDisplayNameFormat, "Alice", "", "Alice"},
+		{"{family}, {given} ({id})", "Alice", "User", "User, Alice (12345)"},
+		{"{given}{given}", "Bo", "", "BoBo"},
+		{"Member {id}", "Alice", "User", "Member 12345"},
+	}
+	for _, tt := range tests {
+		f, err := ParseDisplayNameFormat(tt.format)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.format, err)
+		}
+		if got := f.Format("12345", tt.given, tt.family); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.format, tt.want, got)
+		}
+	}
+	for _, format := range []string{"{given", "{nickname}", "{Given}"} {
+		if _, err := ParseDisplayNameFormat(format); err == nil {
+			t.Errorf("%q: expected an error", format)
+		}
+	}
+}
+
+func TestInvalidDisplayNameFormat(t *testing.T) {
+	prev := displayNameFormat
+	defer func() { displayNameFormat = prev }()
+	displayNameFormat = "{nickname}"
+
+	var fatal bool
+	for _, p := range CheckEnv() {
+		fatal = fatal || p.Setting == "RADIO_DISPLAY_NAME_FORMAT" && p.Fatal
+	}
+	if !fatal {
+		t.Fatal("expected the format to refuse startup")
+	}
+}
+
+func TestDispatchDisplayName(t *testing.T) {
+	chat := New()
+	chat.nameFormat, _ = ParseDisplayNameFormat("{family}, {given} ({id})")
+	chat.history = NewHistory(10)
+	user := &Client{role: "user", id: "12345", givenName: "Alice", familyName: "User", room: DefaultRoom}
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "hi"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	msgs := chat.history.Since("", 0, nil)
+	if len(msgs) != 1 || msgs[0].DisplayName != "User, Alice (12345)" {
+		t.Fatalf("expected the formatted display name, got: %+v", msgs)
+	}
+
+	chat.privacy = PrivacyAnonymous
+	if got := chat.hideMember(msgs[0]); got.DisplayName != "" {
+		t.Fatalf("expected anonymous radios to get no display name, got %q", got.DisplayName)
+	}
+}
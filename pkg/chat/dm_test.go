@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserDirectMessage(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.userDM = true
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	alice, radio := connectUserAndRadio(t, chat, wsBase)
+	defer alice.Close()
+	defer radio.Close()
+	carol := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute), "")
+	defer carol.Close()
+	waitForUsers(t, chat, 2)
+
+	if err := alice.WriteJSON(IncomingMessage{To: "22222", Content: "meet at the finish?"}); err != nil {
+		t.Fatalf("alice write: %v", err)
+	}
+	dm, err := readJSONWithDeadline[OutgoingMessage](t, carol, 2*time.Second)
+	if err != nil {
+		t.Fatalf("carol read: %v", err)
+	}
+	if dm.From != "12345" || dm.To != "22222" || dm.Content != "meet at the finish?" {
+		t.Fatalf("unexpected dm: %+v", dm)
+	}
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, radio, 200*time.Millisecond); err == nil {
+		t.Fatal("expected radios not to receive direct messages")
+	}
+
+	// Kept in the history, but not shown in the radio inbox
+	if msgs := chat.history.Since("", 0, nil); len(msgs) != 1 || msgs[0].ID != dm.ID {
+		t.Fatalf("expected dm in history, got: %+v", msgs)
+	}
+	if inbox := getInbox(t, chat, ""); len(inbox.Messages) != 0 {
+		t.Fatalf("expected dm not to be in the inbox, got: %+v", inbox.Messages)
+	}
+}
+
+func TestUserDirectMessageToAbsentUser(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.userDM = true
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	alice, radio := connectUserAndRadio(t, chat, wsBase)
+	defer alice.Close()
+	defer radio.Close()
+
+	if err := alice.WriteJSON(IncomingMessage{To: "22222", Content: "anyone there?"}); err != nil {
+		t.Fatalf("alice write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, alice, 2*time.Second)
+	if err != nil {
+		t.Fatalf("alice read: %v", err)
+	}
+	if out.Type != MessageTypeError || out.Content != "user not connected" {
+		t.Fatalf("expected error frame, got: %+v", out)
+	}
+}
+
+func TestUserDirectMessageDisabled(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.userDM = false
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	alice, radio := connectUserAndRadio(t, chat, wsBase)
+	defer alice.Close()
+	defer radio.Close()
+	carol := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute), "")
+	defer carol.Close()
+	waitForUsers(t, chat, 2)
+
+	if err := alice.WriteJSON(IncomingMessage{To: "22222", Content: "hello carol"}); err != nil {
+		t.Fatalf("alice write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil || out.Content != "hello carol" {
+		t.Fatalf("expected message at the radio, got: %+v, %v", out, err)
+	}
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, carol, 200*time.Millisecond); err == nil {
+		t.Fatal("expected no direct delivery while disabled")
+	}
+}
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	godotenv.Load()
+}
+
+// String retrieves a string from the environment. If not found, writes the
+// fallback value to the environment, before returning it.
+func String(env, fb string) (r string) {
+	r = fb
+	if v, exists := os.LookupEnv(env); exists {
+		r = v
+	}
+
+	return
+}
+
+// Int retrieves an integer from the environment, falling back to fb when the
+// variable is unset or not a number.
+func Int(env string, fb int) int {
+	v, exists := os.LookupEnv(env)
+	if !exists {
+		return fb
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		invalidEnv(env, "integer", v, err)
+		return fb
+	}
+	return i
+}
+
+// Duration retrieves a duration such as "5s" from the environment, falling back
+// to fb when the variable is unset or invalid.
+func Duration(env string, fb time.Duration) time.Duration {
+	v, exists := os.LookupEnv(env)
+	if !exists {
+		return fb
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		invalidEnv(env, "duration", v, err)
+		return fb
+	}
+	return d
+}
+
+// Bool retrieves a boolean from the environment, falling back to fb when the
+// variable is unset or invalid.
+func Bool(env string, fb bool) bool {
+	v, exists := os.LookupEnv(env)
+	if !exists {
+		return fb
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		invalidEnv(env, "boolean", v, err)
+		return fb
+	}
+	return b
+}
+
+// envProblems collects the variables that could not be parsed, see
+// EnvProblems.
+var (
+	envMu       sync.Mutex
+	envProblems []ConfigProblem
+)
+
+// invalidEnv logs and records a variable that falls back to its default.
+func invalidEnv(env, kind, value string, err error) {
+	log.Warn().Err(err).Str("env", env).Msg("invalid " + kind + ", using default")
+	envMu.Lock()
+	defer envMu.Unlock()
+	envProblems = append(envProblems, ConfigProblem{
+		Setting: env,
+		Err:     fmt.Errorf("invalid %s %q, using the default", kind, value),
+	})
+}
+
+// EnvProblems returns the variables read with Int, Duration or Bool so far
+// that could not be parsed and fell back to their default.
+func EnvProblems() []ConfigProblem {
+	envMu.Lock()
+	defer envMu.Unlock()
+	return slices.Clone(envProblems)
+}
+
+// parseList splits a comma-separated list, dropping empty entries.
+func parseList(raw string) []string {
+	var list []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
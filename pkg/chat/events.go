@@ -0,0 +1,80 @@
+package chat
+
+// ClientInfo describes a connected client to code outside the chat.
+type ClientInfo struct {
+	ID         string `json:"id" description:"Lidnr"`
+	Role       string `json:"role"` // one of Roles
+	Room       string `json:"room" description:"Room the client is connected to"`
+	GivenName  string `json:"given_name,omitempty" description:"Given name"`
+	FamilyName string `json:"family_name,omitempty" description:"Family name"`
+	Transport  string `json:"transport" enum:"websocket,sse,http"`
+
+	// Only set in state snapshots
+	LastRTTMs       float64 `json:"lastRttMs,omitempty" description:"Round trip time of the last ping, in milliseconds"`
+	Compressed      bool    `json:"compressed,omitempty" description:"Whether permessage-deflate was negotiated"`
+	DroppedMessages uint64  `json:"droppedMessages,omitempty" description:"Chat messages dropped because the send queue was full, see RADIO_DROP_ON_BACKPRESSURE"`
+	ClientVersion   string  `json:"clientVersion,omitempty" description:"Client version sent in the handshake"`
+	ClientPlatform  string  `json:"clientPlatform,omitempty" description:"Client platform sent in the handshake"`
+	UserAgent       string  `json:"userAgent,omitempty" description:"User-Agent of the websocket upgrade or stream request"`
+}
+
+// EventListener is notified of connection lifecycle events, for example by
+// monitoring. Methods are called on their own goroutine, so a slow listener
+// never holds up message routing, and may be called concurrently.
+type EventListener interface {
+	OnConnect(client ClientInfo)
+	OnDisconnect(client ClientInfo, reason string)
+	OnMessage(msg OutgoingMessage)
+	OnError(client ClientInfo, err error)
+}
+
+// Option configures a Chat in New.
+type Option func(*Chat)
+
+// WithEventListener adds a listener for connection events.
+func WithEventListener(l EventListener) Option {
+	return func(c *Chat) {
+		c.listeners = append(c.listeners, l)
+	}
+}
+
+func (cl *Client) info() ClientInfo {
+	transport := "websocket"
+	if cl.stream != nil {
+		transport = cl.stream.kind()
+	} else if cl.conn == nil {
+		transport = "http"
+	}
+	return ClientInfo{
+		ID:         cl.id,
+		Role:       cl.role,
+		Room:       cl.room,
+		GivenName:  cl.givenName,
+		FamilyName: cl.familyName,
+		Transport:  transport,
+	}
+}
+
+func (c *Chat) emitConnect(client ClientInfo) {
+	for _, l := range c.listeners {
+		go l.OnConnect(client)
+	}
+}
+
+func (c *Chat) emitDisconnect(client ClientInfo, reason string) {
+	for _, l := range c.listeners {
+		go l.OnDisconnect(client, reason)
+	}
+}
+
+func (c *Chat) emitMessage(msg OutgoingMessage) {
+	for _, l := range c.listeners {
+		go l.OnMessage(msg)
+	}
+}
+
+func (c *Chat) emitError(client ClientInfo, err error) {
+	for _, l := range c.listeners {
+		go l.OnError(client, err)
+	}
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingListener struct {
+	connects, disconnects, messages, errors atomic.Int32
+}
+
+func (l *countingListener) OnConnect(ClientInfo)            { l.connects.Add(1) }
+func (l *countingListener) OnDisconnect(ClientInfo, string) { l.disconnects.Add(1) }
+func (l *countingListener) OnMessage(OutgoingMessage)       { l.messages.Add(1) }
+func (l *countingListener) OnError(ClientInfo, error)       { l.errors.Add(1) }
+
+func waitForCalls(t *testing.T, name string, counter *atomic.Int32, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for counter.Load() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d %s calls, have %d", n, name, counter.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventListener(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	listener := &countingListener{}
+	chat := New(WithEventListener(listener))
+	chat.resumeGrace = 0 // disconnect right away instead of after the grace window
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer radio.Close()
+	waitForCalls(t, "OnConnect", &listener.connects, 2)
+
+	if err := user.WriteJSON(IncomingMessage{Content: "hello"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	waitForCalls(t, "OnMessage", &listener.messages, 1)
+
+	if err := user.WriteJSON(IncomingMessage{Type: "unknown"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	waitForCalls(t, "OnError", &listener.errors, 1)
+
+	_ = user.Close()
+	waitForCalls(t, "OnDisconnect", &listener.disconnects, 1)
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HandleExport streams the messages in the store, or in the history without
+// one, as newline-delimited JSON, oldest first, for support to download a
+// transcript. ?from= and ?to= are RFC 3339 times limiting sentAt to
+// [from, to), ?room= keeps the messages of a room and those sent to every
+// room. Requires the admin key.
+func (c *Chat) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+
+	var from, to time.Time
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+name+", expected RFC 3339")
+			return
+		}
+		*t = parsed
+	}
+	roomName := r.URL.Query().Get("room")
+
+	var messages []OutgoingMessage
+	if c.store != nil {
+		var err error
+		if messages, err = c.store.Query(r.Context(), StoreQuery{From: from, To: to, Room: roomName}); err != nil {
+			requestLogger(r.Context()).Error().Err(err).Msg("could not query message store")
+			writeError(w, http.StatusInternalServerError, "could not read messages")
+			return
+		}
+	} else {
+		messages = c.history.Since("", 0, func(_ string, msg OutgoingMessage) bool {
+			switch {
+			case !from.IsZero() && msg.SentAt.Before(from):
+				return false
+			case !to.IsZero() && !msg.SentAt.Before(to):
+				return false
+			}
+			return roomName == "" || msg.Room == "" || msg.Room == roomName
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="chat-export.ndjson"`)
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, msg := range messages {
+		if err := enc.Encode(msg); err != nil {
+			requestLogger(r.Context()).Debug().Err(err).Msg("export aborted")
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportHistory(t *testing.T, chat *Chat, query string) (*httptest.ResponseRecorder, []OutgoingMessage) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/history/export"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	chat.HandleExport(rec, req)
+
+	var messages []OutgoingMessage
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var msg OutgoingMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, msg)
+	}
+	return rec, messages
+}
+
+func TestExportTimeRange(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	start := time.Date(2026, 10, 16, 20, 0, 0, 0, time.UTC)
+	for i, room := range []string{DefaultRoom, "tech", DefaultRoom, ""} {
+		chat.history.Add("user", OutgoingMessage{
+			ID:      chat.nextMessageID(),
+			SentAt:  start.Add(time.Duration(i) * time.Hour),
+			From:    "12345",
+			Content: "message " + string(rune('a'+i)),
+			Room:    room,
+		})
+	}
+
+	rec, all := exportHistory(t, chat, "")
+	if rec.Code != http.StatusOK || len(all) != 4 {
+		t.Fatalf("expected all 4 messages, got %d: %+v", rec.Code, all)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("expected application/x-ndjson, got %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="chat-export.ndjson"`) {
+		t.Fatalf("expected an attachment, got %q", cd)
+	}
+
+	from := queryTime(start.Add(time.Hour))
+	to := queryTime(start.Add(3 * time.Hour))
+	_, ranged := exportHistory(t, chat, "?from="+from+"&to="+to)
+	if len(ranged) != 2 || ranged[0].Content != "message b" || ranged[1].Content != "message c" {
+		t.Fatalf("expected messages b and c, got: %+v", ranged)
+	}
+
+	_, room := exportHistory(t, chat, "?room=main&from="+from)
+	if len(room) != 2 || room[0].Content != "message c" || room[1].Content != "message d" {
+		t.Fatalf("expected message c and the message to every room, got: %+v", room)
+	}
+}
+
+func queryTime(t time.Time) string {
+	return url.QueryEscape(t.Format(time.RFC3339))
+}
+
+func TestExportEmpty(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+
+	rec, messages := exportHistory(t, chat, "")
+	if rec.Code != http.StatusOK || len(messages) != 0 || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty export, got %d: %q", rec.Code, rec.Body)
+	}
+	chat.history.Add("user", OutgoingMessage{ID: chat.nextMessageID(), SentAt: time.Now(), Content: "hi", Room: DefaultRoom})
+	if _, messages := exportHistory(t, chat, "?to="+queryTime(time.Now().Add(-time.Hour))); len(messages) != 0 {
+		t.Fatalf("expected nothing before the first message, got: %+v", messages)
+	}
+
+	if rec, _ := exportHistory(t, chat, "?from=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid from, got %d", rec.Code)
+	}
+	chat.adminKey = "other"
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/history/export", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = httptest.NewRecorder()
+	chat.HandleExport(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin key, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// fanoutWorkers is how many deliveries of a broadcast run at once. 0, the
+// default, delivers to one recipient after the other, which is faster as long
+// as a delivery only queues the message, see BenchmarkBroadcast.
+var fanoutWorkers = Int("RADIO_FANOUT_WORKERS", 0)
+
+var broadcastDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "radiogaga_broadcast_duration_seconds",
+	Help:    "Time to hand a message to every recipient of a room-wide delivery.",
+	Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+})
+
+// fanoutJob delivers the shared payload to a single recipient.
+type fanoutJob struct {
+	ctx    context.Context
+	client *Client
+	send   func(*Client, []byte) error
+	data   []byte
+	err    *error // where the outcome goes, owned by this job
+	wg     *sync.WaitGroup
+}
+
+// deliveryFailure is a recipient a fan-out could not deliver to.
+type deliveryFailure struct {
+	client *Client
+	err    error
+}
+
+// fanoutPool spreads the deliveries of a message over a fixed number of
+// workers, so a few slow recipients do not hold up everyone else. Workers are
+// started on first use and stopped by Chat.Shutdown.
+type fanoutPool struct {
+	chat    *Chat
+	workers int
+	jobs    chan fanoutJob
+	start   sync.Once
+	running sync.WaitGroup
+
+	mu      sync.RWMutex // held for reading while jobs are queued, see stop
+	stopped bool
+}
+
+func newFanoutPool(c *Chat, workers int) *fanoutPool {
+	return &fanoutPool{chat: c, workers: workers, jobs: make(chan fanoutJob)}
+}
+
+func (p *fanoutPool) run() {
+	defer p.running.Done()
+	for job := range p.jobs {
+		*job.err = p.chat.traceWrite(job.ctx, job.client, job.send, job.data)
+		job.wg.Done()
+	}
+}
+
+// deliver sends data to every recipient and returns those it failed for. It
+// returns once every send finished, so deliveries of the next message never
+// overtake this one. Without workers, or once stopped, it sends inline.
+func (p *fanoutPool) deliver(ctx context.Context, recipients []*Client, send func(*Client, []byte) error, data []byte) []deliveryFailure {
+	defer prometheus.NewTimer(broadcastDuration).ObserveDuration()
+	errs := make([]error, len(recipients))
+
+	p.mu.RLock()
+	if p.workers <= 0 || p.stopped || len(recipients) < 2 {
+		p.mu.RUnlock()
+		for i, cl := range recipients {
+			errs[i] = p.chat.traceWrite(ctx, cl, send, data)
+		}
+	} else {
+		p.start.Do(func() {
+			p.running.Add(p.workers)
+			for range p.workers {
+				go p.run()
+			}
+		})
+		var wg sync.WaitGroup
+		wg.Add(len(recipients))
+		for i, cl := range recipients {
+			p.jobs <- fanoutJob{ctx: ctx, client: cl, send: send, data: data, err: &errs[i], wg: &wg}
+		}
+		p.mu.RUnlock()
+		wg.Wait()
+	}
+
+	var failed []deliveryFailure
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, deliveryFailure{client: recipients[i], err: err})
+		}
+	}
+	return failed
+}
+
+// stop waits for queued deliveries and ends the workers. Later deliveries are
+// sent inline.
+func (p *fanoutPool) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+	close(p.jobs)
+	p.running.Wait()
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// streamUsers registers n users connected over server-sent events.
+func streamUsers(chat *Chat, n int) []*Client {
+	users := make([]*Client, n)
+	for i := range users {
+		users[i] = &Client{role: "user", id: strconv.Itoa(10000 + i), room: DefaultRoom, stream: newSSEStream()}
+		chat.register(users[i])
+	}
+	return users
+}
+
+func TestFanoutSlowRecipients(t *testing.T) {
+	chat := New()
+	chat.fanout = newFanoutPool(chat, 8)
+	defer chat.fanout.stop()
+	users := streamUsers(chat, 100)
+
+	// Four recipients take a while each, one after the other that adds up
+	const delay = 100 * time.Millisecond
+	slow := map[*Client]bool{users[0]: true, users[10]: true, users[20]: true, users[30]: true}
+	send := func(cl *Client, data []byte) error {
+		if slow[cl] {
+			time.Sleep(delay)
+		}
+		return cl.send(data)
+	}
+
+	start := time.Now()
+	if failed := chat.fanout.deliver(context.Background(), users, send, []byte(`{"content":"hi"}`)); len(failed) != 0 {
+		t.Fatalf("expected every delivery to succeed, got: %+v", failed)
+	}
+	if elapsed := time.Since(start); elapsed >= 3*delay {
+		t.Fatalf("expected the slow recipients to be served side by side, took %v", elapsed)
+	}
+	for _, u := range users {
+		if len(u.stream.(*sseStream).queue) != 1 {
+			t.Fatalf("expected user %s to get the message", u.id)
+		}
+	}
+}
+
+func TestFanoutDropsFailures(t *testing.T) {
+	chat := New()
+	chat.fanout = newFanoutPool(chat, 4)
+	users := streamUsers(chat, 10)
+	users[3].stream.close(0, "")
+
+	chat.deliverToUsers(context.Background(), OutgoingMessage{ID: chat.nextMessageID(), Content: "hi", Room: DefaultRoom})
+	if n := chat.Stats().ConnectedUsers; n != 9 {
+		t.Fatalf("expected the closed stream to be removed, have %d users", n)
+	}
+	for i, u := range users {
+		if got := len(u.stream.(*sseStream).queue); got != 1 && i != 3 {
+			t.Fatalf("expected user %s to get the message, got %d", u.id, got)
+		}
+	}
+
+	// Once stopped, deliveries are sent inline
+	chat.fanout.stop()
+	chat.deliverToUsers(context.Background(), OutgoingMessage{ID: chat.nextMessageID(), Content: "again", Room: DefaultRoom})
+	if got := len(users[0].stream.(*sseStream).queue); got != 2 {
+		t.Fatalf("expected delivery after stopping the pool, got %d messages", got)
+	}
+}
@@ -0,0 +1,129 @@
+package chat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrMessageBlocked = errors.New("message blocked")
+
+// ContentFilter decides whether a user message must be blocked.
+type ContentFilter interface {
+	Match(content string) bool
+}
+
+type contentFilter struct {
+	ContentFilter
+	action FilterAction
+}
+
+// FilterAction decides what happens to a user whose message is blocked. The
+// message itself is always dropped.
+type FilterAction string
+
+const (
+	FilterActionWarn       FilterAction = "warn"       // tell the user the message was blocked
+	FilterActionDrop       FilterAction = "drop"       // drop silently
+	FilterActionDisconnect FilterAction = "disconnect" // close the connection
+)
+
+func ParseFilterAction(s string) (FilterAction, error) {
+	switch a := FilterAction(s); a {
+	case FilterActionWarn, FilterActionDrop, FilterActionDisconnect:
+		return a, nil
+	}
+	return "", fmt.Errorf("invalid filter action %q, want warn, drop or disconnect", s)
+}
+
+// WordFilter matches banned words and phrases on word boundaries, ignoring
+// case and punctuation, so "ass" does not match "class".
+type WordFilter struct {
+	phrases []string // normalized, see normalizeWords
+}
+
+func NewWordFilter(words []string) *WordFilter {
+	f := &WordFilter{}
+	for _, w := range words {
+		if n := normalizeWords(w); n != "" {
+			f.phrases = append(f.phrases, n)
+		}
+	}
+	return f
+}
+
+// LoadWordFilter reads a newline-delimited list of banned words and phrases.
+// Empty lines and lines starting with # are skipped.
+func LoadWordFilter(path string) (*WordFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordFilter(words), nil
+}
+
+func (f *WordFilter) Match(content string) bool {
+	padded := " " + normalizeWords(content) + " "
+	for _, p := range f.phrases {
+		if strings.Contains(padded, " "+p+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWords lowercases s and reduces it to its words separated by single
+// spaces.
+func normalizeWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// UseFilter blocks user messages matching the filter, applying the action to
+// the sender. Filters must be added before the chat starts serving.
+func (c *Chat) UseFilter(f ContentFilter, action FilterAction) {
+	c.filters = append(c.filters, contentFilter{ContentFilter: f, action: action})
+}
+
+// filtered reports whether the message is blocked, and applies the action of
+// the first matching filter to the sender.
+func (c *Chat) filtered(client *Client, in IncomingMessage) bool {
+	if client.role != "user" {
+		return false
+	}
+	i := slices.IndexFunc(c.filters, func(f contentFilter) bool { return f.Match(in.Content) })
+	if i < 0 {
+		return false
+	}
+	c.filteredMessages.Add(1)
+
+	switch c.filters[i].action {
+	case FilterActionDisconnect:
+		client.closeWith(websocket.ClosePolicyViolation, ErrMessageBlocked.Error())
+	case FilterActionDrop:
+	default:
+		c.sendNotice(client, MessageTypeWarning, ErrMessageBlocked.Error())
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWordFilterMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# banned\nspam\n\nBuy Now\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := LoadWordFilter(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	for content, want := range map[string]bool{
+		"this is SPAM!":           true,
+		"buy   now, cheap":        true,
+		"spam.":                   true,
+		"nice song":               false,
+		"spammer":                 false,
+		"buy it now":              false,
+		"# banned":                false,
+		"I'd like to buy nowhere": false,
+	} {
+		if got := filter.Match(content); got != want {
+			t.Errorf("Match(%q) = %v, want %v", content, got, want)
+		}
+	}
+}
+
+func TestBlockedMessageWarnsUser(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.UseFilter(NewWordFilter([]string{"spam"}), FilterActionWarn)
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, 1)
+
+	if err := user.WriteJSON(IncomingMessage{Content: "spam spam spam"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	warning, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if warning.Type != MessageTypeWarning || warning.Content != "message blocked" {
+		t.Fatalf("unexpected warning: %+v", warning)
+	}
+
+	// The connection stays open and clean messages still go through
+	if err := user.WriteJSON(IncomingMessage{Content: "clean"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.Content != "clean" {
+		t.Fatalf("expected only the clean message at the radio, got: %+v", out)
+	}
+	if n := chat.Stats().FilteredMessages; n != 1 {
+		t.Fatalf("expected 1 filtered message, got %d", n)
+	}
+}
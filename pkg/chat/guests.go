@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxGuests caps concurrent guest connections per instance. 0, the default,
+// disables guest access, as guests read the chat without a token.
+var maxGuests = Int("RADIO_MAX_GUESTS", 0)
+
+var (
+	ErrGuestReadOnly = errors.New("guests cannot send messages")
+	ErrTooManyGuests = errors.New("too many guests")
+)
+
+// guestVisible reports whether a message delivered to users is also sent to
+// guests. Guests only follow what is said to everyone, such as broadcasts and
+// announcements, never messages meant for a single member.
+func guestVisible(msg OutgoingMessage) bool {
+	if msg.To != "" {
+		return false
+	}
+	switch msg.Type {
+	case MessageTypeSystem, MessageTypeUnpin, MessageTypeRadioUpdate:
+		return true
+	}
+	return false
+}
+
+// reserveGuest claims a guest slot, reporting false when all are taken.
+func (c *Chat) reserveGuest() bool {
+	for {
+		n := c.guestCount.Load()
+		if int(n) >= c.guestLimit {
+			return false
+		}
+		if c.guestCount.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (c *Chat) releaseGuest() {
+	c.guestCount.Add(-1)
+}
+
+// guestID returns the ID of a guest connection. The prefix keeps it apart
+// from member lidnrs in logs and events.
+func guestID(connID string) string {
+	return "guest-" + connID
+}
+
+// rejectGuest refuses a frame sent by a guest with an error frame, keeping
+// the connection open.
+func (c *Chat) rejectGuest(client *Client) error {
+	c.sendNotice(client, MessageTypeError, ErrGuestReadOnly.Error())
+	return ErrGuestReadOnly
+}
+
+// acceptGuest upgrades a guest connection. Guests skip the handshake and any
+// token, are never listed as users and do not cause connect or disconnect
+// events.
+func (c *Chat) acceptGuest(w http.ResponseWriter, r *http.Request, roomName string, requested []string, tokenProtocol string) {
+	logger := requestLogger(r.Context())
+	if !c.reserveGuest() {
+		logger.Warn().Int("limit", c.guestLimit).Msg("rejecting guest: limit reached")
+		http.Error(w, ErrTooManyGuests.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	upgrader, header := c.upgraderFor(requested, tokenProtocol)
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		c.releaseGuest()
+		logger.Warn().Err(err).Msg("websocket upgrade failed")
+		return
+	}
+
+	connID := newConnID()
+	client := &Client{
+		conn:     conn,
+		role:     "guest",
+		connID:   connID,
+		id:       guestID(connID),
+		room:     roomName,
+		protocol: negotiatedProtocol(conn, tokenProtocol),
+
+		recentMsgIDs: newRecentMsgIDs(),
+	}
+	client.binary = c.binaryFor(client.protocol)
+	client.style = c.style
+	client.ws = &c.ws
+	client.queueWait = c.sendQueueWait(client)
+	client.setLogger(withConnID(logger, connID))
+	if !c.admit(client) {
+		c.releaseGuest()
+		c.refuseShutdown(client)
+		return
+	}
+	c.setupCompression(client, r)
+	client.upgrade = trace.LinkFromContext(r.Context())
+	client.startWriter()
+	client.keepAlive()
+
+	if err := c.register(client); err != nil {
+		client.log.Info().Err(err).Msg("refusing guest")
+		client.closeWith(CloseCodeRoomClosed, CloseReason(CloseCodeRoomClosed))
+		c.releaseGuest()
+		c.release(client)
+		return
+	}
+	client.log.Info().Str("room", roomName).Msg("guest connected")
+	c.sendPinned(client)
+
+	go c.handleClient(client)
+}
@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialGuest(t *testing.T, wsBase string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(wsBase+"?role=guest", nil)
+	if err != nil {
+		if resp != nil {
+			t.Fatalf("dial guest failed: %v, status=%d", err, resp.StatusCode)
+		}
+		t.Fatalf("dial guest failed: %v", err)
+	}
+	return conn
+}
+
+func waitForGuests(t *testing.T, chat *Chat, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := chat.Stats().ConnectedGuests
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d guests, have %d", n, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGuestReceivesBroadcastsOnly(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.guestLimit = 10
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+	guest := dialGuest(t, wsBase)
+	defer guest.Close()
+	waitForGuests(t, chat, 1)
+
+	// A direct reply to a member is not for guests, so the broadcast after it
+	// is the first frame the guest gets
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "Coming up next"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	expectContent(t, user, "Coming up next")
+	if rec := postBroadcast(t, chat, RADIOChatKey, `{"content":"Team 42 has passed checkpoint 7"}`); rec.Code != http.StatusOK {
+		t.Fatalf("broadcast: %d %s", rec.Code, rec.Body)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, guest, 2*time.Second)
+	if err != nil || out.Type != MessageTypeSystem || out.Content != "Team 42 has passed checkpoint 7" {
+		t.Fatalf("expected broadcast for the guest, got: %+v (%v)", out, err)
+	}
+}
+
+func TestGuestSendRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.guestLimit = 10
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	waitForRadios(t, chat, 1)
+	guest := dialGuest(t, wsBase)
+	defer guest.Close()
+	waitForGuests(t, chat, 1)
+
+	if err := guest.WriteJSON(IncomingMessage{Content: "can I request a song?"}); err != nil {
+		t.Fatalf("guest write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, guest, 2*time.Second)
+	if err != nil || out.Type != MessageTypeError || out.Content != ErrGuestReadOnly.Error() {
+		t.Fatalf("expected an error frame, got: %+v (%v)", out, err)
+	}
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 200*time.Millisecond); err == nil {
+		t.Fatalf("expected nothing on the radio, got: %+v", out)
+	}
+}
+
+func TestGuestsKeptApartFromUsers(t *testing.T) {
+	chat := New()
+	chat.guestLimit = 1
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	guest := dialGuest(t, wsBase)
+	defer guest.Close()
+	waitForGuests(t, chat, 1)
+
+	if users := chat.Users(""); len(users) != 0 {
+		t.Fatalf("expected guests not to be listed, got: %+v", users)
+	}
+	if s := chat.Stats(); s.ConnectedUsers != 0 || len(s.Rooms) != 1 || s.Rooms[0].ConnectedGuests != 1 {
+		t.Fatalf("expected one guest and no users, got: %+v", s)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsBase+"?role=guest", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 over the guest limit, got: %v", err)
+	}
+
+	// The slot is freed on disconnect
+	_ = guest.Close()
+	waitForGuests(t, chat, 0)
+	other := dialGuest(t, wsBase)
+	_ = other.Close()
+}
+
+func TestGuestsDisabledByDefault(t *testing.T) {
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsBase+"?role=guest", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected guests to be refused by default, got: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import "net/http"
+
+// Handler serves the websocket endpoint and the chat's REST API under
+// /api/v1. Requests are tagged with a request ID and panics are reported to
+// the chat's ErrorReporter. Mount it at the root of a mux to add endpoints
+// next to it.
+func (c *Chat) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", c.HandleWS)
+	mux.HandleFunc("/api/v1/health", c.HandleHealth)
+	mux.HandleFunc("/api/v1/broadcast", c.HandleBroadcast)
+	mux.HandleFunc("/api/v1/chat/inbox", c.HandleInbox)
+	mux.HandleFunc("/api/v1/chat/reply", c.HandleReply)
+	mux.HandleFunc("/api/v1/chat/stream", c.HandleStream)
+	mux.HandleFunc("/api/v1/chat/send", c.HandleSend)
+	mux.HandleFunc("/api/v1/poll", c.HandleLongPoll)
+	mux.HandleFunc("/api/v1/chat/users", c.HandleUsers)
+	mux.HandleFunc("/api/v1/chat/questions", c.HandleQuestions)
+	mux.HandleFunc("/api/v1/chat/audit", c.HandleAudit)
+	mux.HandleFunc("/api/v1/history/export", c.HandleExport)
+	mux.HandleFunc("/api/v1/history/users/{id}", c.HandleUserHistory)
+	mux.HandleFunc("/api/v1/state", c.HandleState)
+	mux.HandleFunc("/api/v1/metrics/connections", c.HandleConnectionMetrics)
+	mux.HandleFunc("/api/v1/countdown", c.HandleCountdown)
+	mux.HandleFunc("/api/v1/connections/{id}", c.HandleConnection)
+	mux.HandleFunc("/api/v1/connections/{id}/messages", c.HandleConnectionMessages)
+	mux.HandleFunc("/api/v1/polls/{id}", c.HandlePoll)
+	mux.HandleFunc("/api/v1/rooms", c.HandleRooms)
+	mux.HandleFunc("/api/v1/rooms/{name}", c.HandleRoom)
+	return c.wrapHandler(mux)
+}
+
+// PublicHandler serves only what members connect with, the websocket
+// endpoint and its server-sent events and long-poll fallbacks, and the health
+// check, for a listener facing the internet while Handler is served on an
+// internal one.
+func (c *Chat) PublicHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", c.HandleWS)
+	mux.HandleFunc("/api/v1/chat/stream", c.HandleStream)
+	mux.HandleFunc("/api/v1/chat/send", c.HandleSend)
+	mux.HandleFunc("/api/v1/poll", c.HandleLongPoll)
+	mux.HandleFunc("/api/v1/health", c.HandleHealth)
+	return c.wrapHandler(mux)
+}
+
+// wrapHandler tags requests with a request ID and reports panics.
+func (c *Chat) wrapHandler(h http.Handler) http.Handler {
+	return requestIDMiddleware(c.log, recoverMiddleware(c.reporter, h))
+}
+
+// HandleHealth answers 200 while the chat accepts clients, and 503 once it is
+// draining so load balancers stop sending new clients here.
+func (c *Chat) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if c.Draining() {
+		writeJSON(w, http.StatusServiceUnavailable, StatusResponse{Status: "draining"})
+		return
+	}
+	writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+}
@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"slices"
+	"sync"
+)
+
+var historySize = Int("CHAT_HISTORY_SIZE", 500)
+
+type historyEntry struct {
+	role      string // role of the sender, empty for system messages
+	msg       OutgoingMessage
+	retracted bool
+}
+
+// History is a fixed size ring buffer of recently dispatched messages, oldest
+// first. Message IDs are increasing, so cursors can be compared as strings.
+type History struct {
+	mu      sync.Mutex
+	entries []historyEntry
+	start   int
+	size    int
+	byID    map[string]int // message ID -> index in entries, evicted with the entry
+}
+
+func NewHistory(capacity int) *History {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &History{
+		entries: make([]historyEntry, capacity),
+		byID:    make(map[string]int, capacity),
+	}
+}
+
+func (h *History) Add(role string, msg OutgoingMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := (h.start + h.size) % len(h.entries)
+	if h.size < len(h.entries) {
+		h.size++
+	} else {
+		delete(h.byID, h.entries[i].msg.ID)
+		h.start = (h.start + 1) % len(h.entries)
+	}
+	h.entries[i] = historyEntry{role: role, msg: msg}
+	h.byID[msg.ID] = i
+}
+
+// Lookup returns a message still in the history by its ID, together with the
+// role of its sender.
+func (h *History) Lookup(id string) (role string, msg OutgoingMessage, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i, ok := h.byID[id]
+	if !ok {
+		return "", OutgoingMessage{}, false
+	}
+	return h.entries[i].role, h.entries[i].msg, true
+}
+
+// Update changes a message still in the history if match accepts it, and
+// reports whether it did.
+func (h *History) Update(id string, match func(role string, msg OutgoingMessage) bool, update func(msg *OutgoingMessage)) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i, ok := h.byID[id]
+	if !ok || !match(h.entries[i].role, h.entries[i].msg) {
+		return false
+	}
+	update(&h.entries[i].msg)
+	return true
+}
+
+// Remove retracts a message, so it is no longer returned by Lookup or Since.
+// It reports whether the message was still in the history.
+func (h *History) Remove(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i, ok := h.byID[id]
+	if !ok {
+		return false
+	}
+	delete(h.byID, id)
+	h.entries[i].retracted = true
+	return true
+}
+
+// EraseUser removes the messages sent by or to the member, and returns how
+// many there were.
+func (h *History) EraseUser(lidnr string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for i := 0; i < h.size; i++ {
+		e := &h.entries[(h.start+i)%len(h.entries)]
+		if e.retracted || (e.msg.From != lidnr && e.msg.To != lidnr) {
+			continue
+		}
+		delete(h.byID, e.msg.ID)
+		*e = historyEntry{retracted: true}
+		n++
+	}
+	return n
+}
+
+// Since returns up to limit messages with an ID after the cursor that match
+// the filter, oldest first. An empty cursor starts at the oldest message and a
+// limit <= 0 means no limit.
+func (h *History) Since(cursor string, limit int, match func(role string, msg OutgoingMessage) bool) []OutgoingMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []OutgoingMessage
+	for i := 0; i < h.size; i++ {
+		e := h.entries[(h.start+i)%len(h.entries)]
+		if e.retracted || e.msg.ID <= cursor || (match != nil && !match(e.role, e.msg)) {
+			continue
+		}
+		out = append(out, e.msg)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+// Before returns the last limit messages with an ID before the cursor that
+// match the filter, oldest first. An empty cursor starts after the newest
+// message and a limit <= 0 means no limit.
+func (h *History) Before(cursor string, limit int, match func(role string, msg OutgoingMessage) bool) []OutgoingMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []OutgoingMessage
+	for i := h.size - 1; i >= 0; i-- {
+		e := h.entries[(h.start+i)%len(h.entries)]
+		if e.retracted || (cursor != "" && e.msg.ID >= cursor) || (match != nil && !match(e.role, e.msg)) {
+			continue
+		}
+		out = append(out, e.msg)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	slices.Reverse(out)
+	return out
+}
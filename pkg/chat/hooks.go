@@ -0,0 +1,48 @@
+package chat
+
+import "context"
+
+// MessageHook is a side effect executed for every valid message of a given
+// type, before the message is routed.
+type MessageHook func(ctx context.Context, client *Client, msg IncomingMessage)
+
+type cancelDeliveryKey struct{}
+
+// OnMessageType registers a hook for a message type. Hooks run synchronously in
+// registration order.
+func (c *Chat) OnMessageType(msgType string, hook MessageHook) {
+	c.typesMu.Lock()
+	defer c.typesMu.Unlock()
+	c.hooks[msgType] = append(c.hooks[msgType], hook)
+}
+
+// CancelDelivery can be called by a hook to stop the remaining hooks and
+// prevent the message from being routed.
+func CancelDelivery(ctx context.Context) {
+	if cancel, ok := ctx.Value(cancelDeliveryKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
+
+// runHooks executes the hooks for the message type and reports whether the
+// message should still be delivered.
+func (c *Chat) runHooks(parent context.Context, client *Client, in IncomingMessage) bool {
+	c.typesMu.RLock()
+	hooks := c.hooks[in.Type]
+	c.typesMu.RUnlock()
+	if len(hooks) == 0 {
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	ctx = context.WithValue(ctx, cancelDeliveryKey{}, cancel)
+
+	for _, hook := range hooks {
+		hook(ctx, client, in)
+		if ctx.Err() != nil {
+			return false
+		}
+	}
+	return true
+}
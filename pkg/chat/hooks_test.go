@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMessageHookCountsCalls(t *testing.T) {
+	chat := New()
+	client := &Client{role: "user", id: "12345"}
+
+	var order []int
+	chat.OnMessageType(MessageTypeChat, func(ctx context.Context, cl *Client, msg IncomingMessage) {
+		order = append(order, 1)
+	})
+	chat.OnMessageType(MessageTypeChat, func(ctx context.Context, cl *Client, msg IncomingMessage) {
+		order = append(order, 2)
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := chat.dispatch(context.Background(), client, IncomingMessage{Content: "hello"}); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+	}
+	// Invalid messages never reach hooks
+	_ = chat.dispatch(context.Background(), client, IncomingMessage{})
+
+	if len(order) != 6 {
+		t.Fatalf("expected 6 hook calls, got %d", len(order))
+	}
+	for i := 0; i < len(order); i += 2 {
+		if order[i] != 1 || order[i+1] != 2 {
+			t.Fatalf("hooks not called in registration order: %v", order)
+		}
+	}
+}
+
+func TestMessageHookCancelsDelivery(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	chat.OnMessageType(MessageTypeChat, func(ctx context.Context, cl *Client, msg IncomingMessage) {
+		if msg.Content == "blocked" {
+			CancelDelivery(ctx)
+		}
+	})
+	laterCalled := false
+	chat.OnMessageType(MessageTypeChat, func(ctx context.Context, cl *Client, msg IncomingMessage) {
+		if msg.Content == "blocked" {
+			laterCalled = true
+		}
+	})
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForRadios(t, chat, 1)
+
+	if err := user.WriteJSON(IncomingMessage{Content: "blocked"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	if err := user.WriteJSON(IncomingMessage{Content: "allowed"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.Content != "allowed" {
+		t.Fatalf("expected cancelled message to be dropped, got: %+v", out)
+	}
+	if laterCalled {
+		t.Fatal("expected hooks after cancellation to be skipped")
+	}
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// icecastSource is a mount point in /status-json.xsl.
+type icecastSource struct {
+	ListenURL string `json:"listenurl"`
+	Title     string `json:"title"`
+	Artist    string `json:"artist"`
+	Listeners int    `json:"listeners"`
+}
+
+// icecastStatus is the /status-json.xsl document. Icecast sends source as an
+// object with one mount point and as an array with several.
+type icecastStatus struct {
+	Icestats struct {
+		Source json.RawMessage `json:"source"`
+	} `json:"icestats"`
+}
+
+func (s icecastStatus) sources() ([]icecastSource, error) {
+	raw := s.Icestats.Source
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '[' {
+		var sources []icecastSource
+		err := json.Unmarshal(raw, &sources)
+		return sources, err
+	}
+	var source icecastSource
+	err := json.Unmarshal(raw, &source)
+	return []icecastSource{source}, err
+}
+
+// IcecastPoller copies the now playing metadata of a mount point into the
+// radio state, telling clients when it changes.
+type IcecastPoller struct {
+	URL      string
+	Mount    string // e.g. /high, the first mount point when empty or not found
+	Interval time.Duration
+	State    *RadioState
+	OnChange func(RadioInfo)
+
+	client *http.Client
+}
+
+// Run polls until ctx is done. While Icecast is down the last metadata is
+// kept.
+func (p *IcecastPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.poll(ctx); err != nil {
+			log.Warn().Err(err).Str("url", p.URL).Msg("could not poll Icecast, keeping metadata")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *IcecastPoller) poll(ctx context.Context) error {
+	if p.client == nil {
+		p.client = &http.Client{Timeout: p.Interval}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var status icecastStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("decode status: %w", err)
+	}
+	sources, err := status.sources()
+	if err != nil {
+		return fmt.Errorf("decode sources: %w", err)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no mount points")
+	}
+
+	source := sources[0]
+	for _, s := range sources {
+		if p.Mount != "" && strings.HasSuffix(s.ListenURL, p.Mount) {
+			source = s
+			break
+		}
+	}
+	info, changed := p.State.SetMetadata(source.Title, source.Artist)
+	if changed {
+		log.Info().Str("title", info.Title).Str("artist", info.Artist).Msg("radio metadata changed")
+		if p.OnChange != nil {
+			p.OnChange(info)
+		}
+	}
+	return nil
+}
+
+// RadioUpdate sends the radio info to every user and radio on this instance.
+// It is not published, as every instance polls Icecast itself. Info POSTed to
+// HandleRadio is published, see publishRadio.
+func (c *Chat) RadioUpdate(ctx context.Context, info RadioInfo) {
+	out := radioUpdate(info)
+	c.deliverToUsers(ctx, out)
+	c.deliverToRadios(ctx, nil, out)
+}
+
+func radioUpdate(info RadioInfo) OutgoingMessage {
+	info.Live = info.IsLive()
+	return OutgoingMessage{
+		SentAt: time.Now(),
+		Type:   MessageTypeRadioUpdate,
+		Title:  info.Title,
+		Artist: info.Artist,
+		Radio:  &info,
+	}
+}
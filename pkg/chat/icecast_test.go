@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeIcecast serves status as /status-json.xsl, or 503 when it is empty.
+type fakeIcecast struct {
+	mu     sync.Mutex
+	status string
+}
+
+func (f *fakeIcecast) set(status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakeIcecast) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte(f.status))
+}
+
+func TestIcecastPoll(t *testing.T) {
+	icecast := &fakeIcecast{}
+	srv := httptest.NewServer(icecast)
+	defer srv.Close()
+
+	var updates []RadioInfo
+	poller := &IcecastPoller{
+		URL:      srv.URL + "/status-json.xsl",
+		Mount:    "/high",
+		Interval: time.Second,
+		State:    NewRadioState(RadioInfo{StartTime: "2025-08-18T07:00:00Z"}),
+		OnChange: func(info RadioInfo) { updates = append(updates, info) },
+	}
+	ctx := context.Background()
+
+	icecast.set(`{"icestats": {"source": [
+		{"listenurl": "http://bata-radio.snt.utwente.nl/low", "title": "Low", "artist": "Low"},
+		{"listenurl": "http://bata-radio.snt.utwente.nl/high", "title": "Radio Ga Ga", "artist": "Queen", "listeners": 42}
+	]}}`)
+	if err := poller.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if info := poller.State.Info(); info.Title != "Radio Ga Ga" || info.Artist != "Queen" {
+		t.Fatalf("unexpected metadata: %+v", info)
+	}
+
+	// Unchanged metadata is not announced again
+	if err := poller.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("expected 1 update, got %d", len(updates))
+	}
+
+	// A single mount point is sent as an object
+	icecast.set(`{"icestats": {"source": {"listenurl": "http://bata-radio.snt.utwente.nl/high", "title": "Bohemian Rhapsody", "artist": "Queen"}}}`)
+	if err := poller.poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(updates) != 2 || updates[1].Title != "Bohemian Rhapsody" || updates[1].StartTime != "2025-08-18T07:00:00Z" {
+		t.Fatalf("unexpected updates: %+v", updates)
+	}
+
+	// Downtime keeps the last metadata
+	icecast.set("")
+	if err := poller.poll(ctx); err == nil {
+		t.Fatal("expected error while Icecast is down")
+	}
+	if info := poller.State.Info(); info.Title != "Bohemian Rhapsody" {
+		t.Fatalf("expected metadata to be kept, got: %+v", info)
+	}
+}
+
+func TestRadioUpdateDelivered(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	chat.RadioUpdate(context.Background(), RadioInfo{Title: "Radio Ga Ga", Artist: "Queen"})
+	for name, conn := range map[string]*websocket.Conn{"user": user, "radio": radio} {
+		out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+		if err != nil || out.Type != MessageTypeRadioUpdate || out.Title != "Radio Ga Ga" || out.Artist != "Queen" {
+			t.Fatalf("%s: expected radio_update, got: %+v (%v)", name, out, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package chat
+
+import "time"
+
+// idleTimeout closes user connections that neither sent nor were sent a
+// message for this long, 0 disables. Radios are never closed for idling.
+var idleTimeout = Duration("CHAT_IDLE_TIMEOUT", 0)
+
+// IdleReason is the close message of idle connections, so the frontend can
+// offer to reconnect.
+const IdleReason = "idle timeout"
+
+// startIdleTimer closes the client with CloseCodeSessionExpired once it has
+// been idle for the timeout. See touch.
+func (cl *Client) startIdleTimer(timeout time.Duration) {
+	cl.idleTimeout = timeout
+	cl.idle = time.AfterFunc(timeout, func() {
+		cl.log.Info().Dur("timeout", timeout).Msg("closing idle connection")
+		cl.closeWith(CloseCodeSessionExpired, IdleReason)
+	})
+}
+
+// touch restarts the idle timer, if any. It is called for messages the client
+// sends and messages addressed to it; broadcasts do not count, as they would
+// keep every idle listener connected.
+func (cl *Client) touch() {
+	if cl.idle != nil {
+		cl.idle.Reset(cl.idleTimeout)
+	}
+}
+
+func (cl *Client) stopIdleTimer() {
+	if cl.idle != nil {
+		cl.idle.Stop()
+	}
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func expectIdleClose(t *testing.T, conn *websocket.Conn, within time.Duration) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(within))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseCodeSessionExpired) {
+			t.Fatalf("expected close code %d, got: %v", CloseCodeSessionExpired, err)
+		}
+		if ce := err.(*websocket.CloseError); ce.Text != IdleReason {
+			t.Fatalf("expected reason %q, got %q", IdleReason, ce.Text)
+		}
+		return
+	}
+}
+
+func TestIdleUserClosed(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.idleTimeout = 200 * time.Millisecond
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	expectIdleClose(t, user, 2*time.Second)
+	waitForUsers(t, chat, 0)
+
+	// Radios are exempt
+	if s := chat.Stats(); s.ConnectedRadios != 1 {
+		t.Fatalf("expected the radio to stay connected, got: %+v", s)
+	}
+}
+
+func TestIdleTimerResetByActivity(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.idleTimeout = 300 * time.Millisecond
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	// Alternate sending and receiving replies for longer than the timeout
+	start := time.Now()
+	for i := 0; time.Since(start) < 600*time.Millisecond; i++ {
+		time.Sleep(150 * time.Millisecond)
+		if i%2 == 0 {
+			sendAsUser(t, user, "still here "+time.Now().String())
+			continue
+		}
+		if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "Coming up next"}); err != nil {
+			t.Fatalf("radio write: %v", err)
+		}
+		expectContent(t, user, "Coming up next")
+	}
+	if s := chat.Stats(); s.ConnectedUsers != 1 {
+		t.Fatalf("expected the active user to stay connected, got: %+v", s)
+	}
+
+	expectIdleClose(t, user, 2*time.Second)
+}
@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxInboxLimit = 500
+
+// restRadio returns the identity used for radios talking to the chat over HTTP.
+func restRadio(roomName string) *Client {
+	return &Client{role: "radio", id: "radio-key", givenName: "Radio", room: roomName}
+}
+
+type InboxResponse struct {
+	Messages []OutgoingMessage `json:"messages"`
+	Cursor   string            `json:"cursor" description:"Pass as since to fetch newer messages"`
+}
+
+type ReplyRequest struct {
+	To        string `json:"to" description:"Target lidnr"`
+	Content   string `json:"content" description:"Message body"`
+	Room      string `json:"room,omitempty" description:"Room of the target user, defaults to main"`
+	InReplyTo string `json:"inReplyTo,omitempty" description:"ID of the user message this reply answers"`
+}
+
+// HandleInbox returns user messages in the ?room= newer than the ?since=
+// cursor, so radios without a websocket can poll the chat.
+func (c *Chat) HandleInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.radioKeyAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing radio key")
+		return
+	}
+
+	limit := maxInboxLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxInboxLimit)
+	}
+	roomName, err := c.roomFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cursor := r.URL.Query().Get("since")
+	msgs := c.history.Since(cursor, limit, func(role string, msg OutgoingMessage) bool {
+		return role == "user" && msg.Room == roomName && !c.isDM(role, msg)
+	})
+	if len(msgs) > 0 {
+		cursor = msgs[len(msgs)-1].ID
+	}
+	if msgs == nil {
+		msgs = []OutgoingMessage{}
+	}
+	for i := range msgs {
+		msgs[i] = c.hideMember(msgs[i])
+	}
+	writeJSON(w, http.StatusOK, InboxResponse{Messages: msgs, Cursor: cursor})
+}
+
+// HandleReply sends a radio reply to a user through the same dispatch path as
+// a websocket radio.
+func (c *Chat) HandleReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.radioKeyAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing radio key")
+		return
+	}
+
+	var req ReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.To) == "" {
+		writeError(w, http.StatusBadRequest, "missing to")
+		return
+	}
+	if req.Room == "" {
+		req.Room = DefaultRoom
+	}
+	if !c.knownRoom(req.Room) {
+		writeError(w, http.StatusBadRequest, ErrUnknownRoom.Error())
+		return
+	}
+	req.To = c.memberID(req.To)
+	if !c.reachable(req.Room, req.To) {
+		writeError(w, http.StatusNotFound, ErrUserNotConnected.Error())
+		return
+	}
+
+	if err := c.dispatch(r.Context(), restRadio(req.Room), IncomingMessage{To: req.To, Content: req.Content, InReplyTo: req.InReplyTo}); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+}
+
+// reachable reports whether a user is in the room on this instance or might be
+// connected to a peer instance.
+func (c *Chat) reachable(roomName, userID string) bool {
+	if c.backend != nil {
+		return true
+	}
+	_, ok := c.lookupUser(roomName, userID)
+	return ok
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getInbox(t *testing.T, chat *Chat, since string) InboxResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/chat/inbox?since="+url.QueryEscape(since), nil)
+	req.Header.Set("Authorization", "Bearer "+RADIOChatKey)
+	rec := httptest.NewRecorder()
+	chat.HandleInbox(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("inbox: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp InboxResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("inbox: invalid json: %v", err)
+	}
+	return resp
+}
+
+func postReply(t *testing.T, chat *Chat, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat/reply", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+RADIOChatKey)
+	rec := httptest.NewRecorder()
+	chat.HandleReply(rec, req)
+	return rec
+}
+
+func TestRESTAndWebsocketRadiosSeeSameMessages(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, 1)
+
+	// User question reaches both the websocket radio and the REST inbox
+	if err := user.WriteJSON(IncomingMessage{Content: "where is checkpoint 7?"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	wsOut, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	inbox := getInbox(t, chat, "")
+	if len(inbox.Messages) != 1 || inbox.Messages[0].ID != wsOut.ID || inbox.Cursor != wsOut.ID {
+		t.Fatalf("inbox does not match websocket radio: %+v vs %+v", inbox, wsOut)
+	}
+
+	// Polling again with the cursor is idempotent
+	if again := getInbox(t, chat, inbox.Cursor); len(again.Messages) != 0 || again.Cursor != inbox.Cursor {
+		t.Fatalf("expected empty inbox after cursor, got: %+v", again)
+	}
+
+	// REST reply reaches the user and is mirrored to the websocket radio
+	if rec := postReply(t, chat, `{"to":"12345","content":"near the bridge"}`); rec.Code != http.StatusOK {
+		t.Fatalf("reply: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	userOut, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if userOut.Content != "near the bridge" || userOut.To != "12345" {
+		t.Fatalf("unexpected reply at user: %+v", userOut)
+	}
+	mirror, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if mirror.ID != userOut.ID {
+		t.Fatalf("expected radio to see the REST reply, got: %+v", mirror)
+	}
+
+	// Radio replies are not part of the inbox
+	if again := getInbox(t, chat, inbox.Cursor); len(again.Messages) != 0 {
+		t.Fatalf("expected radio replies to be excluded, got: %+v", again)
+	}
+}
+
+func TestRESTReplyToOfflineUser(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	if rec := postReply(t, chat, `{"to":"12345","content":"hello"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestInboxRequiresKey(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	rec := httptest.NewRecorder()
+	chat.HandleInbox(rec, httptest.NewRequest(http.MethodGet, "/api/v1/chat/inbox", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startHandlerServer serves the chat's full Handler instead of only /ws.
+func startHandlerServer(t *testing.T, chat *Chat) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewServer(chat.Handler())
+	return srv, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+func TestIndependentChats(t *testing.T) {
+	studio := New(WithSecret("studio-secret"), WithRadioKey("studio-key", nil))
+	relay := New(WithSecret("relay-secret"), WithRadioKey("relay-key", nil), WithJSONStyle(JSONCamelCase))
+	studioSrv, studioWS := startHandlerServer(t, studio)
+	defer studioSrv.Close()
+	relaySrv, relayWS := startHandlerServer(t, relay)
+	defer relaySrv.Close()
+
+	studioRadio := dialAndHandshake(t, studioWS, "radio", makeToken(t, "studio-secret", 99999, "Bob", "Radio", time.Minute), "studio-key")
+	defer studioRadio.Close()
+	relayRadio := dialAndHandshake(t, relayWS, "radio", makeToken(t, "relay-secret", 99999, "Bob", "Radio", time.Minute), "relay-key")
+	defer relayRadio.Close()
+	waitForRadios(t, studio, 1)
+	waitForRadios(t, relay, 1)
+
+	studioUser := dialAndHandshake(t, studioWS, "user", makeToken(t, "studio-secret", 12345, "Alice", "User", time.Minute), "")
+	defer studioUser.Close()
+	relayUser := dialAndHandshake(t, relayWS, "user", makeToken(t, "relay-secret", 12345, "Alice", "User", time.Minute), "")
+	defer relayUser.Close()
+	waitForUsers(t, studio, 1)
+	waitForUsers(t, relay, 1)
+
+	sendAsUser(t, studioUser, "Can you play Bohemian Rhapsody?")
+	sendAsUser(t, relayUser, "Play Queen!")
+	out, err := readJSONWithDeadline[OutgoingMessage](t, studioRadio, 2*time.Second)
+	if err != nil || out.Content != "Can you play Bohemian Rhapsody?" || out.From != "12345" {
+		t.Fatalf("expected the studio message in snake_case on the studio radio, got: %+v (%v)", out, err)
+	}
+	// The first message on the relay radio is its own, not the studio's
+	camel, err := readJSONWithDeadline[OutgoingMessageCamel](t, relayRadio, 2*time.Second)
+	if err != nil || camel.Content != "Play Queen!" || camel.From != "12345" {
+		t.Fatalf("expected the relay message in camelCase on the relay radio, got: %+v (%v)", camel, err)
+	}
+}
+
+func TestIndependentChatSecrets(t *testing.T) {
+	studio := New(WithSecret("studio-secret"), WithRadioKey("studio-key", nil))
+	relay := New(WithSecret("relay-secret"), WithRadioKey("relay-key", nil))
+	srv, wsBase := startHandlerServer(t, relay)
+	defer srv.Close()
+
+	// A token of the other chat is not accepted
+	conn := dialHandshake(t, wsBase, "user", makeToken(t, "studio-secret", 12345, "Alice", "User", time.Minute), "")
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("expected close after a token signed with the other chat's secret")
+	}
+
+	// Neither is its radio key
+	tok := makeToken(t, "relay-secret", 99999, "Bob", "Radio", time.Minute)
+	radio := dialHandshake(t, wsBase, "radio", tok, "studio-key")
+	defer radio.Close()
+	_ = radio.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := radio.ReadMessage(); !websocket.IsCloseError(err, CloseCodeInvalidRadioKey) {
+		t.Fatalf("expected close code %d, got: %v", CloseCodeInvalidRadioKey, err)
+	}
+	if n := studio.Stats().ConnectedRadios + relay.Stats().ConnectedRadios; n != 0 {
+		t.Fatalf("expected no radios, got %d", n)
+	}
+}
+
+func TestHandlerRoutes(t *testing.T) {
+	chat := New(WithAdminKey("admin"))
+	srv := httptest.NewServer(chat.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(RequestIDHeader) == "" {
+		t.Fatalf("expected 200 with a request ID, got %d %q", resp.StatusCode, resp.Header.Get(RequestIDHeader))
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/chat/audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin key, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSONStyle is how the member fields of messages written to clients are
+// named. Other fields are camelCase either way.
+type JSONStyle string
+
+const (
+	JSONSnakeCase JSONStyle = "snake_case" // from, given_name, family_name, display_name
+	JSONCamelCase JSONStyle = "camelCase"  // fromId, givenName, familyName, displayName
+)
+
+// radioJSONStyle is the style of messages written to websocket and SSE
+// clients. The HTTP API, pub/sub, the store and webhooks always use
+// snake_case.
+var radioJSONStyle = String("RADIO_JSON_STYLE", string(JSONSnakeCase))
+
+func ParseJSONStyle(s string) (JSONStyle, error) {
+	switch style := JSONStyle(s); style {
+	case JSONSnakeCase, JSONCamelCase:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown JSON style %q, expected snake_case or camelCase", s)
+}
+
+// OutgoingMessageCamel is OutgoingMessage with the member fields in
+// camelCase. The fields must stay the same as OutgoingMessage's, in the same
+// order, for the conversion between them.
+type OutgoingMessageCamel struct {
+	ID          string     `json:"id,omitempty"`
+	SentAt      time.Time  `json:"sentAt,omitzero"`
+	Type        string     `json:"type,omitempty"`
+	From        string     `json:"fromId"`
+	GivenName   string     `json:"givenName,omitempty"`
+	FamilyName  string     `json:"familyName,omitempty"`
+	DisplayName string     `json:"displayName,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	To          string     `json:"to,omitempty"`
+	Content     string     `json:"content"`
+	Pinned      bool       `json:"pinned,omitempty"`
+	Room        string     `json:"room,omitempty"`
+	MessageID   string     `json:"messageId,omitempty"`
+	Emoji       string     `json:"emoji,omitempty"`
+	InReplyTo   string     `json:"inReplyTo,omitempty"`
+	Answered    bool       `json:"answered,omitempty"`
+	PollID      string     `json:"pollId,omitempty"`
+	Question    string     `json:"question,omitempty"`
+	Options     []string   `json:"options,omitempty"`
+	Tally       []int      `json:"tally,omitempty"`
+	Closed      bool       `json:"closed,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Artist      string     `json:"artist,omitempty"`
+	Radio       *RadioInfo `json:"radio,omitempty"`
+	EndsAt      time.Time  `json:"endsAt,omitzero"`
+
+	ClientMsgID  string   `json:"clientMsgId,omitempty"`
+	ResumeToken  string   `json:"resumeToken,omitempty"`
+	Resumed      bool     `json:"resumed,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	AckRequired  bool     `json:"ackRequired,omitempty"`
+
+	Replayed bool   `json:"replayed,omitempty"`
+	SeqNum   uint64 `json:"seq,omitempty"`
+}
+
+// WithJSONStyle names the member fields of messages to clients in the style
+// instead of RADIO_JSON_STYLE.
+func WithJSONStyle(style JSONStyle) Option {
+	return func(c *Chat) {
+		c.style = style
+	}
+}
+
+// styled returns the message as it is encoded for clients in the style.
+func (s JSONStyle) styled(msg OutgoingMessage) any {
+	if s == JSONCamelCase {
+		return OutgoingMessageCamel(msg)
+	}
+	return msg
+}
+
+// marshal encodes a message for clients in the style.
+func (s JSONStyle) marshal(msg OutgoingMessage) []byte {
+	data, _ := json.Marshal(s.styled(msg))
+	return data
+}
+
+// unmarshal decodes a message encoded by marshal.
+func (s JSONStyle) unmarshal(data []byte) (OutgoingMessage, error) {
+	if s == JSONCamelCase {
+		var msg OutgoingMessageCamel
+		err := json.Unmarshal(data, &msg)
+		return OutgoingMessage(msg), err
+	}
+	var msg OutgoingMessage
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
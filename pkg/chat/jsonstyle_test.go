@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestJSONStyles(t *testing.T) {
+	msg := OutgoingMessage{
+		ID:          "00065df3140a7172",
+		SentAt:      time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		From:        "12345",
+		GivenName:   "Alice",
+		FamilyName:  "User",
+		DisplayName: "Alice User",
+		Content:     "Can you play Bohemian Rhapsody?",
+		Room:        DefaultRoom,
+	}
+	tests := []struct {
+		style JSONStyle
+		want  string
+	}{
+		{JSONSnakeCase, `{"id":"00065df3140a7172","sentAt":"2026-10-16T12:00:00Z","from":"12345","given_name":"Alice","family_name":"User","display_name":"Alice User","content":"Can you play Bohemian Rhapsody?","room":"main"}`},
+		{JSONCamelCase, `{"id":"00065df3140a7172","sentAt":"2026-10-16T12:00:00Z","fromId":"12345","givenName":"Alice","familyName":"User","displayName":"Alice User","content":"Can you play Bohemian Rhapsody?","room":"main"}`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.style), func(t *testing.T) {
+			data := tt.style.marshal(msg)
+			if string(data) != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, data)
+			}
+			got, err := tt.style.unmarshal(data)
+			if err != nil || !reflect.DeepEqual(got, msg) {
+				t.Fatalf("round trip changed the message: %+v (%v)", got, err)
+			}
+			encoded, err := encodeBinary(data, tt.style)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			var binary map[string]any
+			if err := msgpack.Unmarshal(encoded, &binary); err != nil {
+				t.Fatalf("decode msgpack: %v", err)
+			}
+			for key := range fields {
+				if _, ok := binary[key]; !ok {
+					t.Errorf("expected %s in the MessagePack encoding, got: %v", key, binary)
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONStyle(t *testing.T) {
+	for _, s := range []string{"snake_case", "camelCase"} {
+		if style, err := ParseJSONStyle(s); err != nil || string(style) != s {
+			t.Errorf("expected %s to parse, got %q (%v)", s, style, err)
+		}
+	}
+	if _, err := ParseJSONStyle("kebab-case"); err == nil {
+		t.Error("expected an error for kebab-case")
+	}
+}
+
+func TestCamelCaseDelivery(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New(WithJSONStyle(JSONCamelCase))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+	out, err := readJSONWithDeadline[OutgoingMessageCamel](t, radio, 2*time.Second)
+	if err != nil || out.From != "12345" || out.GivenName != "Alice" || out.FamilyName != "User" {
+		t.Fatalf("expected the sender in camelCase fields, got: %+v (%v)", out, err)
+	}
+}
@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksServer serves the public keys added to it, or 503 when down.
+type jwksServer struct {
+	mu   sync.Mutex
+	keys []jsonWebKey
+	down bool
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+}
+
+func (s *jwksServer) addRSA(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	})
+	return key
+}
+
+func (s *jwksServer) addEC(t *testing.T, kid string) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	})
+	return key
+}
+
+func signWithKey(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	j := jwt.NewWithClaims(method, GEWISClaims{
+		Lidnr:            12345,
+		GivenName:        "Alice",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	j.Header["kid"] = kid
+	s, err := j.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func startJWKSChat(t *testing.T) (*Chat, *jwksServer, *JWKS) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	keys := &jwksServer{}
+	srv := httptest.NewServer(keys)
+	t.Cleanup(srv.Close)
+	jwks := NewJWKS(srv.URL)
+	return New(WithJWKS(jwks)), keys, jwks
+}
+
+func TestJWKSVerification(t *testing.T) {
+	chat, keys, _ := startJWKSChat(t)
+	rsaKey := keys.addRSA(t, "rsa-1")
+	ecKey := keys.addEC(t, "ec-1")
+
+	for name, token := range map[string]string{
+		"RS256": signWithKey(t, jwt.SigningMethodRS256, "rsa-1", rsaKey),
+		"ES256": signWithKey(t, jwt.SigningMethodES256, "ec-1", ecKey),
+		"HS512": makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute),
+	} {
+		claims, err := chat.verifyGEWISTokenHandshake(token)
+		if err != nil || claims.Lidnr != 12345 {
+			t.Errorf("%s: expected valid token, got %+v, %v", name, claims, err)
+		}
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := chat.verifyGEWISTokenHandshake(signWithKey(t, jwt.SigningMethodRS256, "rsa-1", other)); err == nil {
+		t.Error("expected token signed with another key to be rejected")
+	}
+}
+
+func TestJWKSRefreshesOnUnknownKid(t *testing.T) {
+	chat, keys, jwks := startJWKSChat(t)
+	keys.addRSA(t, "old")
+	if err := jwks.Refresh(t.Context()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	// Pretend the last refresh was long ago, so a miss may refresh again
+	jwks.lastRefresh = time.Time{}
+
+	rotated := keys.addRSA(t, "new")
+	if _, err := chat.verifyGEWISTokenHandshake(signWithKey(t, jwt.SigningMethodRS256, "new", rotated)); err != nil {
+		t.Fatalf("expected key rotated in after the last refresh to verify, got %v", err)
+	}
+}
+
+func TestJWKSKeepsCachedKeysWhenDown(t *testing.T) {
+	chat, keys, jwks := startJWKSChat(t)
+	key := keys.addRSA(t, "rsa-1")
+	if err := jwks.Refresh(t.Context()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	keys.mu.Lock()
+	keys.down = true
+	keys.mu.Unlock()
+	if err := jwks.Refresh(t.Context()); err == nil {
+		t.Fatal("expected refresh to fail while the JWKS is down")
+	}
+	if _, err := chat.verifyGEWISTokenHandshake(signWithKey(t, jwt.SigningMethodRS256, "rsa-1", key)); err != nil {
+		t.Fatalf("expected cached key to verify, got %v", err)
+	}
+}
+
+func TestAsymmetricTokensRequireJWKS(t *testing.T) {
+	GEWISSecret = "testsecret"
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := New().verifyGEWISTokenHandshake(signWithKey(t, jwt.SigningMethodRS256, "rsa-1", key)); err == nil {
+		t.Fatal("expected RS256 token to be rejected without a JWKS")
+	}
+}
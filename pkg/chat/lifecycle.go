@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHookFailed is returned in place of the panic of a hook, so the panic
+// value is logged and reported but never shown to members.
+var ErrHookFailed = errors.New("message could not be processed")
+
+// RejectError is returned by a connect hook to refuse a connection with a
+// specific close code.
+type RejectError struct {
+	Code   int    // application close code, 4000-4999
+	Reason string // close message text, CloseReason(Code) when empty
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("connection rejected: %s", e.Reason)
+}
+
+// Lifecycle hooks let code outside the chat take part in connections and
+// messages of members, unlike an EventListener, which only observes. They run
+// on the connection's goroutine outside the chat's locks, so they should be
+// quick. A panicking hook is reported and counts as ErrHookFailed.
+type (
+	// ConnectFunc is called before a user or radio joins its room. An error
+	// refuses the connection, see RejectError.
+	ConnectFunc func(client ClientInfo) error
+	// MessageFunc is called with every chat or typing message before it is
+	// routed. It returns the message to route instead, or an error to drop it
+	// and tell the sender.
+	MessageFunc func(sender ClientInfo, msg OutgoingMessage) (OutgoingMessage, error)
+	// DisconnectFunc is called once a user or radio connection has closed.
+	DisconnectFunc func(client ClientInfo, reason string)
+)
+
+// WithOnConnect calls the hook for every new user and radio connection.
+func WithOnConnect(hook ConnectFunc) Option {
+	return func(c *Chat) {
+		c.onConnect = hook
+	}
+}
+
+// WithOnMessage calls the hook for every chat and typing message.
+func WithOnMessage(hook MessageFunc) Option {
+	return func(c *Chat) {
+		c.onMessage = hook
+	}
+}
+
+// WithOnDisconnect calls the hook for every closed user and radio
+// connection.
+func WithOnDisconnect(hook DisconnectFunc) Option {
+	return func(c *Chat) {
+		c.onDisconnect = hook
+	}
+}
+
+// recoverHook turns a panic of a hook into ErrHookFailed, and reports it.
+func (c *Chat) recoverHook(name string, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	panicErr := fmt.Errorf("%s hook panicked: %v", name, v)
+	c.log.Error().Err(panicErr).Msg("recovered from panic")
+	c.reporter.Report(ErrorEvent{Kind: ErrorKindPanic, Err: panicErr})
+	*err = ErrHookFailed
+}
+
+// hookConnect runs the connect hook, returning the close code and reason to
+// refuse the connection with, or 0 to accept it.
+func (c *Chat) hookConnect(client ClientInfo) (code int, reason string, err error) {
+	if c.onConnect == nil {
+		return 0, "", nil
+	}
+	func() {
+		defer c.recoverHook("connect", &err)
+		err = c.onConnect(client)
+	}()
+	if err == nil {
+		return 0, "", nil
+	}
+	code, reason = CloseCodeRejected, CloseReason(CloseCodeRejected)
+	var reject *RejectError
+	if errors.As(err, &reject) && reject.Code != 0 {
+		code, reason = reject.Code, reject.Reason
+		if reason == "" {
+			reason = CloseReason(code)
+		}
+	}
+	return code, reason, err
+}
+
+// hookMessage runs the message hook on a message about to be routed.
+func (c *Chat) hookMessage(client *Client, msg OutgoingMessage) (out OutgoingMessage, err error) {
+	if c.onMessage == nil {
+		return msg, nil
+	}
+	defer c.recoverHook("message", &err)
+	return c.onMessage(client.info(), msg)
+}
+
+// hookDisconnect runs the disconnect hook.
+func (c *Chat) hookDisconnect(client ClientInfo, reason string) {
+	if c.onDisconnect == nil {
+		return
+	}
+	var err error
+	defer c.recoverHook("disconnect", &err)
+	c.onDisconnect(client, reason)
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectHookRejects(t *testing.T) {
+	GEWISSecret = "testsecret"
+	tests := []struct {
+		name   string
+		err    error
+		code   int
+		reason string
+	}{
+		{"plain error", errors.New("not today"), CloseCodeRejected, "connection rejected"},
+		{"reject error", &RejectError{Code: CloseCodeBanned}, CloseCodeBanned, "banned"},
+		{"reject error with reason", &RejectError{Code: 4999, Reason: "studio closed"}, 4999, "studio closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen ClientInfo
+			chat := New(WithOnConnect(func(client ClientInfo) error {
+				seen = client
+				return tt.err
+			}))
+			srv, wsBase := startTestServer(t, chat)
+			defer srv.Close()
+
+			conn := dialHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, _, err := conn.ReadMessage()
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != tt.code || closeErr.Text != tt.reason {
+				t.Fatalf("expected close %d %q, got: %v", tt.code, tt.reason, err)
+			}
+			if seen.ID != "12345" || seen.Role != "user" || seen.GivenName != "Alice" {
+				t.Fatalf("unexpected client passed to the hook: %+v", seen)
+			}
+			if n := chat.Stats().ConnectedUsers; n != 0 {
+				t.Fatalf("expected no users, got %d", n)
+			}
+		})
+	}
+}
+
+func TestMessageHookMutates(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New(WithOnMessage(func(sender ClientInfo, msg OutgoingMessage) (OutgoingMessage, error) {
+		if sender.Role == "user" {
+			msg.Content = strings.ToUpper(msg.Content)
+		}
+		return msg, nil
+	}))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	sendAsUser(t, user, "play queen")
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil || out.Content != "PLAY QUEEN" || out.ID == "" {
+		t.Fatalf("expected the changed message, got: %+v (%v)", out, err)
+	}
+}
+
+func TestMessageHookVetoes(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New(WithOnMessage(func(sender ClientInfo, msg OutgoingMessage) (OutgoingMessage, error) {
+		if strings.Contains(msg.Content, "spam") {
+			return msg, errors.New("no spam please")
+		}
+		if strings.Contains(msg.Content, "boom") {
+			panic("hook bug")
+		}
+		return msg, nil
+	}))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	sendAsUser(t, user, "buy spam")
+	notice, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || notice.Type != MessageTypeError || notice.Content != "no spam please" {
+		t.Fatalf("expected an error notice, got: %+v (%v)", notice, err)
+	}
+	// A panicking hook drops the message instead of the connection
+	sendAsUser(t, user, "boom")
+	notice, err = readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || notice.Type != MessageTypeError || notice.Content != ErrHookFailed.Error() {
+		t.Fatalf("expected a generic error notice, got: %+v (%v)", notice, err)
+	}
+
+	sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil || out.Content != "Can you play Bohemian Rhapsody?" {
+		t.Fatalf("expected only the allowed message on the radio, got: %+v (%v)", out, err)
+	}
+}
+
+func TestDisconnectHook(t *testing.T) {
+	GEWISSecret = "testsecret"
+	reasons := make(chan string, 1)
+	chat := New(WithOnDisconnect(func(client ClientInfo, reason string) {
+		if client.ID == "12345" {
+			reasons <- reason
+		}
+	}))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	waitForUsers(t, chat, 1)
+	_ = user.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	user.Close()
+
+	select {
+	case reason := <-reasons:
+		if reason == "" {
+			t.Fatal("expected a disconnect reason")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("disconnect hook not called")
+	}
+}
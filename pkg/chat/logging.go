@@ -0,0 +1,83 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// traceSampler limits per-message trace logs to a burst per second plus every
+// 100th message beyond it, shared by all connections.
+var traceSampler = &zerolog.BurstSampler{
+	Burst:       20,
+	Period:      time.Second,
+	NextSampler: &zerolog.BasicSampler{N: 100},
+}
+
+// messageLogSample logs one in N message-level events, such as a message
+// being forwarded, instead of using traceSampler. Errors are always logged.
+var messageLogSample = Int("LOG_MESSAGE_SAMPLE", 0)
+
+// messageSampler returns the sampler of message-level logs, keeping one in n
+// events below the error level, or traceSampler when n <= 0.
+func messageSampler(n int) zerolog.Sampler {
+	if n <= 0 {
+		return traceSampler
+	}
+	basic := &zerolog.BasicSampler{N: uint32(n)}
+	return &zerolog.LevelSampler{TraceSampler: basic, DebugSampler: basic, InfoSampler: basic, WarnSampler: basic}
+}
+
+// countingSampler counts the events its sampler suppresses. zerolog only asks
+// for events at an enabled level, so they would have been logged otherwise.
+type countingSampler struct {
+	zerolog.Sampler
+	suppressed *atomic.Uint64
+}
+
+func (s countingSampler) Sample(lvl zerolog.Level) bool {
+	if s.Sampler.Sample(lvl) {
+		return true
+	}
+	s.suppressed.Add(1)
+	return false
+}
+
+// WithMessageLogSample logs one in n message-level events instead of
+// LOG_MESSAGE_SAMPLE, 0 for the default burst sampling.
+func WithMessageLogSample(n int) Option {
+	return func(c *Chat) {
+		c.messageSample = n
+	}
+}
+
+// WithLogger logs to the logger instead of the global one. Connections and
+// requests log to children of it.
+func WithLogger(l zerolog.Logger) Option {
+	return func(c *Chat) {
+		c.log = l
+	}
+}
+
+// newConnID returns a short random ID telling connections of the same member
+// apart in the logs.
+func newConnID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withConnID returns a child of the request logger for a new connection.
+func withConnID(logger *zerolog.Logger, connID string) zerolog.Logger {
+	return logger.With().Str("conn_id", connID).Logger()
+}
+
+// setLogger derives the client's loggers from the connection logger, adding
+// its role and lidnr.
+func (cl *Client) setLogger(conn zerolog.Logger) {
+	cl.log = conn.With().Str("role", cl.role).Str("lidnr", cl.id).Logger()
+	cl.trace = cl.log.Sample(traceSampler)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid log line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestConnectionIDInLogs(t *testing.T) {
+	var buf syncBuffer
+	prev := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = prev }()
+
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	// The same member connects twice, the second session replaces the first
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	first := dialAndHandshake(t, wsBase, "user", tok, "")
+	defer first.Close()
+	waitForUsers(t, chat, 1)
+	second := dialAndHandshake(t, wsBase, "user", tok, "")
+	defer second.Close()
+	_ = first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, _ = first.ReadMessage()
+
+	var connIDs []string
+	for _, line := range buf.lines(t) {
+		if line["message"] != "client connected" {
+			continue
+		}
+		if line["lidnr"] != "12345" || line["role"] != "user" {
+			t.Fatalf("expected lidnr and role on connect log, got: %v", line)
+		}
+		id, _ := line["conn_id"].(string)
+		if id == "" {
+			t.Fatalf("expected conn_id on connect log, got: %v", line)
+		}
+		connIDs = append(connIDs, id)
+	}
+	if len(connIDs) != 2 || connIDs[0] == connIDs[1] {
+		t.Fatalf("expected two distinct connection IDs, got: %v", connIDs)
+	}
+}
+
+func TestMessageLogSample(t *testing.T) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	defer zerolog.SetGlobalLevel(level)
+	buf := &syncBuffer{}
+	chat := New(WithLogger(zerolog.New(buf).Level(zerolog.TraceLevel)), WithMessageLogSample(10))
+
+	// Nobody is connected, so every attempt logs one trace event
+	for range 100 {
+		chat.forwardToUser(t.Context(), "12345", OutgoingMessage{ID: chat.nextMessageID(), To: "12345", Content: "hi"})
+	}
+	for range 5 {
+		chat.traceLog.Error().Msg("always logged")
+	}
+	traces, errs := 0, 0
+	for _, line := range buf.lines(t) {
+		switch line["message"] {
+		case "trying to forward message to user":
+			traces++
+		case "always logged":
+			errs++
+		}
+	}
+	if traces != 10 || errs != 5 {
+		t.Fatalf("expected 10 of 100 trace events and every error, got %d and %d", traces, errs)
+	}
+	if n := chat.Stats().SuppressedLogs; n != 90 {
+		t.Fatalf("expected 90 suppressed events, got %d", n)
+	}
+}
@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pollTimeout is how long a long poll waits for a message before answering
+// 204.
+var pollTimeout = Duration("RADIO_POLL_TIMEOUT", 30*time.Second)
+
+// HandleLongPoll is a long-polling fallback for members whose network blocks
+// websockets and server-sent events. It authenticates with ?token= and
+// answers with the first message to the user after the ?since= message ID,
+// waiting up to RADIO_POLL_TIMEOUT for one, or 204 when none arrived. Clients
+// poll again right away, with the ID of the message they got.
+func (c *Chat) HandleLongPoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if c.refuseWhileDraining(w) {
+		return
+	}
+	roomName, err := c.roomFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	claims, err := c.verifyGEWISTokenHandshake(r.URL.Query().Get("token"))
+	if err != nil {
+		requestLogger(r.Context()).Warn().Err(err).Msg("rejecting poll: invalid token")
+		writeError(w, http.StatusUnauthorized, tokenErrorMessage(err))
+		return
+	}
+	user := &Client{role: "user", id: strconv.Itoa(claims.Lidnr), room: roomName}
+
+	// Wait before looking at the history, so a message dispatched in between
+	// is not missed
+	waiter := c.addPollWaiter(roomName, user.id)
+	defer c.removePollWaiter(roomName, user.id, waiter)
+
+	if since := r.URL.Query().Get("since"); since != "" {
+		missed := c.history.Since(since, 1, func(role string, msg OutgoingMessage) bool {
+			return receivedByUser(user, role, msg, c.isDM(role, msg))
+		})
+		if len(missed) > 0 {
+			writeJSON(w, http.StatusOK, missed[0])
+			return
+		}
+	}
+
+	timeout := time.NewTimer(c.pollTimeout)
+	defer timeout.Stop()
+	select {
+	case msg, ok := <-waiter:
+		if !ok {
+			// Replaced by a newer poll of the same user
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, msg)
+	case <-timeout.C:
+		w.WriteHeader(http.StatusNoContent)
+	case <-r.Context().Done():
+	}
+}
+
+// addPollWaiter registers a poll of the user in the room, ending an earlier
+// one.
+func (c *Chat) addPollWaiter(roomName, userID string) chan OutgoingMessage {
+	waiter := make(chan OutgoingMessage, 1)
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+	waiters, ok := c.pollWaiters[roomName]
+	if !ok {
+		waiters = make(map[string]chan OutgoingMessage)
+		c.pollWaiters[roomName] = waiters
+	}
+	if prev, ok := waiters[userID]; ok {
+		close(prev)
+	}
+	waiters[userID] = waiter
+	return waiter
+}
+
+// removePollWaiter unregisters the poll, unless a newer one replaced it.
+func (c *Chat) removePollWaiter(roomName, userID string, waiter chan OutgoingMessage) {
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+	waiters := c.pollWaiters[roomName]
+	if waiters[userID] != waiter {
+		return
+	}
+	delete(waiters, userID)
+	if len(waiters) == 0 {
+		delete(c.pollWaiters, roomName)
+	}
+}
+
+// polling reports whether the user has a long poll waiting in any room.
+func (c *Chat) polling(userID string) bool {
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+	for _, waiters := range c.pollWaiters {
+		if _, ok := waiters[userID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyPollers hands the message to the waiting polls it is for, like
+// deliverToUser and deliverToUsers hand it to websocket sessions: the poll of
+// the user in the message's room, or of every user in it when userID is
+// empty. A message without a room is for every room. It reports whether there
+// was a poll. A poll is answered with the first message only, the next one
+// is picked up from the history by the next poll.
+func (c *Chat) notifyPollers(userID string, msg OutgoingMessage) bool {
+	c.pollMu.Lock()
+	defer c.pollMu.Unlock()
+	notified := false
+	notify := func(waiter chan OutgoingMessage) {
+		select {
+		case waiter <- msg:
+		default:
+		}
+		notified = true
+	}
+	for roomName, waiters := range c.pollWaiters {
+		if msg.Room != "" && roomName != msg.Room {
+			continue
+		}
+		if userID != "" {
+			if waiter, ok := waiters[userID]; ok {
+				notify(waiter)
+			}
+			continue
+		}
+		for _, waiter := range waiters {
+			notify(waiter)
+		}
+	}
+	return notified
+}
@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func longPoll(chat *Chat, query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	chat.HandleLongPoll(rec, httptest.NewRequest(http.MethodGet, "/api/v1/poll?"+query, nil))
+	return rec
+}
+
+func waitForPoller(t *testing.T, chat *Chat, roomName, userID string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		chat.pollMu.Lock()
+		_, ok := chat.pollWaiters[roomName][userID]
+		chat.pollMu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for a poll of %s", userID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLongPollDelivery(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- longPoll(chat, "token="+tok) }()
+	waitForPoller(t, chat, DefaultRoom, "12345")
+
+	radio := restRadio(DefaultRoom)
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{To: "12345", Content: "Coming up next"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	var rec *httptest.ResponseRecorder
+	select {
+	case rec = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("poll not answered")
+	}
+	var got OutgoingMessage
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.Content != "Coming up next" || got.ID == "" {
+		t.Fatalf("expected the reply, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A message that arrived between two polls is picked up from the history
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{To: "12345", Content: "And then"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	rec = longPoll(chat, "token="+tok+"&since="+got.ID)
+	var next OutgoingMessage
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &next) != nil || next.Content != "And then" {
+		t.Fatalf("expected the missed reply, got %d: %s", rec.Code, rec.Body)
+	}
+	chat.pollMu.Lock()
+	defer chat.pollMu.Unlock()
+	if len(chat.pollWaiters) != 0 {
+		t.Fatalf("expected no waiting polls, got %d", len(chat.pollWaiters))
+	}
+}
+
+// startLongPoll polls in the background, the answer arrives on the channel.
+func startLongPoll(t *testing.T, chat *Chat, roomName, token string) chan *httptest.ResponseRecorder {
+	t.Helper()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- longPoll(chat, "room="+roomName+"&token="+token) }()
+	waitForPoller(t, chat, roomName, "12345")
+	return done
+}
+
+// expectPolled waits for the answer to a poll and fails unless it carries
+// the content.
+func expectPolled(t *testing.T, done chan *httptest.ResponseRecorder, content string) {
+	t.Helper()
+	select {
+	case rec := <-done:
+		var got OutgoingMessage
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.Content != content {
+			t.Fatalf("expected %q, got %d: %s", content, rec.Code, rec.Body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("poll not answered")
+	}
+}
+
+func TestLongPollOnlyInItsRoom(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.pollTimeout = 300 * time.Millisecond
+	if err := chat.AddRoom("tech"); err != nil {
+		t.Fatalf("add room: %v", err)
+	}
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	inMain := startLongPoll(t, chat, DefaultRoom, tok)
+	inTech := startLongPoll(t, chat, "tech", tok)
+
+	if err := chat.dispatch(context.Background(), restRadio(DefaultRoom), IncomingMessage{To: "12345", Content: "Main only"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	expectPolled(t, inMain, "Main only")
+	select {
+	case rec := <-inTech:
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected the poll in another room to time out, got %d: %s", rec.Code, rec.Body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("poll not answered")
+	}
+}
+
+func TestLongPollGetsBroadcasts(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	done := startLongPoll(t, chat, DefaultRoom, tok)
+
+	if err := chat.Broadcast(context.Background(), "", "Hello everyone"); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectPolled(t, done, "Hello everyone")
+}
+
+func TestLongPollAcrossInstances(t *testing.T) {
+	GEWISSecret = "testsecret"
+	backend := newMemoryBackend()
+	chatA, chatB := New(), New()
+	for _, chat := range []*Chat{chatA, chatB} {
+		if err := chat.UseBackend(backend); err != nil {
+			t.Fatalf("use backend: %v", err)
+		}
+	}
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+
+	// Both a message to the user and one to everyone reach a poll on B
+	done := startLongPoll(t, chatB, DefaultRoom, tok)
+	if err := chatA.Broadcast(context.Background(), "12345", "From A"); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectPolled(t, done, "From A")
+	done = startLongPoll(t, chatB, DefaultRoom, tok)
+	if err := chatA.Broadcast(context.Background(), "", "From A to all"); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectPolled(t, done, "From A to all")
+}
+
+func TestLongPollTimeout(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.pollTimeout = 50 * time.Millisecond
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+
+	start := time.Now()
+	if rec := longPoll(chat, "token="+tok); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Fatalf("expected 204 after the timeout, got %d: %s", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed < chat.pollTimeout {
+		t.Fatalf("expected the poll to wait %v, returned after %v", chat.pollTimeout, elapsed)
+	}
+	if rec := longPoll(chat, "token=invalid"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an invalid token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package chat
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, served on /metrics.
+var (
+	messageContentBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "radiogaga_message_content_bytes",
+		Help:    "Content size of dispatched messages in bytes.",
+		Buckets: []float64{64, 256, 512, 1024, 2048, 4096},
+	})
+	wsWriteBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "radiogaga_ws_write_bytes_total",
+		Help: "Bytes written to websocket connections.",
+	})
+	connectionRTT = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "radiogaga_connection_rtt_milliseconds",
+		Help: "Round trip time of the last ping per websocket connection.",
+	}, []string{"conn_id", "role"})
+)
+
+// recordRTT stores the round trip time of a ping.
+func (cl *Client) recordRTT(rtt time.Duration) {
+	cl.lastRTT.Store(int64(rtt))
+	connectionRTT.WithLabelValues(cl.connID, cl.role).Set(float64(rtt) / float64(time.Millisecond))
+	cl.trace.Trace().Dur("rtt", rtt).Msg("pong received")
+}
+
+// forgetRTT removes the connection's gauge once it is closed.
+func (cl *Client) forgetRTT() {
+	connectionRTT.DeleteLabelValues(cl.connID, cl.role)
+}
@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func readMetric(t *testing.T, m prometheus.Metric) *dto.Metric {
+	t.Helper()
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		t.Fatalf("read metric: %v", err)
+	}
+	return &out
+}
+
+func TestMessageContentBytesObserved(t *testing.T) {
+	chat := New()
+	user := &Client{role: "user", id: "12345", room: DefaultRoom}
+	before := readMetric(t, messageContentBytes).GetHistogram()
+
+	content := "Can you play Bohemian Rhapsody?"
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: content}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	after := readMetric(t, messageContentBytes).GetHistogram()
+	if after.GetSampleCount() != before.GetSampleCount()+1 {
+		t.Fatalf("expected one observation, got %d -> %d", before.GetSampleCount(), after.GetSampleCount())
+	}
+	if sum := after.GetSampleSum() - before.GetSampleSum(); sum != float64(len(content)) {
+		t.Fatalf("expected %d bytes observed, got %v", len(content), sum)
+	}
+}
+
+func TestWSWriteBytesCounted(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+	before := readMetric(t, wsWriteBytes).GetCounter().GetValue()
+
+	sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+	expectContent(t, radio, "Can you play Bohemian Rhapsody?")
+
+	// The counter is updated right after the write, which may be after the read
+	deadline := time.Now().Add(2 * time.Second)
+	for readMetric(t, wsWriteBytes).GetCounter().GetValue() <= before {
+		if time.Now().After(deadline) {
+			t.Fatal("expected written bytes to be counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPingRTTRecorded(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+	client, _ := chat.lookupUser(DefaultRoom, "12345")
+
+	// Pretend a ping went out 50ms ago and answer it
+	client.pingTime.Store(time.Now().Add(-50 * time.Millisecond).UnixNano())
+	if err := user.WriteControl(websocket.PongMessage, nil, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("write pong: %v", err)
+	}
+	// Pongs are handled by the read loop, a message makes sure it ran
+	sendAsUser(t, user, "sync")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for client.lastRTT.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the round trip time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if users := chat.SnapshotState().Users; len(users) != 1 || users[0].LastRTTMs < 50 {
+		t.Fatalf("expected a round trip of at least 50ms, got: %+v", users)
+	}
+	if v := readMetric(t, connectionRTT.WithLabelValues(client.connID, "user")).GetGauge().GetValue(); v < 50 {
+		t.Fatalf("expected the gauge to be at least 50ms, got %v", v)
+	}
+
+	// A pong without a ping does not change it
+	rtt := client.lastRTT.Load()
+	_ = user.WriteControl(websocket.PongMessage, nil, time.Now().Add(time.Second))
+	sendAsUser(t, user, "sync again")
+	time.Sleep(50 * time.Millisecond)
+	if got := client.lastRTT.Load(); got != rtt {
+		t.Fatalf("expected an unsolicited pong to be ignored, got %v", time.Duration(got))
+	}
+}
@@ -0,0 +1,14 @@
+CREATE TABLE messages (
+    id        TEXT    PRIMARY KEY,
+    sent_at   BIGINT  NOT NULL, -- unix nanoseconds
+    role      TEXT    NOT NULL,
+    sender    TEXT    NOT NULL,
+    recipient TEXT    NOT NULL,
+    room      TEXT    NOT NULL,
+    retracted BOOLEAN NOT NULL DEFAULT FALSE,
+    body      JSONB   NOT NULL  -- OutgoingMessage
+);
+
+CREATE INDEX messages_sent_at ON messages (sent_at);
+CREATE INDEX messages_sender ON messages (sender, id);
+CREATE INDEX messages_recipient ON messages (recipient);
@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+// NATSBackend is a PubSubBackend backed by a NATS server.
+type NATSBackend struct {
+	conn *nats.Conn
+}
+
+func NewNATSBackend(url string) (*NATSBackend, error) {
+	conn, err := nats.Connect(url, nats.Name("radiogaga"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSBackend{conn: conn}, nil
+}
+
+func (b *NATSBackend) Publish(subject string, data []byte) error {
+	return b.conn.Publish(subject, data)
+}
+
+func (b *NATSBackend) Subscribe(subject string, handler func([]byte)) (CancelFunc, error) {
+	sub, err := b.conn.Subscribe(subject, func(m *nats.Msg) {
+		handler(m.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = sub.Unsubscribe() }, nil
+}
+
+func (b *NATSBackend) Close() {
+	b.conn.Close()
+}
@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// natsServer speaks enough of the NATS client protocol for NATSBackend:
+// CONNECT, PING, SUB, UNSUB and PUB without wildcards, queue groups or
+// headers.
+type natsServer struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	subs map[string]map[natsSub]bool // subject -> subscriptions
+}
+
+type natsSub struct {
+	conn *natsConn
+	sid  string
+}
+
+type natsConn struct {
+	mu sync.Mutex // serializes writes
+	w  *bufio.Writer
+}
+
+func (c *natsConn) send(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.w, format, args...)
+	_ = c.w.Flush()
+}
+
+// runNATSServer starts a server on a random port for the duration of the
+// test and returns its URL.
+func runNATSServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &natsServer{listener: listener, subs: make(map[string]map[natsSub]bool)}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return "nats://" + listener.Addr().String()
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &natsConn{w: bufio.NewWriter(conn)}
+	defer s.unsubscribeAll(c)
+	c.send("INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			c.send("PONG\r\n")
+		case "SUB":
+			if len(fields) < 3 {
+				return
+			}
+			s.mu.Lock()
+			if s.subs[fields[1]] == nil {
+				s.subs[fields[1]] = make(map[natsSub]bool)
+			}
+			s.subs[fields[1]][natsSub{conn: c, sid: fields[len(fields)-1]}] = true
+			s.mu.Unlock()
+		case "UNSUB":
+			if len(fields) < 2 {
+				return
+			}
+			s.mu.Lock()
+			for _, subs := range s.subs {
+				delete(subs, natsSub{conn: c, sid: fields[1]})
+			}
+			s.mu.Unlock()
+		case "PUB":
+			if len(fields) < 3 {
+				return
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return
+			}
+			payload := make([]byte, size+2) // with the trailing CRLF
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.publish(fields[1], payload[:size])
+		}
+	}
+}
+
+func (s *natsServer) publish(subject string, payload []byte) {
+	s.mu.Lock()
+	var subs []natsSub
+	for sub := range s.subs[subject] {
+		subs = append(subs, sub)
+	}
+	s.mu.Unlock()
+	for _, sub := range subs {
+		sub.conn.send("MSG %s %s %d\r\n%s\r\n", subject, sub.sid, len(payload), payload)
+	}
+}
+
+func (s *natsServer) unsubscribeAll(c *natsConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, subs := range s.subs {
+		for sub := range subs {
+			if sub.conn == c {
+				delete(subs, sub)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"time"
+)
+
+// ownerTTL is how long an instance stays the owner of a user without
+// refreshing, see UserOwnership.
+var ownerTTL = Duration("RADIO_OWNER_TTL", 30*time.Second)
+
+// UserOwnership is implemented by pub/sub backends that record which instance
+// a user last connected to. Messages to the user are then only delivered by
+// that instance, so a user that moved to another instance before the old
+// session timed out does not get them twice.
+type UserOwnership interface {
+	// Claim makes the instance the owner of the user, taking over from any
+	// other instance.
+	Claim(instance, id string, ttl time.Duration) error
+	// Refresh extends the ownership of the users the instance still owns and
+	// claims those without an owner. It returns the users another instance
+	// owns.
+	Refresh(instance string, ids []string, ttl time.Duration) (lost []string, err error)
+	// Owner returns the instance owning the user, or "" if none does.
+	Owner(id string) (string, error)
+}
+
+// claimUser makes this instance the owner of a user that just connected, and
+// tells the other instances, see lostUser.
+func (c *Chat) claimUser(id string) {
+	if c.owners == nil {
+		return
+	}
+	if err := c.owners.Claim(c.instanceID, id, c.ownerTTL); err != nil {
+		c.log.Warn().Err(err).Str("user", id).Msg("could not claim user")
+		return
+	}
+	c.ownerMu.Lock()
+	delete(c.lostUsers, id)
+	c.ownerMu.Unlock()
+	c.publish(subjectClaims, id, OutgoingMessage{})
+}
+
+// lostUser handles the claim of a user by another instance. The backend is
+// asked who owns the user now, as the user may have come back here since.
+func (c *Chat) lostUser(id string) {
+	owner, err := c.owners.Owner(id)
+	if err != nil {
+		c.log.Warn().Err(err).Str("user", id).Msg("could not look up user owner")
+		return
+	}
+	if owner == "" || owner == c.instanceID {
+		return
+	}
+	c.ownerMu.Lock()
+	defer c.ownerMu.Unlock()
+	if c.lostUsers == nil {
+		c.lostUsers = make(map[string]bool)
+	}
+	c.lostUsers[id] = true
+}
+
+// ownsUser reports whether this instance should deliver messages to the user.
+// It does not ask the backend, but goes by the users claimed by another
+// instance, learnt from their claims and from refreshOwnership, so delivery
+// never waits on the backend. Without ownership every instance delivers.
+func (c *Chat) ownsUser(id string) bool {
+	if c.owners == nil {
+		return true
+	}
+	c.ownerMu.RLock()
+	defer c.ownerMu.RUnlock()
+	return !c.lostUsers[id]
+}
+
+// userReachable reports whether a message to the user has somewhere to go: a
+// session or long poll on this instance or, with ownership, another instance
+// owning the user. Without ownership any peer may have the user. It asks the
+// backend, so it is called before c.order is taken.
+func (c *Chat) userReachable(id string) bool {
+	if c.userConnected(id) || c.polling(id) {
+		return true
+	}
+	if c.backend == nil {
+		return false
+	}
+	if c.owners == nil {
+		return true
+	}
+	owner, err := c.owners.Owner(id)
+	if err != nil {
+		// Rather publish in vain than lose the message
+		c.log.Warn().Err(err).Str("user", id).Msg("could not look up user owner")
+		return true
+	}
+	return owner != "" && owner != c.instanceID
+}
+
+// refreshOwnership keeps the claims on the users connected to this instance
+// from expiring, and remembers those another instance took over for
+// ownsUser.
+func (c *Chat) refreshOwnership() {
+	var ids []string
+	c.mutex.RLock()
+	c.rangeRooms("", func(_ string, r *room) {
+		for id := range r.users {
+			ids = append(ids, id)
+		}
+	})
+	c.mutex.RUnlock()
+	lost := make(map[string]bool)
+	if len(ids) > 0 {
+		others, err := c.owners.Refresh(c.instanceID, ids, c.ownerTTL)
+		if err != nil {
+			c.log.Warn().Err(err).Int("users", len(ids)).Msg("could not refresh user ownership")
+			return
+		}
+		for _, id := range others {
+			lost[id] = true
+		}
+	}
+	c.ownerMu.Lock()
+	c.lostUsers = lost
+	c.ownerMu.Unlock()
+}
+
+// keepOwnership refreshes the claims three times per TTL until stop is
+// called.
+func (c *Chat) keepOwnership() (stop CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.ownerTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.refreshOwnership()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
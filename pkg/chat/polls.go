@@ -0,0 +1,316 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxPollOptions    = 10
+	pollTallyInterval = time.Second // rooms receive at most one poll_update per poll per interval
+)
+
+var (
+	maxPolls = Int("RADIO_MAX_POLLS", 5)
+	pollTTL  = Duration("RADIO_POLL_TTL", 15*time.Minute)
+)
+
+var (
+	ErrUnknownPoll  = errors.New("unknown poll")
+	ErrPollClosed   = errors.New("poll closed")
+	ErrTooManyPolls = errors.New("too many open polls")
+)
+
+type poll struct {
+	msg    OutgoingMessage // the poll as sent to users
+	votes  map[string]int  // lidnr -> option
+	closed bool
+
+	lastTally time.Time
+	pending   *time.Timer // scheduled tally, nil when none is due
+	expiry    *time.Timer // forgets the poll after pollTTL, see expirePoll
+}
+
+func (p *poll) tally() []int {
+	counts := make([]int, len(p.msg.Options))
+	for _, option := range p.votes {
+		counts[option]++
+	}
+	return counts
+}
+
+// pollState holds the polls of a chat, open and recently closed.
+type pollState struct {
+	mu   sync.Mutex
+	byID map[string]*poll
+}
+
+// pollQuestion and pollOptions accept both ways to start a poll: type=poll
+// with question and options, or a message with pollOptions asking its content.
+func pollQuestion(in IncomingMessage) string {
+	if in.Question != "" {
+		return in.Question
+	}
+	return in.Content
+}
+
+func pollOptions(in IncomingMessage) []string {
+	if len(in.PollOptions) > 0 {
+		return in.PollOptions
+	}
+	return in.Options
+}
+
+func validatePoll(in IncomingMessage) error {
+	if strings.TrimSpace(pollQuestion(in)) == "" {
+		return errors.New("poll requires a question")
+	}
+	options := pollOptions(in)
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return fmt.Errorf("poll requires 2 to %d options", maxPollOptions)
+	}
+	for _, o := range options {
+		if strings.TrimSpace(o) == "" {
+			return errors.New("poll options must not be empty")
+		}
+	}
+	return nil
+}
+
+// parseVote returns the poll and option voted for, given either as pollId and
+// option or as content "<pollId>:<option>".
+func parseVote(in IncomingMessage) (string, int, error) {
+	if in.PollID != "" && in.Option != nil {
+		return in.PollID, *in.Option, nil
+	}
+	pollID, option, ok := strings.Cut(in.Content, ":")
+	if !ok || pollID == "" {
+		return "", 0, errors.New("vote requires pollId and option")
+	}
+	index, err := strconv.Atoi(option)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid option %q", option)
+	}
+	return pollID, index, nil
+}
+
+func validateVote(in IncomingMessage) error {
+	_, _, err := parseVote(in)
+	return err
+}
+
+// startPoll opens a poll from a radio and sends it to everyone in the room.
+// Polls close automatically after pollTTL.
+func (c *Chat) startPoll(ctx context.Context, client *Client, in IncomingMessage) error {
+	if client.role != "radio" {
+		return errors.New("only radios can start polls")
+	}
+
+	c.order.Lock()
+	defer c.order.Unlock()
+	out := OutgoingMessage{
+		ID:          c.nextMessageID(),
+		SentAt:      time.Now(),
+		Type:        MessageTypePoll,
+		From:        client.id,
+		GivenName:   client.givenName,
+		FamilyName:  client.familyName,
+		DisplayName: c.displayName(client),
+		Room:        client.room,
+		Question:    pollQuestion(in),
+		Options:     pollOptions(in),
+	}
+	out.PollID = out.ID
+
+	c.polls.mu.Lock()
+	open := 0
+	for _, p := range c.polls.byID {
+		if !p.closed {
+			open++
+		}
+	}
+	if open >= maxPolls {
+		c.polls.mu.Unlock()
+		c.sendNotice(client, MessageTypeError, ErrTooManyPolls.Error())
+		return ErrTooManyPolls
+	}
+	p := &poll{msg: out, votes: make(map[string]int)}
+	p.expiry = time.AfterFunc(pollTTL, func() { c.expirePoll(out.PollID) })
+	c.polls.byID[out.PollID] = p
+	c.polls.mu.Unlock()
+
+	c.forwardToUsers(ctx, out)
+	c.forwardToRadios(ctx, out)
+	return nil
+}
+
+// vote records the vote of a user, replacing an earlier vote on the same poll.
+func (c *Chat) vote(ctx context.Context, client *Client, in IncomingMessage) error {
+	if client.role != "user" {
+		return errors.New("only users can vote")
+	}
+	pollID, option, err := parseVote(in)
+	if err != nil {
+		return err
+	}
+
+	c.polls.mu.Lock()
+	p, ok := c.polls.byID[pollID]
+	switch {
+	case !ok || p.msg.Room != client.room:
+		err = ErrUnknownPoll
+	case p.closed:
+		err = ErrPollClosed
+	case option < 0 || option >= len(p.msg.Options):
+		err = fmt.Errorf("invalid option %d", option)
+	default:
+		p.votes[client.id] = option
+		c.scheduleTally(p)
+	}
+	c.polls.mu.Unlock()
+
+	if err != nil {
+		c.sendNotice(client, MessageTypeError, err.Error())
+	}
+	return err
+}
+
+// scheduleTally sends the tally to everyone in the room of the poll, at most
+// once per pollTallyInterval. Callers must hold c.polls.mu.
+func (c *Chat) scheduleTally(p *poll) {
+	if p.pending != nil {
+		return
+	}
+	delay := max(0, time.Until(p.lastTally.Add(pollTallyInterval)))
+	p.pending = time.AfterFunc(delay, func() {
+		c.polls.mu.Lock()
+		if p.pending == nil {
+			// Cancelled by closing the poll
+			c.polls.mu.Unlock()
+			return
+		}
+		p.pending = nil
+		p.lastTally = time.Now()
+		tally := c.tallyMessage(p)
+		c.polls.mu.Unlock()
+
+		ctx := context.Background()
+		c.forwardToUsers(ctx, tally)
+		c.forwardToRadios(ctx, tally)
+	})
+}
+
+// tallyMessage returns the current results. Callers must hold c.polls.mu.
+func (c *Chat) tallyMessage(p *poll) OutgoingMessage {
+	return OutgoingMessage{
+		SentAt: time.Now(),
+		Type:   MessageTypePollUpdate,
+		Room:   p.msg.Room,
+		PollID: p.msg.PollID,
+		Tally:  p.tally(),
+		Closed: p.closed,
+	}
+}
+
+// closePoll stops accepting votes on a poll in the radio's room and sends the
+// final tally to everyone in the room. The poll is forgotten after it expires.
+func (c *Chat) closePoll(ctx context.Context, client *Client, pollID string) error {
+	err := c.endPoll(ctx, pollID, client.room)
+	if err != nil {
+		c.sendNotice(client, MessageTypeError, err.Error())
+	}
+	return err
+}
+
+// endPoll closes an open poll and sends the final tally to everyone in its
+// room. An empty room matches polls in every room. Closing a closed poll does
+// nothing.
+func (c *Chat) endPoll(ctx context.Context, pollID, room string) error {
+	c.polls.mu.Lock()
+	p, ok := c.polls.byID[pollID]
+	if !ok || (room != "" && p.msg.Room != room) {
+		c.polls.mu.Unlock()
+		return ErrUnknownPoll
+	}
+	if p.closed {
+		c.polls.mu.Unlock()
+		return nil
+	}
+	tally := c.finishPoll(p)
+	c.polls.mu.Unlock()
+
+	c.forwardToUsers(ctx, tally)
+	c.forwardToRadios(ctx, tally)
+	return nil
+}
+
+// finishPoll closes the poll and returns its final tally. Callers must hold
+// c.polls.mu.
+func (c *Chat) finishPoll(p *poll) OutgoingMessage {
+	p.closed = true
+	if p.pending != nil {
+		p.pending.Stop()
+		p.pending = nil
+	}
+	return c.tallyMessage(p)
+}
+
+// stopPolls stops the tallies and expiries of all polls, for Shutdown.
+func (c *Chat) stopPolls() {
+	c.polls.mu.Lock()
+	defer c.polls.mu.Unlock()
+	for _, p := range c.polls.byID {
+		p.expiry.Stop()
+		if p.pending != nil {
+			p.pending.Stop()
+			p.pending = nil
+		}
+	}
+}
+
+// expirePoll closes a poll that is still open and forgets it.
+func (c *Chat) expirePoll(pollID string) {
+	c.polls.mu.Lock()
+	p, ok := c.polls.byID[pollID]
+	if !ok {
+		c.polls.mu.Unlock()
+		return
+	}
+	delete(c.polls.byID, pollID)
+	wasOpen := !p.closed
+	tally := c.finishPoll(p)
+	c.polls.mu.Unlock()
+
+	if wasOpen {
+		ctx := context.Background()
+		c.forwardToUsers(ctx, tally)
+		c.forwardToRadios(ctx, tally)
+	}
+}
+
+// HandlePoll closes a poll with DELETE /api/v1/polls/{id}, as if a radio sent
+// closepoll. Requires the admin key.
+func (c *Chat) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := c.endPoll(r.Context(), id, ""); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	c.audit(ActorAdminKey, CommandClosePoll, id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,274 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTestPoll opens a poll from the radio and returns it as seen by the user.
+func startTestPoll(t *testing.T, user, radio *websocket.Conn) OutgoingMessage {
+	t.Helper()
+	if err := radio.WriteJSON(IncomingMessage{Type: MessageTypePoll, Question: "Next song?", Options: []string{"A", "B"}}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	p, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if p.Type != MessageTypePoll || p.PollID == "" || len(p.Options) != 2 {
+		t.Fatalf("unexpected poll: %+v", p)
+	}
+	// The radio receives its own poll as well
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second); err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	return p
+}
+
+func vote(t *testing.T, user *websocket.Conn, pollID string, option int) {
+	t.Helper()
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeVote, PollID: pollID, Option: &option}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+}
+
+func TestPollVoteReplacesEarlierVote(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	p := startTestPoll(t, user, radio)
+	vote(t, user, p.PollID, 0)
+	vote(t, user, p.PollID, 1)
+
+	deadline := time.Now().Add(3 * pollTallyInterval)
+	for {
+		tally, err := readJSONWithDeadline[OutgoingMessage](t, radio, time.Until(deadline))
+		if err != nil {
+			t.Fatalf("expected tally [0 1] before deadline: %v", err)
+		}
+		if tally.Type == MessageTypePollUpdate && slices.Equal(tally.Tally, []int{0, 1}) {
+			return
+		}
+	}
+}
+
+func TestPollTallyIsDebounced(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	p := startTestPoll(t, user, radio)
+	for i := range 10 {
+		vote(t, user, p.PollID, i%2)
+	}
+
+	// Ten votes in quick succession result in at most two tallies: the first
+	// vote right away and the rest batched an interval later.
+	var tallies []time.Time
+	deadline := time.Now().Add(pollTallyInterval + 500*time.Millisecond)
+	for {
+		tally, err := readJSONWithDeadline[OutgoingMessage](t, radio, time.Until(deadline))
+		if err != nil {
+			break
+		}
+		if tally.Type == MessageTypePollUpdate {
+			tallies = append(tallies, time.Now())
+		}
+	}
+	if len(tallies) == 0 || len(tallies) > 2 {
+		t.Fatalf("expected one or two tallies, got %d", len(tallies))
+	}
+	if len(tallies) == 2 && tallies[1].Sub(tallies[0]) < pollTallyInterval-100*time.Millisecond {
+		t.Fatalf("tallies only %v apart", tallies[1].Sub(tallies[0]))
+	}
+}
+
+func TestVoteAfterPollClosedRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	p := startTestPoll(t, user, radio)
+	if err := radio.WriteJSON(IncomingMessage{Cmd: CommandClosePoll, PollID: p.PollID}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	final, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if final.Type != MessageTypePollUpdate || !final.Closed {
+		t.Fatalf("expected final tally, got: %+v", final)
+	}
+
+	vote(t, user, p.PollID, 0)
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if out.Type != MessageTypeError || out.Content != ErrPollClosed.Error() {
+		t.Fatalf("expected poll closed error, got: %+v", out)
+	}
+}
+
+func deletePoll(t *testing.T, chat *Chat, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/polls/"+id, nil)
+	req.SetPathValue("id", id)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	chat.HandlePoll(rec, req)
+	return rec
+}
+
+func TestClosePollByAdmin(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+	others := make([]*websocket.Conn, 2)
+	for i := range others {
+		others[i] = dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 20000+i, "Carol", "User", time.Minute), "")
+		defer others[i].Close()
+	}
+	waitForUsers(t, chat, 3)
+
+	p := startTestPoll(t, user, radio)
+	for _, other := range others {
+		if _, err := readJSONWithDeadline[OutgoingMessage](t, other, 2*time.Second); err != nil {
+			t.Fatalf("user read: %v", err)
+		}
+	}
+	vote(t, user, p.PollID, 0)
+	vote(t, others[0], p.PollID, 1)
+	vote(t, others[1], p.PollID, 1)
+	vote(t, user, p.PollID, 1)
+	// Votes are dispatched asynchronously, wait until all four are counted
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		chat.polls.mu.Lock()
+		tally := chat.polls.byID[p.PollID].tally()
+		chat.polls.mu.Unlock()
+		if slices.Equal(tally, []int{0, 3}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a tally of [0 3], got %v", tally)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec := deletePoll(t, chat, p.PollID); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	// Skip the updates sent while the votes came in
+	for {
+		final, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+		if err != nil || final.Type != MessageTypePollUpdate {
+			t.Fatalf("expected the final tally [0 3], got: %+v (%v)", final, err)
+		}
+		if final.Closed {
+			if !slices.Equal(final.Tally, []int{0, 3}) {
+				t.Fatalf("expected the final tally [0 3], got %v", final.Tally)
+			}
+			break
+		}
+	}
+	if rec := deletePoll(t, chat, p.PollID); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected closing twice to succeed, got %d", rec.Code)
+	}
+	if rec := deletePoll(t, chat, "unknown"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown poll, got %d", rec.Code)
+	}
+}
+
+func TestPollUpdateReachesUsers(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+	other := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 20000, "Carol", "User", time.Minute), "")
+	defer other.Close()
+	waitForUsers(t, chat, 2)
+
+	// A message with pollOptions starts a poll asking its content
+	if err := radio.WriteJSON(IncomingMessage{Content: "Next song?", PollOptions: []string{"A", "B"}}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	p, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || p.Type != MessageTypePoll || p.Question != "Next song?" || !slices.Equal(p.Options, []string{"A", "B"}) {
+		t.Fatalf("expected the poll, got: %+v (%v)", p, err)
+	}
+	if p.PollID != p.ID {
+		t.Fatalf("expected the poll to be keyed by its message ID, got %q and %q", p.PollID, p.ID)
+	}
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, other, 2*time.Second); err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeVote, Content: p.PollID + ":1"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	for _, conn := range []*websocket.Conn{user, other} {
+		update, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+		if err != nil || update.Type != MessageTypePollUpdate || update.PollID != p.PollID || !slices.Equal(update.Tally, []int{0, 1}) {
+			t.Fatalf("expected a poll_update with tally [0 1], got: %+v (%v)", update, err)
+		}
+	}
+}
+
+func TestParseVote(t *testing.T) {
+	option := 2
+	for _, tc := range []struct {
+		in     IncomingMessage
+		pollID string
+		option int
+		ok     bool
+	}{
+		{IncomingMessage{PollID: "abc", Option: &option}, "abc", 2, true},
+		{IncomingMessage{Content: "abc:1"}, "abc", 1, true},
+		{IncomingMessage{Content: "abc"}, "", 0, false},
+		{IncomingMessage{Content: ":1"}, "", 0, false},
+		{IncomingMessage{Content: "abc:one"}, "", 0, false},
+	} {
+		pollID, option, err := parseVote(tc.in)
+		if (err == nil) != tc.ok || pollID != tc.pollID || option != tc.option {
+			t.Errorf("parseVote(%+v) = %q, %d, %v", tc.in, pollID, option, err)
+		}
+	}
+}
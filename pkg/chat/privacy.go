@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+)
+
+// PrivacyMode controls how members are shown to radios. Routing, history,
+// events and the audit log always use the real lidnr.
+type PrivacyMode string
+
+const (
+	PrivacyFull      PrivacyMode = "full"      // lidnr and names
+	PrivacyPseudonym PrivacyMode = "pseudonym" // a generated handle instead of lidnr and names
+	PrivacyAnonymous PrivacyMode = "anonymous" // lidnr without names
+)
+
+var chatPrivacyMode = String("CHAT_PRIVACY_MODE", string(PrivacyFull))
+
+func ParsePrivacyMode(s string) (PrivacyMode, error) {
+	switch m := PrivacyMode(s); m {
+	case PrivacyFull, PrivacyPseudonym, PrivacyAnonymous:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown privacy mode %q, expected full, pseudonym or anonymous", s)
+}
+
+var pseudonymNouns = []string{
+	"Runner", "Listener", "Dancer", "Drummer", "Singer", "Rocker", "Raver", "Hummer",
+	"Whistler", "Tapper", "Crooner", "Strummer", "Bopper", "Jiver", "Skater", "Dreamer",
+}
+
+// pseudonyms hands out a handle per lidnr, kept until the process exits so a
+// member keeps their handle across reconnects.
+type pseudonyms struct {
+	mu       sync.Mutex
+	byID     map[string]string // lidnr -> handle
+	byHandle map[string]string // handle -> lidnr
+}
+
+func newPseudonyms() *pseudonyms {
+	return &pseudonyms{byID: make(map[string]string), byHandle: make(map[string]string)}
+}
+
+// handle returns the member's handle, generating one on first use. Numbers
+// get an extra digit whenever a few picks in a row were taken.
+func (p *pseudonyms) handle(id string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if h, ok := p.byID[id]; ok {
+		return h
+	}
+	limit := 100
+	for i := 1; ; i++ {
+		h := fmt.Sprintf("%s-%d", pseudonymNouns[rand.IntN(len(pseudonymNouns))], rand.IntN(limit))
+		if _, taken := p.byHandle[h]; !taken {
+			p.byID[id] = h
+			p.byHandle[h] = id
+			return h
+		}
+		if i%8 == 0 {
+			limit *= 10
+		}
+	}
+}
+
+// resolve returns the lidnr of a handle.
+func (p *pseudonyms) resolve(h string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.byHandle[h]
+	return id, ok
+}
+
+// hideMember returns the message as radios see it when it was sent by a
+// member.
+func (c *Chat) hideMember(msg OutgoingMessage) OutgoingMessage {
+	switch c.privacy {
+	case PrivacyPseudonym:
+		msg.From = c.pseudonyms.handle(msg.From)
+		msg.GivenName, msg.FamilyName, msg.DisplayName, msg.Email = msg.From, "", msg.From, ""
+	case PrivacyAnonymous:
+		msg.GivenName, msg.FamilyName, msg.DisplayName, msg.Email = "", "", "", ""
+	}
+	return msg
+}
+
+// hideUser returns a connected user as radios see them.
+func (c *Chat) hideUser(u UserInfo) UserInfo {
+	switch c.privacy {
+	case PrivacyPseudonym:
+		u.ID = c.pseudonyms.handle(u.ID)
+		u.GivenName, u.FamilyName = u.ID, ""
+	case PrivacyAnonymous:
+		u.GivenName, u.FamilyName = "", ""
+	}
+	return u
+}
+
+// hideRecipient returns a radio message as other radios see it.
+func (c *Chat) hideRecipient(msg OutgoingMessage) OutgoingMessage {
+	if c.privacy == PrivacyPseudonym && msg.To != "" {
+		msg.To = c.pseudonyms.handle(msg.To)
+	}
+	return msg
+}
+
+// memberID returns the lidnr a radio means by to, which is a handle in
+// pseudonym mode. Unknown handles are returned as is.
+func (c *Chat) memberID(to string) string {
+	if c.privacy != PrivacyPseudonym {
+		return to
+	}
+	if id, ok := c.pseudonyms.resolve(to); ok {
+		return id
+	}
+	return to
+}
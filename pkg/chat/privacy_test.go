@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrivacyModes(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	tests := []struct {
+		mode  PrivacyMode
+		check func(out OutgoingMessage) bool
+		want  string
+	}{
+		{PrivacyFull, func(out OutgoingMessage) bool {
+			return out.From == "12345" && out.GivenName == "Alice" && out.FamilyName == "User"
+		}, "real lidnr and names"},
+		{PrivacyPseudonym, func(out OutgoingMessage) bool {
+			return out.From != "12345" && strings.Contains(out.From, "-") && out.GivenName == out.From && out.FamilyName == ""
+		}, "handle without names"},
+		{PrivacyAnonymous, func(out OutgoingMessage) bool {
+			return out.From == "12345" && out.GivenName == "" && out.FamilyName == ""
+		}, "lidnr without names"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			chat := New()
+			chat.privacy = tt.mode
+			srv, wsBase := startTestServer(t, chat)
+			defer srv.Close()
+			user, radio := connectUserAndRadio(t, chat, wsBase)
+			defer user.Close()
+			defer radio.Close()
+
+			sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+			out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+			if err != nil || !tt.check(out) {
+				t.Fatalf("expected %s, got: %+v (%v)", tt.want, out, err)
+			}
+			if _, msg, _ := chat.history.Lookup(out.ID); msg.From != "12345" || msg.GivenName != "Alice" {
+				t.Fatalf("expected the history to keep the member, got: %+v", msg)
+			}
+
+			// Replying to the from field reaches the member
+			if err := radio.WriteJSON(IncomingMessage{To: out.From, Content: "Coming up next"}); err != nil {
+				t.Fatalf("radio write: %v", err)
+			}
+			reply, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+			if err != nil || reply.Content != "Coming up next" || reply.To != "12345" {
+				t.Fatalf("expected the reply for 12345, got: %+v (%v)", reply, err)
+			}
+		})
+	}
+}
+
+func TestInvalidPrivacyMode(t *testing.T) {
+	prev := chatPrivacyMode
+	defer func() { chatPrivacyMode = prev }()
+	chatPrivacyMode = "pseudonymous"
+
+	if chat := New(); chat.privacy != PrivacyAnonymous {
+		t.Fatalf("expected names to be hidden, got %q", chat.privacy)
+	}
+	var fatal bool
+	for _, p := range CheckEnv() {
+		fatal = fatal || p.Setting == "CHAT_PRIVACY_MODE" && p.Fatal
+	}
+	if !fatal {
+		t.Fatal("expected the mode to refuse startup")
+	}
+}
+
+func TestPseudonymStableAcrossReconnect(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.privacy = PrivacyPseudonym
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer radio.Close()
+
+	sendAsUser(t, user, "first")
+	first, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+
+	user = dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+	sendAsUser(t, user, "second")
+	second, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil || second.From != first.From {
+		t.Fatalf("expected handle %q again, got: %+v (%v)", first.From, second, err)
+	}
+
+	other := chat.pseudonyms.handle("22222")
+	if other == first.From {
+		t.Fatalf("expected distinct handles, both got %q", other)
+	}
+	if users := chat.Users(""); len(users) != 1 || chat.hideUser(users[0]).ID != first.From {
+		t.Fatalf("expected the user listing to show the handle, got: %+v", users)
+	}
+}
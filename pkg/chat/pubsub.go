@@ -0,0 +1,193 @@
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// Subjects used to share messages between instances.
+const (
+	subjectRadios = "radiogaga.radios"
+	subjectUsers  = "radiogaga.users"
+	subjectRadio  = "radiogaga.radio"  // radio info POSTed to an instance
+	subjectClaims = "radiogaga.claims" // users claimed by an instance, see claimUser
+)
+
+// publishQueueSize is how many messages may wait for the pub/sub backend
+// before new ones are dropped, see publish.
+const publishQueueSize = 1024
+
+// CancelFunc stops a subscription.
+type CancelFunc func()
+
+// PubSubBackend connects multiple radiogaga instances, so that users and radios
+// connected to different instances can reach each other.
+type PubSubBackend interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func([]byte)) (CancelFunc, error)
+}
+
+// publication is a message waiting to be handed to the pub/sub backend.
+type publication struct {
+	subject string
+	data    []byte
+}
+
+// envelope is the wire format of a message shared between instances.
+type envelope struct {
+	Origin  string          `json:"origin"`
+	To      string          `json:"to,omitempty"` // target user, empty for everyone
+	Message OutgoingMessage `json:"message"`
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// UseBackend subscribes the chat to messages published by peer instances and
+// publishes all outgoing messages from now on. Backends implementing
+// UserOwnership also decide which instance delivers messages to a user.
+func (c *Chat) UseBackend(backend PubSubBackend) error {
+	if c.backend != nil {
+		return errors.New("pub/sub backend already configured")
+	}
+
+	cancelRadios, err := backend.Subscribe(subjectRadios, func(data []byte) {
+		if env, ok := c.decodeEnvelope(data); ok {
+			c.deliverToRadios(context.Background(), nil, env.Message)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	cancelUsers, err := backend.Subscribe(subjectUsers, func(data []byte) {
+		env, ok := c.decodeEnvelope(data)
+		if !ok {
+			return
+		}
+		if env.To == "" {
+			c.deliverToUsers(context.Background(), env.Message)
+			return
+		}
+		// Radios on peers may reply to a handle this instance gave out
+		if id := c.memberID(env.To); id != env.To {
+			env.To, env.Message.To = id, id
+		}
+		if c.ownsUser(env.To) {
+			c.deliverToUser(context.Background(), env.To, env.Message)
+		}
+	})
+	if err != nil {
+		cancelRadios()
+		return err
+	}
+	cancelRadio, err := backend.Subscribe(subjectRadio, func(data []byte) {
+		if env, ok := c.decodeEnvelope(data); ok {
+			c.applyRadio(context.Background(), env.Message)
+		}
+	})
+	if err != nil {
+		cancelRadios()
+		cancelUsers()
+		return err
+	}
+	subscriptions := []CancelFunc{cancelRadios, cancelUsers, cancelRadio}
+
+	owners, _ := backend.(UserOwnership)
+	if owners != nil && c.ownerTTL > 0 {
+		c.owners = owners
+		cancelClaims, err := backend.Subscribe(subjectClaims, func(data []byte) {
+			if env, ok := c.decodeEnvelope(data); ok {
+				c.lostUser(env.To)
+			}
+		})
+		if err != nil {
+			c.owners = nil
+			for _, cancel := range subscriptions {
+				cancel()
+			}
+			return err
+		}
+		subscriptions = append(subscriptions, cancelClaims, c.keepOwnership())
+	}
+
+	c.publishQueue = make(chan publication, publishQueueSize)
+	c.publishStop = make(chan struct{})
+	c.publishDone = make(chan struct{})
+	go c.publishLoop(backend)
+	c.backend = backend
+	c.subscriptions = subscriptions
+	return nil
+}
+
+// decodeEnvelope parses a message from a peer, dropping our own.
+func (c *Chat) decodeEnvelope(data []byte) (envelope, bool) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		c.log.Warn().Err(err).Msg("invalid message from pub/sub backend")
+		return env, false
+	}
+	return env, env.Origin != c.instanceID
+}
+
+// publish queues a message for peer instances and reports whether it was
+// queued. Messages are handed to the backend in the order they were queued,
+// by publishLoop, so callers holding c.order never wait on the backend. A full
+// queue drops the message rather than holding up the chat.
+func (c *Chat) publish(subject, to string, msg OutgoingMessage) bool {
+	if c.backend == nil {
+		return false
+	}
+	data, _ := json.Marshal(envelope{Origin: c.instanceID, To: to, Message: msg})
+	select {
+	case c.publishQueue <- publication{subject: subject, data: data}:
+		return true
+	default:
+		c.log.Warn().Str("subject", subject).Str("id", msg.ID).Msg("publish queue full, not sharing message with peers")
+		return false
+	}
+}
+
+// publishLoop hands queued messages to the backend until stopPublishing is
+// called, and then the ones still queued.
+func (c *Chat) publishLoop(backend PubSubBackend) {
+	defer close(c.publishDone)
+	send := func(p publication) {
+		if err := backend.Publish(p.subject, p.data); err != nil {
+			c.log.Warn().Err(err).Str("subject", p.subject).Msg("failed to publish message")
+		}
+	}
+	for {
+		select {
+		case p := <-c.publishQueue:
+			send(p)
+		case <-c.publishStop:
+			for {
+				select {
+				case p := <-c.publishQueue:
+					send(p)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopPublishing publishes what is queued and stops publishLoop, waiting
+// until the context is done at most. Later messages are dropped.
+func (c *Chat) stopPublishing(ctx context.Context) {
+	if c.publishStop == nil {
+		return
+	}
+	c.stopPublish.Do(func() { close(c.publishStop) })
+	select {
+	case <-c.publishDone:
+	case <-ctx.Done():
+	}
+}
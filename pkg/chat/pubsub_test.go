@@ -0,0 +1,282 @@
+package chat
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// memoryBackend is an in-process PubSubBackend shared by multiple chats.
+type memoryBackend struct {
+	mu   sync.Mutex
+	subs map[string][]func([]byte)
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{subs: make(map[string][]func([]byte))}
+}
+
+func (b *memoryBackend) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	handlers := append([]func([]byte){}, b.subs[subject]...)
+	b.mu.Unlock()
+	for _, h := range handlers {
+		go h(data)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Subscribe(subject string, handler func([]byte)) (CancelFunc, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[subject] = append(b.subs[subject], handler)
+	return func() {}, nil
+}
+
+// stalledBackend never returns from Publish until released.
+type stalledBackend struct {
+	memoryBackend
+	release chan struct{}
+}
+
+func (b *stalledBackend) Publish(subject string, data []byte) error {
+	<-b.release
+	return nil
+}
+
+func TestStalledBackendDoesNotBlockDelivery(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	backend := &stalledBackend{memoryBackend: *newMemoryBackend(), release: make(chan struct{})}
+	chat := New()
+	if err := chat.UseBackend(backend); err != nil {
+		t.Fatalf("use backend: %v", err)
+	}
+	defer close(backend.release)
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	// Local delivery goes on while the first publish never returns
+	sendAsUser(t, user, "first")
+	expectContent(t, radio, "first")
+	replyToUser(t, radio, "12345", "second")
+	expectContent(t, user, "second")
+	if err := chat.Broadcast(t.Context(), "", "third"); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectContent(t, user, "third")
+}
+
+func testCrossInstance(t *testing.T, a, b PubSubBackend) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+
+	chatA, chatB := New(), New()
+	if err := chatA.UseBackend(a); err != nil {
+		t.Fatalf("use backend: %v", err)
+	}
+	if err := chatB.UseBackend(b); err != nil {
+		t.Fatalf("use backend: %v", err)
+	}
+
+	srvA, wsA := startTestServer(t, chatA)
+	defer srvA.Close()
+	srvB, wsB := startTestServer(t, chatB)
+	defer srvB.Close()
+
+	user := dialAndHandshake(t, wsA, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	radio := dialAndHandshake(t, wsB, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	waitForUsers(t, chatA, 1)
+	waitForRadios(t, chatB, 1)
+
+	if err := user.WriteJSON(IncomingMessage{Content: "hi from A"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.From != "12345" || out.Content != "hi from A" {
+		t.Fatalf("unexpected message at radio: %+v", out)
+	}
+
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "hi from B"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	out, err = readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if out.From != "99999" || out.Content != "hi from B" {
+		t.Fatalf("unexpected message at user: %+v", out)
+	}
+}
+
+func TestCrossInstanceDelivery(t *testing.T) {
+	backend := newMemoryBackend()
+	testCrossInstance(t, backend, backend)
+}
+
+func TestOwnMessagesIgnored(t *testing.T) {
+	chat := New()
+	backend := newMemoryBackend()
+	if err := chat.UseBackend(backend); err != nil {
+		t.Fatalf("use backend: %v", err)
+	}
+
+	data := []byte(`{"origin":"` + chat.instanceID + `","message":{"from":"1","content":"x"}}`)
+	if _, ok := chat.decodeEnvelope(data); ok {
+		t.Fatal("expected own message to be ignored")
+	}
+}
+
+// TestNATSCrossInstanceDelivery runs against runNATSServer, or a real NATS
+// server when RADIO_NATS_TEST_URL is set, e.g. nats://localhost:4222.
+func TestNATSCrossInstanceDelivery(t *testing.T) {
+	url := os.Getenv("RADIO_NATS_TEST_URL")
+	if url == "" {
+		url = runNATSServer(t)
+	}
+
+	a, err := NewNATSBackend(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer a.Close()
+	b, err := NewNATSBackend(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer b.Close()
+
+	testCrossInstance(t, a, b)
+}
+
+func TestRedisCrossInstanceDelivery(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	a, err := NewRedisBackend("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer a.Close()
+	b, err := NewRedisBackend("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer b.Close()
+
+	testCrossInstance(t, a, b)
+}
+
+func TestRedisOwnership(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	server := miniredis.RunT(t)
+	chatA, chatB := New(), New()
+	for _, chat := range []*Chat{chatA, chatB} {
+		backend, err := NewRedisBackend("redis://" + server.Addr())
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer backend.Close()
+		if err := chat.UseBackend(backend); err != nil {
+			t.Fatalf("use backend: %v", err)
+		}
+	}
+	// Every subject goes over a single subscription per instance
+	if n := server.PubSubNumSub(redisChannel)[redisChannel]; n != 2 {
+		t.Fatalf("expected one subscription per instance, got %d", n)
+	}
+	srvA, wsA := startTestServer(t, chatA)
+	defer srvA.Close()
+	srvB, wsB := startTestServer(t, chatB)
+	defer srvB.Close()
+
+	token := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	stale := dialAndHandshake(t, wsA, "user", token, "")
+	defer stale.Close()
+	radioA := dialAndHandshake(t, wsA, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radioA.Close()
+	waitForUsers(t, chatA, 1)
+	if owner, _ := chatA.owners.Owner("12345"); owner != chatA.instanceID {
+		t.Fatalf("expected instance A to own the user, got %q", owner)
+	}
+
+	// The user moves to B before the session on A timed out
+	moved := dialAndHandshake(t, wsB, "user", token, "")
+	defer moved.Close()
+	waitForUsers(t, chatB, 1)
+	if owner, _ := chatA.owners.Owner("12345"); owner != chatB.instanceID {
+		t.Fatalf("expected instance B to own the user, got %q", owner)
+	}
+	// A learns from B's claim, without waiting for its next refresh
+	deadline := time.Now().Add(2 * time.Second)
+	for chatA.ownsUser("12345") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected instance A to know it lost the user")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	replyToUser(t, radioA, "12345", "only once")
+	expectContent(t, moved, "only once")
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, stale, 200*time.Millisecond); err == nil {
+		t.Fatalf("expected the stale session to get nothing, got: %+v", out)
+	}
+
+	// A keeps its stale session but does not take the user back, and claims
+	// it again once B's claim expired
+	chatA.refreshOwnership()
+	if owner, _ := chatA.owners.Owner("12345"); owner != chatB.instanceID {
+		t.Fatalf("expected instance B to keep the user, got %q", owner)
+	}
+	server.FastForward(chatB.ownerTTL + time.Second)
+	chatA.refreshOwnership()
+	if owner, _ := chatA.owners.Owner("12345"); owner != chatA.instanceID || !chatA.ownsUser("12345") {
+		t.Fatalf("expected instance A to claim the unowned user, got %q", owner)
+	}
+	if ttl := server.TTL(ownerKey("12345")); ttl <= 0 || ttl > chatA.ownerTTL {
+		t.Fatalf("expected the claim to expire within %v, got %v", chatA.ownerTTL, ttl)
+	}
+}
+
+func TestRedisUserPresence(t *testing.T) {
+	GEWISSecret = "testsecret"
+	server := miniredis.RunT(t)
+	chatA, chatB := New(), New()
+	for _, chat := range []*Chat{chatA, chatB} {
+		backend, err := NewRedisBackend("redis://" + server.Addr())
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer backend.Close()
+		if err := chat.UseBackend(backend); err != nil {
+			t.Fatalf("use backend: %v", err)
+		}
+	}
+	srvB, wsB := startTestServer(t, chatB)
+	defer srvB.Close()
+	user := dialAndHandshake(t, wsB, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chatB, 1)
+
+	// A reaches the user on B, but knows nobody owns 77777
+	if err := chatA.Broadcast(t.Context(), "12345", "on B"); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	expectContent(t, user, "on B")
+	if err := chatA.Broadcast(t.Context(), "77777", "nobody"); !errors.Is(err, ErrUserNotConnected) {
+		t.Fatalf("expected %v, got %v", ErrUserNotConnected, err)
+	}
+}
@@ -0,0 +1,49 @@
+package chat
+
+import "net/http"
+
+// isQuestion reports whether a message in the history is a user message radios
+// are expected to answer.
+func (c *Chat) isQuestion(role string, msg OutgoingMessage) bool {
+	return role == "user" && msg.Type == MessageTypeChat && !c.isDM(role, msg)
+}
+
+// markAnswered marks a question in the room as answered and reports whether
+// it was found.
+func (c *Chat) markAnswered(roomName, id string) bool {
+	return c.history.Update(id,
+		func(role string, msg OutgoingMessage) bool {
+			return msg.Room == roomName && c.isQuestion(role, msg)
+		},
+		func(msg *OutgoingMessage) { msg.Answered = true },
+	)
+}
+
+// HandleQuestions lists the unanswered questions in the ?room=, oldest first.
+// Questions that aged out of the history are not included.
+func (c *Chat) HandleQuestions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.radioKeyAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing radio key")
+		return
+	}
+	roomName, err := c.roomFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	questions := c.history.Since("", 0, func(role string, msg OutgoingMessage) bool {
+		return msg.Room == roomName && !msg.Answered && c.isQuestion(role, msg)
+	})
+	if questions == nil {
+		questions = []OutgoingMessage{}
+	}
+	for i := range questions {
+		questions[i] = c.hideMember(questions[i])
+	}
+	writeJSON(w, http.StatusOK, questions)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getQuestions(t *testing.T, chat *Chat) []OutgoingMessage {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/chat/questions", nil)
+	req.Header.Set("Authorization", "Bearer "+RADIOChatKey)
+	rec := httptest.NewRecorder()
+	chat.HandleQuestions(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("questions: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var questions []OutgoingMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &questions); err != nil {
+		t.Fatalf("questions: invalid json: %v", err)
+	}
+	return questions
+}
+
+func TestReplyMarksQuestionAnswered(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := user.WriteJSON(IncomingMessage{Content: "where is the water post?"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	question, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "at km 5", InReplyTo: question.ID}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	reply, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if reply.InReplyTo != question.ID {
+		t.Fatalf("expected reply to carry inReplyTo, got: %+v", reply)
+	}
+
+	if open := getQuestions(t, chat); len(open) != 0 {
+		t.Fatalf("expected no open questions, got: %+v", open)
+	}
+	inbox := getInbox(t, chat, "")
+	if len(inbox.Messages) != 1 || !inbox.Messages[0].Answered {
+		t.Fatalf("expected the inbox to show the question as answered, got: %+v", inbox.Messages)
+	}
+}
+
+func TestResolveMarksQuestionAnswered(t *testing.T) {
+	chat := New()
+	user := &Client{role: "user", id: "12345", room: DefaultRoom}
+	radio := &Client{role: "radio", id: "99999", room: DefaultRoom}
+
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "thanks!"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	question := chat.history.Since("", 0, nil)[0]
+
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{Cmd: CommandResolve, MessageID: question.ID}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if _, msg, _ := chat.history.Lookup(question.ID); !msg.Answered {
+		t.Fatalf("expected question to be answered, got: %+v", msg)
+	}
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{Cmd: CommandResolve, MessageID: "0000000000000001"}); err != ErrUnknownMessage {
+		t.Fatalf("expected ErrUnknownMessage, got: %v", err)
+	}
+}
+
+func TestOpenQuestionsOrderedByAge(t *testing.T) {
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	radio := &Client{role: "radio", id: "99999", room: DefaultRoom}
+
+	for _, u := range []struct{ id, content string }{{"1", "first"}, {"2", "second"}, {"3", "third"}} {
+		client := &Client{role: "user", id: u.id, room: DefaultRoom}
+		if err := chat.dispatch(context.Background(), client, IncomingMessage{Content: u.content}); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+	}
+	// Radio messages are not questions
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{To: "1", Content: "noted"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	second := chat.history.Since("", 0, nil)[1]
+	if err := chat.dispatch(context.Background(), radio, IncomingMessage{Cmd: CommandResolve, MessageID: second.ID}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	open := getQuestions(t, chat)
+	if len(open) != 2 || open[0].Content != "first" || open[1].Content != "third" {
+		t.Fatalf("expected first and third question, got: %+v", open)
+	}
+}
@@ -0,0 +1,222 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type RadioInfo struct {
+	VideoURL        string `json:"videoUrl" description:"HLS video stream"`
+	AudioURL        string `json:"audioUrl" description:"Icecast host"`
+	AudioMountPoint string `json:"audioMountPoint" description:"Icecast mount point"`
+	StartTime       string `json:"startTime" format:"date-time" description:"Start of the broadcast"`
+	Duration        string `json:"duration,omitempty" description:"ISO 8601 length of the broadcast, e.g. PT2H30M"`
+	EndTime         string `json:"endTime,omitempty" format:"date-time" description:"Start time plus duration"` // see ComputeEndTime
+	Title           string `json:"title,omitempty" description:"Now playing, from Icecast"`
+	Artist          string `json:"artist,omitempty" description:"Now playing, from Icecast"`
+	Live            bool   `json:"is_live" description:"Whether the broadcast has started and not yet ended"` // IsLive at the time of the request
+}
+
+// RadioState holds the RadioInfo served by /api/v1/radio, which changes while
+// running when the Icecast metadata does.
+type RadioState struct {
+	mu      sync.RWMutex
+	info    RadioInfo
+	version uint64 // bumped on every replacement, served as ETag
+}
+
+func NewRadioState(info RadioInfo) *RadioState {
+	return &RadioState{info: info}
+}
+
+func (s *RadioState) Info() RadioInfo {
+	info, _ := s.Versioned()
+	return info
+}
+
+// Versioned returns the info with its version.
+func (s *RadioState) Versioned() (RadioInfo, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.info, s.version
+}
+
+// Replace swaps in new info, returning the previous info and the new version.
+func (s *RadioState) Replace(info RadioInfo) (RadioInfo, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.info
+	s.info = info
+	s.version++
+	return prev, s.version
+}
+
+// SetMetadata updates the title and artist, reporting whether they changed.
+func (s *RadioState) SetMetadata(title, artist string) (RadioInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.info.Title != title || s.info.Artist != artist
+	s.info.Title, s.info.Artist = title, artist
+	return s.info, changed
+}
+
+// validate checks that all required fields are present and the times parse,
+// computing EndTime.
+func (r *RadioInfo) validate() error {
+	switch {
+	case r.VideoURL == "":
+		return errors.New("videoUrl is required")
+	case r.AudioURL == "":
+		return errors.New("audioUrl is required")
+	case r.AudioMountPoint == "":
+		return errors.New("audioMountPoint is required")
+	case r.StartTime == "":
+		return errors.New("startTime is required")
+	}
+	if _, err := time.Parse(time.RFC3339, r.StartTime); err != nil {
+		return errors.New("startTime must be RFC 3339")
+	}
+	return r.ComputeEndTime()
+}
+
+// ComputeEndTime sets EndTime from StartTime and Duration, or clears it when
+// there is no duration.
+func (r *RadioInfo) ComputeEndTime() error {
+	if r.Duration == "" {
+		r.EndTime = ""
+		return nil
+	}
+	start, err := time.Parse(time.RFC3339, r.StartTime)
+	if err != nil {
+		return fmt.Errorf("start time: %w", err)
+	}
+	d, err := parseISODuration(r.Duration)
+	if err != nil {
+		return err
+	}
+	r.EndTime = start.Add(d).Format(time.RFC3339)
+	return nil
+}
+
+// IsLive reports whether the radio has started and not yet ended. Without an
+// end time it stays live after the start.
+func (r RadioInfo) IsLive() bool {
+	return r.isLiveAt(time.Now())
+}
+
+func (r RadioInfo) isLiveAt(now time.Time) bool {
+	start, err := time.Parse(time.RFC3339, r.StartTime)
+	if err != nil || now.Before(start) {
+		return false
+	}
+	if r.EndTime == "" {
+		return true
+	}
+	end, err := time.Parse(time.RFC3339, r.EndTime)
+	return err == nil && now.Before(end)
+}
+
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses ISO 8601 durations in days, hours, minutes and
+// seconds, like P1DT2H or PT2H30M. Years, months and weeks are not supported.
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDurationPattern.FindStringSubmatch(s)
+	if m == nil || s == "P" || s[len(s)-1] == 'T' {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q, expected e.g. PT2H30M", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	if d <= 0 {
+		return 0, errors.New("duration must be positive")
+	}
+	return d, nil
+}
+
+// WithRadioState keeps the state up to date with radio info POSTed to peer
+// instances. Pass the state served by HandleRadio.
+func WithRadioState(state *RadioState) Option {
+	return func(c *Chat) {
+		c.radioState = state
+	}
+}
+
+// publishRadio shares radio info POSTed to this instance with its peers, which
+// apply it with applyRadio.
+func (c *Chat) publishRadio(info RadioInfo) {
+	c.publish(subjectRadio, "", radioUpdate(info))
+}
+
+// applyRadio replaces the radio info with that POSTed to a peer and tells the
+// clients on this instance.
+func (c *Chat) applyRadio(ctx context.Context, msg OutgoingMessage) {
+	if msg.Radio == nil {
+		return
+	}
+	info := *msg.Radio
+	info.Live = false
+	if c.radioState != nil {
+		c.radioState.Replace(info)
+	}
+	c.RadioUpdate(ctx, info)
+}
+
+// HandleRadio serves the radio info on GET. POST replaces all of it at once,
+// for example when a new DJ set begins, tells every client, also those of peer
+// instances, and returns the previous info. POST requires the radio key.
+func (c *Chat) HandleRadio(state *RadioState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			info, version := state.Versioned()
+			info.Live = info.IsLive()
+			w.Header().Set("ETag", etag(version))
+			writeJSON(w, http.StatusOK, info)
+		case http.MethodPost:
+			if !c.radioKeyAuthorized(r) {
+				writeError(w, http.StatusUnauthorized, "invalid or missing radio key")
+				return
+			}
+			var info RadioInfo
+			if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid json")
+				return
+			}
+			if err := info.validate(); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			info.Live = false
+			prev, version := state.Replace(info)
+			c.audit(ActorRadioKey, "radio", "", map[string]string{"startTime": info.StartTime, "duration": info.Duration})
+			c.RadioUpdate(r.Context(), info)
+			c.publishRadio(info)
+
+			prev.Live = prev.IsLive()
+			w.Header().Set("ETag", etag(version))
+			writeJSON(w, http.StatusOK, prev)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT2H30M": 2*time.Hour + 30*time.Minute,
+		"P1DT2H":  26 * time.Hour,
+		"PT90S":   90 * time.Second,
+		"PT0.5S":  500 * time.Millisecond,
+	}
+	for s, want := range tests {
+		if got, err := parseISODuration(s); err != nil || got != want {
+			t.Errorf("parseISODuration(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "P", "PT", "2h", "P1Y", "PT0S"} {
+		if _, err := parseISODuration(s); err == nil {
+			t.Errorf("parseISODuration(%q): expected error", s)
+		}
+	}
+}
+
+func TestRadioInfoIsLive(t *testing.T) {
+	radio := RadioInfo{StartTime: "2025-08-18T07:00:00Z", Duration: "PT2H30M"}
+	if err := radio.ComputeEndTime(); err != nil {
+		t.Fatalf("ComputeEndTime: %v", err)
+	}
+	if radio.EndTime != "2025-08-18T09:30:00Z" {
+		t.Fatalf("unexpected end time %q", radio.EndTime)
+	}
+
+	tests := []struct {
+		name  string
+		radio RadioInfo
+		now   string
+		want  bool
+	}{
+		{"before start", radio, "2025-08-18T06:59:59Z", false},
+		{"at start", radio, "2025-08-18T07:00:00Z", true},
+		{"during", radio, "2025-08-18T08:00:00Z", true},
+		{"at end", radio, "2025-08-18T09:30:00Z", false},
+		{"without end time", RadioInfo{StartTime: "2025-08-18T07:00:00Z"}, "2026-01-01T00:00:00Z", true},
+		{"invalid start time", RadioInfo{StartTime: "soon"}, "2025-08-18T08:00:00Z", false},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		if got := tt.radio.isLiveAt(now); got != tt.want {
+			t.Errorf("%s: isLiveAt(%s) = %v, want %v", tt.name, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceRadioInfo(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	state := NewRadioState(RadioInfo{
+		VideoURL:        "https://example.com/live.m3u8",
+		AudioURL:        "bata-radio.snt.utwente.nl",
+		AudioMountPoint: "/high",
+		StartTime:       "2025-08-18T07:00:00Z",
+	})
+	handler := chat.HandleRadio(state)
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/radio", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := post("wrong", `{}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+	if rec := post(RADIOChatKey, `{"videoUrl": "https://example.com/dj.m3u8"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for missing fields, got %d", rec.Code)
+	}
+
+	rec := post(RADIOChatKey, `{
+		"videoUrl": "https://example.com/dj.m3u8",
+		"audioUrl": "bata-radio.snt.utwente.nl",
+		"audioMountPoint": "/dj",
+		"startTime": "2025-08-18T21:00:00Z",
+		"duration": "PT3H"
+	}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", rec.Header().Get("ETag"))
+	}
+	var prev RadioInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &prev); err != nil || prev.AudioMountPoint != "/high" {
+		t.Fatalf("expected previous info, got %+v (%v)", prev, err)
+	}
+	if info := state.Info(); info.AudioMountPoint != "/dj" || info.EndTime != "2025-08-19T00:00:00Z" {
+		t.Fatalf("unexpected state: %+v", info)
+	}
+
+	for name, conn := range map[string]*websocket.Conn{"user": user, "radio": radio} {
+		out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+		if err != nil || out.Type != MessageTypeRadioUpdate || out.Radio == nil || out.Radio.AudioMountPoint != "/dj" {
+			t.Fatalf("%s: expected radio_update with the new info, got: %+v (%v)", name, out, err)
+		}
+	}
+}
+
+func TestReplaceRadioInfoOnPeers(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	backend := newMemoryBackend()
+	stateA := NewRadioState(RadioInfo{AudioMountPoint: "/high"})
+	stateB := NewRadioState(RadioInfo{AudioMountPoint: "/high"})
+	chatA, chatB := New(WithRadioState(stateA)), New(WithRadioState(stateB))
+	for _, chat := range []*Chat{chatA, chatB} {
+		if err := chat.UseBackend(backend); err != nil {
+			t.Fatalf("use backend: %v", err)
+		}
+	}
+	srvB, wsB := startTestServer(t, chatB)
+	defer srvB.Close()
+	user := dialAndHandshake(t, wsB, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chatB, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/radio", strings.NewReader(`{
+		"videoUrl": "https://example.com/dj.m3u8",
+		"audioUrl": "bata-radio.snt.utwente.nl",
+		"audioMountPoint": "/dj",
+		"startTime": "2025-08-18T21:00:00Z"
+	}`))
+	req.Header.Set("Authorization", "Bearer "+RADIOChatKey)
+	rec := httptest.NewRecorder()
+	chatA.HandleRadio(stateA)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || out.Type != MessageTypeRadioUpdate || out.Radio == nil || out.Radio.AudioMountPoint != "/dj" {
+		t.Fatalf("expected radio_update from the peer, got: %+v (%v)", out, err)
+	}
+	if info := stateB.Info(); info.AudioMountPoint != "/dj" {
+		t.Fatalf("expected the peer's state to be replaced, got %+v", info)
+	}
+}
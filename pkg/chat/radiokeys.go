@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// RadioKeyHeader carries the radio key for websocket connections that pass
+// their token in the upgrade request instead of a handshake message.
+const RadioKeyHeader = "X-Radio-Key"
+
+// radioKeyExpiryWarning is how long before expiry a key is reported in the logs.
+const radioKeyExpiryWarning = 24 * time.Hour
+
+var (
+	ErrInvalidRadioKey = errors.New("invalid radio key")
+	ErrRadioKeyExpired = errors.New("radio key expired")
+)
+
+// RadioKey is a named radio key, optionally valid until ExpiresAt.
+type RadioKey struct {
+	Secret    string    `json:"secret"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// radioAllowedRoles lists token roles that may connect as radio without a
+// radio key, configured as RADIO_ALLOWED_ROLES=board,audio-committee.
+var radioAllowedRoles = parseList(String("RADIO_ALLOWED_ROLES", ""))
+
+// radioRole returns the first role in the token that grants radio access.
+func (c *Chat) radioRole(claims *GEWISClaims) (string, bool) {
+	for _, role := range claims.Roles {
+		if slices.Contains(c.radioRoles, role) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// RADIOChatKeys holds additional radio keys by key ID, configured as a JSON
+// object in RADIO_CHAT_KEYS. They are accepted next to RADIOChatKey. New
+// copies them, see WithRadioKey. Keys that cannot be parsed are left out and
+// reported by CheckEnv.
+var RADIOChatKeys, radioKeysErr = parseRadioKeys(envOr("RADIO_CHAT_KEYS", ""))
+
+func parseRadioKeys(raw string) (map[string]RadioKey, error) {
+	keys := make(map[string]RadioKey)
+	if raw == "" {
+		return keys, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+		return make(map[string]RadioKey), err
+	}
+	return keys, nil
+}
+
+// WithRadioKey authenticates radios with the key instead of RADIO_CHAT_KEY,
+// and the named keys instead of RADIO_CHAT_KEYS.
+func WithRadioKey(key string, named map[string]RadioKey) Option {
+	return func(c *Chat) {
+		c.radioKey = key
+		c.radioKeys = maps.Clone(named)
+	}
+}
+
+// checkRadioKey returns the ID of the key matching the supplied secret.
+func (c *Chat) checkRadioKey(secret string, now time.Time) (string, error) {
+	if secret == "" {
+		return "", ErrInvalidRadioKey
+	}
+	if c.radioKey != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(c.radioKey)) == 1 {
+		return "default", nil
+	}
+	for id, key := range c.radioKeys {
+		if key.Secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(key.Secret)) != 1 {
+			continue
+		}
+		if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			return id, ErrRadioKeyExpired
+		}
+		return id, nil
+	}
+	return "", ErrInvalidRadioKey
+}
+
+// radioKeyAuthorized reports whether the request carries a valid radio key as
+// bearer token.
+func (c *Chat) radioKeyAuthorized(r *http.Request) bool {
+	_, err := c.checkRadioKey(bearerToken(r), time.Now())
+	return err == nil
+}
+
+// WatchRadioKeyExpiry logs a warning once for every key that expires within a
+// day, checking at the given interval until stop is closed.
+func (c *Chat) WatchRadioKeyExpiry(interval time.Duration, stop <-chan struct{}) {
+	warned := make(map[string]bool)
+	check := func() {
+		now := time.Now()
+		for id, key := range c.radioKeys {
+			if key.ExpiresAt.IsZero() || warned[id] || key.ExpiresAt.Sub(now) > radioKeyExpiryWarning {
+				continue
+			}
+			warned[id] = true
+			c.log.Warn().Str("key", id).Time("expires_at", key.ExpiresAt).Msg("radio key expires within 24 hours")
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case <-stop:
+			return
+		}
+	}
+}
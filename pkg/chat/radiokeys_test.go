@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckRadioKeyExpiry(t *testing.T) {
+	keys, err := parseRadioKeys(`{"studio": {"secret": "s3cret", "expires_at": "2025-12-31T23:59:59Z"}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	chat := New(WithRadioKey("", keys))
+
+	before := time.Date(2025, 12, 31, 12, 0, 0, 0, time.UTC)
+	if id, err := chat.checkRadioKey("s3cret", before); err != nil || id != "studio" {
+		t.Fatalf("expected key to be accepted before expiry, got %q, %v", id, err)
+	}
+	after := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := chat.checkRadioKey("s3cret", after); err != ErrRadioKeyExpired {
+		t.Fatalf("expected ErrRadioKeyExpired after expiry, got %v", err)
+	}
+	if _, err := chat.checkRadioKey("other", before); err != ErrInvalidRadioKey {
+		t.Fatalf("expected ErrInvalidRadioKey, got %v", err)
+	}
+}
+
+func TestExpiredRadioKeyRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = ""
+	RADIOChatKeys = map[string]RadioKey{
+		"valid":   {Secret: "fresh", ExpiresAt: time.Now().Add(time.Hour)},
+		"expired": {Secret: "stale", ExpiresAt: time.Now().Add(-time.Hour)},
+	}
+	defer func() {
+		RADIOChatKey = "ChangeMe"
+		RADIOChatKeys = map[string]RadioKey{}
+	}()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	tok := makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute)
+	ok := dialAndHandshake(t, wsBase, "radio", tok, "fresh")
+	defer ok.Close()
+	waitForRadios(t, chat, 1)
+
+	expired := dialAndHandshake(t, wsBase, "radio", tok, "stale")
+	defer expired.Close()
+	_ = expired.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := expired.ReadMessage()
+	if !websocket.IsCloseError(err, CloseCodeSessionExpired) {
+		t.Fatalf("expected close code 4408, got: %v", err)
+	}
+}
+
+func makeRoleToken(t *testing.T, lidnr int, roles ...string) string {
+	t.Helper()
+	j := jwt.NewWithClaims(jwt.SigningMethodHS512, GEWISClaims{
+		Lidnr:            lidnr,
+		GivenName:        "Bob",
+		Roles:            roles,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	s, err := j.SignedString([]byte(GEWISSecret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func TestRadioAuthorization(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	tests := []struct {
+		name     string
+		roles    []string
+		radioKey string
+		accepted bool
+	}{
+		{"allowed role without key", []string{"member", "audio-committee"}, "", true},
+		{"other role without key", []string{"member"}, "", false},
+		{"other role with key", []string{"member"}, RADIOChatKey, true},
+		{"key only", nil, RADIOChatKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := New()
+			chat.radioRoles = []string{"board", "audio-committee"}
+			srv, wsBase := startTestServer(t, chat)
+			defer srv.Close()
+
+			conn := dialAndHandshake(t, wsBase, "radio", makeRoleToken(t, 99999, tt.roles...), tt.radioKey)
+			defer conn.Close()
+			if tt.accepted {
+				waitForRadios(t, chat, 1)
+				return
+			}
+			expectInvalidRadioKey(t, conn)
+		})
+	}
+}
+
+// expectInvalidRadioKey asserts that the radio connection is closed for its
+// key.
+func expectInvalidRadioKey(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, CloseCodeInvalidRadioKey) {
+		t.Fatalf("expected close code %d, got: %v", CloseCodeInvalidRadioKey, err)
+	}
+}
+
+func TestEmptyRadioKeyRejectsAll(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = ""
+	defer func() { RADIOChatKey = "ChangeMe" }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	// An empty key disables the shared key rather than matching an empty one
+	tok := makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute)
+	for _, key := range []string{"", "ChangeMe", "anything"} {
+		conn := dialAndHandshake(t, wsBase, "radio", tok, key)
+		expectInvalidRadioKey(t, conn)
+		_ = conn.Close()
+	}
+	if n := chat.RadioCount(); n != 0 {
+		t.Fatalf("expected no radios, got %d", n)
+	}
+}
+
+func TestDefaultRadioChatKeyWorks(t *testing.T) {
+	t.Setenv("RADIO_CHAT_KEY", "")
+	key := envOr("RADIO_CHAT_KEY", "ChangeMe")
+	if key != "ChangeMe" {
+		t.Fatalf("expected the default key, got %q", key)
+	}
+
+	GEWISSecret = "testsecret"
+	chat := New(WithRadioKey(key, nil))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	tok := makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute)
+	conn := dialAndHandshake(t, wsBase, "radio", tok, "ChangeMe")
+	defer conn.Close()
+	waitForRadios(t, chat, 1)
+
+	wrong := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 88888, "Eve", "Radio", time.Minute), "changeme")
+	defer wrong.Close()
+	expectInvalidRadioKey(t, wrong)
+}
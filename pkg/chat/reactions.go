@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// reactionEmoji are the emoji accepted in reactions.
+var reactionEmoji = []string{"👍", "👎", "❤️", "😂", "🎉", "👀"}
+
+var ErrUnknownMessage = errors.New("unknown message")
+
+// react forwards a reaction to the sender of the message reacted to. Radios
+// react to user messages, users to radio replies addressed to them. Reactions
+// can only be sent while the message is still in the history.
+func (c *Chat) react(ctx context.Context, client *Client, in IncomingMessage) error {
+	role, target, ok := c.history.Lookup(in.MessageID)
+	if !ok || target.Room != client.room || !canReactTo(client, role, target) {
+		c.sendNotice(client, MessageTypeError, ErrUnknownMessage.Error())
+		return ErrUnknownMessage
+	}
+
+	out := OutgoingMessage{
+		SentAt:      time.Now(),
+		Type:        MessageTypeReaction,
+		From:        client.id,
+		GivenName:   client.givenName,
+		FamilyName:  client.familyName,
+		DisplayName: c.displayName(client),
+		Room:        client.room,
+		MessageID:   target.ID,
+		Emoji:       in.Emoji,
+	}
+	if client.role == "radio" {
+		out.To = target.From
+		c.forwardToUser(ctx, target.From, out)
+		c.forwardToOtherRadios(ctx, client, c.hideRecipient(out))
+		return nil
+	}
+	// Reactions to replies go to all radios, like any user message
+	c.forwardToRadios(ctx, c.hideMember(out))
+	return nil
+}
+
+func canReactTo(client *Client, role string, target OutgoingMessage) bool {
+	if client.role == "radio" {
+		return role == "user"
+	}
+	return role == "radio" && target.To == client.id
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func connectUserAndRadio(t *testing.T, chat *Chat, wsBase string) (user, radio *websocket.Conn) {
+	t.Helper()
+	radio = dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	user = dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, 1)
+	return user, radio
+}
+
+func TestRadioReactsToUserMessage(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := user.WriteJSON(IncomingMessage{Content: "checkpoint 7 reached"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	msg, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+
+	if err := radio.WriteJSON(IncomingMessage{Type: MessageTypeReaction, MessageID: msg.ID, Emoji: "👍"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	reaction, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if reaction.Type != MessageTypeReaction || reaction.MessageID != msg.ID || reaction.Emoji != "👍" || reaction.From != "99999" {
+		t.Fatalf("unexpected reaction: %+v", reaction)
+	}
+}
+
+func TestUserReactsToRadioReply(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "well done"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	reply, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeReaction, MessageID: reply.ID, Emoji: "🎉"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	reaction, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if reaction.Type != MessageTypeReaction || reaction.MessageID != reply.ID || reaction.Emoji != "🎉" || reaction.From != "12345" {
+		t.Fatalf("unexpected reaction: %+v", reaction)
+	}
+}
+
+func TestReactionToUnknownMessage(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := radio.WriteJSON(IncomingMessage{Type: MessageTypeReaction, MessageID: "0000000000000001", Emoji: "👍"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.Type != MessageTypeError || out.Content != ErrUnknownMessage.Error() {
+		t.Fatalf("expected error frame, got: %+v", out)
+	}
+}
+
+func TestReactionEmojiAllowlist(t *testing.T) {
+	chat := New()
+	if err := chat.validate(IncomingMessage{Type: MessageTypeReaction, MessageID: "1", Emoji: "💩"}); err == nil {
+		t.Fatal("expected emoji outside the allowlist to be rejected")
+	}
+	if err := chat.validate(IncomingMessage{Type: MessageTypeReaction, Emoji: "👍"}); err == nil {
+		t.Fatal("expected reaction without messageId to be rejected")
+	}
+}
@@ -0,0 +1,170 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// redisChannel carries all subjects, see redisFrame.
+const redisChannel = "radiogaga:messages"
+
+// redisFrame wraps a message with its subject, since all subjects share a
+// single Redis channel.
+type redisFrame struct {
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// RedisBackend is a PubSubBackend backed by Redis pub/sub. All subjects
+// share one subscription, each message is decoded once and handed to the
+// handlers of its subject.
+type RedisBackend struct {
+	client *redis.Client
+
+	mu       sync.Mutex // guards sub and handlers
+	sub      *redis.PubSub
+	handlers []*redisHandler
+}
+
+type redisHandler struct {
+	subject string
+	handle  func([]byte)
+}
+
+func NewRedisBackend(url string) (*RedisBackend, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &RedisBackend{client: client}, nil
+}
+
+func (b *RedisBackend) Publish(subject string, data []byte) error {
+	frame, err := json.Marshal(redisFrame{Subject: subject, Data: data})
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(context.Background(), redisChannel, frame).Err()
+}
+
+// Subscribe adds a handler for the subject, subscribing to redisChannel for
+// the first one. The subscription ends with the last handler.
+func (b *RedisBackend) Subscribe(subject string, handler func([]byte)) (CancelFunc, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sub == nil {
+		ctx := context.Background()
+		sub := b.client.Subscribe(ctx, redisChannel)
+		// Wait for the subscription, so no message published after
+		// Subscribe returns is missed
+		if _, err := sub.Receive(ctx); err != nil {
+			_ = sub.Close()
+			return nil, err
+		}
+		b.sub = sub
+		go b.dispatch(sub)
+	}
+
+	h := &redisHandler{subject: subject, handle: handler}
+	b.handlers = append(b.handlers, h)
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.handlers = slices.DeleteFunc(b.handlers, func(other *redisHandler) bool { return other == h })
+		if len(b.handlers) == 0 && b.sub != nil {
+			_ = b.sub.Close()
+			b.sub = nil
+		}
+	}, nil
+}
+
+// dispatch hands the messages of a subscription to the handlers of their
+// subject until it is closed.
+func (b *RedisBackend) dispatch(sub *redis.PubSub) {
+	for msg := range sub.Channel() {
+		var frame redisFrame
+		if err := json.Unmarshal([]byte(msg.Payload), &frame); err != nil {
+			log.Warn().Err(err).Msg("invalid message from redis")
+			continue
+		}
+		b.mu.Lock()
+		handlers := slices.Clone(b.handlers)
+		b.mu.Unlock()
+		for _, h := range handlers {
+			if h.subject == frame.Subject {
+				h.handle(frame.Data)
+			}
+		}
+	}
+}
+
+func (b *RedisBackend) Close() {
+	b.mu.Lock()
+	if b.sub != nil {
+		_ = b.sub.Close()
+		b.sub = nil
+	}
+	b.mu.Unlock()
+	_ = b.client.Close()
+}
+
+// ownerKey holds the instance owning a user, see UserOwnership.
+func ownerKey(id string) string {
+	return "radiogaga:owner:" + id
+}
+
+// refreshOwner extends the key if the instance owns it and sets it if nobody
+// does.
+var refreshOwner = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner == false then
+	return redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+elseif owner == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+func (b *RedisBackend) Claim(instance, id string, ttl time.Duration) error {
+	return b.client.Set(context.Background(), ownerKey(id), instance, ttl).Err()
+}
+
+func (b *RedisBackend) Refresh(instance string, ids []string, ttl time.Duration) ([]string, error) {
+	ctx := context.Background()
+	pipe := b.client.Pipeline()
+	cmds := make([]*redis.Cmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = refreshOwner.Eval(ctx, pipe, []string{ownerKey(id)}, instance, ttl.Milliseconds())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	var lost []string
+	for i, cmd := range cmds {
+		// The script returns 0 when another instance owns the user
+		if n, err := cmd.Int64(); err == nil && n == 0 {
+			lost = append(lost, ids[i])
+		}
+	}
+	return lost, nil
+}
+
+func (b *RedisBackend) Owner(id string) (string, error) {
+	owner, err := b.client.Get(context.Background(), ownerKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return owner, err
+}
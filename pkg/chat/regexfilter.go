@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// RegexFilter blocks messages matching any of the Go regular expressions in a
+// file, one per line. Reload recompiles the file while messages are being
+// matched, without locking.
+type RegexFilter struct {
+	path     string
+	patterns atomic.Value // []*regexp.Regexp
+}
+
+func LoadRegexFilter(path string) (*RegexFilter, error) {
+	f := &RegexFilter{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload reads and compiles the pattern file again. If it cannot be read or
+// any pattern fails to compile, the previous patterns stay in use.
+func (f *RegexFilter) Reload() error {
+	patterns, err := compilePatterns(f.path)
+	if err != nil {
+		return err
+	}
+	f.patterns.Store(patterns)
+	return nil
+}
+
+func (f *RegexFilter) Match(content string) bool {
+	patterns, _ := f.patterns.Load().([]*regexp.Regexp)
+	for _, re := range patterns {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns compiles every line of the file. Empty lines and lines
+// starting with # are skipped.
+func compilePatterns(path string) ([]*regexp.Regexp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		patterns = append(patterns, re)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePatterns(t *testing.T, path, patterns string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(patterns), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegexFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patterns.txt")
+	writePatterns(t, path, "# links\nhttps?://\\S+\n")
+	filter, err := LoadRegexFilter(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !filter.Match("visit http://spam.example") || filter.Match("free tickets") {
+		t.Fatal("unexpected matches before reload")
+	}
+
+	writePatterns(t, path, "(?i)free\\s+tickets\n")
+	if err := filter.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if filter.Match("visit http://spam.example") || !filter.Match("FREE tickets") {
+		t.Fatal("expected reload to replace the patterns")
+	}
+
+	// A broken pattern keeps the previous set in use
+	writePatterns(t, path, "valid\n(unclosed\n")
+	if err := filter.Reload(); err == nil {
+		t.Fatal("expected reload to fail on invalid pattern")
+	}
+	if !filter.Match("free tickets") || filter.Match("valid") {
+		t.Fatal("expected old patterns to be kept after a failed reload")
+	}
+}
+
+func TestRegexFilterReloadKeepsConnections(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	path := filepath.Join(t.TempDir(), "patterns.txt")
+	writePatterns(t, path, "^never$\n")
+	filter, err := LoadRegexFilter(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	chat := New()
+	chat.UseFilter(filter, FilterActionWarn)
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := user.WriteJSON(IncomingMessage{Content: "call 0612345678"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second); err != nil || out.Content != "call 0612345678" {
+		t.Fatalf("expected message before reload, got: %+v, %v", out, err)
+	}
+
+	writePatterns(t, path, "\\b06\\d{8}\\b\n")
+	if err := filter.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if err := user.WriteJSON(IncomingMessage{Content: "call 0612345678"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	warning, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || warning.Type != MessageTypeWarning {
+		t.Fatalf("expected warning after reload, got: %+v, %v", warning, err)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected user to stay connected, have %d users", n)
+	}
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Built-in message types.
+const (
+	MessageTypeChat     = "chat"
+	MessageTypeTyping   = "typing"
+	MessageTypePing     = "ping"
+	MessageTypeReaction = "reaction"
+	MessageTypeRetract  = "retract"
+	MessageTypePoll     = "poll"
+	MessageTypeVote     = "vote"
+
+	MessageTypeTokenRefresh = "token_refresh"
+)
+
+var ErrUnknownMessageType = errors.New("unknown message type")
+
+// MessageTypeRegistry maps a message type to the validator that must accept a
+// message before it is routed.
+type MessageTypeRegistry map[string]func(IncomingMessage) error
+
+func defaultMessageTypes() MessageTypeRegistry {
+	return MessageTypeRegistry{
+		MessageTypeChat: func(in IncomingMessage) error {
+			if strings.TrimSpace(in.Content) == "" {
+				return errors.New("chat message requires content")
+			}
+			return nil
+		},
+		MessageTypeTyping: func(in IncomingMessage) error {
+			if in.Content != "" {
+				return errors.New("typing message must not have content")
+			}
+			return nil
+		},
+		// Pings keep the application layer alive and are never forwarded.
+		MessageTypePing: func(IncomingMessage) error { return nil },
+		MessageTypeReaction: func(in IncomingMessage) error {
+			if in.MessageID == "" {
+				return errors.New("reaction requires messageId")
+			}
+			if !slices.Contains(reactionEmoji, in.Emoji) {
+				return fmt.Errorf("emoji %q not allowed", in.Emoji)
+			}
+			return nil
+		},
+		MessageTypePoll:      validatePoll,
+		MessageTypeCountdown: validateCountdown,
+		MessageTypeTokenRefresh: func(in IncomingMessage) error {
+			if in.Token == "" {
+				return errors.New("token_refresh requires token")
+			}
+			return nil
+		},
+		MessageTypeVote: validateVote,
+		MessageTypeAck: func(in IncomingMessage) error {
+			if in.AckID == "" {
+				return errors.New("ack requires ack_id")
+			}
+			return nil
+		},
+		MessageTypeRetract: func(in IncomingMessage) error {
+			if in.MessageID == "" {
+				return errors.New("retract requires messageId")
+			}
+			return nil
+		},
+	}
+}
+
+// RegisterMessageType adds or replaces the validator for a message type.
+func (c *Chat) RegisterMessageType(name string, validator func(IncomingMessage) error) {
+	c.typesMu.Lock()
+	defer c.typesMu.Unlock()
+	c.types[name] = validator
+}
+
+func (c *Chat) validate(in IncomingMessage) error {
+	c.typesMu.RLock()
+	validator, ok := c.types[in.Type]
+	c.typesMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownMessageType, in.Type)
+	}
+	if validator == nil {
+		return nil
+	}
+	if err := validator(in); err != nil {
+		return fmt.Errorf("invalid %s message: %w", in.Type, err)
+	}
+	return nil
+}
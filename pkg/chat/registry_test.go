@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChatTypeRequiresContent(t *testing.T) {
+	chat := New()
+
+	if err := chat.validate(IncomingMessage{Type: MessageTypeChat, Content: "hello"}); err != nil {
+		t.Fatalf("expected valid chat message, got: %v", err)
+	}
+	if err := chat.validate(IncomingMessage{Type: MessageTypeChat, Content: "  "}); err == nil {
+		t.Fatal("expected error for empty chat message")
+	}
+}
+
+func TestTypingTypeRejectsContent(t *testing.T) {
+	chat := New()
+
+	if err := chat.validate(IncomingMessage{Type: MessageTypeTyping}); err != nil {
+		t.Fatalf("expected valid typing message, got: %v", err)
+	}
+	if err := chat.validate(IncomingMessage{Type: MessageTypeTyping, Content: "x"}); err == nil {
+		t.Fatal("expected error for typing message with content")
+	}
+}
+
+func TestPingTypeNotForwarded(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForRadios(t, chat, 1)
+
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypePing}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	if err := user.WriteJSON(IncomingMessage{Content: "after ping"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.Type != MessageTypeChat || out.Content != "after ping" {
+		t.Fatalf("expected only the chat message, got: %+v", out)
+	}
+}
+
+func TestUnknownTypeRejected(t *testing.T) {
+	chat := New()
+	client := &Client{role: "user", id: "12345"}
+
+	err := chat.dispatch(context.Background(), client, IncomingMessage{Type: "song_request", Content: "Bohemian Rhapsody"})
+	if !errors.Is(err, ErrUnknownMessageType) {
+		t.Fatalf("expected ErrUnknownMessageType, got: %v", err)
+	}
+}
+
+func TestRegisterMessageType(t *testing.T) {
+	chat := New()
+	client := &Client{role: "user", id: "12345"}
+
+	chat.RegisterMessageType("song_request", func(in IncomingMessage) error {
+		if in.Content == "" {
+			return errors.New("song required")
+		}
+		return nil
+	})
+
+	if err := chat.dispatch(context.Background(), client, IncomingMessage{Type: "song_request", Content: "Bohemian Rhapsody"}); err != nil {
+		t.Fatalf("expected custom type to be accepted, got: %v", err)
+	}
+	if err := chat.dispatch(context.Background(), client, IncomingMessage{Type: "song_request"}); err == nil {
+		t.Fatal("expected custom validator to reject empty song request")
+	}
+}
@@ -0,0 +1,45 @@
+package chat
+
+// maxReplay caps how many missed messages a reconnecting user receives.
+var maxReplay = Int("RADIO_MAX_REPLAY", 50)
+
+// replayMissed sends a user the messages addressed to them after lastSeen
+// that are still in the history, oldest first and marked as replayed. When
+// more were missed than the replay limit, only the newest are sent.
+func (c *Chat) replayMissed(client *Client, lastSeen string) {
+	if lastSeen == "" || client.role != "user" || c.replayLimit <= 0 {
+		return
+	}
+	missed := c.history.Since(lastSeen, 0, func(role string, msg OutgoingMessage) bool {
+		return receivedByUser(client, role, msg, c.isDM(role, msg))
+	})
+	if len(missed) > c.replayLimit {
+		missed = missed[len(missed)-c.replayLimit:]
+	}
+	for _, msg := range missed {
+		msg.Replayed = true
+		data := c.style.marshal(msg)
+		if err := client.send(data); err != nil {
+			client.log.Warn().Err(err).Msg("could not replay missed messages")
+			return
+		}
+	}
+	if len(missed) > 0 {
+		client.log.Debug().Int("count", len(missed)).Str("last_seen", lastSeen).Msg("replayed missed messages")
+	}
+}
+
+// receivedByUser reports whether the user was sent the message live:
+// broadcasts, and radio replies and direct messages to them in their room.
+func receivedByUser(client *Client, role string, msg OutgoingMessage, dm bool) bool {
+	if msg.Room != "" && msg.Room != client.room {
+		return false
+	}
+	switch {
+	case role == "":
+		return msg.To == "" || msg.To == client.id
+	case role == "radio", dm:
+		return msg.To == client.id
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func reconnectUser(t *testing.T, wsBase, lastSeen string) *websocket.Conn {
+	t.Helper()
+	u, _ := url.Parse(wsBase)
+	u.RawQuery = url.Values{"role": {"user"}}.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	handshake := IncomingMessage{
+		Token:             makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute),
+		LastSeenMessageID: lastSeen,
+	}
+	if err := conn.WriteJSON(handshake); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	expectWelcome(t, conn)
+	return conn
+}
+
+func replyToUser(t *testing.T, radio *websocket.Conn, to, content string) {
+	t.Helper()
+	if err := radio.WriteJSON(IncomingMessage{To: to, Content: content}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+}
+
+func TestReplayMissedMessages(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer radio.Close()
+
+	replyToUser(t, radio, "12345", "seen 1")
+	replyToUser(t, radio, "12345", "seen 2")
+	expectContent(t, user, "seen 1")
+	lastSeen, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || lastSeen.Content != "seen 2" {
+		t.Fatalf("expected second reply, got: %+v (%v)", lastSeen, err)
+	}
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+
+	replyToUser(t, radio, "12345", "missed 1")
+	replyToUser(t, radio, "54321", "for someone else")
+	replyToUser(t, radio, "12345", "missed 2")
+	// Wait for the radio's messages to be dispatched
+	for i := 0; len(chat.history.Since(lastSeen.ID, 0, nil)) < 3; i++ {
+		if i == 100 {
+			t.Fatal("timeout waiting for the replies")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := chat.Broadcast(t.Context(), "", "Team 42 has passed checkpoint 7"); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+
+	user = reconnectUser(t, wsBase, lastSeen.ID)
+	defer user.Close()
+	for _, want := range []string{"missed 1", "missed 2", "Team 42 has passed checkpoint 7"} {
+		out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+		if err != nil || out.Content != want || !out.Replayed {
+			t.Fatalf("expected replayed %q, got: %+v (%v)", want, out, err)
+		}
+	}
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, user, 200*time.Millisecond); err == nil {
+		t.Fatalf("expected nothing else, got: %+v", out)
+	}
+}
+
+func TestReplayCapped(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.replayLimit = 2
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	for _, content := range []string{"one", "two", "three"} {
+		chat.history.Add("radio", OutgoingMessage{ID: chat.nextMessageID(), To: "12345", Content: content, Room: DefaultRoom})
+	}
+
+	// Only the newest messages are replayed
+	user := reconnectUser(t, wsBase, "0")
+	defer user.Close()
+	expectContent(t, user, "two")
+	expectContent(t, user, "three")
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, user, 200*time.Millisecond); err == nil {
+		t.Fatalf("expected nothing else, got: %+v", out)
+	}
+}
+
+// Messages dispatched while a user reconnects are either replayed or
+// delivered live, never neither.
+func TestReplayWhileDispatching(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.resumeGrace = 0
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer radio.Close()
+	replyToUser(t, radio, "12345", "start")
+	lastSeen, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	const messages = 40
+	for round := range 5 {
+		_ = user.Close()
+		waitForUsers(t, chat, 0)
+		dispatched := make(chan error, 1)
+		go func() {
+			for i := range messages {
+				if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: fmt.Sprintf("%d-%d", round, i)}); err != nil {
+					dispatched <- err
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+			dispatched <- nil
+		}()
+		user = reconnectUser(t, wsBase, lastSeen.ID)
+		if err := <-dispatched; err != nil {
+			t.Fatalf("radio write: %v", err)
+		}
+		for i := range messages {
+			want := fmt.Sprintf("%d-%d", round, i)
+			out, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+			if err != nil || out.Content != want {
+				t.Fatalf("round %d: expected %q, got: %+v (%v)", round, want, out, err)
+			}
+			lastSeen = out
+		}
+	}
+	_ = user.Close()
+}
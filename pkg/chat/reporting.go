@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// ErrorReportInterval is the minimum time between reports of the same kind for
+// the same member, see NewRateLimitedReporter.
+const ErrorReportInterval = 10 * time.Minute
+
+// Kinds of reported errors.
+const (
+	ErrorKindPanic       = "panic"
+	ErrorKindWriteFailed = "write_failed"
+	ErrorKindWebhook     = "webhook_failed"
+)
+
+// ErrorEvent is an unexpected failure worth someone's attention, as opposed to
+// the warnings that only end up in the logs.
+type ErrorEvent struct {
+	Kind   string
+	Err    error
+	Client *ClientInfo // connection the failure concerns, if any
+}
+
+// ErrorReporter sends error events to an error tracker. Report must not block.
+type ErrorReporter interface {
+	Report(ev ErrorEvent)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(ErrorEvent) {}
+
+// WithErrorReporter reports unexpected failures of the chat to r.
+func WithErrorReporter(r ErrorReporter) Option {
+	return func(c *Chat) {
+		c.reporter = r
+	}
+}
+
+func (c *Chat) reportError(kind string, err error, client *Client) {
+	ev := ErrorEvent{Kind: kind, Err: err}
+	if client != nil {
+		info := client.info()
+		ev.Client = &info
+	}
+	c.reporter.Report(ev)
+}
+
+// rateLimitedReporter passes on at most one event per kind and member per
+// interval, so a flapping client cannot flood the error tracker.
+type rateLimitedReporter struct {
+	next     ErrorReporter
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// NewRateLimitedReporter passes on at most one event per kind and member per
+// interval to next.
+func NewRateLimitedReporter(next ErrorReporter, interval time.Duration) ErrorReporter {
+	return &rateLimitedReporter{next: next, interval: interval, last: make(map[string]time.Time)}
+}
+
+func (r *rateLimitedReporter) Report(ev ErrorEvent) {
+	key := ev.Kind
+	if ev.Client != nil {
+		key += "/" + ev.Client.Role + "/" + ev.Client.ID
+	}
+	now := time.Now()
+	r.mu.Lock()
+	if last, ok := r.last[key]; ok && now.Sub(last) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.last[key] = now
+	// Forget keys that can no longer suppress anything
+	for k, t := range r.last {
+		if now.Sub(t) >= r.interval {
+			delete(r.last, k)
+		}
+	}
+	r.mu.Unlock()
+	r.next.Report(ev)
+}
+
+// SentryReporter sends events to Sentry.
+type SentryReporter struct{}
+
+// NewSentryReporter initializes the Sentry client for the DSN.
+func NewSentryReporter(dsn string) (SentryReporter, error) {
+	return SentryReporter{}, sentry.Init(sentry.ClientOptions{Dsn: dsn})
+}
+
+func (SentryReporter) Report(ev ErrorEvent) {
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("kind", ev.Kind)
+		if ev.Client != nil {
+			scope.SetUser(sentry.User{ID: ev.Client.ID})
+			scope.SetTag("role", ev.Client.Role)
+			scope.SetContext("connection", sentry.Context{
+				"role":      ev.Client.Role,
+				"room":      ev.Client.Room,
+				"transport": ev.Client.Transport,
+			})
+		}
+		sentry.CaptureException(ev.Err)
+	})
+}
+
+// Flush waits for queued events to be sent, for use before exiting.
+func (SentryReporter) Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
+
+// recoverPanic reports a panic of the calling goroutine instead of crashing
+// the server. It must be deferred directly.
+func recoverPanic(reporter ErrorReporter, client *Client) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	ev := ErrorEvent{Kind: ErrorKindPanic, Err: fmt.Errorf("panic: %v", v)}
+	if client != nil {
+		info := client.info()
+		ev.Client = &info
+		client.log.Error().Err(ev.Err).Msg("recovered from panic")
+	}
+	reporter.Report(ev)
+}
+
+// recoverMiddleware answers requests whose handler panics with a 500 and
+// reports the panic.
+func recoverMiddleware(reporter ErrorReporter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err := fmt.Errorf("panic: %v", v)
+			requestLogger(r.Context()).Error().Err(err).Str("path", r.URL.Path).Msg("recovered from panic")
+			reporter.Report(ErrorEvent{Kind: ErrorKindPanic, Err: err})
+			writeError(w, http.StatusInternalServerError, "internal error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	events []ErrorEvent
+}
+
+func (r *recordingReporter) Report(ev ErrorEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+}
+
+func (r *recordingReporter) Events() []ErrorEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ErrorEvent(nil), r.events...)
+}
+
+func TestWriteFailureReported(t *testing.T) {
+	reporter := &recordingReporter{}
+	chat := New(WithErrorReporter(reporter))
+
+	// A radio without transport fails every write
+	radio := &Client{role: "radio", id: "99999", room: DefaultRoom}
+	chat.register(radio)
+	user := &Client{role: "user", id: "12345", room: DefaultRoom}
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "hello"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	events := reporter.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got: %+v", events)
+	}
+	ev := events[0]
+	if ev.Kind != ErrorKindWriteFailed || !errors.Is(ev.Err, errNoTransport) || ev.Client == nil || ev.Client.ID != "99999" || ev.Client.Role != "radio" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
+
+func TestRateLimitedReporter(t *testing.T) {
+	rec := &recordingReporter{}
+	reporter := NewRateLimitedReporter(rec, time.Hour)
+
+	alice := &ClientInfo{ID: "12345", Role: "user"}
+	bob := &ClientInfo{ID: "54321", Role: "user"}
+	for range 5 {
+		reporter.Report(ErrorEvent{Kind: ErrorKindWriteFailed, Err: errNoTransport, Client: alice})
+	}
+	reporter.Report(ErrorEvent{Kind: ErrorKindWriteFailed, Err: errNoTransport, Client: bob})
+	reporter.Report(ErrorEvent{Kind: ErrorKindPanic, Err: errors.New("boom"), Client: alice})
+
+	if events := rec.Events(); len(events) != 3 {
+		t.Fatalf("expected one event per kind and member, got: %+v", events)
+	}
+}
+
+func TestWebhookExhaustionReported(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	reporter := &recordingReporter{}
+	webhook := NewWebhook(WebhookConfig{URL: receiver.URL, QueueSize: 1, Timeout: time.Second, Retries: 1, Backoff: time.Millisecond, Reporter: reporter})
+	webhook.Enqueue(OutgoingMessage{ID: "1", From: "12345", Content: "hello"})
+	webhook.Close()
+
+	events := reporter.Events()
+	if len(events) != 1 || events[0].Kind != ErrorKindWebhook {
+		t.Fatalf("expected webhook event, got: %+v", events)
+	}
+}
+
+func TestRecoverMiddlewareReportsPanic(t *testing.T) {
+	reporter := &recordingReporter{}
+	h := recoverMiddleware(reporter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	events := reporter.Events()
+	if len(events) != 1 || events[0].Kind != ErrorKindPanic {
+		t.Fatalf("expected panic event, got: %+v", events)
+	}
+}
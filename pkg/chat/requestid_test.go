@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestRequestIDRoundTrip(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(log.Logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	req.Header.Set(RequestIDHeader, "trace-me")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "trace-me" {
+		t.Fatalf("expected response header trace-me, got %q", got)
+	}
+	if seen != "trace-me" {
+		t.Fatalf("expected context value trace-me, got %q", seen)
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(log.Logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+
+	got := rec.Header().Get(RequestIDHeader)
+	if _, err := uuid.Parse(got); err != nil {
+		t.Fatalf("expected generated uuid, got %q", got)
+	}
+	if seen != got {
+		t.Fatalf("expected context value %q, got %q", got, seen)
+	}
+}
+
+func TestRequestIDInLogs(t *testing.T) {
+	var buf bytes.Buffer
+	handler := requestIDMiddleware(zerolog.New(&buf), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestLogger(r.Context()).Info().Msg("handling")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	req.Header.Set(RequestIDHeader, "trace-me")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), `"request_id":"trace-me"`) {
+		t.Fatalf("expected request_id in log output, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWithToken(wsBase, role string, header http.Header, protocols ...string) (*websocket.Conn, *http.Response, error) {
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	return dialer.Dial(wsBase+"?role="+role, header)
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestTokenInRequest(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	alice := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+
+	tests := []struct {
+		name      string
+		header    http.Header
+		protocols []string
+	}{
+		{"authorization header", bearer(alice), nil},
+		{"subprotocol", nil, []string{tokenProtocolPrefix + alice}},
+		{"header before subprotocol", bearer(alice), []string{tokenProtocolPrefix + "definitely-not-a-jwt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := New()
+			srv, wsBase := startTestServer(t, chat)
+			defer srv.Close()
+			radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+			defer radio.Close()
+			waitForRadios(t, chat, 1)
+
+			user, _, err := dialWithToken(wsBase, "user", tt.header, tt.protocols...)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer user.Close()
+			if len(tt.protocols) > 0 && user.Subprotocol() != tt.protocols[0] {
+				t.Fatalf("expected the token subprotocol to be echoed, got %q", user.Subprotocol())
+			}
+			waitForUsers(t, chat, 1)
+
+			// The first frame is a normal message
+			sendAsUser(t, user, "Play Radio Ga Ga")
+			expectContent(t, radio, "Play Radio Ga Ga")
+		})
+	}
+}
+
+func TestTokenInFirstFrameStillSupported(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+}
+
+func TestInvalidTokenInRequestRejectedBeforeUpgrade(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	for name, dial := range map[string]func() (*websocket.Conn, *http.Response, error){
+		"header": func() (*websocket.Conn, *http.Response, error) {
+			return dialWithToken(wsBase, "user", bearer("definitely-not-a-jwt"))
+		},
+		"subprotocol": func() (*websocket.Conn, *http.Response, error) {
+			return dialWithToken(wsBase, "user", nil, tokenProtocolPrefix+"definitely-not-a-jwt")
+		},
+	} {
+		_, resp, err := dial()
+		if err == nil {
+			t.Fatalf("%s: expected dial error", name)
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got: %+v, err=%v", name, resp, err)
+		}
+	}
+}
+
+func TestRadioKeyHeaderWithTokenInRequest(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	header := bearer(makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute))
+	header.Set(RadioKeyHeader, RADIOChatKey)
+	radio, _, err := dialWithToken(wsBase, "radio", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer radio.Close()
+	waitForRadios(t, chat, 1)
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// resumeGrace is how long a dropped user session can be resumed, 0 disables
+// resuming.
+var resumeGrace = Duration("CHAT_RESUME_GRACE", 2*time.Minute)
+
+// parkedSession is what is kept of a dropped user session until it is resumed
+// or the grace window ends.
+type parkedSession struct {
+	token  string
+	radio  *Client      // sticky radio, if any
+	sends  *recentSends // see resent
+	lastID string       // last message ID handed out when the session dropped
+	info   ClientInfo
+	reason string
+	timer  *time.Timer // emits the disconnect event once the window ends
+}
+
+// Capabilities listed in the welcome frame, which clients may rely on.
+const (
+	CapabilityOrdered = "ordered" // messages of the same priority arrive in ID order, see nextMessageID
+	CapabilityResume  = "resume"  // the resumeToken resumes the session, see CHAT_RESUME_GRACE
+	CapabilityAck     = "ack"     // messages with ackRequired must be acked, see RADIO_ACK_MODE
+)
+
+func (c *Chat) capabilities() []string {
+	caps := []string{CapabilityOrdered}
+	if c.resumeGrace > 0 {
+		caps = append(caps, CapabilityResume)
+	}
+	if c.ackMode {
+		caps = append(caps, CapabilityAck)
+	}
+	return caps
+}
+
+func newResumeToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sessionKey(id, roomName string) string {
+	return roomName + "/" + id
+}
+
+// sendWelcome tells a user their session is set up and what the server
+// guarantees, with the token to resume it after a short disconnect unless
+// resuming is disabled.
+func (c *Chat) sendWelcome(client *Client, resumed bool) {
+	data := c.style.marshal(OutgoingMessage{
+		Type:         MessageTypeWelcome,
+		SentAt:       time.Now(),
+		Room:         client.room,
+		ResumeToken:  client.resumeToken,
+		Resumed:      resumed,
+		Capabilities: c.capabilities(),
+	})
+	if err := client.sendHighPriority(data); err != nil {
+		client.log.Warn().Err(err).Msg("failed to send welcome")
+	}
+}
+
+// park keeps the state of a dropped user session for the grace window and
+// reports whether it did. Sessions the server closed are not parked. The
+// disconnect event is only emitted when the window ends without a resume.
+// Must be called before unregister, which forgets the sticky radio.
+func (c *Chat) park(client *Client, reason string) bool {
+	if c.resumeGrace <= 0 || client.role != "user" || client.resumeToken == "" || client.closedByServer.Load() {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if r, ok := c.rooms[client.room]; !ok || r.users[client.id] != client {
+		// Replaced by a newer session
+		return false
+	}
+
+	key := sessionKey(client.id, client.room)
+	if prev, ok := c.parked[key]; ok && prev.timer.Stop() {
+		c.emitDisconnect(prev.info, prev.reason)
+	}
+	p := &parkedSession{
+		token:  client.resumeToken,
+		radio:  c.userRadio[client.id],
+		sends:  client.recentSends,
+		lastID: fmt.Sprintf("%016x", c.lastMessageID.Load()),
+		info:   client.info(),
+		reason: reason,
+	}
+	p.timer = time.AfterFunc(c.resumeGrace, func() {
+		c.mutex.Lock()
+		if c.parked[key] == p {
+			delete(c.parked, key)
+		}
+		c.mutex.Unlock()
+		c.emitDisconnect(p.info, p.reason)
+	})
+	c.parked[key] = p
+	return true
+}
+
+// resume takes the parked session of the user in the room. It returns nil
+// when there is none, the token does not match or the window has ended; a
+// parked session that is not resumed is ended right away, so its disconnect
+// event goes out before the new connect event.
+func (c *Chat) resume(client *Client, token string) *parkedSession {
+	key := sessionKey(client.id, client.room)
+	c.mutex.Lock()
+	p, ok := c.parked[key]
+	if ok {
+		delete(c.parked, key)
+	}
+	c.mutex.Unlock()
+	if !ok || !p.timer.Stop() {
+		return nil
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		if token != "" {
+			client.log.Info().Msg("resume token mismatch, starting a new session")
+		}
+		c.emitDisconnect(p.info, p.reason)
+		return nil
+	}
+	return p
+}
+
+// restore gives a resumed session the state of the parked one. The sticky
+// radio is only restored if it is still connected.
+func (c *Chat) restore(client *Client, p *parkedSession) {
+	client.recentSends = p.sends
+	if p.radio == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if r, ok := c.rooms[client.room]; ok {
+		if _, connected := r.radios[p.radio]; connected {
+			c.userRadio[client.id] = p.radio
+		}
+	}
+}
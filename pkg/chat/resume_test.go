@@ -0,0 +1,132 @@
+package chat
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func resumeUser(t *testing.T, wsBase, token string) (*websocket.Conn, OutgoingMessage) {
+	t.Helper()
+	u, _ := url.Parse(wsBase)
+	u.RawQuery = url.Values{"role": {"user"}}.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	handshake := IncomingMessage{
+		Token:       makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute),
+		ResumeToken: token,
+	}
+	if err := conn.WriteJSON(handshake); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	return conn, expectWelcome(t, conn)
+}
+
+// startResumableChat connects a radio and user 12345, returning the resume
+// token the user got.
+func startResumableChat(t *testing.T, grace time.Duration) (chat *Chat, listener *countingListener, wsBase string, user, radio *websocket.Conn, token string) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	listener = &countingListener{}
+	chat = New(WithEventListener(listener))
+	chat.resumeGrace = grace
+	chat.sticky = true
+	srv, wsBase := startTestServer(t, chat)
+	t.Cleanup(srv.Close)
+
+	radio = dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	t.Cleanup(func() { _ = radio.Close() })
+	user = dialHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	welcome := expectWelcome(t, user)
+	if welcome.ResumeToken == "" || welcome.Resumed {
+		t.Fatalf("expected a fresh session with a resume token, got: %+v", welcome)
+	}
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, 1)
+	return chat, listener, wsBase, user, radio, welcome.ResumeToken
+}
+
+func TestResumeSession(t *testing.T) {
+	chat, listener, wsBase, user, radio, token := startResumableChat(t, time.Minute)
+
+	sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+	expectContent(t, radio, "Can you play Bohemian Rhapsody?")
+	waitForStickyRadio(t, chat, "12345")
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+
+	// Replies sent while the user is away are replayed on resume
+	replyToUser(t, radio, "12345", "Coming up next")
+	time.Sleep(50 * time.Millisecond)
+
+	user, welcome := resumeUser(t, wsBase, token)
+	defer user.Close()
+	if !welcome.Resumed || welcome.ResumeToken == "" || welcome.ResumeToken == token {
+		t.Fatalf("expected a resumed session with a new token, got: %+v", welcome)
+	}
+	replayed, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || replayed.Content != "Coming up next" || !replayed.Replayed {
+		t.Fatalf("expected the missed reply, got: %+v (%v)", replayed, err)
+	}
+	waitForUsers(t, chat, 1)
+	if id := stickyRadioID(chat, "12345"); id != "99999" {
+		t.Fatalf("expected the sticky radio to be restored, got %q", id)
+	}
+	if n := listener.connects.Load(); n != 2 {
+		t.Fatalf("expected no connect event on resume, got %d connects", n)
+	}
+	if n := listener.disconnects.Load(); n != 0 {
+		t.Fatalf("expected no disconnect event on resume, got %d", n)
+	}
+}
+
+func TestResumeWrongToken(t *testing.T) {
+	chat, listener, wsBase, user, _, _ := startResumableChat(t, time.Minute)
+
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+
+	user, welcome := resumeUser(t, wsBase, "not-the-token")
+	defer user.Close()
+	if welcome.Resumed {
+		t.Fatalf("expected a fresh session, got: %+v", welcome)
+	}
+	waitForCalls(t, "OnDisconnect", &listener.disconnects, 1)
+	waitForCalls(t, "OnConnect", &listener.connects, 3)
+}
+
+func TestResumeAfterGrace(t *testing.T) {
+	chat, listener, wsBase, user, _, token := startResumableChat(t, 50*time.Millisecond)
+
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+	waitForCalls(t, "OnDisconnect", &listener.disconnects, 1)
+
+	user, welcome := resumeUser(t, wsBase, token)
+	defer user.Close()
+	if welcome.Resumed {
+		t.Fatalf("expected a fresh session after the grace window, got: %+v", welcome)
+	}
+	waitForCalls(t, "OnConnect", &listener.connects, 3)
+}
+
+func TestNoResumeAfterServerClose(t *testing.T) {
+	chat, listener, wsBase, user, _, token := startResumableChat(t, time.Minute)
+	defer user.Close()
+
+	if err := chat.ForceDisconnect("12345", CloseCodeBanned, "abuse"); err != nil {
+		t.Fatalf("force disconnect: %v", err)
+	}
+	waitForCalls(t, "OnDisconnect", &listener.disconnects, 1)
+
+	user, welcome := resumeUser(t, wsBase, token)
+	defer user.Close()
+	if welcome.Resumed {
+		t.Fatalf("expected a fresh session after a server close, got: %+v", welcome)
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrRetractNotAllowed = errors.New("not allowed to retract this message")
+
+// retract unsends a message that is still in the history. Senders can retract
+// their own messages and radios can retract any user message. The recipients
+// of the original message receive a retract notice with its ID.
+func (c *Chat) retract(ctx context.Context, client *Client, in IncomingMessage) error {
+	role, target, ok := c.history.Lookup(in.MessageID)
+	if !ok || target.Room != client.room {
+		c.sendNotice(client, MessageTypeError, ErrUnknownMessage.Error())
+		return ErrUnknownMessage
+	}
+	if !canRetract(client, role, target) {
+		c.sendNotice(client, MessageTypeError, ErrRetractNotAllowed.Error())
+		return ErrRetractNotAllowed
+	}
+	if !c.history.Remove(target.ID) {
+		// Aged out between the lookup and now
+		c.sendNotice(client, MessageTypeError, ErrUnknownMessage.Error())
+		return ErrUnknownMessage
+	}
+
+	c.storeRetract(target.ID)
+
+	if client.role == "radio" && target.From != client.id {
+		c.audit(client.id, "retract", target.ID, map[string]string{"from": target.From, "content": target.Content})
+	}
+
+	notice := OutgoingMessage{
+		SentAt:      time.Now(),
+		Type:        MessageTypeRetract,
+		From:        client.id,
+		GivenName:   client.givenName,
+		FamilyName:  client.familyName,
+		DisplayName: c.displayName(client),
+		To:          target.To,
+		Room:        client.room,
+		MessageID:   target.ID,
+	}
+	if target.To != "" && (role == "radio" || c.isDM(role, target)) {
+		c.forwardToUser(ctx, target.To, notice)
+	}
+	switch {
+	case c.isDM(role, target):
+		// Radios never saw the direct message
+	case client.role == "radio":
+		c.forwardToOtherRadios(ctx, client, c.hideRecipient(notice))
+	default:
+		c.forwardToRadios(ctx, c.hideMember(notice))
+	}
+	client.log.Info().Str("message", target.ID).Msg("message retracted")
+	return nil
+}
+
+func canRetract(client *Client, role string, target OutgoingMessage) bool {
+	if role == client.role && target.From == client.id {
+		return true
+	}
+	return client.role == "radio" && role == "user"
+}
@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUserRetractsOwnMessage(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := user.WriteJSON(IncomingMessage{Content: "oops"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	msg, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeRetract, MessageID: msg.ID}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	notice, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if notice.Type != MessageTypeRetract || notice.MessageID != msg.ID {
+		t.Fatalf("unexpected notice: %+v", notice)
+	}
+
+	if inbox := getInbox(t, chat, ""); len(inbox.Messages) != 0 {
+		t.Fatalf("expected retracted message to be gone from the history, got: %+v", inbox.Messages)
+	}
+	if _, _, ok := chat.history.Lookup(msg.ID); ok {
+		t.Fatal("expected retracted message to be gone from the index")
+	}
+}
+
+func TestRadioRetractsMisdirectedReply(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "meant for someone else"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	reply, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+
+	// The user cannot retract the radio's reply
+	if err := user.WriteJSON(IncomingMessage{Type: MessageTypeRetract, MessageID: reply.ID}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	refused, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil || refused.Type != MessageTypeError || refused.Content != ErrRetractNotAllowed.Error() {
+		t.Fatalf("expected error frame, got: %+v, %v", refused, err)
+	}
+
+	if err := radio.WriteJSON(IncomingMessage{Type: MessageTypeRetract, MessageID: reply.ID}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	notice, err := readJSONWithDeadline[OutgoingMessage](t, user, 2*time.Second)
+	if err != nil {
+		t.Fatalf("user read: %v", err)
+	}
+	if notice.Type != MessageTypeRetract || notice.MessageID != reply.ID {
+		t.Fatalf("unexpected notice: %+v", notice)
+	}
+	if msgs := chat.history.Since("", 0, nil); len(msgs) != 0 {
+		t.Fatalf("expected history not to replay the retracted reply, got: %+v", msgs)
+	}
+}
+
+func TestRetractAgedOutMessage(t *testing.T) {
+	chat := New()
+	chat.history = NewHistory(1)
+	user := &Client{role: "user", id: "12345", room: DefaultRoom}
+
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "first"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	first := chat.history.Since("", 0, nil)[0]
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "second"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Type: MessageTypeRetract, MessageID: first.ID}); err != ErrUnknownMessage {
+		t.Fatalf("expected ErrUnknownMessage for an aged out message, got: %v", err)
+	}
+}
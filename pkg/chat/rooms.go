@@ -0,0 +1,376 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultRoom is joined when no ?room= is given. It is always allowed.
+const DefaultRoom = "main"
+
+var (
+	ErrUnknownRoom     = errors.New("unknown room")
+	ErrInvalidRoomName = errors.New("invalid room name")
+	ErrTooManyRooms    = errors.New("too many rooms")
+	ErrRoomExists      = errors.New("room already exists")
+	ErrRoomClosed      = errors.New("room closed")
+)
+
+// allowedRooms lists the rooms clients may join, configured as
+// RADIO_ROOM_LIST=main,requests,tech. ROOMS is still read when it is not set.
+var allowedRooms = parseRooms(String("RADIO_ROOM_LIST", String("ROOMS", DefaultRoom)))
+
+var (
+	// maxRooms caps the listed rooms plus the auto-created rooms in use
+	maxRooms = Int("RADIO_MAX_ROOMS", 10)
+	// autoCreateRooms lets clients join rooms that are not listed
+	autoCreateRooms = Bool("RADIO_AUTO_CREATE_ROOMS", false)
+)
+
+var roomNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+func parseRooms(raw string) map[string]bool {
+	rooms := map[string]bool{DefaultRoom: true}
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			rooms[name] = true
+		}
+	}
+	return rooms
+}
+
+// room holds the members of a single chat room. Rooms are created when the
+// first member joins and removed when the last one leaves.
+type room struct {
+	users      map[string]*Client   // id -> client
+	radios     map[*Client]struct{} // radio connections
+	radiosByID map[string]*Client   // id -> radio connection, mirrors radios
+	guests     map[*Client]struct{} // read-only connections, kept apart from users
+}
+
+// removeRadio forgets the radio connection, unless it is unknown.
+func (r *room) removeRadio(cl *Client) {
+	delete(r.radios, cl)
+	if r.radiosByID[cl.id] == cl {
+		delete(r.radiosByID, cl.id)
+	}
+}
+
+func (r *room) empty() bool {
+	return len(r.users) == 0 && len(r.radios) == 0 && len(r.guests) == 0
+}
+
+// compressed counts the members that negotiated compression.
+func (r *room) compressed() int {
+	n := 0
+	for _, u := range r.users {
+		if u.compressed {
+			n++
+		}
+	}
+	for _, group := range []map[*Client]struct{}{r.radios, r.guests} {
+		for cl := range group {
+			if cl.compressed {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// roomFromRequest returns the room named in the ?room= query parameter.
+func (c *Chat) roomFromRequest(r *http.Request) (string, error) {
+	name := r.URL.Query().Get("room")
+	if name == "" {
+		return DefaultRoom, nil
+	}
+	if err := c.canJoin(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// canJoin reports whether a client may join the room. Rooms closed by
+// CloseRoom cannot be joined until they are added again. Listed rooms can
+// always be joined. With auto-creation, other rooms can be joined as long as they are
+// in use or there is room for one more.
+func (c *Chat) canJoin(name string) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closedRooms[name] {
+		return fmt.Errorf("%w: %q", ErrRoomClosed, name)
+	}
+	if c.roomList[name] {
+		return nil
+	}
+	if !c.autoCreate {
+		return fmt.Errorf("%w: %q", ErrUnknownRoom, name)
+	}
+	if !roomNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidRoomName, name)
+	}
+	if _, inUse := c.rooms[name]; !inUse && c.roomCount() >= c.maxRooms {
+		return ErrTooManyRooms
+	}
+	return nil
+}
+
+// knownRoom reports whether the room is listed or in use.
+func (c *Chat) knownRoom(name string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	_, inUse := c.rooms[name]
+	return inUse || c.roomList[name]
+}
+
+// roomCount returns the number of listed rooms plus the unlisted rooms in use.
+// Callers must hold c.mutex, for reading at least.
+func (c *Chat) roomCount() int {
+	n := len(c.roomList)
+	for name := range c.rooms {
+		if !c.roomList[name] {
+			n++
+		}
+	}
+	return n
+}
+
+// joinRoom returns the named room, creating it if needed. Callers must hold
+// c.mutex.
+func (c *Chat) joinRoom(name string) *room {
+	r, ok := c.rooms[name]
+	if !ok {
+		r = &room{
+			users:      make(map[string]*Client),
+			radios:     make(map[*Client]struct{}),
+			radiosByID: make(map[string]*Client),
+			guests:     make(map[*Client]struct{}),
+		}
+		c.rooms[name] = r
+	}
+	return r
+}
+
+// pruneRoom removes the named room if nobody is left in it. Callers must hold
+// c.mutex.
+func (c *Chat) pruneRoom(name string) {
+	if r, ok := c.rooms[name]; ok && r.empty() {
+		delete(c.rooms, name)
+	}
+}
+
+// eachRoom calls fn for the named room, or for every room when name is empty.
+// Rooms left empty by fn are removed afterwards. Callers must hold c.mutex.
+func (c *Chat) eachRoom(name string, fn func(name string, r *room)) {
+	if name != "" {
+		if r, ok := c.rooms[name]; ok {
+			fn(name, r)
+			c.pruneRoom(name)
+		}
+		return
+	}
+	for name, r := range c.rooms {
+		fn(name, r)
+		c.pruneRoom(name)
+	}
+}
+
+// rangeRooms calls fn for the named room, or for every room when name is
+// empty. fn must not change the rooms. Callers must hold c.mutex, for reading
+// at least.
+func (c *Chat) rangeRooms(name string, fn func(name string, r *room)) {
+	if name != "" {
+		if r, ok := c.rooms[name]; ok {
+			fn(name, r)
+		}
+		return
+	}
+	for name, r := range c.rooms {
+		fn(name, r)
+	}
+}
+
+// lookupUser returns the session of a user in a room.
+func (c *Chat) lookupUser(roomName, id string) (*Client, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	r, ok := c.rooms[roomName]
+	if !ok {
+		return nil, false
+	}
+	client, ok := r.users[id]
+	return client, ok
+}
+
+type UserInfo struct {
+	ID         string `json:"id" description:"Lidnr"`
+	GivenName  string `json:"given_name,omitempty" description:"Given name"`
+	FamilyName string `json:"family_name,omitempty" description:"Family name"`
+	Room       string `json:"room" description:"Room the user is connected to"`
+}
+
+// Users lists the users connected to this instance, optionally limited to a
+// single room, sorted by room and ID.
+func (c *Chat) Users(roomName string) []UserInfo {
+	users := []UserInfo{}
+	c.mutex.RLock()
+	c.rangeRooms(roomName, func(name string, r *room) {
+		for _, u := range r.users {
+			users = append(users, UserInfo{ID: u.id, GivenName: u.givenName, FamilyName: u.familyName, Room: name})
+		}
+	})
+	c.mutex.RUnlock()
+
+	slices.SortFunc(users, func(a, b UserInfo) int {
+		if n := strings.Compare(a.Room, b.Room); n != 0 {
+			return n
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return users
+}
+
+// HandleUsers lists connected users for radios. Without ?room= all rooms are
+// included.
+func (c *Chat) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.radioKeyAuthorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing radio key")
+		return
+	}
+
+	name := r.URL.Query().Get("room")
+	if name != "" && !c.knownRoom(name) {
+		writeError(w, http.StatusBadRequest, ErrUnknownRoom.Error())
+		return
+	}
+	users := c.Users(name)
+	for i := range users {
+		users[i] = c.hideUser(users[i])
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+type RoomRequest struct {
+	Name string `json:"name" pattern:"^[a-z0-9][a-z0-9_-]{0,31}$"`
+}
+
+// AddRoom lists a room, so it can be joined even without auto-creation.
+func (c *Chat) AddRoom(name string) error {
+	if !roomNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidRoomName, name)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.roomList[name] {
+		return ErrRoomExists
+	}
+	if _, inUse := c.rooms[name]; !inUse && c.roomCount() >= c.maxRooms {
+		return ErrTooManyRooms
+	}
+	c.roomList[name] = true
+	delete(c.closedRooms, name)
+	return nil
+}
+
+// CloseRoom unlists a room and disconnects everyone in it with
+// CloseCodeRoomClosed. The room cannot be joined again, even with
+// auto-creation, until AddRoom adds it. Clients that were let in before it
+// closed are refused by addClient. The default room cannot be closed.
+func (c *Chat) CloseRoom(name string) error {
+	if name == DefaultRoom {
+		return fmt.Errorf("%w: %q cannot be closed", ErrInvalidRoomName, name)
+	}
+	var members []*Client
+	c.mutex.Lock()
+	r, inUse := c.rooms[name]
+	if !inUse && !c.roomList[name] {
+		c.mutex.Unlock()
+		return fmt.Errorf("%w: %q", ErrUnknownRoom, name)
+	}
+	delete(c.roomList, name)
+	c.closedRooms[name] = true
+	if inUse {
+		for id, u := range r.users {
+			members = append(members, u)
+			delete(c.userRadio, id)
+		}
+		for radio := range r.radios {
+			members = append(members, radio)
+		}
+		for g := range r.guests {
+			members = append(members, g)
+		}
+		delete(c.rooms, name)
+	}
+	c.mutex.Unlock()
+	c.pinMu.Lock()
+	delete(c.pinned, name)
+	c.pinMu.Unlock()
+
+	for _, m := range members {
+		m.closeWith(CloseCodeRoomClosed, CloseReason(CloseCodeRoomClosed))
+	}
+	return nil
+}
+
+// HandleRooms adds a room with POST {"name": "..."}. Requires the admin key.
+func (c *Chat) HandleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+	var req RoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	switch err := c.AddRoom(req.Name); {
+	case errors.Is(err, ErrInvalidRoomName):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	c.audit(ActorAdminKey, "room_create", req.Name, nil)
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// HandleRoom closes a room with DELETE /api/v1/rooms/{name}. Requires the
+// admin key.
+func (c *Chat) HandleRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+
+	name := r.PathValue("name")
+	switch err := c.CloseRoom(name); {
+	case errors.Is(err, ErrUnknownRoom):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.audit(ActorAdminKey, "room_close", name, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
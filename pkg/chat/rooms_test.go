@@ -0,0 +1,298 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRoomsAreIsolated(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	allowedRooms = parseRooms("main,tech")
+	defer func() { allowedRooms = parseRooms(DefaultRoom) }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	mainUser := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 11111, "Alice", "User", time.Minute), "")
+	defer mainUser.Close()
+	techUser := dialAndHandshake(t, wsBase+"?room=tech", "user", makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute), "")
+	defer techUser.Close()
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, 2)
+
+	// The tech message must not reach the radio in main, so the first message
+	// it reads is the one from main.
+	if err := techUser.WriteJSON(IncomingMessage{Content: "tech question"}); err != nil {
+		t.Fatalf("tech write: %v", err)
+	}
+	if err := mainUser.WriteJSON(IncomingMessage{Content: "song request"}); err != nil {
+		t.Fatalf("main write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.From != "11111" || out.Room != DefaultRoom {
+		t.Fatalf("expected message from main, got: %+v", out)
+	}
+
+	// A reply from main does not reach a user in another room
+	if err := radio.WriteJSON(IncomingMessage{To: "22222", Content: "wrong room"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, techUser, 200*time.Millisecond); err == nil {
+		t.Fatal("expected no message across rooms")
+	}
+}
+
+func TestReconnectOnlyReplacesWithinRoom(t *testing.T) {
+	GEWISSecret = "testsecret"
+	allowedRooms = parseRooms("main,tech")
+	defer func() { allowedRooms = parseRooms(DefaultRoom) }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	tok := makeToken(t, GEWISSecret, 77777, "Eve", "User", time.Minute)
+	inMain := dialAndHandshake(t, wsBase, "user", tok, "")
+	defer inMain.Close()
+	inTech := dialAndHandshake(t, wsBase+"?room=tech", "user", tok, "")
+	defer inTech.Close()
+	waitForUsers(t, chat, 2)
+
+	// Connecting to tech again only replaces the tech session
+	again := dialAndHandshake(t, wsBase+"?room=tech", "user", tok, "")
+	defer again.Close()
+
+	_ = inTech.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := inTech.ReadMessage(); !websocket.IsCloseError(err, 4100) {
+		t.Fatalf("expected close code 4100 in tech, got: %v", err)
+	}
+	if _, err := readJSONWithDeadline[OutgoingMessage](t, inMain, 200*time.Millisecond); websocket.IsCloseError(err, 4100) {
+		t.Fatal("expected session in main to stay connected")
+	}
+
+	users := chat.Users("")
+	if len(users) != 2 || users[0].Room != DefaultRoom || users[1].Room != "tech" {
+		t.Fatalf("expected one session per room, got: %+v", users)
+	}
+}
+
+func TestEmptyRoomsAreRemoved(t *testing.T) {
+	GEWISSecret = "testsecret"
+	allowedRooms = parseRooms("main,tech")
+	defer func() { allowedRooms = parseRooms(DefaultRoom) }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase+"?room=tech", "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	waitForUsers(t, chat, 1)
+	if rooms := chat.Stats().Rooms; len(rooms) != 1 || rooms[0].Room != "tech" {
+		t.Fatalf("expected tech room, got: %+v", rooms)
+	}
+
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	if len(chat.rooms) != 0 {
+		t.Fatalf("expected empty rooms to be removed, got: %v", chat.rooms)
+	}
+}
+
+func TestUnknownRoomRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsBase+"?role=user&room=nope", nil)
+	if err == nil {
+		t.Fatal("expected dial to fail for unknown room")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got: %v", resp)
+	}
+	if !strings.Contains(err.Error(), "bad handshake") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAutoCreateRooms(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.autoCreate = true
+	chat.maxRooms = 2
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase+"?room=quiz", "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+
+	// main and quiz are all rooms there may be
+	for _, query := range []string{"?role=user&room=party", "?role=user&room=Not%20Valid"} {
+		_, resp, err := websocket.DefaultDialer.Dial(wsBase+query, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got: %v", query, err)
+		}
+	}
+	again := dialAndHandshake(t, wsBase+"?room=quiz", "user", makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute), "")
+	defer again.Close()
+	waitForUsers(t, chat, 2)
+}
+
+func roomRequest(t *testing.T, handler http.HandlerFunc, method, target, name, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.SetPathValue("name", name)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestAddRoom(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	chat.maxRooms = 2
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	if rec := roomRequest(t, chat.HandleRooms, http.MethodPost, "/api/v1/rooms", "", `{"name":"Bad Name"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid name, got %d", rec.Code)
+	}
+	if rec := roomRequest(t, chat.HandleRooms, http.MethodPost, "/api/v1/rooms", "", `{"name":"tech"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := roomRequest(t, chat.HandleRooms, http.MethodPost, "/api/v1/rooms", "", `{"name":"tech"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an existing room, got %d", rec.Code)
+	}
+	if rec := roomRequest(t, chat.HandleRooms, http.MethodPost, "/api/v1/rooms", "", `{"name":"quiz"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 over the room limit, got %d", rec.Code)
+	}
+
+	user := dialAndHandshake(t, wsBase+"?room=tech", "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+}
+
+func TestCloseRoom(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	allowedRooms = parseRooms("main,tech")
+	defer func() { allowedRooms = parseRooms(DefaultRoom) }()
+	chat := New()
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase+"?room=tech", "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	radio := dialAndHandshake(t, wsBase+"?room=tech", "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	waitForUsers(t, chat, 1)
+	waitForRadios(t, chat, 1)
+
+	if rec := roomRequest(t, chat.HandleRoom, http.MethodDelete, "/api/v1/rooms/main", DefaultRoom, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for the default room, got %d", rec.Code)
+	}
+	if rec := roomRequest(t, chat.HandleRoom, http.MethodDelete, "/api/v1/rooms/quiz", "quiz", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown room, got %d", rec.Code)
+	}
+	if rec := roomRequest(t, chat.HandleRoom, http.MethodDelete, "/api/v1/rooms/tech", "tech", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	for _, conn := range []*websocket.Conn{user, radio} {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, CloseCodeRoomClosed) {
+			t.Fatalf("expected close code %d, got: %v", CloseCodeRoomClosed, err)
+		}
+	}
+	if s := chat.Stats(); s.ConnectedUsers != 0 || s.ConnectedRadios != 0 {
+		t.Fatalf("expected the room to be empty, got: %+v", s)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(wsBase+"?role=user&room=tech", nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a closed room, got: %v", err)
+	}
+}
+
+func TestClosedRoomRefusesLateJoins(t *testing.T) {
+	allowedRooms = parseRooms("main,tech")
+	defer func() { allowedRooms = parseRooms(DefaultRoom) }()
+	chat := New()
+	chat.autoCreate = true
+
+	// Let in before the room closed, registered after
+	if err := chat.canJoin("tech"); err != nil {
+		t.Fatalf("expected tech to be joinable, got: %v", err)
+	}
+	if err := chat.CloseRoom("tech"); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	client := stalledClient(false)
+	client.room = "tech"
+	if err := chat.register(client); !errors.Is(err, ErrRoomClosed) {
+		t.Fatalf("expected %v, got: %v", ErrRoomClosed, err)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 0 || chat.knownRoom("tech") {
+		t.Fatalf("expected the closed room to stay gone, got %d users", n)
+	}
+	if err := chat.canJoin("tech"); !errors.Is(err, ErrRoomClosed) {
+		t.Fatalf("expected auto-creation to refuse the closed room, got: %v", err)
+	}
+
+	if err := chat.AddRoom("tech"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := chat.register(client); err != nil {
+		t.Fatalf("expected the room to be joinable once added again, got: %v", err)
+	}
+}
+
+func TestCloseRoomRacesJoins(t *testing.T) {
+	allowedRooms = parseRooms("main,tech")
+	defer func() { allowedRooms = parseRooms(DefaultRoom) }()
+	chat := New()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = chat.register(&Client{role: "user", id: strconv.Itoa(i), room: "tech"})
+		}()
+	}
+	_ = chat.CloseRoom("tech")
+	wg.Wait()
+
+	// Every client either was closed with the room or refused
+	if chat.knownRoom("tech") {
+		chat.mutex.RLock()
+		n := len(chat.rooms["tech"].users)
+		chat.mutex.RUnlock()
+		t.Fatalf("expected no one left in the closed room, got %d users", n)
+	}
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GEWISSecrets are tried in order when verifying tokens, so GEWIS_SECRET can
+// be rotated without invalidating tokens signed with the old one. Configured
+// as GEWIS_SECRETS=new,old, an entry written as kid:secret is only used for
+// tokens with that kid header when one is present. Falls back to GEWISSecret.
+// New copies them, see WithSecret.
+var GEWISSecrets = parseSecrets(envOr("GEWIS_SECRETS", ""))
+
+type gewisSecret struct {
+	kid string
+	key []byte
+}
+
+func parseSecrets(raw string) []gewisSecret {
+	var secrets []gewisSecret
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var s gewisSecret
+		if kid, key, ok := strings.Cut(entry, ":"); ok {
+			s.kid, entry = kid, key
+		}
+		s.key = []byte(entry)
+		secrets = append(secrets, s)
+	}
+	return secrets
+}
+
+func defaultSecrets() []gewisSecret {
+	if len(GEWISSecrets) > 0 {
+		return slices.Clone(GEWISSecrets)
+	}
+	return []gewisSecret{{key: []byte(GEWISSecret)}}
+}
+
+// WithSecret verifies HS512 tokens with the secrets, tried in order, instead
+// of GEWIS_SECRET and GEWIS_SECRETS. An entry written as kid:secret is only
+// used for tokens with that kid header when one is present.
+func WithSecret(secrets ...string) Option {
+	return func(c *Chat) {
+		c.secrets = parseSecrets(strings.Join(secrets, ","))
+	}
+}
+
+// validMethods lists the accepted signing algorithms, RS256 and ES256 only
+// with a JWKS.
+func (c *Chat) validMethods() []string {
+	if c.jwks == nil {
+		return []string{jwt.SigningMethodHS512.Alg()}
+	}
+	return []string{jwt.SigningMethodHS512.Alg(), jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}
+}
+
+// keyfunc verifies HS512 tokens with the GEWIS secrets and others with the
+// JWKS.
+func (c *Chat) keyfunc(t *jwt.Token) (any, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok || c.jwks == nil {
+		return c.gewisKeyfunc(t)
+	}
+	return c.jwks.Keyfunc(t)
+}
+
+// gewisKeyfunc returns the secret named by the token's kid header, or else all
+// secrets for the parser to try in order.
+func (c *Chat) gewisKeyfunc(t *jwt.Token) (any, error) {
+	secrets := c.secrets
+	if kid, ok := t.Header["kid"].(string); ok && kid != "" {
+		for _, s := range secrets {
+			if s.kid == kid {
+				return s.key, nil
+			}
+		}
+	}
+	set := jwt.VerificationKeySet{}
+	for _, s := range secrets {
+		set.Keys = append(set.Keys, s.key)
+	}
+	return set, nil
+}
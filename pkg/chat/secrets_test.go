@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signToken(t *testing.T, secret, kid string) string {
+	t.Helper()
+	j := jwt.NewWithClaims(jwt.SigningMethodHS512, GEWISClaims{
+		Lidnr:            12345,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	if kid != "" {
+		j.Header["kid"] = kid
+	}
+	s, err := j.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func TestSecretRotation(t *testing.T) {
+	GEWISSecrets = parseSecrets("new-secret, old-secret")
+	defer func() { GEWISSecrets = nil }()
+	chat := New()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"new secret", signToken(t, "new-secret", ""), true},
+		{"old secret", signToken(t, "old-secret", ""), true},
+		{"neither", signToken(t, "other-secret", ""), false},
+	}
+	for _, tt := range tests {
+		if _, err := chat.verifyGEWISTokenHandshake(tt.token); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestSecretSelectedByKid(t *testing.T) {
+	GEWISSecrets = parseSecrets("2025:new-secret,2024:old-secret")
+	defer func() { GEWISSecrets = nil }()
+	chat := New()
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"matching kid", signToken(t, "old-secret", "2024"), true},
+		{"other kid", signToken(t, "old-secret", "2025"), false},
+		{"unknown kid tries all", signToken(t, "old-secret", "2023"), true},
+		{"no kid tries all", signToken(t, "new-secret", ""), true},
+	}
+	for _, tt := range tests {
+		if _, err := chat.verifyGEWISTokenHandshake(tt.token); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
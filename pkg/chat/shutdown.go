@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdownDrain is how long connected clients keep chatting after shutdown
+// starts, while new connections are refused.
+var shutdownDrain = Duration("RADIO_SHUTDOWN_DRAIN", 5*time.Second)
+
+// Draining reports whether Shutdown was called. New connections are refused
+// with 503 from then on.
+func (c *Chat) Draining() bool {
+	return c.draining.Load()
+}
+
+// refuseWhileDraining answers 503 and reports true once shutdown started.
+func (c *Chat) refuseWhileDraining(w http.ResponseWriter) bool {
+	if !c.Draining() {
+		return false
+	}
+	w.Header().Set("Retry-After", "5")
+	writeError(w, http.StatusServiceUnavailable, "server shutting down")
+	return true
+}
+
+// admit reserves a websocket connection's or event stream's place among the
+// goroutines Shutdown waits for, or reports false once Shutdown closed the
+// connections. Admitted clients are released by handleClient, or when
+// HandleStream returns.
+func (c *Chat) admit(client *Client) bool {
+	c.admitMu.Lock()
+	defer c.admitMu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.admitted[client] = struct{}{}
+	c.running.Add(1)
+	client.running = &c.running
+	return true
+}
+
+// release gives up the place taken by admit.
+func (c *Chat) release(client *Client) {
+	c.admitMu.Lock()
+	delete(c.admitted, client)
+	c.admitMu.Unlock()
+	c.running.Done()
+}
+
+// refuseShutdown closes a connection that upgraded while Shutdown closed the
+// others, before any of its goroutines started.
+func (c *Chat) refuseShutdown(client *Client) {
+	_ = client.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+		time.Now().Add(c.ws.CloseTimeout),
+	)
+	client.log.Warn().Msg("closing connection: server shutting down")
+	_ = client.conn.Close()
+}
+
+// spawn runs f on a goroutine of the client's connection, which Shutdown
+// waits for.
+func (cl *Client) spawn(f func()) {
+	if cl.running == nil {
+		go f()
+		return
+	}
+	cl.running.Add(1)
+	go func() {
+		defer cl.running.Done()
+		f()
+	}()
+}
+
+// Shutdown refuses new connections, lets the connected clients go on for the
+// drain period and then closes them with 1001 (going away). It also stops the
+// fan-out workers and the timers of polls and countdowns. A context that ends
+// first cuts the drain short, the clients are still closed. It then waits for
+// the goroutines of every connection to exit, returning ctx.Err() if the
+// context ends first.
+func (c *Chat) Shutdown(ctx context.Context) error {
+	if c.draining.Swap(true) {
+		return nil
+	}
+	c.log.Info().Dur("drain", c.drain).Msg("draining connections")
+
+	timer := time.NewTimer(c.drain)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// Connections admitted but not yet registered are closed too, later ones
+	// are refused by admit
+	closing := make(map[*Client]struct{})
+	c.admitMu.Lock()
+	c.closed = true
+	for cl := range c.admitted {
+		closing[cl] = struct{}{}
+	}
+	c.admitMu.Unlock()
+	c.mutex.RLock()
+	c.rangeRooms("", func(_ string, r *room) {
+		for _, u := range r.users {
+			closing[u] = struct{}{}
+		}
+		for cl := range r.radios {
+			closing[cl] = struct{}{}
+		}
+		for g := range r.guests {
+			closing[g] = struct{}{}
+		}
+	})
+	c.mutex.RUnlock()
+	clients := slices.Collect(maps.Keys(closing))
+
+	// closeWith waits for each client to flush, so close them all at once
+	var wg sync.WaitGroup
+	for _, cl := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cl.closeWith(websocket.CloseGoingAway, "server shutting down")
+		}()
+	}
+	wg.Wait()
+	c.stopPolls()
+	c.stopCountdowns()
+	c.fanout.stop()
+	c.stopPublishing(ctx)
+	c.log.Info().Int("clients", len(clients)).Msg("closed remaining connections")
+	if err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
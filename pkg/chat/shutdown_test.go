@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/goleak"
+)
+
+func waitForDraining(t *testing.T, chat *Chat) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !chat.Draining() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the drain to start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectGoingAway(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("expected close 1001, got: %v", err)
+		}
+		return
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.drain = 500 * time.Millisecond
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() { done <- chat.Shutdown(context.Background()) }()
+	waitForDraining(t, chat)
+
+	// New connections are refused
+	_, resp, err := dialSubprotocols(wsBase)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %v (%v)", resp, err)
+	}
+	rec := httptest.NewRecorder()
+	chat.HandleStream(rec, httptest.NewRequest(http.MethodGet, "/api/v1/chat/stream", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a stream while draining, got %d", rec.Code)
+	}
+
+	// Connected clients keep chatting
+	sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+	expectContent(t, radio, "Can you play Bohemian Rhapsody?")
+	replyToUser(t, radio, "12345", "Coming up next")
+	expectContent(t, user, "Coming up next")
+
+	expectGoingAway(t, user)
+	expectGoingAway(t, radio)
+	if err := <-done; err != nil {
+		t.Fatalf("expected a full drain, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < chat.drain {
+		t.Fatalf("expected clients to be closed after the drain, closed after %v", elapsed)
+	}
+}
+
+func TestShutdownContextCutsDrainShort(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.drain = time.Hour
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := chat.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to end the drain, got: %v", err)
+	}
+	expectGoingAway(t, user)
+	expectGoingAway(t, radio)
+}
+
+func TestShutdownLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.drain = 0
+	srv, wsBase := startTestServer(t, chat)
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	sendAsUser(t, user, "Can you play Bohemian Rhapsody?")
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second); err != nil || out.Content == "" {
+		t.Fatalf("expected the message on the radio, got: %+v (%v)", out, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := chat.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	expectGoingAway(t, user)
+	expectGoingAway(t, radio)
+	srv.Close()
+
+	// Connections upgraded after Shutdown are closed right away
+	if _, _, err := dialSubprotocols(wsBase); err == nil {
+		t.Fatal("expected the dial to fail after shutdown")
+	}
+}
+
+func TestShutdownStopsTimers(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.drain = 0
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	startTestPoll(t, user, radio)
+	if err := radio.WriteJSON(IncomingMessage{Type: MessageTypeCountdown, Content: "30m"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	expectType(t, user, MessageTypeCountdownStart)
+
+	if err := chat.Shutdown(t.Context()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	// Stop reports whether the timer was still running
+	chat.polls.mu.Lock()
+	defer chat.polls.mu.Unlock()
+	if len(chat.polls.byID) == 0 {
+		t.Fatal("expected the poll to be kept")
+	}
+	for id, p := range chat.polls.byID {
+		if p.expiry.Stop() {
+			t.Errorf("expected the expiry of poll %s to be stopped", id)
+		}
+	}
+	chat.countdownMu.Lock()
+	defer chat.countdownMu.Unlock()
+	if len(chat.countdowns) == 0 {
+		t.Fatal("expected the countdown to be kept")
+	}
+	for room, cd := range chat.countdowns {
+		if cd.timer.Stop() {
+			t.Errorf("expected the countdown in %s to be stopped", room)
+		}
+	}
+}
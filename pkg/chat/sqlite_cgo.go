@@ -0,0 +1,7 @@
+//go:build cgo
+
+package chat
+
+// sqliteSupported reports whether the binary can open SQLite databases, which
+// go-sqlite3 needs cgo for.
+const sqliteSupported = true
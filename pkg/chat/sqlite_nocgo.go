@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package chat
+
+// sqliteSupported is false without cgo, which go-sqlite3 needs.
+const sqliteSupported = false
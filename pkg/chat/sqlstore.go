@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// sqlDialect is what differs between the databases a SQLStore supports.
+type sqlDialect struct {
+	driver     string // database/sql driver name
+	numbered   bool   // placeholders are $1, $2, ... instead of ?
+	migrations string // directory in migrations
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"sqlite":   {driver: "sqlite3", migrations: "migrations/sqlite"},
+	"postgres": {driver: "pgx", numbered: true, migrations: "migrations/postgres"},
+}
+
+// SQLStore is a MessageStore in SQLite or Postgres.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// CheckSQLDriver reports whether OpenSQLStore supports the driver in this
+// build.
+func CheckSQLDriver(driver string) error {
+	if _, ok := sqlDialects[driver]; !ok {
+		return fmt.Errorf("unknown database driver %q, expected sqlite or postgres", driver)
+	}
+	if driver == "sqlite" && !sqliteSupported {
+		return errors.New("database driver sqlite needs a build with CGO_ENABLED=1")
+	}
+	return nil
+}
+
+// OpenSQLStore connects to the database of CHAT_DB_DRIVER, sqlite or
+// postgres, and applies the migrations it has not seen yet. SQLite needs a
+// cgo build.
+func OpenSQLStore(ctx context.Context, driver, dsn string) (*SQLStore, error) {
+	if err := CheckSQLDriver(driver); err != nil {
+		return nil, err
+	}
+	dialect := sqlDialects[driver]
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// A single connection serializes writes, which SQLite needs anyway
+		db.SetMaxOpenConns(1)
+	}
+	s := &SQLStore{db: db, dialect: dialect}
+	if err := s.migrate(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the embedded migrations of the dialect in name order, each
+// in its own transaction.
+func (s *SQLStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)"); err != nil {
+		return err
+	}
+	files, err := fs.Glob(migrations, s.dialect.migrations+"/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(files)
+	for _, file := range files {
+		version := strings.TrimSuffix(file[strings.LastIndex(file, "/")+1:], ".sql")
+		var applied int
+		if err := s.db.QueryRowContext(ctx, s.rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+		script, err := migrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, s.rebind("INSERT INTO schema_migrations (version) VALUES (?)"), version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebind turns the ? placeholders of a query into those of the dialect.
+func (s *SQLStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLStore) Append(ctx context.Context, role string, msg OutgoingMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.rebind(
+		"INSERT INTO messages (id, sent_at, role, sender, recipient, room, body) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+		msg.ID, msg.SentAt.UnixNano(), role, msg.From, msg.To, msg.Room, string(body))
+	return err
+}
+
+func (s *SQLStore) Query(ctx context.Context, q StoreQuery) ([]OutgoingMessage, error) {
+	where := []string{"retracted = FALSE"}
+	var args []any
+	if !q.From.IsZero() {
+		where = append(where, "sent_at >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "sent_at < ?")
+		args = append(args, q.To.UnixNano())
+	}
+	if q.Room != "" {
+		where = append(where, "(room = ? OR room = '')")
+		args = append(args, q.Room)
+	}
+	if q.Lidnr != "" {
+		where = append(where, "sender = ?")
+		args = append(args, q.Lidnr)
+	}
+	if q.BeforeID != "" {
+		where = append(where, "id < ?")
+		args = append(args, q.BeforeID)
+	}
+	query := "SELECT body FROM messages WHERE " + strings.Join(where, " AND ")
+	if q.Limit > 0 {
+		// The newest messages, reversed below
+		query += " ORDER BY id DESC LIMIT " + strconv.Itoa(q.Limit)
+	} else {
+		query += " ORDER BY id"
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []OutgoingMessage
+	for rows.Next() {
+		var body []byte
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		var msg OutgoingMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return nil, err
+		}
+		out = append(out, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if q.Limit > 0 {
+		slices.Reverse(out)
+	}
+	return out, nil
+}
+
+func (s *SQLStore) Retract(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind("UPDATE messages SET retracted = TRUE WHERE id = ?"), id)
+	return err
+}
+
+func (s *SQLStore) DeleteUser(ctx context.Context, lidnr string) (int64, error) {
+	if lidnr == "" {
+		return 0, errors.New("lidnr required")
+	}
+	res, err := s.db.ExecContext(ctx, s.rebind("DELETE FROM messages WHERE sender = ? OR recipient = ?"), lidnr, lidnr)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,224 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const sseBufferSize = 64
+
+var errStreamClosed = errors.New("stream closed")
+
+// sseStream buffers messages for a member connected over server-sent events.
+// The HTTP handler owning the stream drains the queue.
+type sseStream struct {
+	queue chan []byte
+	done  chan struct{}
+
+	mu          sync.Mutex
+	closed      bool
+	closeCode   int
+	closeReason string
+}
+
+func newSSEStream() *sseStream {
+	return &sseStream{
+		queue: make(chan []byte, sseBufferSize),
+		done:  make(chan struct{}),
+	}
+}
+
+func (s *sseStream) kind() string {
+	return "sse"
+}
+
+func (s *sseStream) send(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errStreamClosed
+	}
+	select {
+	case s.queue <- data:
+		return nil
+	default:
+		return errors.New("stream buffer full")
+	}
+}
+
+func (s *sseStream) close(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closeCode = code
+	s.closeReason = reason
+	close(s.done)
+}
+
+// SSEClose is sent as a "close" event when the server ends a stream, mirroring
+// the websocket close frame.
+type SSEClose struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// HandleStream is a server-sent events fallback for members whose network
+// blocks websockets. It authenticates with ?token= and receives the same
+// messages a websocket user in the ?room= would. Messages are sent with
+// HandleSend.
+func (c *Chat) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if c.refuseWhileDraining(w) {
+		return
+	}
+	logger := requestLogger(r.Context())
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	roomName, err := c.roomFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	claims, err := c.verifyGEWISTokenHandshake(r.URL.Query().Get("token"))
+	if err != nil {
+		logger.Warn().Err(err).Msg("rejecting stream: invalid token")
+		writeError(w, http.StatusUnauthorized, tokenErrorMessage(err))
+		return
+	}
+
+	stream := newSSEStream()
+	client := &Client{
+		role:       "user",
+		id:         strconv.Itoa(claims.Lidnr),
+		givenName:  claims.GivenName,
+		familyName: claims.FamilyName,
+		email:      claims.Email,
+		room:       roomName,
+		stream:     stream,
+		userAgent:  r.UserAgent(),
+	}
+	client.setLogger(withConnID(logger, newConnID()))
+	if _, reason, err := c.hookConnect(client.info()); err != nil {
+		client.log.Warn().Err(err).Msg("rejecting stream: rejected by connect hook")
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+	if !c.admit(client) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, "server shutting down")
+		return
+	}
+	defer c.release(client)
+	if err := c.register(client); err != nil {
+		client.log.Info().Err(err).Msg("rejecting stream")
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client.log.Info().Str("room", roomName).Str("transport", "sse").Msg("client connected")
+	c.emitConnect(client.info())
+	defer func() {
+		c.unregister(client)
+		stream.close(websocket.CloseNormalClosure, "")
+		client.log.Info().Str("transport", "sse").Msg("client disconnected")
+		c.hookDisconnect(client.info(), "stream ended")
+		c.emitDisconnect(client.info(), "stream ended")
+	}()
+
+	c.sendPinned(client)
+
+	keepalive := time.NewTicker(c.ws.PingPeriod)
+	defer keepalive.Stop()
+	buf := getFrameBuffer()
+	defer putFrameBuffer(buf)
+	for {
+		select {
+		case data := <-stream.queue:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", client.stamp(buf, data)); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-stream.done:
+			stream.mu.Lock()
+			data, _ := json.Marshal(SSEClose{Code: stream.closeCode, Reason: stream.closeReason})
+			stream.mu.Unlock()
+			_, _ = fmt.Fprintf(w, "event: close\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// HandleSend accepts a message from a member in the ?room=, authenticated with
+// their GEWIS token as bearer token. It pairs with HandleStream but works for
+// any member.
+func (c *Chat) HandleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	logger := requestLogger(r.Context())
+	roomName, err := c.roomFromRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	claims, err := c.verifyGEWISTokenHandshake(bearerToken(r))
+	if err != nil {
+		logger.Warn().Err(err).Msg("rejecting send: invalid token")
+		writeError(w, http.StatusUnauthorized, tokenErrorMessage(err))
+		return
+	}
+
+	var in IncomingMessage
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+
+	id := strconv.Itoa(claims.Lidnr)
+	client, ok := c.lookupUser(roomName, id)
+	if !ok {
+		client = &Client{
+			role:       "user",
+			id:         id,
+			givenName:  claims.GivenName,
+			familyName: claims.FamilyName,
+			email:      claims.Email,
+			room:       roomName,
+		}
+		client.setLogger(*logger)
+	}
+
+	if err := c.dispatch(r.Context(), client, in); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, StatusResponse{Status: "ok"})
+}
@@ -0,0 +1,216 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startSSETestServer(t *testing.T, chat *Chat) (*httptest.Server, string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", chat.HandleWS)
+	mux.HandleFunc("/api/v1/chat/stream", chat.HandleStream)
+	mux.HandleFunc("/api/v1/chat/send", chat.HandleSend)
+	srv := httptest.NewServer(mux)
+	return srv, "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// openStream connects to the SSE endpoint and returns a channel of events.
+func openStream(t *testing.T, baseURL, token string) (<-chan sseEvent, func()) {
+	t.Helper()
+	resp, err := http.Get(baseURL + "/api/v1/chat/stream?token=" + token)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("open stream: expected 200, got %d", resp.StatusCode)
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && ev.data != "":
+				events <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return events, func() { _ = resp.Body.Close() }
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return sseEvent{}
+}
+
+func TestSSEUserReceivesRadioReply(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+
+	srv, wsBase := startSSETestServer(t, chat)
+	defer srv.Close()
+
+	userTok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	events, closeStream := openStream(t, srv.URL, userTok)
+	defer closeStream()
+	waitForUsers(t, chat, 1)
+
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	waitForRadios(t, chat, 1)
+
+	// Sending pairs with the stream
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/chat/send", strings.NewReader(`{"content":"hello over sse"}`))
+	req.Header.Set("Authorization", "Bearer "+userTok)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("send: expected 200, got %d", resp.StatusCode)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+	if out.From != "12345" || out.Content != "hello over sse" {
+		t.Fatalf("unexpected message at radio: %+v", out)
+	}
+
+	if err := radio.WriteJSON(IncomingMessage{To: "12345", Content: "hello sse user"}); err != nil {
+		t.Fatalf("radio write: %v", err)
+	}
+	ev := nextEvent(t, events)
+	var reply OutgoingMessage
+	if err := json.Unmarshal([]byte(ev.data), &reply); err != nil {
+		t.Fatalf("invalid event data %q: %v", ev.data, err)
+	}
+	if reply.From != "99999" || reply.Content != "hello sse user" {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+}
+
+func TestWebsocketReconnectReplacesSSE(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+
+	srv, wsBase := startSSETestServer(t, chat)
+	defer srv.Close()
+
+	tok := makeToken(t, GEWISSecret, 77777, "Eve", "User", time.Minute)
+	events, closeStream := openStream(t, srv.URL, tok)
+	defer closeStream()
+	waitForUsers(t, chat, 1)
+
+	ws := dialAndHandshake(t, wsBase, "user", tok, "")
+	defer ws.Close()
+
+	ev := nextEvent(t, events)
+	if ev.event != "close" {
+		t.Fatalf("expected close event, got: %+v", ev)
+	}
+	var closed SSEClose
+	if err := json.Unmarshal([]byte(ev.data), &closed); err != nil || closed.Code != 4100 {
+		t.Fatalf("expected close code 4100, got: %q", ev.data)
+	}
+
+	// The stream ends and the websocket stays registered
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("expected stream to end")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for stream to end")
+	}
+	current, _ := chat.lookupUser(DefaultRoom, "77777")
+	if current == nil || current.stream != nil {
+		t.Fatalf("expected websocket session to remain registered, got: %+v", current)
+	}
+}
+
+func TestSSERejectsInvalidToken(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+
+	rec := httptest.NewRecorder()
+	chat.HandleStream(rec, httptest.NewRequest(http.MethodGet, "/api/v1/chat/stream?token=nope", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestSSERefusedOnceClosed(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	// Shutdown took its list of clients after the request passed the
+	// draining check
+	chat.admitMu.Lock()
+	chat.closed = true
+	chat.admitMu.Unlock()
+
+	token := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+	rec := httptest.NewRecorder()
+	chat.HandleStream(rec, httptest.NewRequest(http.MethodGet, "/api/v1/chat/stream?token="+token, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 0 {
+		t.Fatalf("expected the stream not to register, got %d users", n)
+	}
+}
+
+func TestShutdownWaitsForStreams(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.drain = 0
+	srv, _ := startSSETestServer(t, chat)
+	defer srv.Close()
+
+	events, stop := openStream(t, srv.URL, makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute))
+	defer stop()
+	waitForUsers(t, chat, 1)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	if err := chat.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	for ev := range events {
+		if ev.event == "close" {
+			return
+		}
+	}
+	t.Fatal("expected a close event before the stream ended")
+}
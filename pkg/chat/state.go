@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// StateSnapshot is a point-in-time copy of the connected clients, for
+// debugging and admin inspection.
+type StateSnapshot struct {
+	Users        []ClientInfo `json:"users"`
+	Radios       []ClientInfo `json:"radios"`
+	Rooms        []string     `json:"rooms" description:"Rooms with at least one member"`
+	MessageCount uint64       `json:"messageCount" description:"Messages dispatched since start"`
+}
+
+// SnapshotState copies the connected clients under the lock and sorts them
+// after releasing it.
+func (c *Chat) SnapshotState() StateSnapshot {
+	s := StateSnapshot{Users: []ClientInfo{}, Radios: []ClientInfo{}, Rooms: []string{}}
+	c.mutex.RLock()
+	for name, r := range c.rooms {
+		s.Rooms = append(s.Rooms, name)
+		for _, cl := range r.users {
+			s.Users = append(s.Users, cl.stateInfo())
+		}
+		for cl := range r.radios {
+			s.Radios = append(s.Radios, cl.stateInfo())
+		}
+	}
+	c.mutex.RUnlock()
+	s.MessageCount = c.messageCount.Load()
+
+	byRoomAndID := func(a, b ClientInfo) int {
+		return cmp.Or(cmp.Compare(a.Room, b.Room), cmp.Compare(a.ID, b.ID))
+	}
+	slices.SortFunc(s.Users, byRoomAndID)
+	slices.SortFunc(s.Radios, byRoomAndID)
+	slices.Sort(s.Rooms)
+	return s
+}
+
+// stateInfo is the client's info with its connection round trip time.
+func (cl *Client) stateInfo() ClientInfo {
+	info := cl.info()
+	info.LastRTTMs = float64(cl.lastRTT.Load()) / float64(time.Millisecond)
+	info.Compressed = cl.compressed
+	info.DroppedMessages = cl.droppedMessages.Load()
+	info.ClientVersion, info.ClientPlatform = cl.clientVersion, cl.clientPlatform
+	info.UserAgent = cl.userAgent
+	return info
+}
+
+// HandleState returns a StateSnapshot. Requires the admin key.
+func (c *Chat) HandleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+	writeJSON(w, http.StatusOK, c.SnapshotState())
+}
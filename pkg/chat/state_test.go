@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSnapshotState(t *testing.T) {
+	chat := New()
+	for _, cl := range []*Client{
+		{role: "user", id: "12345", room: "tech"},
+		{role: "user", id: "12346", room: DefaultRoom},
+		{role: "user", id: "12344", room: DefaultRoom},
+		{role: "radio", id: "99999", room: DefaultRoom},
+	} {
+		chat.register(cl)
+	}
+	chat.nextMessageID()
+	chat.nextMessageID()
+
+	s := chat.SnapshotState()
+	var ids []string
+	for _, u := range s.Users {
+		ids = append(ids, u.Room+"/"+u.ID)
+	}
+	if want := []string{"main/12344", "main/12346", "tech/12345"}; !slices.Equal(ids, want) {
+		t.Fatalf("expected users %v, got %v", want, ids)
+	}
+	if len(s.Radios) != 1 || s.Radios[0].ID != "99999" || s.Radios[0].Role != "radio" {
+		t.Fatalf("unexpected radios: %+v", s.Radios)
+	}
+	if !slices.Equal(s.Rooms, []string{"main", "tech"}) {
+		t.Fatalf("unexpected rooms: %v", s.Rooms)
+	}
+	if s.MessageCount != 2 {
+		t.Fatalf("expected 2 messages, got %d", s.MessageCount)
+	}
+}
+
+func TestSnapshotStateConcurrent(t *testing.T) {
+	chat := New()
+	const members = 50
+
+	var wg sync.WaitGroup
+	for i := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cl := &Client{role: "user", id: strconv.Itoa(10000 + i), room: DefaultRoom}
+			chat.register(cl)
+			if i%2 == 0 {
+				chat.unregister(cl)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		s := chat.SnapshotState()
+		if len(s.Users) > members {
+			t.Fatalf("snapshot has %d users, more than ever connected", len(s.Users))
+		}
+		if !slices.IsSortedFunc(s.Users, func(a, b ClientInfo) int { return strings.Compare(a.ID, b.ID) }) {
+			t.Fatalf("snapshot users not sorted: %+v", s.Users)
+		}
+	}
+
+	if s := chat.SnapshotState(); len(s.Users) != members/2 {
+		t.Fatalf("expected %d users after all changes, got %d", members/2, len(s.Users))
+	}
+}
+
+func TestHandleState(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	chat.register(&Client{role: "user", id: "12345", room: DefaultRoom})
+
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/state", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		chat.HandleState(rec, req)
+		return rec
+	}
+
+	if rec := get("ChangeMe"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin key, got %d", rec.Code)
+	}
+	rec := get("admin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var s StateSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(s.Users) != 1 || s.Users[0].ID != "12345" || s.Users[0].Transport != "http" {
+		t.Fatalf("unexpected snapshot: %+v", s)
+	}
+}
+
+func TestConnectionMetadata(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	header := http.Header{"User-Agent": {"radiogaga-app/2.3 (Android 14)"}}
+	conn, _, err := websocket.DefaultDialer.Dial(wsBase+"?role=user", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	handshake := IncomingMessage{
+		Token:          makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute),
+		ClientVersion:  "2.3.1",
+		ClientPlatform: "android",
+	}
+	if err := conn.WriteJSON(handshake); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	waitForUsers(t, chat, 1)
+
+	users := chat.SnapshotState().Users
+	if len(users) != 1 {
+		t.Fatalf("expected one user, got %+v", users)
+	}
+	got := users[0]
+	if got.ClientVersion != "2.3.1" || got.ClientPlatform != "android" || got.UserAgent != "radiogaga-app/2.3 (Android 14)" {
+		t.Fatalf("expected the connection metadata, got %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+package chat
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Stats is a point-in-time summary of the chat.
+type Stats struct {
+	ConnectedUsers   int         `json:"connectedUsers"`
+	ConnectedRadios  int         `json:"connectedRadios"`
+	ConnectedGuests  int         `json:"connectedGuests"`
+	Compressed       int         `json:"compressedConnections"` // connections that negotiated permessage-deflate
+	Rooms            []RoomStats `json:"rooms"`
+	FilteredMessages uint64      `json:"filteredMessages"`
+	WebhookSent      uint64      `json:"webhookSent"`
+	WebhookDropped   uint64      `json:"webhookDropped"`
+	SuppressedLogs   uint64      `json:"suppressedLogs"` // message-level log events sampled out, see LOG_MESSAGE_SAMPLE
+
+	// Disconnects counts websocket disconnects since startup by reason: left,
+	// connection lost, timeout or closed by server.
+	Disconnects map[string]uint64 `json:"disconnects"`
+}
+
+type RoomStats struct {
+	Room            string `json:"room"`
+	ConnectedUsers  int    `json:"connectedUsers"`
+	ConnectedRadios int    `json:"connectedRadios"`
+	ConnectedGuests int    `json:"connectedGuests"`
+}
+
+// RadioCount returns the number of radios connected to this instance, over all
+// rooms.
+func (c *Chat) RadioCount() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	n := 0
+	for _, r := range c.rooms {
+		n += len(r.radios)
+	}
+	return n
+}
+
+func (c *Chat) Stats() Stats {
+	s := Stats{Rooms: []RoomStats{}}
+	c.mutex.RLock()
+	for name, r := range c.rooms {
+		s.ConnectedUsers += len(r.users)
+		s.ConnectedRadios += len(r.radios)
+		s.ConnectedGuests += len(r.guests)
+		s.Compressed += r.compressed()
+		s.Rooms = append(s.Rooms, RoomStats{
+			Room:            name,
+			ConnectedUsers:  len(r.users),
+			ConnectedRadios: len(r.radios),
+			ConnectedGuests: len(r.guests),
+		})
+	}
+	c.mutex.RUnlock()
+	s.FilteredMessages = c.filteredMessages.Load()
+	s.SuppressedLogs = c.suppressedLogs.Load()
+	s.Disconnects = c.disconnects.snapshot()
+	slices.SortFunc(s.Rooms, func(a, b RoomStats) int { return strings.Compare(a.Room, b.Room) })
+
+	if c.webhook != nil {
+		s.WebhookSent = c.webhook.Delivered()
+		s.WebhookDropped = c.webhook.Dropped()
+	}
+	return s
+}
+
+// ConnectionMetrics is a JSON alternative to scraping /metrics for the
+// connection counts.
+type ConnectionMetrics struct {
+	ConnectedUsers  int    `json:"connected_users"`
+	ConnectedRadios int    `json:"connected_radios"`
+	PeakUsers       uint64 `json:"peak_users" description:"Most users connected at once since startup"`
+	PeakRadios      uint64 `json:"peak_radios" description:"Most radios connected at once since startup"`
+	Connections     uint64 `json:"total_connections_lifetime" description:"Clients connected since startup, guests included"`
+}
+
+// countConnection counts a newly registered client and raises the peaks. The
+// caller must hold the write lock, so the counts are those right after
+// registering.
+func (c *Chat) countConnection() {
+	c.connections.Add(1)
+	var users, radios int
+	for _, r := range c.rooms {
+		users += len(r.users)
+		radios += len(r.radios)
+	}
+	raisePeak(&c.peakUsers, uint64(users))
+	raisePeak(&c.peakRadios, uint64(radios))
+}
+
+// raisePeak sets peak to n if n is higher.
+func raisePeak(peak *atomic.Uint64, n uint64) {
+	for {
+		cur := peak.Load()
+		if n <= cur || peak.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
+
+// ConnectionMetrics returns the current and peak connection counts.
+func (c *Chat) ConnectionMetrics() ConnectionMetrics {
+	s := c.Stats()
+	return ConnectionMetrics{
+		ConnectedUsers:  s.ConnectedUsers,
+		ConnectedRadios: s.ConnectedRadios,
+		PeakUsers:       c.peakUsers.Load(),
+		PeakRadios:      c.peakRadios.Load(),
+		Connections:     c.connections.Load(),
+	}
+}
+
+// HandleConnectionMetrics returns the ConnectionMetrics. Requires the admin
+// key.
+func (c *Chat) HandleConnectionMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+	writeJSON(w, http.StatusOK, c.ConnectionMetrics())
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func connectionMetrics(t *testing.T, chat *Chat) ConnectionMetrics {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics/connections", nil)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	chat.HandleConnectionMetrics(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var m ConnectionMetrics
+	if err := json.NewDecoder(rec.Body).Decode(&m); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return m
+}
+
+func TestConnectionMetricsPeaks(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "radiokey"
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	if m := connectionMetrics(t, chat); m != (ConnectionMetrics{}) {
+		t.Fatalf("expected no connections yet, got: %+v", m)
+	}
+
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	second := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 22222, "Carol", "User", time.Minute), "")
+	waitForUsers(t, chat, 2)
+	_ = user.Close()
+	_ = second.Close()
+	_ = radio.Close()
+	waitForUsers(t, chat, 0)
+	waitForRadios(t, chat, 0)
+
+	// A second cycle with fewer users keeps the peak
+	user = dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	waitForUsers(t, chat, 1)
+
+	m := connectionMetrics(t, chat)
+	want := ConnectionMetrics{ConnectedUsers: 1, ConnectedRadios: 0, PeakUsers: 2, PeakRadios: 1, Connections: 4}
+	if m != want {
+		t.Fatalf("expected %+v, got %+v", want, m)
+	}
+}
+
+func TestConnectionMetricsRequiresAdminKey(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics/connections", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	New().HandleConnectionMetrics(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
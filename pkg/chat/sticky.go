@@ -0,0 +1,63 @@
+package chat
+
+import (
+	"context"
+)
+
+// stickyRouting sends all messages of a user to the radio that received their
+// first message, so a single radio handles the conversation.
+var stickyRouting = Bool("RADIO_STICKY_ROUTING", false)
+
+// forwardFromUser delivers a user message to the radios. With sticky routing
+// it only goes to the user's radio, falling back to all radios when that radio
+// is gone. The first local radio that receives the fallback becomes the
+// user's radio. Radios get the message as hideMember shows it.
+func (c *Chat) forwardFromUser(ctx context.Context, msg OutgoingMessage) {
+	shown := c.hideMember(msg)
+	if !c.sticky {
+		c.forwardToRadios(ctx, shown)
+		return
+	}
+
+	if radio := c.stickyRadio(msg.From, msg.Room); radio != nil {
+		data := c.style.marshal(shown)
+		radio.trace.Trace().Str("user", msg.From).Msg("forwarding message to sticky radio")
+		err := c.traceWrite(ctx, radio, sendFunc(shown), data)
+		if err == nil {
+			return
+		}
+		radio.log.Warn().Err(err).Msg("failed to forward to sticky radio, removing")
+		c.reportError(ErrorKindWriteFailed, err, radio)
+		radio.terminate()
+		c.unregister(radio)
+	}
+
+	c.traceLog.Trace().Str("user", msg.From).Msg("forwarding message to radios")
+	first := c.deliverToRadios(ctx, nil, shown)
+	c.publish(subjectRadios, "", shown)
+	if first != nil {
+		c.mutex.Lock()
+		// The user may have left in the meantime
+		if r, ok := c.rooms[msg.Room]; ok && r.users[msg.From] != nil {
+			c.userRadio[msg.From] = first
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// stickyRadio returns the user's radio if it is still connected to the room.
+// It only reads, unregister forgets radios that leave.
+func (c *Chat) stickyRadio(userID, roomName string) *Client {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	radio, ok := c.userRadio[userID]
+	if !ok {
+		return nil
+	}
+	if r, ok := c.rooms[roomName]; ok && radio.room == roomName {
+		if _, connected := r.radios[radio]; connected {
+			return radio
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package chat
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startStickyChat connects a user and two radios to a chat with sticky
+// routing.
+func startStickyChat(t *testing.T) (chat *Chat, user *websocket.Conn, radios map[string]*websocket.Conn) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat = New()
+	chat.sticky = true
+
+	srv, wsBase := startTestServer(t, chat)
+	t.Cleanup(srv.Close)
+	radios = map[string]*websocket.Conn{
+		"99998": dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99998, "Carol", "Radio", time.Minute), RADIOChatKey),
+		"99999": dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey),
+	}
+	user = dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	t.Cleanup(func() {
+		_ = user.Close()
+		for _, r := range radios {
+			_ = r.Close()
+		}
+	})
+	waitForRadios(t, chat, 2)
+	waitForUsers(t, chat, 1)
+	return chat, user, radios
+}
+
+// waitForStickyRadio waits until the user's radio is recorded, which happens
+// right after the delivery.
+func waitForStickyRadio(t *testing.T, chat *Chat, userID string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if id := stickyRadioID(chat, userID); id != "" {
+			return id
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for sticky radio")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func stickyRadioID(chat *Chat, userID string) string {
+	chat.mutex.Lock()
+	defer chat.mutex.Unlock()
+	if r := chat.userRadio[userID]; r != nil {
+		return r.id
+	}
+	return ""
+}
+
+func sendAsUser(t *testing.T, user *websocket.Conn, content string) {
+	t.Helper()
+	if err := user.WriteJSON(IncomingMessage{Content: content}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+}
+
+func expectContent(t *testing.T, conn *websocket.Conn, content string) {
+	t.Helper()
+	out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 2*time.Second)
+	if err != nil || out.Content != content {
+		t.Fatalf("expected %q, got: %+v (%v)", content, out, err)
+	}
+}
+
+func TestStickyRouting(t *testing.T) {
+	chat, user, radios := startStickyChat(t)
+
+	// The first message goes to every radio
+	sendAsUser(t, user, "first")
+	for _, r := range radios {
+		expectContent(t, r, "first")
+	}
+	sticky := waitForStickyRadio(t, chat, "12345")
+
+	sendAsUser(t, user, "second")
+	for id, r := range radios {
+		if id == sticky {
+			expectContent(t, r, "second")
+			continue
+		}
+		if out, err := readJSONWithDeadline[OutgoingMessage](t, r, 200*time.Millisecond); err == nil {
+			t.Fatalf("expected nothing on the other radio, got: %+v", out)
+		}
+	}
+}
+
+func TestStickyRoutingFallback(t *testing.T) {
+	chat, user, radios := startStickyChat(t)
+
+	sendAsUser(t, user, "first")
+	for _, r := range radios {
+		expectContent(t, r, "first")
+	}
+	sticky := waitForStickyRadio(t, chat, "12345")
+	_ = radios[sticky].Close()
+	delete(radios, sticky)
+	waitForRadios(t, chat, 1)
+
+	sendAsUser(t, user, "second")
+	for id, r := range radios {
+		expectContent(t, r, "second")
+		if got := waitForStickyRadio(t, chat, "12345"); got != id {
+			t.Fatalf("expected remaining radio %s to become sticky, got %q", id, got)
+		}
+	}
+}
+
+func TestStickyRoutingClearedOnUserDisconnect(t *testing.T) {
+	chat, user, radios := startStickyChat(t)
+
+	sendAsUser(t, user, "first")
+	for _, r := range radios {
+		expectContent(t, r, "first")
+	}
+	waitForStickyRadio(t, chat, "12345")
+
+	_ = user.Close()
+	waitForUsers(t, chat, 0)
+	if got := stickyRadioID(chat, "12345"); got != "" {
+		t.Fatalf("expected sticky radio to be cleared, got %q", got)
+	}
+}
+
+func TestStickyRadioGoneConcurrently(t *testing.T) {
+	chat := New()
+	chat.sticky = true
+	radio := &Client{role: "radio", id: "99999", room: DefaultRoom}
+	if err := chat.register(radio); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	var ids []string
+	for i := range 8 {
+		id := strconv.Itoa(20000 + i)
+		if err := chat.register(&Client{role: "user", id: id, room: DefaultRoom}); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+		chat.userRadio[id] = radio
+		ids = append(ids, id)
+	}
+
+	chat.unregister(radio)
+	if n := len(chat.userRadio); n != 0 {
+		t.Fatalf("expected the users of the radio to be forgotten, %d left", n)
+	}
+
+	// Users whose radio is gone, as a resumed session may have, fall back
+	// to all radios from concurrent deliveries
+	for _, id := range ids {
+		chat.userRadio[id] = radio
+	}
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if got := chat.stickyRadio(id, DefaultRoom); got != nil {
+					t.Errorf("expected no sticky radio for %s, got %s", id, got.id)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
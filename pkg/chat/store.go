@@ -0,0 +1,171 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var dbQueueSize = Int("CHAT_DB_QUEUE_SIZE", 1024)
+
+var errStoreClosed = errors.New("message store closed")
+
+// MessageStore keeps dispatched messages beyond the in-memory history, for
+// the export and the per-user history. See OpenSQLStore.
+type MessageStore interface {
+	// Append stores a message with the role of its sender, empty for system
+	// messages.
+	Append(ctx context.Context, role string, msg OutgoingMessage) error
+	// Query returns the matching messages that were not retracted, oldest
+	// first.
+	Query(ctx context.Context, q StoreQuery) ([]OutgoingMessage, error)
+	// Retract hides a message from Query.
+	Retract(ctx context.Context, id string) error
+	// DeleteUser removes the messages sent by or to the member, and returns
+	// how many there were.
+	DeleteUser(ctx context.Context, lidnr string) (int64, error)
+	Close() error
+}
+
+// StoreQuery selects messages from a MessageStore. Zero fields do not filter.
+type StoreQuery struct {
+	From     time.Time // sentAt at or after
+	To       time.Time // sentAt before
+	Room     string    // messages in the room and those sent to every room
+	Lidnr    string    // messages sent by the member
+	BeforeID string    // messages with a lower ID
+	Limit    int       // the newest Limit messages
+}
+
+// storeOp is a write to the store, applied in the order it was queued.
+type storeOp struct {
+	apply func(ctx context.Context, s MessageStore) error
+	done  chan error // nil if nobody waits for the result
+}
+
+// UseStore writes every message added to the history to the store as well,
+// in the background, and serves the export and per-user history from it.
+func (c *Chat) UseStore(store MessageStore) {
+	c.store = store
+	c.storeQueue = make(chan storeOp, max(dbQueueSize, 1))
+	c.storeDone = make(chan struct{})
+	go func() {
+		defer close(c.storeDone)
+		for op := range c.storeQueue {
+			err := op.apply(context.Background(), store)
+			if op.done != nil {
+				op.done <- err
+			} else if err != nil {
+				c.log.Warn().Err(err).Msg("could not write to message store")
+			}
+		}
+	}()
+}
+
+// CloseStore writes what is queued and closes the store. Later writes are
+// dropped.
+func (c *Chat) CloseStore() error {
+	if c.store == nil {
+		return nil
+	}
+	c.storeMu.Lock()
+	if c.storeClosed {
+		c.storeMu.Unlock()
+		return nil
+	}
+	c.storeClosed = true
+	close(c.storeQueue)
+	c.storeMu.Unlock()
+	<-c.storeDone
+	return c.store.Close()
+}
+
+// tryQueueStore queues a write for the store if there is room, and reports
+// whether it did.
+func (c *Chat) tryQueueStore(op storeOp) bool {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	if c.storeClosed {
+		return false
+	}
+	select {
+	case c.storeQueue <- op:
+		return true
+	default:
+		return false
+	}
+}
+
+// queueStore queues a write for the store, waiting for room until the
+// context is done.
+func (c *Chat) queueStore(ctx context.Context, op storeOp) error {
+	c.storeMu.RLock()
+	defer c.storeMu.RUnlock()
+	if c.storeClosed {
+		return errStoreClosed
+	}
+	select {
+	case c.storeQueue <- op:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// record adds a dispatched message to the history and queues it for the
+// store. A full queue drops the write rather than holding up the chat.
+func (c *Chat) record(role string, msg OutgoingMessage) {
+	c.history.Add(role, msg)
+	if c.store == nil {
+		return
+	}
+	op := storeOp{apply: func(ctx context.Context, s MessageStore) error {
+		return s.Append(ctx, role, msg)
+	}}
+	if !c.tryQueueStore(op) {
+		c.log.Warn().Str("id", msg.ID).Msg("message store queue full, not storing message")
+	}
+}
+
+// storeRetract queues hiding a retracted message in the store. Like record,
+// a full queue drops the write.
+func (c *Chat) storeRetract(id string) {
+	if c.store == nil {
+		return
+	}
+	op := storeOp{apply: func(ctx context.Context, s MessageStore) error {
+		return s.Retract(ctx, id)
+	}}
+	if !c.tryQueueStore(op) {
+		c.log.Warn().Str("id", id).Msg("message store queue full, not retracting message")
+	}
+}
+
+// EraseUser removes the messages sent by or to the member from the history
+// and the store, after the writes queued before. It returns how many messages
+// were removed from the store, or from the history without one. It waits for
+// the store until the context is done.
+func (c *Chat) EraseUser(ctx context.Context, lidnr string) (int64, error) {
+	n := int64(c.history.EraseUser(lidnr))
+	if c.store == nil {
+		return n, nil
+	}
+	done := make(chan error, 1)
+	op := storeOp{
+		apply: func(_ context.Context, s MessageStore) error {
+			var err error
+			n, err = s.DeleteUser(ctx, lidnr)
+			return err
+		},
+		done: done,
+	}
+	if err := c.queueStore(ctx, op); err != nil {
+		return 0, err
+	}
+	select {
+	case err := <-done:
+		return n, err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,281 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testMessageStore is the conformance suite every MessageStore passes. open
+// returns an empty store, called again with the same t it reopens it.
+func testMessageStore(t *testing.T, open func(t *testing.T) MessageStore) {
+	ctx := context.Background()
+	start := time.Date(2026, 10, 16, 20, 0, 0, 0, time.UTC)
+	msg := func(i int, from, to, room string) OutgoingMessage {
+		return OutgoingMessage{
+			ID:          "0000000000000" + strconv.Itoa(100+i),
+			SentAt:      start.Add(time.Duration(i) * time.Minute),
+			From:        from,
+			To:          to,
+			Content:     "message " + strconv.Itoa(i),
+			Room:        room,
+			DisplayName: "Alice User",
+		}
+	}
+	fill := func(t *testing.T, s MessageStore) {
+		t.Helper()
+		for i, m := range []OutgoingMessage{
+			msg(0, "12345", "", DefaultRoom),
+			msg(1, "22222", "", "tech"),
+			msg(2, "99999", "12345", DefaultRoom),
+			msg(3, "12345", "", "tech"),
+			msg(4, "", "", ""),
+		} {
+			role := "user"
+			if i == 2 {
+				role = "radio"
+			}
+			if err := s.Append(ctx, role, m); err != nil {
+				t.Fatalf("append %d: %v", i, err)
+			}
+		}
+	}
+	contents := func(msgs []OutgoingMessage) []string {
+		var out []string
+		for _, m := range msgs {
+			out = append(out, m.Content)
+		}
+		return out
+	}
+	query := func(t *testing.T, s MessageStore, q StoreQuery) []string {
+		t.Helper()
+		msgs, err := s.Query(ctx, q)
+		if err != nil {
+			t.Fatalf("query %+v: %v", q, err)
+		}
+		return contents(msgs)
+	}
+	expect := func(t *testing.T, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %q, got %q", want, got)
+			}
+		}
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		s := open(t)
+		fill(t, s)
+		msgs, err := s.Query(ctx, StoreQuery{})
+		if err != nil || len(msgs) != 5 {
+			t.Fatalf("expected 5 messages, got %d (%v)", len(msgs), err)
+		}
+		if got, want := msgs[2], msg(2, "99999", "12345", DefaultRoom); got.ID != want.ID || !got.SentAt.Equal(want.SentAt) || got.To != want.To || got.DisplayName != want.DisplayName {
+			t.Fatalf("expected %+v, got %+v", want, got)
+		}
+	})
+	t.Run("time range and room", func(t *testing.T) {
+		s := open(t)
+		fill(t, s)
+		expect(t, query(t, s, StoreQuery{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)}), "message 1", "message 2")
+		expect(t, query(t, s, StoreQuery{Room: "tech"}), "message 1", "message 3", "message 4")
+		expect(t, query(t, s, StoreQuery{Room: "tech", From: start.Add(2 * time.Minute)}), "message 3", "message 4")
+	})
+	t.Run("user pages", func(t *testing.T) {
+		s := open(t)
+		fill(t, s)
+		expect(t, query(t, s, StoreQuery{Lidnr: "12345"}), "message 0", "message 3")
+		expect(t, query(t, s, StoreQuery{Lidnr: "12345", Limit: 1}), "message 3")
+		expect(t, query(t, s, StoreQuery{Lidnr: "12345", Limit: 1, BeforeID: msg(3, "", "", "").ID}), "message 0")
+		expect(t, query(t, s, StoreQuery{Lidnr: "12345", BeforeID: msg(0, "", "", "").ID}))
+	})
+	t.Run("retract", func(t *testing.T) {
+		s := open(t)
+		fill(t, s)
+		if err := s.Retract(ctx, msg(1, "", "", "").ID); err != nil {
+			t.Fatalf("retract: %v", err)
+		}
+		expect(t, query(t, s, StoreQuery{Room: "tech"}), "message 3", "message 4")
+	})
+	t.Run("delete user", func(t *testing.T) {
+		s := open(t)
+		fill(t, s)
+		n, err := s.DeleteUser(ctx, "12345")
+		if err != nil || n != 3 {
+			t.Fatalf("expected 3 messages sent by or to 12345 deleted, got %d (%v)", n, err)
+		}
+		expect(t, query(t, s, StoreQuery{}), "message 1", "message 4")
+	})
+	t.Run("reopen", func(t *testing.T) {
+		s := open(t)
+		fill(t, s)
+		if err := s.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		expect(t, query(t, open(t), StoreQuery{}), "message 0", "message 1", "message 2", "message 3", "message 4")
+	})
+}
+
+// openSQLite returns a SQLite store in the test's temporary directory, the
+// same one every time it is called with t.
+func openSQLite(t *testing.T) MessageStore {
+	t.Helper()
+	s, err := OpenSQLStore(context.Background(), "sqlite", filepath.Join(t.TempDir(), "..", "chat.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testMessageStore(t, openSQLite)
+}
+
+// TestPostgresStore runs against a real database when
+// CHAT_DB_TEST_POSTGRES_DSN is set, e.g. postgres://localhost/radiogaga_test.
+// Its tables are dropped first.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("CHAT_DB_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("CHAT_DB_TEST_POSTGRES_DSN not set")
+	}
+	opened := map[*testing.T]bool{}
+	testMessageStore(t, func(t *testing.T) MessageStore {
+		t.Helper()
+		if !opened[t] {
+			resetPostgres(t, dsn)
+			opened[t] = true
+		}
+		s, err := OpenSQLStore(context.Background(), "postgres", dsn)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func resetPostgres(t *testing.T, dsn string) {
+	t.Helper()
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DROP TABLE IF EXISTS messages, schema_migrations"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+}
+
+// syncStore waits until the writes queued for the store are done.
+func syncStore(t *testing.T, chat *Chat) {
+	t.Helper()
+	done := make(chan error, 1)
+	chat.storeQueue <- storeOp{apply: func(context.Context, MessageStore) error { return nil }, done: done}
+	<-done
+}
+
+func TestStoreBackedEndpoints(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	chat.history = NewHistory(2)
+	chat.UseStore(openSQLite(t))
+	for i := range 5 {
+		chat.record("user", OutgoingMessage{
+			ID:      chat.nextMessageID(),
+			SentAt:  time.Now(),
+			From:    "12345",
+			Content: "12345 " + strconv.Itoa(i),
+			Room:    DefaultRoom,
+		})
+	}
+	syncStore(t, chat)
+
+	// The store outlives the 2 messages kept in memory
+	if _, messages := exportHistory(t, chat, ""); len(messages) != 5 {
+		t.Fatalf("expected all 5 messages exported from the store, got %d", len(messages))
+	}
+	code, page := userHistory(t, chat, "12345", "?limit=2")
+	if code != http.StatusOK || len(page.Messages) != 2 || page.Messages[1].Content != "12345 4" || page.NextBeforeID == "" {
+		t.Fatalf("expected the newest 2 messages and a next page, got %d: %+v", code, page)
+	}
+	_, older := userHistory(t, chat, "12345", "?limit=2&before_id="+page.NextBeforeID)
+	if len(older.Messages) != 2 || older.Messages[1].Content != "12345 2" {
+		t.Fatalf("expected the 2 messages before, got: %+v", older)
+	}
+
+	if n, err := chat.EraseUser(context.Background(), "12345"); err != nil || n != 5 {
+		t.Fatalf("expected 5 messages erased, got %d (%v)", n, err)
+	}
+	if code, _ := userHistory(t, chat, "12345", ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after erasing, got %d", code)
+	}
+	if msgs := chat.history.Since("", 0, nil); len(msgs) != 0 {
+		t.Fatalf("expected the history erased as well, got: %+v", msgs)
+	}
+	if err := chat.CloseStore(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+// stalledStore blocks every write until released, like a database that
+// stopped answering.
+type stalledStore struct {
+	MessageStore
+	release chan struct{}
+}
+
+func (s stalledStore) Append(context.Context, string, OutgoingMessage) error {
+	<-s.release
+	return nil
+}
+
+func TestStalledStore(t *testing.T) {
+	size := dbQueueSize
+	dbQueueSize = 1
+	defer func() { dbQueueSize = size }()
+	chat := New()
+	store := stalledStore{MessageStore: openSQLite(t), release: make(chan struct{})}
+	chat.UseStore(store)
+
+	// One write stalls the writer, the next fills the queue
+	chat.record("user", OutgoingMessage{ID: chat.nextMessageID(), From: "12345", Content: "a"})
+	chat.record("user", OutgoingMessage{ID: chat.nextMessageID(), From: "12345", Content: "b"})
+	retracted := make(chan struct{})
+	go func() {
+		chat.storeRetract("1")
+		close(retracted)
+	}()
+	select {
+	case <-retracted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the retract to be dropped rather than wait for the store")
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := chat.EraseUser(ctx, "12345"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the erasure to give up with the context, got: %v", err)
+	}
+
+	close(store.release)
+	if err := chat.CloseStore(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	// Nothing is queued once closed
+	chat.storeRetract("1")
+	if _, err := chat.EraseUser(t.Context(), "12345"); !errors.Is(err, errStoreClosed) {
+		t.Fatalf("expected %v, got: %v", errStoreClosed, err)
+	}
+}
@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsSubprotocols lists the websocket subprotocols the server speaks, most
+// preferred first, configured as RADIO_WS_SUBPROTOCOLS=radiogaga.v2,radiogaga.v1.
+var wsSubprotocols = parseList(String("RADIO_WS_SUBPROTOCOLS", ""))
+
+// supportsSubprotocol reports whether any of the requested subprotocols is
+// supported. Clients that request none are always accepted.
+func supportsSubprotocol(supported, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, p := range requested {
+		if slices.Contains(supported, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenProtocolPrefix marks the subprotocol gewis-token.<jwt>, which carries
+// the token for browsers that cannot set an Authorization header.
+const tokenProtocolPrefix = "gewis-token."
+
+// requestToken returns the token from the Authorization header, or else from
+// the token subprotocol, and the token subprotocol if one was requested.
+func requestToken(r *http.Request) (token, tokenProtocol string) {
+	for _, p := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(p, tokenProtocolPrefix) {
+			tokenProtocol = p
+			break
+		}
+	}
+	if token = bearerToken(r); token == "" {
+		token = strings.TrimPrefix(tokenProtocol, tokenProtocolPrefix)
+	}
+	return token, tokenProtocol
+}
+
+// upgraderFor returns the upgrader and response header for a request.
+// Browsers fail the connection unless the server picks one of the requested
+// subprotocols, so the token subprotocol is picked when no other one is
+// supported.
+func (c *Chat) upgraderFor(requested []string, tokenProtocol string) (*websocket.Upgrader, http.Header) {
+	if tokenProtocol == "" || slices.ContainsFunc(requested, func(p string) bool {
+		return slices.Contains(c.upgrader.Subprotocols, p)
+	}) {
+		return &c.upgrader, nil
+	}
+	upgrader := c.upgrader
+	upgrader.Subprotocols = nil
+	return &upgrader, http.Header{"Sec-Websocket-Protocol": {tokenProtocol}}
+}
+
+// negotiatedProtocol is the subprotocol picked for the connection, ignoring
+// the token subprotocol.
+func negotiatedProtocol(conn *websocket.Conn, tokenProtocol string) string {
+	if p := conn.Subprotocol(); p != tokenProtocol {
+		return p
+	}
+	return ""
+}
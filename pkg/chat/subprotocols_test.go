@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialSubprotocols(wsBase string, protocols ...string) (*websocket.Conn, *http.Response, error) {
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	return dialer.Dial(wsBase+"?role=user", nil)
+}
+
+func TestSubprotocolNegotiated(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.upgrader.Subprotocols = parseList("radiogaga.v2, radiogaga.v1")
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	conn, _, err := dialSubprotocols(wsBase, "radiogaga.v3", "radiogaga.v1")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if got := conn.Subprotocol(); got != "radiogaga.v1" {
+		t.Fatalf("expected radiogaga.v1, got %q", got)
+	}
+	if err := conn.WriteJSON(IncomingMessage{Token: makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)}); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	waitForUsers(t, chat, 1)
+
+	chat.mutex.Lock()
+	client := chat.rooms[DefaultRoom].users["12345"]
+	chat.mutex.Unlock()
+	if client.protocol != "radiogaga.v1" {
+		t.Fatalf("expected client protocol radiogaga.v1, got %q", client.protocol)
+	}
+}
+
+func TestUnsupportedSubprotocolRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.upgrader.Subprotocols = []string{"radiogaga.v2"}
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	_, resp, err := dialSubprotocols(wsBase, "radiogaga.v1")
+	if err == nil {
+		t.Fatal("expected dial error for unsupported subprotocol")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got: %+v, err=%v", resp, err)
+	}
+
+	// Clients that do not ask for a subprotocol are still accepted
+	conn, _, err := dialSubprotocols(wsBase)
+	if err != nil {
+		t.Fatalf("dial without subprotocol: %v", err)
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jwtCacheTTL is how long a verified token is trusted without checking its
+// signature again, 0 disables the cache.
+var jwtCacheTTL = Duration("RADIO_JWT_CACHE_TTL", 30*time.Second)
+
+// tokenCachePruneEvery is how many stores go by between sweeps of stale
+// entries.
+const tokenCachePruneEvery = 1024
+
+// tokenCache remembers verified tokens, so a burst of connections with the
+// same token costs one signature check. Only tokens that passed verification
+// are stored, and never past their exp claim.
+type tokenCache struct {
+	ttl     time.Duration
+	entries sync.Map // token string -> tokenCacheEntry
+	stores  atomic.Uint64
+}
+
+type tokenCacheEntry struct {
+	claims   *GEWISClaims
+	cachedAt time.Time
+}
+
+// fresh reports whether the entry may still be used at now.
+func (e tokenCacheEntry) fresh(now time.Time, ttl time.Duration) bool {
+	if now.Sub(e.cachedAt) >= ttl {
+		return false
+	}
+	return e.claims.ExpiresAt == nil || now.Before(e.claims.ExpiresAt.Time)
+}
+
+// get returns a copy of the claims of a fresh entry for the token.
+func (tc *tokenCache) get(tokenStr string, now time.Time) (*GEWISClaims, bool) {
+	if tc.ttl <= 0 {
+		return nil, false
+	}
+	v, ok := tc.entries.Load(tokenStr)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(tokenCacheEntry)
+	if !entry.fresh(now, tc.ttl) {
+		tc.entries.CompareAndDelete(tokenStr, v)
+		return nil, false
+	}
+	claims := *entry.claims
+	return &claims, true
+}
+
+// put stores the verified claims of the token, unless it already expired.
+func (tc *tokenCache) put(tokenStr string, claims *GEWISClaims, now time.Time) {
+	if tc.ttl <= 0 || (claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Time)) {
+		return
+	}
+	stored := *claims
+	tc.entries.Store(tokenStr, tokenCacheEntry{claims: &stored, cachedAt: now})
+	if tc.stores.Add(1)%tokenCachePruneEvery == 0 {
+		tc.prune(now)
+	}
+}
+
+// prune drops the entries that are no longer fresh, so tokens seen once do
+// not pile up.
+func (tc *tokenCache) prune(now time.Time) {
+	tc.entries.Range(func(k, v any) bool {
+		if !v.(tokenCacheEntry).fresh(now, tc.ttl) {
+			tc.entries.CompareAndDelete(k, v)
+		}
+		return true
+	})
+}
@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenCache(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)
+
+	first, err := chat.verifyGEWISTokenHandshake(tok)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	// A hit skips the signature, so a changed secret goes unnoticed
+	WithSecret("rotated")(chat)
+	second, err := chat.verifyGEWISTokenHandshake(tok)
+	if err != nil || second.Lidnr != 12345 {
+		t.Fatalf("expected a cache hit, got %+v (%v)", second, err)
+	}
+	second.GivenName = "Mallory"
+	if first.GivenName != "Alice" {
+		t.Fatal("cache hits must not share claims")
+	}
+
+	// Stale entries are verified again
+	now := time.Now()
+	if _, ok := chat.tokenCache.get(tok, now.Add(chat.tokenCache.ttl)); ok {
+		t.Fatal("expected the entry to go stale after the TTL")
+	}
+	if _, err := chat.verifyGEWISTokenHandshake(tok); err == nil {
+		t.Fatal("expected the token to be verified with the rotated secret")
+	}
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.tokenExpiry = TokenExpiryWarn
+
+	// Expired tokens are never stored
+	expired := makeToken(t, GEWISSecret, 12345, "Alice", "User", -time.Minute)
+	if _, err := chat.verifyGEWISTokenHandshake(expired); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, ok := chat.tokenCache.entries.Load(expired); ok {
+		t.Fatal("expected no cache entry for an expired token")
+	}
+
+	// Nor used past their exp claim, even within the TTL
+	tok := makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Second)
+	claims, err := chat.verifyGEWISTokenHandshake(tok)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, ok := chat.tokenCache.get(tok, claims.ExpiresAt.Time); ok {
+		t.Fatal("expected no hit at the token's expiry")
+	}
+
+	chat.tokenCache.ttl = 0
+	fresh := makeToken(t, GEWISSecret, 12346, "Bob", "User", time.Minute)
+	if _, err := chat.verifyGEWISTokenHandshake(fresh); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if _, ok := chat.tokenCache.entries.Load(fresh); ok {
+		t.Fatal("expected no caching with a TTL of 0")
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Required token issuer and audience, so tokens minted by other apps sharing
+// GEWISSecret are refused. Empty accepts any.
+var (
+	tokenRequiredIssuer   = String("TOKEN_REQUIRED_ISSUER", "")
+	tokenRequiredAudience = String("TOKEN_REQUIRED_AUDIENCE", "")
+)
+
+// placeholderGivenName is shown for members whose token has no given name.
+const placeholderGivenName = "GEWIS member"
+
+var (
+	ErrTokenIssuer   = errors.New("token issuer not accepted")
+	ErrTokenAudience = errors.New("token audience not accepted")
+	ErrTokenLidnr    = errors.New("token has no valid lidnr")
+)
+
+// checkMember rejects claims without a lidnr, which would all share id "0"
+// and replace each other, and fills in a missing given name.
+func checkMember(claims *GEWISClaims) error {
+	if claims.Lidnr <= 0 {
+		log.Warn().Int("lidnr", claims.Lidnr).Str("sub", claims.Subject).Msg("token has no valid lidnr")
+		return ErrTokenLidnr
+	}
+	if strings.TrimSpace(claims.GivenName) == "" {
+		claims.GivenName = placeholderGivenName
+	}
+	return nil
+}
+
+// checkIssuerAudience rejects claims that do not match the required issuer or
+// audience. A missing claim never matches.
+func (c *Chat) checkIssuerAudience(claims *GEWISClaims) error {
+	if c.requiredIssuer != "" && claims.Issuer != c.requiredIssuer {
+		return ErrTokenIssuer
+	}
+	if c.requiredAudience != "" && !slices.Contains(claims.Audience, c.requiredAudience) {
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+// tokenCloseCode is the close code for a token refused at the handshake, or 0
+// to close without one.
+func tokenCloseCode(err error) int {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return CloseCodeTokenExpired
+	case errors.Is(err, ErrTokenIssuer), errors.Is(err, ErrTokenAudience), errors.Is(err, ErrTokenLidnr):
+		return CloseCodeTokenNotAccepted
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+)
+
+func makeTokenFor(t *testing.T, issuer string, audience ...string) string {
+	t.Helper()
+	claims := GEWISClaims{
+		Lidnr: 12345,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(GEWISSecret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return s
+}
+
+func TestTokenIssuerAudience(t *testing.T) {
+	GEWISSecret = "testsecret"
+	tests := []struct {
+		name     string
+		issuer   string
+		audience string
+		token    string
+		want     error
+	}{
+		{"not required", "", "", makeTokenFor(t, "other-app", "other-app"), nil},
+		{"correct", "gewis", "radiogaga", makeTokenFor(t, "gewis", "website", "radiogaga"), nil},
+		{"wrong issuer", "gewis", "", makeTokenFor(t, "other-app"), ErrTokenIssuer},
+		{"missing issuer", "gewis", "", makeTokenFor(t, ""), ErrTokenIssuer},
+		{"wrong audience", "", "radiogaga", makeTokenFor(t, "gewis", "other-app"), ErrTokenAudience},
+		{"missing audience", "", "radiogaga", makeTokenFor(t, "gewis"), ErrTokenAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := New()
+			chat.requiredIssuer = tt.issuer
+			chat.requiredAudience = tt.audience
+			if _, err := chat.verifyGEWISTokenHandshake(tt.token); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestTokenNotAcceptedHandshakeCloses(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.requiredIssuer = "gewis"
+
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	conn := dialHandshake(t, wsBase, "user", makeTokenFor(t, "other-app"), "")
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, CloseCodeTokenNotAccepted) {
+		t.Fatalf("expected close code %d, got: %v", CloseCodeTokenNotAccepted, err)
+	}
+}
+
+func TestTokenWithoutLidnrRejected(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	withoutLidnr, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"sub":        "alice",
+		"given_name": "Alice",
+		"exp":        time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(GEWISSecret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"missing lidnr": withoutLidnr,
+		"lidnr 0":       makeToken(t, GEWISSecret, 0, "Alice", "User", time.Minute),
+	} {
+		if _, err := chat.verifyGEWISTokenHandshake(token); !errors.Is(err, ErrTokenLidnr) {
+			t.Errorf("%s: expected %v, got %v", name, ErrTokenLidnr, err)
+		}
+		conn := dialHandshake(t, wsBase, "user", token, "")
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, CloseCodeTokenNotAccepted) {
+			t.Errorf("%s: expected close code %d, got: %v", name, CloseCodeTokenNotAccepted, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestTokenWithoutGivenNameGetsPlaceholder(t *testing.T) {
+	GEWISSecret = "testsecret"
+	claims, err := New().verifyGEWISTokenHandshake(makeToken(t, GEWISSecret, 12345, " ", "User", time.Minute))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.GivenName != placeholderGivenName {
+		t.Fatalf("expected placeholder given name, got %q", claims.GivenName)
+	}
+}
+
+func TestTokenEmailClaim(t *testing.T) {
+	chat := New(WithSecret("testsecret"))
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS512, GEWISClaims{
+		Lidnr:            12345,
+		Email:            "alice@gewis.nl",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}).SignedString([]byte("testsecret"))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	claims, err := chat.verifyGEWISTokenHandshake(tok)
+	if err != nil || claims.Email != "alice@gewis.nl" {
+		t.Fatalf("expected the email claim, got %+v (%v)", claims, err)
+	}
+}
+
+func TestDispatchEmail(t *testing.T) {
+	for _, include := range []bool{false, true} {
+		chat := New()
+		chat.includeEmail = include
+		chat.history = NewHistory(10)
+		user := &Client{role: "user", id: "12345", givenName: "Alice", email: "alice@gewis.nl", room: DefaultRoom}
+		if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "hi"}); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+		msgs := chat.history.Since("", 0, nil)
+		want := ""
+		if include {
+			want = "alice@gewis.nl"
+		}
+		if len(msgs) != 1 || msgs[0].Email != want {
+			t.Fatalf("RADIO_INCLUDE_EMAIL=%v: expected email %q, got: %+v", include, want, msgs)
+		}
+		data := chat.style.marshal(msgs[0])
+		if strings.Contains(string(data), `"email"`) != include {
+			t.Fatalf("RADIO_INCLUDE_EMAIL=%v: unexpected encoding %s", include, data)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TokenExpiryMode controls what happens to GEWIS tokens past their exp claim.
+type TokenExpiryMode string
+
+const (
+	TokenExpiryOff     TokenExpiryMode = "off"     // accept silently
+	TokenExpiryWarn    TokenExpiryMode = "warn"    // accept and log
+	TokenExpiryEnforce TokenExpiryMode = "enforce" // reject, allowing for the leeway
+)
+
+var (
+	ErrTokenExpired       = errors.New("token expired")
+	ErrTokenLidnrMismatch = errors.New("refreshed token belongs to another member")
+)
+
+var (
+	tokenValidateExpiry     = String("TOKEN_VALIDATE_EXPIRY", string(TokenExpiryWarn))
+	tokenExpiryLeeway       = Duration("TOKEN_EXPIRY_LEEWAY", 0)
+	tokenRevalidateInterval = Duration("TOKEN_REVALIDATE_INTERVAL", 0)
+	tokenRefreshGrace       = Duration("TOKEN_REFRESH_GRACE", time.Minute)
+)
+
+func ParseTokenExpiryMode(s string) (TokenExpiryMode, error) {
+	switch m := TokenExpiryMode(s); m {
+	case TokenExpiryOff, TokenExpiryWarn, TokenExpiryEnforce:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown token expiry mode %q, expected off, warn or enforce", s)
+}
+
+// tokenExpired reports whether the claims are past their expiry at now,
+// allowing for the leeway. Tokens without exp never expire.
+func tokenExpired(claims *GEWISClaims, now time.Time, leeway time.Duration) bool {
+	return claims.ExpiresAt != nil && now.After(claims.ExpiresAt.Add(leeway))
+}
+
+// tokenErrorMessage is the error returned to HTTP clients for a rejected token.
+func tokenErrorMessage(err error) string {
+	if errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenLidnrMismatch) ||
+		errors.Is(err, ErrTokenIssuer) || errors.Is(err, ErrTokenAudience) || errors.Is(err, ErrTokenLidnr) {
+		return err.Error()
+	}
+	return "invalid token"
+}
+
+// revalidateToken periodically verifies the client's token while it is
+// connected. When it no longer verifies, the client gets a token_expiring
+// frame and has the grace period to send a token_refresh, after which it is
+// closed with CloseCodeTokenExpired.
+func (c *Chat) revalidateToken(client *Client) {
+	ticker := time.NewTicker(c.revalidate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-ticker.C:
+		}
+		if c.tokenValid(client) {
+			continue
+		}
+
+		client.log.Info().Time("expired_at", client.tokenExpiry()).Msg("token no longer valid, asking for refresh")
+		c.sendNotice(client, MessageTypeTokenExpiring, fmt.Sprintf("token expired, send token_refresh within %s", c.refreshGrace))
+		grace := time.NewTimer(c.refreshGrace)
+		select {
+		case <-client.done:
+			grace.Stop()
+			return
+		case <-grace.C:
+		}
+		if !c.tokenValid(client) {
+			client.log.Info().Msg("closing connection: token not refreshed")
+			client.closeWith(CloseCodeTokenExpired, CloseReason(CloseCodeTokenExpired))
+			return
+		}
+	}
+}
+
+func (c *Chat) tokenValid(client *Client) bool {
+	client.tokenMu.Lock()
+	token := client.token
+	client.tokenMu.Unlock()
+	_, err := c.verifyGEWISTokenHandshake(token)
+	return err == nil
+}
+
+// refreshToken replaces the client's token with a newer one of the same
+// member, keeping the connection open.
+func (c *Chat) refreshToken(client *Client, in IncomingMessage) error {
+	claims, err := c.verifyGEWISTokenHandshake(in.Token)
+	if err == nil && strconv.Itoa(claims.Lidnr) != client.id {
+		err = ErrTokenLidnrMismatch
+	}
+	if err != nil {
+		c.sendNotice(client, MessageTypeError, tokenErrorMessage(err))
+		return err
+	}
+	client.setToken(in.Token, claims)
+	client.log.Debug().Msg("token refreshed")
+	return nil
+}
+
+func (cl *Client) setToken(token string, claims *GEWISClaims) {
+	cl.tokenMu.Lock()
+	defer cl.tokenMu.Unlock()
+	cl.token = token
+	cl.tokenExpiresAt = time.Time{}
+	if claims.ExpiresAt != nil {
+		cl.tokenExpiresAt = claims.ExpiresAt.Time
+	}
+}
+
+func (cl *Client) tokenExpiry() time.Time {
+	cl.tokenMu.Lock()
+	defer cl.tokenMu.Unlock()
+	return cl.tokenExpiresAt
+}
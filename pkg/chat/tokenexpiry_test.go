@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTokenExpiryModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     TokenExpiryMode
+		leeway   time.Duration
+		ttl      time.Duration
+		rejected bool
+	}{
+		{"off expired", TokenExpiryOff, 0, -time.Minute, false},
+		{"off valid", TokenExpiryOff, 0, time.Minute, false},
+		{"warn expired", TokenExpiryWarn, 0, -time.Minute, false},
+		{"warn valid", TokenExpiryWarn, 0, time.Minute, false},
+		{"enforce expired", TokenExpiryEnforce, 0, -time.Minute, true},
+		{"enforce valid", TokenExpiryEnforce, 0, time.Minute, false},
+		{"enforce within leeway", TokenExpiryEnforce, 2 * time.Minute, -time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			GEWISSecret = "testsecret"
+			chat := New()
+			chat.tokenExpiry = tt.mode
+			chat.tokenLeeway = tt.leeway
+
+			srv, wsBase := startTestServer(t, chat)
+			defer srv.Close()
+
+			conn := dialHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", tt.ttl), "")
+			defer conn.Close()
+
+			if !tt.rejected {
+				waitForUsers(t, chat, 1)
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, _, err := conn.ReadMessage()
+			if !websocket.IsCloseError(err, CloseCodeTokenExpired) {
+				t.Fatalf("expected close code %d, got: %v", CloseCodeTokenExpired, err)
+			}
+		})
+	}
+}
+
+func TestParseTokenExpiryMode(t *testing.T) {
+	for _, s := range []string{"off", "warn", "enforce"} {
+		if m, err := ParseTokenExpiryMode(s); err != nil || string(m) != s {
+			t.Errorf("ParseTokenExpiryMode(%q) = %q, %v", s, m, err)
+		}
+	}
+	if _, err := ParseTokenExpiryMode("strict"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestInvalidTokenExpiryMode(t *testing.T) {
+	prev := tokenValidateExpiry
+	defer func() { tokenValidateExpiry = prev }()
+	tokenValidateExpiry = "strict"
+
+	if chat := New(); chat.tokenExpiry != TokenExpiryEnforce {
+		t.Fatalf("expected expired tokens to be refused, got %q", chat.tokenExpiry)
+	}
+	var fatal bool
+	for _, p := range CheckEnv() {
+		fatal = fatal || p.Setting == "TOKEN_VALIDATE_EXPIRY" && p.Fatal
+	}
+	if !fatal {
+		t.Fatal("expected the mode to refuse startup")
+	}
+}
+
+// startRevalidatingChat connects user 12345 with a token that expires within
+// a second to a chat that revalidates tokens every 50ms.
+func startRevalidatingChat(t *testing.T) (*Chat, *websocket.Conn) {
+	t.Helper()
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.tokenExpiry = TokenExpiryEnforce
+	chat.revalidate = 50 * time.Millisecond
+	chat.refreshGrace = 300 * time.Millisecond
+
+	srv, wsBase := startTestServer(t, chat)
+	t.Cleanup(srv.Close)
+	conn := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Second), "")
+	t.Cleanup(func() { _ = conn.Close() })
+	waitForUsers(t, chat, 1)
+
+	out, err := readJSONWithDeadline[OutgoingMessage](t, conn, 3*time.Second)
+	if err != nil || out.Type != MessageTypeTokenExpiring {
+		t.Fatalf("expected token_expiring, got: %+v (%v)", out, err)
+	}
+	return chat, conn
+}
+
+func expectTokenExpiredClose(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseCodeTokenExpired) {
+			t.Fatalf("expected close code %d, got: %v", CloseCodeTokenExpired, err)
+		}
+		return
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	chat, conn := startRevalidatingChat(t)
+
+	refresh := IncomingMessage{Type: MessageTypeTokenRefresh, Token: makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)}
+	if err := conn.WriteJSON(refresh); err != nil {
+		t.Fatalf("write refresh: %v", err)
+	}
+	if out, err := readJSONWithDeadline[OutgoingMessage](t, conn, time.Second); err == nil {
+		t.Fatalf("expected the connection to stay quiet, got: %+v", out)
+	}
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected user to stay connected, got %d users", n)
+	}
+}
+
+func TestTokenRefreshLidnrMismatch(t *testing.T) {
+	_, conn := startRevalidatingChat(t)
+
+	refresh := IncomingMessage{Type: MessageTypeTokenRefresh, Token: makeToken(t, GEWISSecret, 54321, "Mallory", "User", time.Minute)}
+	if err := conn.WriteJSON(refresh); err != nil {
+		t.Fatalf("write refresh: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, conn, time.Second)
+	if err != nil || out.Type != MessageTypeError || out.Content != ErrTokenLidnrMismatch.Error() {
+		t.Fatalf("expected mismatch error, got: %+v (%v)", out, err)
+	}
+	expectTokenExpiredClose(t, conn)
+}
+
+func TestTokenNotRefreshedCloses(t *testing.T) {
+	_, conn := startRevalidatingChat(t)
+	expectTokenExpiredClose(t, conn)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "radiogaga"
+
+// Span attributes of the message path.
+const (
+	attrRole        = attribute.Key("chat.role")
+	attrRoom        = attribute.Key("chat.room")
+	attrMessageID   = attribute.Key("chat.message.id")
+	attrPayloadSize = attribute.Key("chat.payload.size")
+	attrRecipients  = attribute.Key("chat.recipients")
+	attrRecipient   = attribute.Key("chat.recipient")
+)
+
+// SetupTracing exports spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is
+// set, configured by the standard OTEL_* variables. Otherwise the global
+// no-op provider stays in place. The returned function flushes pending spans.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(tracerName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// WithTracerProvider traces the message path with the provider instead of the
+// global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Chat) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// TraceHandler wraps an HTTP handler in a server span named after the path.
+func TraceHandler(h http.Handler, opts ...otelhttp.Option) http.Handler {
+	opts = append(opts, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	}))
+	return otelhttp.NewHandler(h, "http", opts...)
+}
+
+// traceFrame starts the span of a frame received from the client, linked to
+// the request that opened the connection.
+func (c *Chat) traceFrame(client *Client, size int) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attrRole.String(client.role),
+			attrRoom.String(client.room),
+			attrPayloadSize.Int(size),
+		),
+	}
+	if client.upgrade.SpanContext.IsValid() {
+		opts = append(opts, trace.WithLinks(client.upgrade))
+	}
+	return c.tracer.Start(context.Background(), "chat.receive", opts...)
+}
+
+// traceDeliver starts the span of a delivery to local clients.
+func (c *Chat) traceDeliver(ctx context.Context, msg OutgoingMessage, size int) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "chat.deliver", trace.WithAttributes(
+		attrMessageID.String(msg.ID),
+		attrRoom.String(msg.Room),
+		attrPayloadSize.Int(size),
+	))
+}
+
+// traceWrite wraps handing the message to a single recipient in a span. A
+// delivery that is not recorded gets no write spans, which would not be
+// recorded either and cost several allocations per recipient.
+func (c *Chat) traceWrite(ctx context.Context, recipient *Client, send func(*Client, []byte) error, data []byte) error {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return send(recipient, data)
+	}
+	_, span := c.tracer.Start(ctx, "chat.write", trace.WithAttributes(
+		attrRole.String(recipient.role),
+		attrRecipient.String(recipient.id),
+	))
+	defer span.End()
+	err := send(recipient, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "write failed")
+	}
+	return err
+}
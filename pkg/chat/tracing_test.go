@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceUserToRadio(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	chat := New(WithTracerProvider(tp))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", chat.HandleWS)
+	srv := httptest.NewServer(TraceHandler(mux, otelhttp.WithTracerProvider(tp)))
+	defer srv.Close()
+	wsBase := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	user, radio := connectUserAndRadio(t, chat, wsBase)
+	defer user.Close()
+	defer radio.Close()
+
+	if err := user.WriteJSON(IncomingMessage{Content: "hello studio"}); err != nil {
+		t.Fatalf("user write: %v", err)
+	}
+	out, err := readJSONWithDeadline[OutgoingMessage](t, radio, 2*time.Second)
+	if err != nil {
+		t.Fatalf("radio read: %v", err)
+	}
+
+	// The frame span ends after dispatch returns, wait for it
+	var receive tracetest.SpanStub
+	deadline := time.Now().Add(2 * time.Second)
+	for receive.Name == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for chat.receive span")
+		}
+		for _, s := range exporter.GetSpans() {
+			if s.Name == "chat.receive" && spanAttr(s, attrRole).AsString() == "user" {
+				receive = s
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := spanAttr(receive, attrMessageID).AsString(); got != out.ID {
+		t.Fatalf("expected message ID %q on receive span, got %q", out.ID, got)
+	}
+	if spanAttr(receive, attrPayloadSize).AsInt64() == 0 {
+		t.Fatal("expected payload size on receive span")
+	}
+
+	spans := exporter.GetSpans()
+	var deliver, write tracetest.SpanStub
+	for _, s := range spans {
+		switch {
+		case s.Name == "chat.deliver" && s.Parent.SpanID() == receive.SpanContext.SpanID():
+			deliver = s
+		case s.Name == "chat.write":
+			write = s
+		}
+	}
+	if deliver.Name == "" {
+		t.Fatalf("expected chat.deliver span under chat.receive, got: %v", spans.Snapshots())
+	}
+	if got := spanAttr(deliver, attrRecipients).AsInt64(); got != 1 {
+		t.Fatalf("expected 1 recipient, got %d", got)
+	}
+	if write.Parent.SpanID() != deliver.SpanContext.SpanID() || spanAttr(write, attrRole).AsString() != "radio" {
+		t.Fatalf("expected chat.write to the radio under chat.deliver, got: %+v", write)
+	}
+
+	// The frame links to the upgrade request of the user's connection
+	if len(receive.Links) != 1 {
+		t.Fatalf("expected a link to the upgrade request, got: %v", receive.Links)
+	}
+	var upgrade bool
+	for _, s := range spans {
+		if s.SpanContext.SpanID() == receive.Links[0].SpanContext.SpanID() {
+			upgrade = s.Name == "GET /ws"
+		}
+	}
+	if !upgrade {
+		t.Fatal("expected link to the GET /ws span")
+	}
+}
@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultUserHistoryLimit = 50
+	maxUserHistoryLimit     = 500
+)
+
+// UserHistoryResponse is a page of the messages sent by a single user.
+type UserHistoryResponse struct {
+	Messages     []OutgoingMessage `json:"messages"`
+	NextBeforeID string            `json:"nextBeforeId,omitempty" description:"before_id of the next, older page, absent on the last page"`
+}
+
+// UserErasure is the result of erasing a user's messages.
+type UserErasure struct {
+	Deleted int64 `json:"deleted" description:"Messages erased, from the message store if one is configured"`
+}
+
+// HandleUserHistory returns the last messages a user sent that are still in
+// the store, or in the history without one, oldest first, limited by ?limit=
+// and paginated backwards with ?before_id=. DELETE erases the messages sent by
+// or to the user, for GDPR requests. Requires the admin key.
+func (c *Chat) HandleUserHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !authorized(r, c.adminKey) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin key")
+		return
+	}
+	id := r.PathValue("id")
+	if r.Method == http.MethodDelete {
+		n, err := c.EraseUser(r.Context(), id)
+		if err != nil {
+			requestLogger(r.Context()).Error().Err(err).Str("user", id).Msg("could not erase user")
+			writeError(w, http.StatusInternalServerError, "could not erase messages")
+			return
+		}
+		c.audit(ActorAdminKey, "eraseuser", id, nil)
+		writeJSON(w, http.StatusOK, UserErasure{Deleted: n})
+		return
+	}
+
+	limit := defaultUserHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxUserHistoryLimit)
+	}
+
+	// One extra message tells whether there is an older page
+	before := r.URL.Query().Get("before_id")
+	var messages []OutgoingMessage
+	if c.store != nil {
+		var err error
+		if messages, err = c.store.Query(r.Context(), StoreQuery{Lidnr: id, BeforeID: before, Limit: limit + 1}); err != nil {
+			requestLogger(r.Context()).Error().Err(err).Msg("could not query message store")
+			writeError(w, http.StatusInternalServerError, "could not read messages")
+			return
+		}
+	} else {
+		messages = c.history.Before(before, limit+1, func(_ string, msg OutgoingMessage) bool {
+			return msg.From == id
+		})
+	}
+	if len(messages) == 0 {
+		writeError(w, http.StatusNotFound, "no messages from this user")
+		return
+	}
+	var resp UserHistoryResponse
+	if len(messages) > limit {
+		messages = messages[1:]
+		resp.NextBeforeID = messages[0].ID
+	}
+	resp.Messages = messages
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func userHistory(t *testing.T, chat *Chat, id, query string) (int, UserHistoryResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/history/users/"+id+query, nil)
+	req.SetPathValue("id", id)
+	req.Header.Set("Authorization", "Bearer "+RADIOAdminKey)
+	rec := httptest.NewRecorder()
+	chat.HandleUserHistory(rec, req)
+
+	var resp UserHistoryResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+// addMessages adds n messages from each sender to the history, alternating
+// between them.
+func addMessages(chat *Chat, n int, senders ...string) {
+	for i := range n {
+		for _, from := range senders {
+			chat.history.Add("user", OutgoingMessage{
+				ID:      chat.nextMessageID(),
+				SentAt:  time.Now(),
+				From:    from,
+				Content: from + " " + strconv.Itoa(i),
+				Room:    DefaultRoom,
+			})
+		}
+	}
+}
+
+func TestUserHistoryFilter(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	addMessages(chat, 3, "12345", "22222")
+
+	code, resp := userHistory(t, chat, "12345", "")
+	if code != http.StatusOK || len(resp.Messages) != 3 || resp.NextBeforeID != "" {
+		t.Fatalf("expected the 3 messages of 12345 on one page, got %d: %+v", code, resp)
+	}
+	for i, msg := range resp.Messages {
+		if msg.From != "12345" || msg.Content != "12345 "+strconv.Itoa(i) {
+			t.Fatalf("expected message %d of 12345, got: %+v", i, msg)
+		}
+	}
+	if code, _ := userHistory(t, chat, "33333", ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a user without messages, got %d", code)
+	}
+}
+
+func TestUserHistoryPagination(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	addMessages(chat, 5, "12345", "22222")
+
+	code, page := userHistory(t, chat, "12345", "?limit=2")
+	if code != http.StatusOK || len(page.Messages) != 2 || page.Messages[0].Content != "12345 3" || page.Messages[1].Content != "12345 4" {
+		t.Fatalf("expected the newest 2 messages, got %d: %+v", code, page)
+	}
+	var seen []string
+	for page.NextBeforeID != "" {
+		for _, msg := range page.Messages {
+			seen = append(seen, msg.Content)
+		}
+		before := page.NextBeforeID
+		if code, page = userHistory(t, chat, "12345", "?limit=2&before_id="+before); code != http.StatusOK {
+			t.Fatalf("expected a page before %s, got %d", before, code)
+		}
+	}
+	for _, msg := range page.Messages {
+		seen = append(seen, msg.Content)
+	}
+	if len(seen) != 5 || seen[4] != "12345 0" {
+		t.Fatalf("expected all 5 messages over the pages, got: %v", seen)
+	}
+
+	if code, _ := userHistory(t, chat, "12345", "?before_id="+page.Messages[0].ID); code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the oldest message, got %d", code)
+	}
+}
+
+func TestUserHistoryLimit(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	chat.history = NewHistory(1000)
+	addMessages(chat, 600, "12345")
+
+	_, resp := userHistory(t, chat, "12345", "")
+	if len(resp.Messages) != defaultUserHistoryLimit || resp.NextBeforeID == "" {
+		t.Fatalf("expected %d messages and a next page, got %d", defaultUserHistoryLimit, len(resp.Messages))
+	}
+	_, resp = userHistory(t, chat, "12345", "?limit=10000")
+	if len(resp.Messages) != maxUserHistoryLimit || resp.Messages[len(resp.Messages)-1].Content != "12345 599" {
+		t.Fatalf("expected the limit clamped to %d, got %d", maxUserHistoryLimit, len(resp.Messages))
+	}
+	for _, limit := range []string{"0", "-1", "many"} {
+		if code, _ := userHistory(t, chat, "12345", "?limit="+limit); code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for limit %s, got %d", limit, code)
+		}
+	}
+}
+
+func TestUserHistoryErase(t *testing.T) {
+	RADIOAdminKey = "admin"
+	defer func() { RADIOAdminKey = "" }()
+	chat := New()
+	chat.history = NewHistory(1000)
+	addMessages(chat, 2, "12345", "22222")
+
+	erase := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/history/users/12345", nil)
+		req.SetPathValue("id", "12345")
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		chat.HandleUserHistory(rec, req)
+		return rec
+	}
+	if rec := erase("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin key, got %d", rec.Code)
+	}
+	rec := erase(RADIOAdminKey)
+	var resp UserErasure
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK || resp.Deleted != 2 {
+		t.Fatalf("expected 2 messages deleted, got %d: %+v (%v)", rec.Code, resp, err)
+	}
+	if code, _ := userHistory(t, chat, "12345", ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after erasing, got %d", code)
+	}
+	if _, other := userHistory(t, chat, "22222", ""); len(other.Messages) != 2 {
+		t.Fatalf("expected the other user's message kept, got: %+v", other)
+	}
+}
@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Shortest secrets and keys not reported as weak by CheckEnv
+const (
+	minSecretLength = 32 // bytes of an HS512 secret
+	minKeyLength    = 16 // radio and admin keys
+)
+
+// ConfigProblem is a setting that is invalid or weak.
+type ConfigProblem struct {
+	Setting string // environment variable, or a description of several
+	Err     error
+	Fatal   bool // the server does not start with it, otherwise it falls back or runs with it
+}
+
+func (p ConfigProblem) Error() string {
+	return p.Setting + ": " + p.Err.Error()
+}
+
+// CheckEnv reports problems with the chat's settings from the environment:
+// modes, websocket timings and radio keys the chat cannot run with, and weak
+// secrets. It checks with the same parsers New
+// uses, without starting anything, so a configuration can be checked before a
+// deploy. Numbers, durations and booleans that could not be parsed are
+// reported by EnvProblems.
+func CheckEnv() []ConfigProblem {
+	var problems []ConfigProblem
+	warn := func(setting string, err error) {
+		problems = append(problems, ConfigProblem{Setting: setting, Err: err})
+	}
+	fatal := func(setting string, err error) {
+		problems = append(problems, ConfigProblem{Setting: setting, Err: err, Fatal: true})
+	}
+
+	// A typo in a mode would otherwise run the chat with its default
+	if _, err := ParseTokenExpiryMode(tokenValidateExpiry); err != nil {
+		fatal("TOKEN_VALIDATE_EXPIRY", err)
+	}
+	if _, err := ParseDisplayNameFormat(displayNameFormat); err != nil {
+		fatal("RADIO_DISPLAY_NAME_FORMAT", err)
+	}
+	if _, err := ParsePrivacyMode(chatPrivacyMode); err != nil {
+		fatal("CHAT_PRIVACY_MODE", err)
+	}
+	if err := wsConfig.Validate(); err != nil {
+		fatal("websocket settings", err)
+	}
+	if radioKeysErr != nil {
+		fatal("RADIO_CHAT_KEYS", radioKeysErr)
+	}
+
+	secretSetting := "GEWIS_SECRET"
+	if len(GEWISSecrets) > 0 {
+		secretSetting = "GEWIS_SECRETS"
+	}
+	for _, s := range defaultSecrets() {
+		if len(s.key) < minSecretLength {
+			warn(secretSetting, fmt.Errorf("secret%s is shorter than %d bytes", kidSuffix(s.kid), minSecretLength))
+		}
+	}
+	if len(RADIOChatKey) < minKeyLength {
+		warn("RADIO_CHAT_KEY", fmt.Errorf("key is shorter than %d characters", minKeyLength))
+	}
+	for _, id := range slices.Sorted(maps.Keys(RADIOChatKeys)) {
+		if len(RADIOChatKeys[id].Secret) < minKeyLength {
+			warn("RADIO_CHAT_KEYS", fmt.Errorf("key %q is shorter than %d characters", id, minKeyLength))
+		}
+	}
+	if RADIOAdminKey != "" && len(RADIOAdminKey) < minKeyLength {
+		warn("RADIO_ADMIN_KEY", fmt.Errorf("key is shorter than %d characters", minKeyLength))
+	}
+	return problems
+}
+
+func kidSuffix(kid string) string {
+	if kid == "" {
+		return ""
+	}
+	return fmt.Sprintf(" %q", kid)
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckEnv(t *testing.T) {
+	prevSecret, prevKey, prevAdmin, prevExpiry, prevWS := GEWISSecret, RADIOChatKey, RADIOAdminKey, tokenValidateExpiry, wsConfig
+	defer func() {
+		GEWISSecret, RADIOChatKey, RADIOAdminKey, tokenValidateExpiry, wsConfig = prevSecret, prevKey, prevAdmin, prevExpiry, prevWS
+	}()
+
+	GEWISSecret = strings.Repeat("s", minSecretLength)
+	RADIOChatKey = strings.Repeat("k", minKeyLength)
+	RADIOAdminKey = ""
+	if problems := CheckEnv(); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	GEWISSecret = "ChangeMe"
+	RADIOChatKey = "ChangeMe"
+	RADIOAdminKey = "admin"
+	tokenValidateExpiry = "sometimes"
+	wsConfig.PingPeriod = wsConfig.PongWait
+	problems := CheckEnv()
+	var settings []string
+	fatal := map[string]bool{}
+	for _, p := range problems {
+		settings = append(settings, p.Setting)
+		fatal[p.Setting] = p.Fatal
+	}
+	want := []string{"TOKEN_VALIDATE_EXPIRY", "websocket settings", "GEWIS_SECRET", "RADIO_CHAT_KEY", "RADIO_ADMIN_KEY"}
+	if !slices.Equal(settings, want) {
+		t.Fatalf("expected problems with %v, got %v", want, problems)
+	}
+	if !fatal["websocket settings"] || !fatal["TOKEN_VALIDATE_EXPIRY"] || fatal["GEWIS_SECRET"] {
+		t.Fatalf("unexpected severities: %v", fatal)
+	}
+}
+
+func TestEnvProblems(t *testing.T) {
+	t.Setenv("RADIO_TEST_DURATION", "5 minutes")
+	t.Setenv("RADIO_TEST_INT", "ten")
+	if d := Duration("RADIO_TEST_DURATION", time.Second); d != time.Second {
+		t.Fatalf("expected the default, got %v", d)
+	}
+	Int("RADIO_TEST_INT", 10)
+
+	var found []string
+	for _, p := range EnvProblems() {
+		if strings.HasPrefix(p.Setting, "RADIO_TEST_") {
+			found = append(found, p.Error())
+		}
+	}
+	want := []string{
+		`RADIO_TEST_DURATION: invalid duration "5 minutes", using the default`,
+		`RADIO_TEST_INT: invalid integer "ten", using the default`,
+	}
+	if !slices.Equal(found, want) {
+		t.Fatalf("expected %v, got %v", want, found)
+	}
+}
+
+func TestParseRadioKeysInvalid(t *testing.T) {
+	if _, err := parseRadioKeys(`{"studio": "s3cret"}`); err == nil {
+		t.Fatal("expected an error for keys that are not objects")
+	}
+}
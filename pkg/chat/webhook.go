@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body.
+const SignatureHeader = "X-Radiogaga-Signature"
+
+type WebhookConfig struct {
+	URL       string
+	Secret    string        // HMAC secret for the signature header
+	QueueSize int           // deliveries waiting for the worker
+	Timeout   time.Duration // per request
+	Retries   int           // retries after the first attempt
+	Backoff   time.Duration // initial retry delay, doubled on every retry
+	Reporter  ErrorReporter // receives deliveries that failed after all retries
+}
+
+// WebhookPayload is the body POSTed for every user message.
+type WebhookPayload struct {
+	ID         string    `json:"id"`
+	From       string    `json:"from"`
+	GivenName  string    `json:"given_name"`
+	FamilyName string    `json:"family_name"`
+	Content    string    `json:"content"`
+	SentAt     time.Time `json:"sentAt"`
+}
+
+// Webhook mirrors user messages to an external URL from a background worker,
+// so a slow or failing receiver never delays dispatch.
+type Webhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+	queue  chan WebhookPayload
+	done   chan struct{}
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+func NewWebhook(cfg WebhookConfig) *Webhook {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	if cfg.Reporter == nil {
+		cfg.Reporter = nopReporter{}
+	}
+	w := &Webhook{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan WebhookPayload, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Enqueue schedules a message for delivery, dropping it if the queue is full.
+func (w *Webhook) Enqueue(msg OutgoingMessage) {
+	p := WebhookPayload{
+		ID:         msg.ID,
+		From:       msg.From,
+		GivenName:  msg.GivenName,
+		FamilyName: msg.FamilyName,
+		Content:    msg.Content,
+		SentAt:     msg.SentAt,
+	}
+	select {
+	case w.queue <- p:
+	default:
+		w.dropped.Add(1)
+		log.Warn().Str("id", p.ID).Msg("webhook queue full, dropping message")
+	}
+}
+
+// Close stops the worker after the queued deliveries have been attempted.
+func (w *Webhook) Close() {
+	close(w.queue)
+	<-w.done
+}
+
+func (w *Webhook) Delivered() uint64 { return w.delivered.Load() }
+func (w *Webhook) Dropped() uint64   { return w.dropped.Load() }
+
+func (w *Webhook) run() {
+	defer close(w.done)
+	for p := range w.queue {
+		if err := w.deliverWithRetry(p); err != nil {
+			w.dropped.Add(1)
+			log.Warn().Err(err).Str("id", p.ID).Msg("webhook delivery failed, dropping message")
+			w.cfg.Reporter.Report(ErrorEvent{Kind: ErrorKindWebhook, Err: fmt.Errorf("message %s: %w", p.ID, err)})
+			continue
+		}
+		w.delivered.Add(1)
+	}
+}
+
+func (w *Webhook) deliverWithRetry(p WebhookPayload) error {
+	body, _ := json.Marshal(p)
+	backoff := w.cfg.Backoff
+
+	var err error
+	for attempt := 0; attempt <= w.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = w.deliver(body); err == nil || !retry {
+			return err
+		}
+		log.Debug().Err(err).Str("id", p.ID).Int("attempt", attempt+1).Msg("webhook delivery failed")
+	}
+	return err
+}
+
+// deliver POSTs the body once and reports whether a failure is worth retrying.
+func (w *Webhook) deliver(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+sign(w.cfg.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return false, nil
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// UseWebhook mirrors every user message to the webhook.
+func (c *Chat) UseWebhook(w *Webhook) {
+	c.webhook = w
+}
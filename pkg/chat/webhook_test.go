@@ -0,0 +1,132 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForCount(t *testing.T, get func() uint64, want uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for get() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for count %d, have %d", want, get())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDeliversSignedPayload(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook(WebhookConfig{URL: receiver.URL, Secret: "s3cret", QueueSize: 4, Timeout: time.Second})
+	defer webhook.Close()
+
+	chat := New()
+	chat.UseWebhook(webhook)
+	user := &Client{role: "user", id: "12345", givenName: "Alice", familyName: "User"}
+	if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "where is checkpoint 7?"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	var r *http.Request
+	var body []byte
+	select {
+	case r = <-received:
+		body = <-bodies
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for webhook")
+	}
+
+	var p WebhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if p.ID == "" || p.From != "12345" || p.GivenName != "Alice" || p.Content != "where is checkpoint 7?" || p.SentAt.IsZero() {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+	if got, want := r.Header.Get(SignatureHeader), "sha256="+sign("s3cret", body); got != want {
+		t.Fatalf("expected signature %q, got %q", want, got)
+	}
+	waitForCount(t, webhook.Delivered, 1)
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook(WebhookConfig{URL: receiver.URL, QueueSize: 4, Timeout: time.Second, Retries: 3, Backoff: time.Millisecond})
+	defer webhook.Close()
+
+	webhook.Enqueue(OutgoingMessage{ID: "1", Content: "hello"})
+
+	waitForCount(t, webhook.Delivered, 1)
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+	if webhook.Dropped() != 0 {
+		t.Fatalf("expected no drops, got %d", webhook.Dropped())
+	}
+}
+
+func TestWebhookRetriesExhausted(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook(WebhookConfig{URL: receiver.URL, QueueSize: 4, Timeout: time.Second, Retries: 1, Backoff: time.Millisecond})
+	defer webhook.Close()
+
+	webhook.Enqueue(OutgoingMessage{ID: "1", Content: "hello"})
+	waitForCount(t, webhook.Dropped, 1)
+}
+
+func TestWebhookQueueOverflow(t *testing.T) {
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook(WebhookConfig{URL: receiver.URL, QueueSize: 2, Timeout: 5 * time.Second})
+	defer webhook.Close()
+
+	chat := New()
+	chat.UseWebhook(webhook)
+	user := &Client{role: "user", id: "12345"}
+
+	// One in flight, two queued, the rest must be dropped without blocking
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if err := chat.dispatch(context.Background(), user, IncomingMessage{Content: "spam"}); err != nil {
+			t.Fatalf("dispatch: %v", err)
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("dispatch blocked on the webhook")
+	}
+	close(release)
+
+	if got := chat.Stats().WebhookDropped; got < 7 {
+		t.Fatalf("expected at least 7 dropped deliveries, got %d", got)
+	}
+}
@@ -0,0 +1,259 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	highPriorityQueueSize = 8
+	normalQueueSize       = 64
+)
+
+var errSendQueueFull = errors.New("send queue full")
+
+// startWriter sets up the send queues of a websocket client and starts the
+// goroutine draining them. It must be called before the client is registered.
+func (cl *Client) startWriter() {
+	cl.highPriorityQueue = make(chan []byte, highPriorityQueueSize)
+	cl.normalQueue = make(chan []byte, normalQueueSize)
+	cl.done = make(chan struct{})
+	cl.flushed = make(chan struct{})
+	cl.spawn(cl.writePump)
+}
+
+// stopWriter makes the writer flush what is queued and exit.
+func (cl *Client) stopWriter() {
+	if cl.done == nil {
+		return
+	}
+	cl.stopOnce.Do(func() { close(cl.done) })
+}
+
+// highPriority reports whether the message originates from the server rather
+// than from another member, such as announcements and notices.
+func highPriority(msg OutgoingMessage) bool {
+	switch msg.Type {
+	case MessageTypeSystem, MessageTypeUnpin, MessageTypeWarning, MessageTypeError, MessageTypeTokenExpiring:
+		return true
+	}
+	return false
+}
+
+// sendFunc returns the send method of a client matching the message priority.
+func sendFunc(msg OutgoingMessage) func(*Client, []byte) error {
+	if highPriority(msg) {
+		return (*Client).sendHighPriority
+	}
+	return (*Client).send
+}
+
+// overflowed is a message that found its queue full, see enqueue.
+type overflowed struct {
+	queue chan []byte
+	data  []byte
+}
+
+// enqueue hands the message to the writer without blocking, as it is called
+// while c.order is held. A message that finds its queue full is set aside
+// for drainOverflow, which waits for room, unless the client does not wait
+// or already has a queue's worth set aside. Such a client is treated as dead
+// by the caller.
+func (cl *Client) enqueue(queue chan []byte, data []byte) error {
+	cl.overflowMu.Lock()
+	defer cl.overflowMu.Unlock()
+	// Messages set aside for the same queue go first
+	if !slices.ContainsFunc(cl.overflow, func(o overflowed) bool { return o.queue == queue }) {
+		select {
+		case queue <- data:
+			return nil
+		default:
+		}
+	}
+	if cl.queueWait <= 0 || len(cl.overflow) >= normalQueueSize {
+		return errSendQueueFull
+	}
+	cl.overflow = append(cl.overflow, overflowed{queue: queue, data: data})
+	if !cl.draining {
+		cl.draining = true
+		go cl.drainOverflow()
+	}
+	return nil
+}
+
+// drainOverflow moves the messages set aside by enqueue into their queues as
+// the writer makes room. A writer that makes no room for queueWait is stuck,
+// and the client is terminated like after a failed write.
+func (cl *Client) drainOverflow() {
+	timer := time.NewTimer(cl.queueWait)
+	defer timer.Stop()
+	for {
+		cl.overflowMu.Lock()
+		if len(cl.overflow) == 0 {
+			cl.draining = false
+			cl.overflowMu.Unlock()
+			return
+		}
+		next := cl.overflow[0]
+		cl.overflowMu.Unlock()
+
+		select {
+		case next.queue <- next.data:
+			cl.overflowMu.Lock()
+			cl.overflow = cl.overflow[1:]
+			cl.overflowMu.Unlock()
+			timer.Reset(cl.queueWait)
+		case <-cl.flushed:
+			cl.dropOverflow()
+			return
+		case <-timer.C:
+			cl.log.Warn().Dur("wait", cl.queueWait).Msg("send queue stayed full, disconnecting")
+			cl.dropOverflow()
+			cl.terminate()
+			return
+		}
+	}
+}
+
+// dropOverflow forgets the messages set aside for a client that is gone.
+func (cl *Client) dropOverflow() {
+	cl.overflowMu.Lock()
+	defer cl.overflowMu.Unlock()
+	cl.overflow, cl.draining = nil, false
+}
+
+// writePump writes queued messages to the connection. High-priority messages,
+// such as notices and announcements, always go before normal chat traffic that
+// is still waiting.
+func (cl *Client) writePump() {
+	defer close(cl.flushed)
+	for {
+		select {
+		case data := <-cl.highPriorityQueue:
+			if !cl.write(data) {
+				return
+			}
+			continue
+		default:
+		}
+
+		select {
+		case data := <-cl.highPriorityQueue:
+			if !cl.write(data) {
+				return
+			}
+		case data := <-cl.normalQueue:
+			if !cl.write(data) {
+				return
+			}
+		case <-cl.done:
+			cl.flush()
+			return
+		}
+	}
+}
+
+// flush writes whatever is still queued, high priority first.
+func (cl *Client) flush() {
+	for _, queue := range []chan []byte{cl.highPriorityQueue, cl.normalQueue} {
+		for {
+			select {
+			case data := <-queue:
+				if !cl.write(data) {
+					return
+				}
+				continue
+			default:
+			}
+			break
+		}
+	}
+}
+
+// write reports whether the message was written, closing the connection on
+// failure so the read loop unregisters the client. Binary clients get
+// messages queued as JSON converted to MessagePack.
+func (cl *Client) write(data []byte) bool {
+	buf := getFrameBuffer()
+	defer putFrameBuffer(buf)
+	messageType := websocket.TextMessage
+	switch {
+	case !cl.binary:
+		data = cl.stamp(buf, data)
+	case len(data) > 0 && data[0] == '{':
+		encoded, err := encodeBinary(cl.stamp(buf, data), cl.style)
+		if err != nil {
+			cl.log.Warn().Err(err).Msg("could not encode binary frame, dropping message")
+			return true
+		}
+		data, messageType = encoded, websocket.BinaryMessage
+	default:
+		data, messageType = cl.stampBinary(buf, data), websocket.BinaryMessage
+	}
+	if err := cl.writeFrame(messageType, data); err != nil {
+		// Not retried: the connection keeps the first write error and
+		// returns it from every later write, so a retry cannot succeed.
+		cl.log.Debug().Err(err).Msg("write failed, closing connection")
+		_ = cl.conn.Close()
+		return false
+	}
+	wsWriteBytes.Add(float64(len(data)))
+	cl.trace.Trace().Int("bytes", len(data)).Msg("message written")
+	return true
+}
+
+// writeFrame writes a single frame, with the write deadline of the client's
+// role.
+func (cl *Client) writeFrame(messageType int, data []byte) error {
+	cl.writeMu.Lock()
+	defer cl.writeMu.Unlock()
+	_ = cl.conn.SetWriteDeadline(time.Now().Add(cl.timings().writeWait(cl.role)))
+	return cl.conn.WriteMessage(messageType, data)
+}
+
+// stamp adds the client's next sequence number to an encoded message, so the
+// client can detect messages it missed. Messages must be stamped in the order
+// they are written. The stamped message is written to buf, so it is only valid
+// until buf is reused. data itself is shared by every recipient of the message
+// and never changed.
+func (cl *Client) stamp(buf *bytes.Buffer, data []byte) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	buf.Reset()
+	buf.Grow(len(data) + 16)
+	buf.WriteString(`{"seq":`)
+	buf.Write(strconv.AppendUint(buf.AvailableBuffer(), cl.seq.Add(1), 10))
+	if rest := bytes.TrimSpace(data[1:]); len(rest) > 0 && rest[0] != '}' {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+	return buf.Bytes()
+}
+
+// maxPooledFrame is the largest buffer kept for reuse, so a single huge
+// message does not stay allocated.
+const maxPooledFrame = 64 << 10
+
+// frameBuffers holds the buffers messages are stamped into. Every recipient
+// of a message gets its own stamped copy, so reusing them saves an allocation
+// per recipient.
+var frameBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+func getFrameBuffer() *bytes.Buffer {
+	return frameBuffers.Get().(*bytes.Buffer)
+}
+
+// putFrameBuffer returns a buffer once what was stamped into it is written.
+func putFrameBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledFrame {
+		return
+	}
+	frameBuffers.Put(buf)
+}
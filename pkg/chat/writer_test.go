@@ -0,0 +1,243 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsPair returns the server and client side of a websocket connection.
+func wsPair(t testing.TB) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = peer.Close() })
+	select {
+	case conn := <-conns:
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn, peer
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for upgrade")
+	}
+	return nil, nil
+}
+
+func TestHighPriorityBypassesQueue(t *testing.T) {
+	conn, peer := wsPair(t)
+	client := &Client{
+		conn:              conn,
+		role:              "user",
+		id:                "12345",
+		room:              DefaultRoom,
+		highPriorityQueue: make(chan []byte, highPriorityQueueSize),
+		normalQueue:       make(chan []byte, normalQueueSize),
+		done:              make(chan struct{}),
+		flushed:           make(chan struct{}),
+	}
+
+	// Congest the normal queue before the writer runs
+	for i := 0; i < normalQueueSize; i++ {
+		if err := client.send([]byte(`{"type":"chat","content":"normal"}`)); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if err := client.send([]byte(`{}`)); err != errSendQueueFull {
+		t.Fatalf("expected full queue, got: %v", err)
+	}
+	if err := client.sendHighPriority([]byte(`{"type":"system","content":"urgent"}`)); err != nil {
+		t.Fatalf("send high priority: %v", err)
+	}
+	go client.writePump()
+	defer client.stopWriter()
+
+	first, err := readJSONWithDeadline[OutgoingMessage](t, peer, 2*time.Second)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if first.Type != MessageTypeSystem || first.Content != "urgent" {
+		t.Fatalf("expected high-priority message first, got: %+v", first)
+	}
+	for i := 0; i < normalQueueSize; i++ {
+		out, err := readJSONWithDeadline[OutgoingMessage](t, peer, 2*time.Second)
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if out.Content != "normal" {
+			t.Fatalf("expected queued normal message %d, got: %+v", i, out)
+		}
+	}
+}
+
+func TestSequenceNumbersContiguous(t *testing.T) {
+	conn, peer := wsPair(t)
+	client := &Client{conn: conn, role: "user", id: "12345", room: DefaultRoom}
+	client.startWriter()
+	defer client.stopWriter()
+
+	const senders, perSender = 10, 10
+	var wg sync.WaitGroup
+	for s := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perSender {
+				data := []byte(fmt.Sprintf(`{"type":"chat","content":"%d-%d"}`, s, i))
+				// Back off while the writer catches up instead of dropping
+				err := client.send(data)
+				for errors.Is(err, errSendQueueFull) {
+					time.Sleep(time.Millisecond)
+					err = client.send(data)
+				}
+				if err != nil {
+					t.Errorf("send: %v", err)
+				}
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+	for want := uint64(1); want <= senders*perSender; want++ {
+		out, err := readJSONWithDeadline[OutgoingMessage](t, peer, 2*time.Second)
+		if err != nil {
+			t.Fatalf("read %d: %v", want, err)
+		}
+		if out.SeqNum != want {
+			t.Fatalf("expected sequence number %d, got %d", want, out.SeqNum)
+		}
+		if seen[out.Content] {
+			t.Fatalf("message %q delivered twice", out.Content)
+		}
+		seen[out.Content] = true
+	}
+	wg.Wait()
+}
+
+func TestStampEmptyObject(t *testing.T) {
+	client := &Client{}
+	if got := string(client.stamp(new(bytes.Buffer), []byte(`{}`))); got != `{"seq":1}` {
+		t.Fatalf("unexpected stamp: %s", got)
+	}
+	if got := string(client.stamp(new(bytes.Buffer), []byte(`{"type":"chat"}`))); got != `{"seq":2,"type":"chat"}` {
+		t.Fatalf("unexpected stamp: %s", got)
+	}
+}
+
+func TestStampReusesBuffer(t *testing.T) {
+	client := &Client{}
+	buf := new(bytes.Buffer)
+	shared := []byte(`{"content":"hi"}`)
+	first := client.stamp(buf, shared)
+	if string(first) != `{"seq":1,"content":"hi"}` {
+		t.Fatalf("unexpected stamp: %s", first)
+	}
+	if second := client.stamp(buf, shared); string(second) != `{"seq":2,"content":"hi"}` || &second[0] != &first[0] {
+		t.Fatalf("expected the second stamp in the same buffer, got: %s", second)
+	}
+	if string(shared) != `{"content":"hi"}` {
+		t.Fatalf("expected the shared payload untouched, got: %s", shared)
+	}
+}
+
+// TestOrderedDelivery has many users send at once and checks the radio gets
+// their messages in ID order. CI runs it with -race.
+func TestOrderedDelivery(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	chat := New()
+	chat.resumeGrace = 0
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	// Dispatch must run in parallel to interleave, also on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(max(4, runtime.NumCPU())))
+	// A round fits in the radio's queue, which is not what this is testing
+	const senders, perSender, rounds = 16, normalQueueSize / 16, 5
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	users := make([]*websocket.Conn, senders)
+	for i := range users {
+		users[i] = dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 10000+i, "Alice", "User", time.Minute), "")
+		defer users[i].Close()
+	}
+	waitForRadios(t, chat, 1)
+	waitForUsers(t, chat, senders)
+
+	last := ""
+	for round := range rounds {
+		var wg sync.WaitGroup
+		for i, user := range users {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range perSender {
+					if err := user.WriteJSON(IncomingMessage{Content: fmt.Sprintf("message %d/%d from %d", round, j, i)}); err != nil {
+						t.Errorf("user write: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		for range senders * perSender {
+			msg, err := readJSONWithDeadline[OutgoingMessage](t, radio, 5*time.Second)
+			if err != nil {
+				t.Fatalf("radio read after %s: %v", last, err)
+			}
+			if msg.ID <= last {
+				t.Fatalf("message %s arrived after %s", msg.ID, last)
+			}
+			last = msg.ID
+		}
+		wg.Wait()
+	}
+}
+
+func TestWelcomeCapabilities(t *testing.T) {
+	GEWISSecret = "testsecret"
+	chat := New()
+	chat.ackMode = true
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user, _, err := dialSubprotocols(wsBase)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer user.Close()
+	if err := user.WriteJSON(IncomingMessage{Token: makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute)}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	welcome := expectWelcome(t, user)
+	if !slices.Equal(welcome.Capabilities, []string{CapabilityOrdered, CapabilityResume, CapabilityAck}) {
+		t.Fatalf("expected ordered, resume and ack, got: %v", welcome.Capabilities)
+	}
+
+	plain := New()
+	plain.resumeGrace = 0
+	if caps := plain.capabilities(); !slices.Equal(caps, []string{CapabilityOrdered}) {
+		t.Fatalf("expected only ordered, got: %v", caps)
+	}
+}
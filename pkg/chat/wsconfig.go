@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"compress/flate"
+	"errors"
+	"time"
+)
+
+// WSConfig holds the websocket timings, buffer sizes and compression.
+type WSConfig struct {
+	PingPeriod   time.Duration // how often clients are pinged, must be below PongWait
+	PongWait     time.Duration // how long a client may stay silent, pongs included
+	WriteWait    time.Duration // deadline for a single write
+	CloseTimeout time.Duration // how long closeWith waits for queued messages
+	ReadBuffer   int           // upgrader read buffer in bytes, 0 uses the 4KB default
+	WriteBuffer  int           // upgrader write buffer in bytes, 0 uses the 4KB default
+
+	EnableCompression bool // negotiate permessage-deflate with clients that offer it
+	CompressionLevel  int  // flate level for compressed writes, see compress/flate
+
+	// Per-role deadlines for a single write, 0 uses WriteWait
+	UserWriteWait  time.Duration
+	RadioWriteWait time.Duration
+}
+
+// wsConfig holds the websocket settings from the environment, see
+// DefaultWSConfig.
+var wsConfig = WSConfig{
+	PingPeriod:   Duration("WS_PING_PERIOD", 25*time.Second),
+	PongWait:     Duration("WS_PONG_WAIT", 60*time.Second),
+	WriteWait:    Duration("WS_WRITE_WAIT", 10*time.Second),
+	CloseTimeout: Duration("WS_CLOSE_TIMEOUT", time.Second),
+	ReadBuffer:   Int("WS_READ_BUFFER", 4096),
+	WriteBuffer:  Int("WS_WRITE_BUFFER", 4096),
+
+	EnableCompression: Bool("WS_ENABLE_COMPRESSION", false),
+	CompressionLevel:  Int("WS_COMPRESSION_LEVEL", flate.BestSpeed),
+
+	UserWriteWait:  Duration("RADIO_USER_WRITE_TIMEOUT", 0),
+	RadioWriteWait: Duration("RADIO_RADIO_WRITE_TIMEOUT", 0),
+}
+
+// Validate reports timings that would drop healthy clients.
+func (w WSConfig) Validate() error {
+	switch {
+	case w.PingPeriod <= 0 || w.PongWait <= 0 || w.WriteWait <= 0 || w.CloseTimeout <= 0:
+		return errors.New("websocket timings must be positive")
+	case w.PingPeriod >= w.PongWait:
+		return errors.New("WS_PING_PERIOD must be shorter than WS_PONG_WAIT")
+	case w.ReadBuffer < 0 || w.WriteBuffer < 0:
+		return errors.New("websocket buffer sizes must not be negative")
+	case w.CompressionLevel < flate.HuffmanOnly || w.CompressionLevel > flate.BestCompression:
+		return errors.New("WS_COMPRESSION_LEVEL must be between -2 and 9")
+	case w.UserWriteWait < 0 || w.RadioWriteWait < 0:
+		return errors.New("RADIO_USER_WRITE_TIMEOUT and RADIO_RADIO_WRITE_TIMEOUT must not be negative")
+	}
+	return nil
+}
+
+// DefaultWSConfig returns the websocket settings from the environment, the
+// ones a Chat uses unless configured with WithWSConfig.
+func DefaultWSConfig() WSConfig {
+	return wsConfig
+}
+
+// WithWSConfig replaces the websocket settings from the environment. The
+// config must be valid.
+func WithWSConfig(w WSConfig) Option {
+	return func(c *Chat) {
+		c.ws = w
+	}
+}
+
+// timings returns the websocket settings of the client's chat, or those from
+// the environment for clients created outside HandleWS.
+func (cl *Client) timings() *WSConfig {
+	if cl.ws != nil {
+		return cl.ws
+	}
+	return &wsConfig
+}
+
+// writeWait returns the deadline for a single write to a client with the
+// role.
+func (w *WSConfig) writeWait(role string) time.Duration {
+	switch {
+	case role == "user" && w.UserWriteWait > 0:
+		return w.UserWriteWait
+	case role == "radio" && w.RadioWriteWait > 0:
+		return w.RadioWriteWait
+	}
+	return w.WriteWait
+}
@@ -0,0 +1,191 @@
+package chat
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSConfigValidate(t *testing.T) {
+	valid := WSConfig{PingPeriod: 25 * time.Second, PongWait: time.Minute, WriteWait: 10 * time.Second, CloseTimeout: time.Second}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+	if err := wsConfig.Validate(); err != nil {
+		t.Fatalf("expected the defaults to be valid, got: %v", err)
+	}
+	tests := map[string]func(w *WSConfig){
+		"ping equal to pong wait": func(w *WSConfig) { w.PingPeriod = w.PongWait },
+		"ping after pong wait":    func(w *WSConfig) { w.PingPeriod = 2 * w.PongWait },
+		"zero write wait":         func(w *WSConfig) { w.WriteWait = 0 },
+		"negative buffer":         func(w *WSConfig) { w.ReadBuffer = -1 },
+		"compression level":       func(w *WSConfig) { w.CompressionLevel = 10 },
+		"negative user write":     func(w *WSConfig) { w.UserWriteWait = -time.Second },
+		"negative radio write":    func(w *WSConfig) { w.RadioWriteWait = -time.Second },
+	}
+	for name, change := range tests {
+		w := valid
+		change(&w)
+		if err := w.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWriteWaitPerRole(t *testing.T) {
+	ws := WSConfig{WriteWait: 10 * time.Second, UserWriteWait: 30 * time.Second, RadioWriteWait: 2 * time.Second}
+	tests := map[string]time.Duration{
+		"user":  30 * time.Second,
+		"radio": 2 * time.Second,
+		"guest": 10 * time.Second,
+	}
+	for role, want := range tests {
+		cl := &Client{role: role, ws: &ws}
+		if got := cl.timings().writeWait(cl.role); got != want {
+			t.Errorf("%s: expected %v, got %v", role, want, got)
+		}
+	}
+
+	// Without per-role values every role uses WriteWait
+	ws = WSConfig{WriteWait: 10 * time.Second}
+	for _, role := range []string{"user", "radio"} {
+		if got := ws.writeWait(role); got != ws.WriteWait {
+			t.Errorf("%s: expected %v, got %v", role, ws.WriteWait, got)
+		}
+	}
+}
+
+// readAll keeps reading from the connection, which is what answers pings,
+// and hands the messages to the returned channel.
+func readAll(conn *websocket.Conn) <-chan []byte {
+	messages := make(chan []byte, 16)
+	go func() {
+		defer close(messages)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			messages <- data
+		}
+	}()
+	return messages
+}
+
+func TestAggressiveTimings(t *testing.T) {
+	GEWISSecret = "testsecret"
+	RADIOChatKey = "ChangeMe"
+	listener := &reasonListener{reasons: make(chan string, 1)}
+	chat := New(WithEventListener(listener), WithWSConfig(WSConfig{
+		PingPeriod:   30 * time.Millisecond,
+		PongWait:     150 * time.Millisecond,
+		WriteWait:    time.Second,
+		CloseTimeout: 100 * time.Millisecond,
+		ReadBuffer:   512,
+		WriteBuffer:  512,
+	}))
+	chat.resumeGrace = 0
+	if chat.upgrader.ReadBufferSize != 512 || chat.upgrader.WriteBufferSize != 512 {
+		t.Fatalf("expected the buffer sizes on the upgrader, got %d/%d", chat.upgrader.ReadBufferSize, chat.upgrader.WriteBufferSize)
+	}
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	// The radio never reads, so it never answers a ping
+	radio := dialAndHandshake(t, wsBase, "radio", makeToken(t, GEWISSecret, 99999, "Bob", "Radio", time.Minute), RADIOChatKey)
+	defer radio.Close()
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	messages := readAll(user)
+	waitForUsers(t, chat, 1)
+
+	select {
+	case reason := <-listener.reasons:
+		if reason != DisconnectTimeout {
+			t.Fatalf("expected the silent radio to time out, got %q", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the radio to be dropped")
+	}
+
+	// Several pong waits later the user answering pings is still there, and
+	// messages larger than the buffers still arrive
+	time.Sleep(300 * time.Millisecond)
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected the user to stay connected, got %d users", n)
+	}
+	content := strings.Repeat("a", 2048)
+	if !chat.forwardToUser(t.Context(), "12345", OutgoingMessage{ID: chat.nextMessageID(), From: "99999", To: "12345", Content: content, Room: DefaultRoom}) {
+		t.Fatal("expected the message to be delivered")
+	}
+	select {
+	case data := <-messages:
+		if !strings.Contains(string(data), content) {
+			t.Fatalf("expected the large message, got %d bytes", len(data))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the large message")
+	}
+}
+
+// Read deadlines are enforced by the network poller on the wall clock, so
+// this runs on real time with short timings rather than a fake clock.
+func TestPongExtendsReadDeadline(t *testing.T) {
+	GEWISSecret = "testsecret"
+	ws := WSConfig{
+		PingPeriod:   100 * time.Millisecond,
+		PongWait:     300 * time.Millisecond,
+		WriteWait:    time.Second,
+		CloseTimeout: 100 * time.Millisecond,
+	}
+	chat := New(WithWSConfig(ws))
+	srv, wsBase := startTestServer(t, chat)
+	defer srv.Close()
+
+	user := dialAndHandshake(t, wsBase, "user", makeToken(t, GEWISSecret, 12345, "Alice", "User", time.Minute), "")
+	defer user.Close()
+	var pings atomic.Int32
+	var answer atomic.Bool
+	answer.Store(true)
+	user.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		if !answer.Load() {
+			return nil
+		}
+		return user.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	readAll(user)
+	waitForUsers(t, chat, 1)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pings.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for a ping")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Alive past the deadline set on connect, only the pongs extended it
+	time.Sleep(ws.PongWait + 200*time.Millisecond)
+	if n := chat.Stats().ConnectedUsers; n != 1 {
+		t.Fatalf("expected the user answering pings to stay connected, got %d users (%d pings)", n, pings.Load())
+	}
+	client, ok := chat.lookupUser(DefaultRoom, "12345")
+	if !ok || client.lastRTT.Load() <= 0 {
+		t.Fatal("expected the pongs to be handled")
+	}
+
+	// Without pongs the deadline is no longer extended. The session is kept
+	// for resuming, its disconnect event only comes after the grace window.
+	answer.Store(false)
+	waitForUsers(t, chat, 0)
+	chat.mutex.RLock()
+	parked, ok := chat.parked[sessionKey("12345", DefaultRoom)]
+	chat.mutex.RUnlock()
+	if !ok || parked.reason != DisconnectTimeout {
+		t.Fatalf("expected the user to time out, got: %+v", parked)
+	}
+}
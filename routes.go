@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// routes returns the handlers of the public and the admin listener. Without
+// a separate admin listener everything but pprof and the config dump is
+// served publicly, as before ADMIN_ADDR, and admin is nil. The radio info and
+// token are for the radio's own tooling, so they are only served on the admin
+// listener when there is one.
+func routes(c *chat.Chat, radioState *chat.RadioState, cfg config, separateAdmin bool) (public, admin http.Handler) {
+	tokenHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(token)
+	}
+
+	if !separateAdmin {
+		mux := http.NewServeMux()
+		mux.Handle("/", c.Handler())
+		mux.HandleFunc("/api/v1/radio", c.HandleRadio(radioState))
+		mux.HandleFunc("/api/v1/openapi.json", handleOpenAPI)
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.HandleFunc("/api/v1/token", tokenHandler)
+		return chat.TraceHandler(mux), nil
+	}
+
+	publicMux := http.NewServeMux()
+	publicMux.Handle("/", c.PublicHandler())
+
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/", c.Handler())
+	adminMux.HandleFunc("/api/v1/radio", c.HandleRadio(radioState))
+	adminMux.HandleFunc("/api/v1/token", tokenHandler)
+	adminMux.HandleFunc("/api/v1/openapi.json", handleOpenAPI)
+	adminMux.Handle("/api/v1/config", c.RequireAdminKey(handleConfig(cfg)))
+	adminMux.Handle("/metrics", promhttp.Handler())
+	adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+	adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return chat.TraceHandler(publicMux), chat.TraceHandler(adminMux)
+}
+
+// handleConfig dumps the configuration main runs with, without the
+// credentials in URLs. routes puts it behind the admin key.
+func handleConfig(cfg config) http.HandlerFunc {
+	dump := cfg.dump()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(dump)
+	}
+}
+
+// dump returns the settings by their environment variable.
+func (cfg config) dump() map[string]string {
+	out := map[string]string{
+		"PORT":                      cfg.Port,
+		"ADMIN_ADDR":                cfg.AdminAddr,
+		"LOG_FORMAT":                cfg.LogFormat,
+		"LOG_LEVEL":                 cfg.LogLevel,
+		"RADIO_START_TIME":          cfg.StartTime,
+		"RADIO_START_TIME_TIMEZONE": cfg.StartZone,
+		"RADIO_DURATION":            cfg.Duration,
+		"RADIO_VIDEO_URL":           redactURL(cfg.VideoURL),
+		"RADIO_AUDIO_URL":           redactURL(cfg.AudioURL),
+		"RADIO_AUDIO_MOUNT_POINT":   cfg.AudioMountPoint,
+		"RADIO_JSON_STYLE":          cfg.JSONStyle,
+		"RADIO_WORD_FILTER_ACTION":  cfg.FilterAction,
+		"RADIO_WORD_FILTER_PATH":    cfg.WordFilterPath,
+		"RADIO_REGEX_FILTER_PATH":   cfg.RegexFilterPath,
+		"CHAT_DB_DRIVER":            cfg.DBDriver,
+	}
+	for env, raw := range cfg.URLs {
+		// NATS takes a comma-separated list of servers
+		urls := strings.Split(raw, ",")
+		for i := range urls {
+			urls[i] = redactURL(strings.TrimSpace(urls[i]))
+		}
+		out[env] = strings.Join(urls, ",")
+	}
+	return out
+}
+
+// redactURL removes the user and password from a URL, which is how Redis
+// passwords and Sentry keys are passed. Values that do not parse are
+// replaced, as they could hold anything.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid>"
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	return u.String()
+}
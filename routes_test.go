@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GEWIS/radiogaga/pkg/chat"
+	"github.com/rs/zerolog"
+)
+
+// statusOf returns the status of a GET of the path.
+func statusOf(t *testing.T, h http.Handler, path string) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestRoutesSingleListener(t *testing.T) {
+	c := chat.New(chat.WithLogger(zerolog.Nop()))
+	public, admin := routes(c, chat.NewRadioState(chat.RadioInfo{}), validConfig(), false)
+	if admin != nil {
+		t.Fatal("expected no admin handler without ADMIN_ADDR")
+	}
+	for _, path := range []string{"/api/v1/health", "/api/v1/token", "/api/v1/radio", "/api/v1/openapi.json", "/metrics"} {
+		if code := statusOf(t, public, path); code != http.StatusOK {
+			t.Errorf("expected %s to be served, got %d", path, code)
+		}
+	}
+	// Admin endpoints are still reachable, with the admin key
+	if code := statusOf(t, public, "/api/v1/state"); code != http.StatusUnauthorized {
+		t.Errorf("expected /api/v1/state to ask for the admin key, got %d", code)
+	}
+	for _, path := range []string{"/debug/pprof/", "/api/v1/config"} {
+		if code := statusOf(t, public, path); code != http.StatusNotFound {
+			t.Errorf("expected %s not to be served, got %d", path, code)
+		}
+	}
+}
+
+func TestRoutesSeparateAdmin(t *testing.T) {
+	c := chat.New(chat.WithLogger(zerolog.Nop()), chat.WithAdminKey("admin"))
+	cfg := validConfig()
+	cfg.URLs["REDIS_URL"] = "redis://:hunter2@redis:6379/0"
+	public, admin := routes(c, chat.NewRadioState(chat.RadioInfo{}), cfg, true)
+
+	if code := statusOf(t, public, "/api/v1/health"); code != http.StatusOK {
+		t.Errorf("expected /api/v1/health to be served publicly, got %d", code)
+	}
+	// The fallbacks for members without websockets, which want a token
+	for _, path := range []string{"/api/v1/chat/stream", "/api/v1/chat/send", "/api/v1/poll"} {
+		if code := statusOf(t, public, path); code == http.StatusNotFound {
+			t.Errorf("expected %s to be served publicly, got %d", path, code)
+		}
+	}
+	// Not found rather than unauthorized, whatever the key
+	for _, path := range []string{"/api/v1/state", "/api/v1/history/export", "/api/v1/broadcast", "/api/v1/chat/audit", "/metrics", "/debug/pprof/", "/api/v1/config", "/api/v1/openapi.json", "/api/v1/radio", "/api/v1/token"} {
+		if code := statusOf(t, public, path); code != http.StatusNotFound {
+			t.Errorf("expected %s not to be served publicly, got %d", path, code)
+		}
+	}
+
+	for _, path := range []string{"/api/v1/health", "/metrics", "/debug/pprof/", "/api/v1/openapi.json", "/api/v1/radio", "/api/v1/token"} {
+		if code := statusOf(t, admin, path); code != http.StatusOK {
+			t.Errorf("expected %s on the admin listener, got %d", path, code)
+		}
+	}
+	for _, path := range []string{"/api/v1/state", "/api/v1/config"} {
+		if code := statusOf(t, admin, path); code != http.StatusUnauthorized {
+			t.Errorf("expected %s on the admin listener to ask for the admin key, got %d", path, code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	admin.ServeHTTP(rec, req)
+	var dump map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &dump); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	if got := dump["REDIS_URL"]; strings.Contains(got, "hunter2") || got != "redis://redacted@redis:6379/0" {
+		t.Errorf("expected the Redis password to be redacted, got %q", got)
+	}
+	if got := dump["RADIO_NATS_URL"]; got != "nats://nats-1:4222,nats://nats-2:4222" {
+		t.Errorf("expected the NATS servers, got %q", got)
+	}
+}
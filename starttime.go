@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// localTimeLayout is RFC 3339 without an offset, interpreted in
+// RADIO_START_TIME_TIMEZONE.
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// parseStartTime parses RADIO_START_TIME as RFC 3339, as a local time without
+// offset in loc, or as a duration like +2h relative to now.
+func parseStartTime(raw string, loc *time.Location, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	for _, layout := range []string{time.RFC3339, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation(localTimeLayout, raw, loc); err == nil {
+		return t, nil
+	}
+	if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+		if d, err := time.ParseDuration(raw); err == nil {
+			return now.Add(d).In(loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse start time %q, expected RFC 3339 like 2025-08-18T07:00:00Z or a duration like +2h", raw)
+}
+
+// normalizeStartTime validates RADIO_START_TIME and formats it as RFC 3339,
+// the format the frontend expects.
+func normalizeStartTime(raw, timezone string, now time.Time) (string, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return "", fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	t, err := parseStartTime(raw, loc, now)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
+}
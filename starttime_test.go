@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeStartTime(t *testing.T) {
+	now := time.Date(2025, 8, 18, 5, 0, 0, 0, time.UTC)
+	tests := []struct {
+		raw, timezone, want string
+	}{
+		{"2025-08-18T07:00:00Z", "UTC", "2025-08-18T07:00:00Z"},
+		{"2025-08-18T09:00:00+02:00", "UTC", "2025-08-18T09:00:00+02:00"},
+		{"2025-08-18T07:00:00.123456789Z", "UTC", "2025-08-18T07:00:00Z"},
+		{"2025-08-18T09:00:00", "Europe/Amsterdam", "2025-08-18T09:00:00+02:00"},
+		{"+2h", "UTC", "2025-08-18T07:00:00Z"},
+		{" -30m ", "UTC", "2025-08-18T04:30:00Z"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeStartTime(tt.raw, tt.timezone, now)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeStartTime(%q, %q) = %q, %v, want %q", tt.raw, tt.timezone, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeStartTimeInvalid(t *testing.T) {
+	for _, tt := range []struct{ raw, timezone string }{
+		{"18-08-2025 07:00", "UTC"},
+		{"2h", "UTC"},
+		{"", "UTC"},
+		{"2025-08-18T07:00:00Z", "Mars/Olympus_Mons"},
+	} {
+		if got, err := normalizeStartTime(tt.raw, tt.timezone, time.Now()); err == nil {
+			t.Errorf("normalizeStartTime(%q, %q) = %q, expected error", tt.raw, tt.timezone, got)
+		}
+	}
+}
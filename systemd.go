@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes sockets as.
+const sdListenFDsStart = 3
+
+// sdListenFDs returns the number of sockets systemd passed in LISTEN_FDS,
+// or 0 when the process is not socket-activated or they are meant for
+// another process, as LISTEN_PID tells.
+func sdListenFDs(listenPID, listenFDs string, pid int) (int, error) {
+	if listenFDs == "" {
+		return 0, nil
+	}
+	if p, err := strconv.Atoi(listenPID); err != nil || p != pid {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(listenFDs)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid LISTEN_FDS %q", listenFDs)
+	}
+	return n, nil
+}
+
+// sdNotifyMessage formats the states, such as READY=1, as a message to
+// systemd.
+func sdNotifyMessage(states ...string) (string, error) {
+	var b strings.Builder
+	for _, state := range states {
+		if !strings.Contains(state, "=") || strings.Contains(state, "\n") {
+			return "", fmt.Errorf("invalid state %q", state)
+		}
+		b.WriteString(state)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// sdNotify sends the states to systemd's notification socket, from
+// NOTIFY_SOCKET. It does nothing without one.
+func sdNotify(socket string, states ...string) error {
+	if socket == "" {
+		return nil
+	}
+	msg, err := sdNotifyMessage(states...)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(msg))
+	return err
+}
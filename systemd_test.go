@@ -0,0 +1,67 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSDListenFDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		listenPID string
+		listenFDs string
+		want      int
+		wantErr   bool
+	}{
+		{"not activated", "", "", 0, false},
+		{"two sockets", "1234", "2", 2, false},
+		{"other process", "4321", "2", 0, false},
+		{"no PID", "", "2", 0, false},
+		{"invalid count", "1234", "two", 0, true},
+		{"negative count", "1234", "-1", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := sdListenFDs(tt.listenPID, tt.listenFDs, 1234)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected %d (error %v), got %d (%v)", tt.name, tt.want, tt.wantErr, got, err)
+		}
+	}
+}
+
+func TestSDNotifyMessage(t *testing.T) {
+	msg, err := sdNotifyMessage("READY=1", "MAINPID=1234")
+	if err != nil || msg != "READY=1\nMAINPID=1234\n" {
+		t.Fatalf("expected two lines, got %q (%v)", msg, err)
+	}
+	for _, state := range []string{"READY", "STATUS=a\nREADY=1"} {
+		if _, err := sdNotifyMessage(state); err == nil {
+			t.Errorf("expected %q to be rejected", state)
+		}
+	}
+}
+
+func TestSDNotify(t *testing.T) {
+	if err := sdNotify("", "READY=1"); err != nil {
+		t.Fatalf("expected no notification without a socket, got: %v", err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := sdNotify(socket, "STOPPING=1"); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "STOPPING=1\n" {
+		t.Fatalf("expected STOPPING=1, got %q (%v)", buf[:n], err)
+	}
+}
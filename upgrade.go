@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables a process passes to the one replacing it, see
+// upgrader.upgrade.
+const (
+	listenersEnv = "RADIOGAGA_LISTENERS" // addresses of the inherited sockets, from fd 3 on
+	readyFDEnv   = "RADIOGAGA_READY_FD"  // pipe to write to once serving
+)
+
+// upgrader hands the listening sockets to a new process of the same binary,
+// so a deploy does not refuse connections while the old process drains. It
+// also takes the sockets of systemd socket activation, and starts normally
+// when there is no parent to inherit sockets from.
+type upgrader struct {
+	inherited    map[string]*os.File // address -> socket of the parent
+	activated    []*os.File          // sockets from systemd, in order
+	readyPipe    *os.File            // nil without a parent
+	notifySocket string              // systemd's NOTIFY_SOCKET
+	pidFile      string
+	listeners    []addrListener
+}
+
+// addrListener is a socket with the address it was configured with, which
+// may differ from its actual address, such as :8080 and [::]:8080.
+type addrListener struct {
+	addr string
+	net.Listener
+}
+
+// newUpgrader picks up the sockets passed by a parent process or systemd, if
+// any.
+func newUpgrader(pidFile string) (*upgrader, error) {
+	u := &upgrader{inherited: map[string]*os.File{}, pidFile: pidFile, notifySocket: os.Getenv("NOTIFY_SOCKET")}
+	addrs := os.Getenv(listenersEnv)
+	if addrs == "" {
+		n, err := sdListenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getpid())
+		if err != nil {
+			return nil, err
+		}
+		for i := range n {
+			u.activated = append(u.activated, os.NewFile(uintptr(sdListenFDsStart+i), "LISTEN_FD_"+strconv.Itoa(sdListenFDsStart+i)))
+		}
+		for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			_ = os.Unsetenv(env)
+		}
+		return u, nil
+	}
+	for i, addr := range strings.Split(addrs, ",") {
+		u.inherited[addr] = os.NewFile(uintptr(3+i), addr)
+	}
+	fd, err := strconv.Atoi(os.Getenv(readyFDEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", readyFDEnv, err)
+	}
+	u.readyPipe = os.NewFile(uintptr(fd), "ready")
+	// Not for the processes this one starts in turn
+	_ = os.Unsetenv(listenersEnv)
+	_ = os.Unsetenv(readyFDEnv)
+	return u, nil
+}
+
+// listen returns the socket inherited for the address, the next one from
+// systemd, or a new one.
+func (u *upgrader) listen(addr string) (net.Listener, error) {
+	var ln net.Listener
+	var err error
+	if f, ok := u.inherited[addr]; ok {
+		delete(u.inherited, addr)
+		ln, err = net.FileListener(f)
+		_ = f.Close()
+	} else if len(u.activated) > 0 {
+		f := u.activated[0]
+		u.activated = u.activated[1:]
+		ln, err = net.FileListener(f)
+		_ = f.Close()
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.listeners = append(u.listeners, addrListener{addr, ln})
+	return ln, nil
+}
+
+// ready writes the PID file and tells the parent, if any, that this process
+// serves on the sockets now, so it can drain.
+func (u *upgrader) ready() error {
+	// Sockets for addresses no longer configured
+	for _, f := range u.inherited {
+		_ = f.Close()
+	}
+	for _, f := range u.activated {
+		_ = f.Close()
+	}
+	u.inherited, u.activated = nil, nil
+	if u.pidFile != "" {
+		if err := os.WriteFile(u.pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+			return fmt.Errorf("write PID file: %w", err)
+		}
+	}
+	if u.readyPipe == nil {
+		return nil
+	}
+	defer u.readyPipe.Close()
+	_, err := u.readyPipe.Write([]byte{1})
+	return err
+}
+
+// notify sends the states to systemd, when started by it with Type=notify.
+func (u *upgrader) notify(states ...string) error {
+	return sdNotify(u.notifySocket, states...)
+}
+
+// upgrade starts the binary again with the same arguments, passing it the
+// listening sockets, and waits up to the timeout for it to be ready. It
+// returns the new process's PID; on errors this process keeps serving. As PID
+// 1, such as in a container, it refuses, since the new process would be
+// killed when this one exits.
+func (u *upgrader) upgrade(timeout time.Duration) (int, error) {
+	if os.Getpid() == 1 {
+		return 0, errors.New("cannot upgrade as PID 1, the new process would stop with this one")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	var addrs []string
+	for _, ln := range u.listeners {
+		tcp, ok := ln.Listener.(*net.TCPListener)
+		if !ok {
+			return 0, fmt.Errorf("cannot pass %T on", ln.Listener)
+		}
+		f, err := tcp.File()
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, f)
+		addrs = append(addrs, ln.addr)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer readyR.Close()
+
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, listenersEnv+"=") || strings.HasPrefix(kv, readyFDEnv+"=")
+	})
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(slices.Clip(files), readyW)
+	cmd.Env = append(env,
+		listenersEnv+"="+strings.Join(addrs, ","),
+		readyFDEnv+"="+strconv.Itoa(3+len(files)),
+	)
+	err = cmd.Start()
+	_ = readyW.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		if err != nil {
+			// The pipe closes when the process exits before it is ready
+			_ = cmd.Process.Kill()
+			return 0, fmt.Errorf("new process failed to start: %w", err)
+		}
+		return cmd.Process.Pid, nil
+	case err := <-exited:
+		return 0, fmt.Errorf("new process exited: %w", err)
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		return 0, errors.New("timeout waiting for the new process")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// upgradeSignal is nil where processes cannot inherit sockets.
+var upgradeSignal os.Signal
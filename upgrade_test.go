@@ -0,0 +1,151 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readPID returns the PID in the file, or 0 while it is missing.
+func readPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+func TestUpgradeHandsOverSockets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs the server")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command to build the server with")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "radiogaga")
+	if out, err := exec.Command(goBin, "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("build: %v\n%s", err, out)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	_, port, _ := net.SplitHostPort(addr)
+
+	logPath := filepath.Join(dir, "radiogaga.log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	pidPath := filepath.Join(dir, "radiogaga.pid")
+	cmd := exec.Command(bin)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.Env = []string{
+		// Without a host, as by default, so the socket's address differs
+		"PORT=:" + port,
+		"LOG_LEVEL=info",
+		"RADIO_SHUTDOWN_DRAIN=500ms",
+		"RADIO_PID_FILE=" + pidPath,
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		if pid := readPID(pidPath); pid != 0 && pid != cmd.Process.Pid {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+		if t.Failed() {
+			out, _ := os.ReadFile(logPath)
+			t.Logf("server output:\n%s", out)
+		}
+	})
+
+	// A new connection for every request, as clients connecting during the
+	// handover would
+	client := &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func() error {
+		resp, err := client.Get("http://" + addr + "/api/v1/token")
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for readPID(pidPath) != cmd.Process.Pid || get() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the server to start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var requests atomic.Int64
+	failures := make(chan error, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := get(); err != nil {
+				select {
+				case failures <- err:
+				default:
+				}
+			}
+			requests.Add(1)
+		}
+	}()
+
+	if err := cmd.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("expected the old process to exit cleanly, got: %v", err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("timeout waiting for the old process to hand over and exit")
+	}
+	if pid := readPID(pidPath); pid == 0 || pid == cmd.Process.Pid {
+		t.Fatalf("expected the PID file to name the new process, got %d", pid)
+	}
+
+	// The new process serves on its own
+	time.Sleep(200 * time.Millisecond)
+	close(done)
+	<-stopped
+	select {
+	case err := <-failures:
+		t.Fatalf("request failed during the handover: %v", err)
+	default:
+	}
+	if requests.Load() == 0 {
+		t.Fatal("expected requests during the handover")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignal makes the server hand its sockets to a new process.
+var upgradeSignal os.Signal = syscall.SIGUSR2